@@ -0,0 +1,8 @@
+terraform {
+  required_version = ">= 0.13"
+}
+
+# init succeeds but validate fails as the variable is never declared
+output "env_name" {
+  value = var.undeclared
+}
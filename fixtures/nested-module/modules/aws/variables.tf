@@ -0,0 +1,21 @@
+variable "access_key" {}
+variable "secret_key" {}
+variable "region" {
+    default = "us-east-1"
+}
+variable "env_name" {}
+variable "build_id" {}
+variable "build_name" {}
+variable "build_job_name" {}
+variable "build_pipeline_name" {}
+variable "build_team_name" {}
+variable "atc_external_url" {}
+
+variable "bucket" {}
+variable "object_key" {}
+variable "object_content" {}
+
+# used to verify error handling
+variable "invalid_object_count" {
+    default = 0
+}
@@ -0,0 +1,163 @@
+package cacert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// systemBundlePaths are checked in order for the system roots, the same
+// locations Go uses on Linux
+var systemBundlePaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+const unknownAuthorityHint = "The server's certificate is signed by an unknown certificate authority. " +
+	"If it sits behind a TLS-intercepting proxy, set `source.ca_cert` to the PEM encoded certificate of the proxy's CA."
+
+// Bundle holds the certificates from `source.ca_cert` together with the
+// system roots, as a file for terraform and as a pool for in-process clients.
+// A nil Bundle leaves the default trust store untouched.
+type Bundle struct {
+	Path string
+	Pool *x509.CertPool
+}
+
+// Parse returns the certificates in pemCerts, which may hold several
+// concatenated PEM blocks
+func Parse(pemCerts string) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	rest := []byte(pemCerts)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse certificate %d in `ca_cert`: %s", len(certs)+1, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("`ca_cert` does not contain any PEM encoded certificates")
+	}
+	return certs, nil
+}
+
+// Write creates a bundle file in dir containing the system roots followed by
+// pemCerts. It returns nil if pemCerts is empty.
+func Write(pemCerts string, dir string) (*Bundle, error) {
+	if pemCerts == "" {
+		return nil, nil
+	}
+	certs, err := Parse(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSL_CERT_FILE replaces the system roots, so the file must include them
+	contents := append(systemRoots(), '\n')
+	contents = append(contents, []byte(strings.TrimSpace(pemCerts)+"\n")...)
+
+	bundleFile, err := ioutil.TempFile(dir, "ca-bundle-*.pem")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create CA bundle: %s", err)
+	}
+	defer bundleFile.Close()
+	if _, err := bundleFile.Write(contents); err != nil {
+		os.Remove(bundleFile.Name())
+		return nil, fmt.Errorf("Failed to write CA bundle: %s", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	return &Bundle{
+		Path: bundleFile.Name(),
+		Pool: pool,
+	}, nil
+}
+
+func systemRoots() []byte {
+	paths := systemBundlePaths
+	if envPath := os.Getenv("SSL_CERT_FILE"); envPath != "" {
+		paths = append([]string{envPath}, paths...)
+	}
+	for _, p := range paths {
+		if contents, err := ioutil.ReadFile(p); err == nil {
+			return contents
+		}
+	}
+	return []byte{}
+}
+
+// Remove deletes the bundle file
+func (b *Bundle) Remove() {
+	if b != nil {
+		_ = os.Remove(b.Path)
+	}
+}
+
+// WithEnv adds the vars which point terraform, its providers, and go-getter
+// at the bundle to env, which may be nil
+func (b *Bundle) WithEnv(env map[string]string) map[string]string {
+	if b == nil {
+		return env
+	}
+	if env == nil {
+		env = map[string]string{}
+	}
+	env["SSL_CERT_FILE"] = b.Path
+	env["CURL_CA_BUNDLE"] = b.Path
+	env["AWS_CA_BUNDLE"] = b.Path
+	return env
+}
+
+// HTTPClient returns a client which trusts the bundle, or nil to use the
+// default client
+func (b *Bundle) HTTPClient() *http.Client {
+	if b == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs: b.Pool,
+	}
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// Hint adds a pointer to `source.ca_cert` to errors caused by an untrusted
+// certificate authority, including those reported in terraform's output
+func Hint(err error) error {
+	if err == nil {
+		return nil
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) || strings.Contains(err.Error(), "certificate signed by unknown authority") {
+		return fmt.Errorf("%s\n\n%s", err, unknownAuthorityHint)
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package cacert_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/ljfranklin/terraform-resource/cacert"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CACert", func() {
+
+	var (
+		server  *httptest.Server
+		caPEM   string
+		tmpDir  string
+		otherCA string
+	)
+
+	BeforeEach(func() {
+		// httptest signs the server's certificate with its own private CA
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		caPEM = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: server.Certificate().Raw,
+		}))
+
+		otherServer := httptest.NewTLSServer(http.NotFoundHandler())
+		otherCA = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: otherServer.Certificate().Raw,
+		}))
+		otherServer.Close()
+
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-cacert-test")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Parse", func() {
+		It("returns each certificate in the bundle", func() {
+			certs, err := cacert.Parse(otherCA + caPEM)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+		})
+
+		It("returns an error if there are no certificates", func() {
+			_, err := cacert.Parse("not-a-cert")
+			Expect(err).To(MatchError("`ca_cert` does not contain any PEM encoded certificates"))
+		})
+
+		It("returns an error if a certificate is malformed", func() {
+			malformed := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+
+			_, err := cacert.Parse(caPEM + malformed)
+			Expect(err).To(MatchError(ContainSubstring("Failed to parse certificate 2 in `ca_cert`")))
+		})
+	})
+
+	Describe("#Write", func() {
+		It("returns a nil bundle which changes nothing if no CA is given", func() {
+			bundle, err := cacert.Write("", tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bundle).To(BeNil())
+
+			Expect(bundle.WithEnv(map[string]string{"KEY": "value"})).To(Equal(map[string]string{"KEY": "value"}))
+			Expect(bundle.HTTPClient()).To(BeNil())
+			bundle.Remove()
+		})
+
+		It("writes a bundle file which trusts the private CA", func() {
+			bundle, err := cacert.Write(otherCA+caPEM, tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(bundle.Path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(caPEM))
+			Expect(string(contents)).To(ContainSubstring(otherCA))
+
+			// terraform loads SSL_CERT_FILE into a pool the same way
+			pool := x509.NewCertPool()
+			Expect(pool.AppendCertsFromPEM(contents)).To(BeTrue())
+			client := server.Client()
+			client.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+			resp, err := client.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+
+			bundle.Remove()
+			Expect(bundle.Path).ToNot(BeAnExistingFile())
+		})
+
+		It("exports the bundle path for terraform and go-getter", func() {
+			bundle, err := cacert.Write(caPEM, tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			env := bundle.WithEnv(nil)
+			Expect(env).To(Equal(map[string]string{
+				"SSL_CERT_FILE":  bundle.Path,
+				"CURL_CA_BUNDLE": bundle.Path,
+				"AWS_CA_BUNDLE":  bundle.Path,
+			}))
+		})
+
+		It("returns an HTTP client which trusts the private CA", func() {
+			bundle, err := cacert.Write(caPEM, tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			resp, err := bundle.HTTPClient().Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	Describe("#Hint", func() {
+		It("points at `ca_cert` when the certificate authority is unknown", func() {
+			_, err := http.Get(server.URL)
+			Expect(err).To(HaveOccurred())
+
+			Expect(cacert.Hint(err)).To(MatchError(ContainSubstring("set `source.ca_cert`")))
+		})
+
+		It("leaves other errors unchanged", func() {
+			err := os.ErrNotExist
+			Expect(cacert.Hint(err)).To(Equal(err))
+			Expect(cacert.Hint(nil)).To(BeNil())
+		})
+	})
+})
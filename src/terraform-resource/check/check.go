@@ -1,26 +1,87 @@
 package check
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ljfranklin/terraform-resource/workspaces"
 
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/proxy"
 	"github.com/ljfranklin/terraform-resource/storage"
 	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type Runner struct {
 	LogWriter io.Writer
+
+	span              *tracing.Span
+	caBundle          *cacert.Bundle
+	structuredLogging bool
+	deadline          time.Time
+	proxy             proxy.Config
+	tmpDir            string
 }
 
 func (r Runner) Run(req models.InRequest) ([]models.Version, error) {
+	r.structuredLogging = req.Source.StructuredLogging
+	r.proxy = req.Source.Proxy
+	r.LogWriter = r.proxy.Writer(r.LogWriter)
+	tracer := tracing.New(req.Source.OTel)
+	r.span = tracer.Start("check", nil)
+
+	versions, err := r.run(req)
+	err = r.proxy.RedactError(cacert.Hint(err))
+	if len(versions) > 0 {
+		r.span.SetAttribute("env_name", versions[len(versions)-1].EnvName)
+		r.span.SetAttribute("serial", versions[len(versions)-1].Serial)
+	}
+	r.span.End(err)
+
+	if flushErr := tracer.Flush(); flushErr != nil {
+		r.newLogger().Warn(fmt.Sprintf("Failed to export OpenTelemetry traces: %s", flushErr))
+	}
+
+	return versions, err
+}
+
+func (r Runner) newLogger() logger.Logger {
+	return logger.New(r.LogWriter, r.structuredLogging)
+}
+
+// httpClient trusts `ca_cert` and uses `proxy`, nil means the default client
+func (r Runner) httpClient() *http.Client {
+	return r.proxy.HTTPClient(r.caBundle.HTTPClient())
+}
+
+func (r Runner) run(req models.InRequest) ([]models.Version, error) {
 	if err := req.Source.Validate(); err != nil {
 		return []models.Version{}, err
 	}
+	r.deadline = req.Source.CheckDeadline(time.Now())
+
+	caBundle, err := cacert.Write(req.Source.CACert, "")
+	if err != nil {
+		return []models.Version{}, err
+	}
+	defer caBundle.Remove()
+	r.caBundle = caBundle
+
+	r.tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-check")
+	if err != nil {
+		return []models.Version{}, fmt.Errorf("Failed to create tmp dir at '%s'", os.TempDir())
+	}
+	defer os.RemoveAll(r.tmpDir)
 
 	if req.Source.BackendType != "" && req.Source.MigratedFromStorage != (storage.Model{}) {
 		if req.Version.IsZero() && req.Source.EnvName == "" {
@@ -48,6 +109,10 @@ func (r Runner) Run(req models.InRequest) ([]models.Version, error) {
 }
 
 func (r Runner) runWithBackend(req models.InRequest) ([]models.Version, error) {
+	if req.Source.StaleWorkspaceDays > 0 {
+		r.warnStaleWorkspaces(req)
+	}
+
 	if req.Version.IsZero() && req.Source.EnvName == "" {
 		// Triggering on new versions is only supported in single-env mode:
 		// - expensive to check for changes across all statefiles
@@ -61,22 +126,18 @@ func (r Runner) runWithBackend(req models.InRequest) ([]models.Version, error) {
 		}
 	}
 
-	terraformModel := req.Source.Terraform
-	terraformModel.Source = "" // ensures that files are created in current dir
-	if err := terraformModel.Validate(); err != nil {
-		return nil, fmt.Errorf("Failed to validate terraform Model: %s", err)
+	client, err := r.backendClient(req)
+	if err != nil {
+		return nil, err
 	}
 
-	client := terraform.NewClient(
-		terraformModel,
-		r.LogWriter,
-	)
-
 	workspaces := workspaces.New(client)
+	workspaces.Prefix = req.Source.WorkspacePrefix
+	workspaces.Filter = req.Source.WorkspaceFilter()
 
 	var targetEnvName string
 	if req.Source.EnvName != "" {
-		targetEnvName = req.Source.EnvName
+		targetEnvName = req.Source.DecorateEnvName(req.Source.EnvName)
 	} else {
 		targetEnvName = req.Version.EnvName
 	}
@@ -85,6 +146,17 @@ func (r Runner) runWithBackend(req models.InRequest) ([]models.Version, error) {
 		return nil, fmt.Errorf("Failed to check backend for latest version of '%s': %s", targetEnvName, err)
 	}
 
+	if req.Source.RequireConverged && (latestVersion != terraform.StateVersion{}) {
+		marker := terraform.ConvergenceMarker{Client: client, EnvName: targetEnvName}
+		converged, unconverged, err := marker.Read()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to check whether '%s' has converged: %s", targetEnvName, err)
+		}
+		if unconverged {
+			latestVersion = converged
+		}
+	}
+
 	resp := []models.Version{}
 	stateExists := (latestVersion != terraform.StateVersion{})
 	if stateExists {
@@ -96,18 +168,107 @@ func (r Runner) runWithBackend(req models.InRequest) ([]models.Version, error) {
 			}
 		}
 
-		if latestVersion.Serial >= serialFromVersion || latestVersion.Lineage != req.Version.Lineage {
-			resp = append(resp, models.Version{
-				EnvName: targetEnvName,
-				Serial:  strconv.Itoa(latestVersion.Serial),
-				Lineage: latestVersion.Lineage,
-			})
+		version := models.Version{
+			EnvName: targetEnvName,
+			Serial:  strconv.Itoa(latestVersion.Serial),
+			Lineage: latestVersion.Lineage,
+		}
+		// check has no access to the source so can't compute a config hash,
+		// instead keep the hash emitted by put to avoid a duplicate version.
+		// For the same reason an upgraded binary mustn't change the version.
+		if latestVersion.Serial == serialFromVersion && latestVersion.Lineage == req.Version.Lineage {
+			version.ConfigHash = req.Version.ConfigHash
+			version.TerraformVersion = req.Version.TerraformVersion
+		} else {
+			version.TerraformVersion = terraformVersion(client)
+		}
+
+		// a version from before the env was migrated out of `storage` can't be
+		// compared to a serial, translate it into exactly one backend version
+		if req.Version.IsLegacy() {
+			return []models.Version{version}, nil
+		}
+
+		if version.Compare(req.Version) >= 0 || latestVersion.Lineage != req.Version.Lineage {
+			resp = append(resp, version)
 		}
 	}
 
 	return resp, nil
 }
 
+func (r Runner) backendClient(req models.InRequest) (terraform.Client, error) {
+	terraformModel, err := r.backendModel(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return terraform.NewClient(
+		terraformModel,
+		r.LogWriter,
+	), nil
+}
+
+func (r Runner) backendModel(req models.InRequest) (models.Terraform, error) {
+	terraformModel := req.Source.Terraform
+	terraformModel.Source = "" // ensures that files are created in current dir
+	terraformModel.WorkspacePrefix = req.Source.BackendPrefix
+	terraformModel.LogJSON = req.Source.StructuredLogging
+	if err := terraformModel.Validate(); err != nil {
+		return models.Terraform{}, fmt.Errorf("Failed to validate terraform Model: %s", err)
+	}
+	if err := terraformModel.ParsePassEnv(); err != nil {
+		return models.Terraform{}, err
+	}
+	if err := terraformModel.ParseBackendConfigFromEnv(req.Source.BackendConfigEnvPrefix); err != nil {
+		return models.Terraform{}, err
+	}
+	terraformModel.Env = r.caBundle.WithEnv(terraformModel.Env)
+	terraformModel.Env = r.proxy.WithEnv(terraformModel.Env)
+	terraformModel, err := terraformModel.WithGCSCredentials(r.tmpDir)
+	if err != nil {
+		return models.Terraform{}, err
+	}
+	return terraform.UseTerraformVersion(terraformModel, r.httpClient(), r.LogWriter)
+}
+
+// terraformVersion is best-effort, e.g. `Terraform v1.5.7`, and empty if
+// `terraform -v` fails rather than failing the check
+func terraformVersion(client terraform.Client) string {
+	output, err := client.Version()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(output, "\n", 2)[0])
+}
+
+// warnStaleWorkspaces is best-effort, failing to read an env's age
+// shouldn't stop the check from emitting versions
+func (r Runner) warnStaleWorkspaces(req models.InRequest) {
+	logger := r.newLogger()
+
+	terraformModel, err := r.backendModel(req)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to check for stale workspaces: %s", err))
+		return
+	}
+	spaces := workspaces.New(terraform.NewClient(terraformModel, r.LogWriter))
+	spaces.StateModified = terraform.NewStateModifiedTime(terraformModel, r.httpClient())
+	spaces.Prefix = req.Source.WorkspacePrefix
+	spaces.Filter = req.Source.WorkspaceFilter()
+	spaces.Concurrency = req.Source.CheckConcurrency
+	spaces.Deadline = r.deadline
+
+	// envs which couldn't be read are reported after those which could
+	staleEnvs, err := spaces.StaleEnvs(req.Source.StaleWorkspaceDays, time.Now())
+	for _, env := range staleEnvs {
+		logger.Warn(fmt.Sprintf("Workspace %s state is %d days old", env.Name, env.AgeDays))
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to check for stale workspaces: %s", err))
+	}
+}
+
 func (r Runner) runWithLegacyStorage(req models.InRequest) ([]models.Version, error) {
 	currentVersionTime := time.Time{}
 	if req.Version.IsZero() == false {
@@ -121,7 +282,12 @@ func (r Runner) runWithLegacyStorage(req models.InRequest) ([]models.Version, er
 	if err := storageModel.Validate(); err != nil {
 		return nil, fmt.Errorf("Failed to validate storage Model: %s", err)
 	}
-	storageDriver := storage.BuildDriver(storageModel)
+	storageModel.HTTPClient = r.httpClient()
+	if warning := storageModel.InsecureWarning(); warning != "" {
+		r.newLogger().Warn(warning)
+	}
+	storageDriver := storage.WithRetries(storage.BuildDriver(storageModel), storageModel.Retryer(r.newLogger()))
+	storageDriver = storage.WithTracing(storageDriver, r.span)
 
 	stateFile := storage.StateFile{
 		StorageDriver: storageDriver,
@@ -133,8 +299,34 @@ func (r Runner) runWithLegacyStorage(req models.InRequest) ([]models.Version, er
 	}
 
 	resp := []models.Version{}
-	if storageVersion.IsZero() == false && !storageVersion.LastModified.Before(currentVersionTime) {
-		version := models.NewVersionFromLegacyStorage(storageVersion)
+	if storageVersion.IsZero() {
+		return resp, nil
+	}
+
+	rawState := &bytes.Buffer{}
+	if _, err := storageDriver.Download(storageVersion.StateFile, rawState); err != nil {
+		return nil, fmt.Errorf("Failed to download state file from storage backend: %s", err)
+	}
+	version := models.NewVersionFromLegacyStorage(storageVersion).WithStateSerial(rawState.Bytes())
+
+	// the same object, even if its LastModified appears to have changed
+	if version.VersionID != "" && version.VersionID == req.Version.VersionID {
+		return append(resp, req.Version), nil
+	}
+
+	// two applies may finish within the same second, so an env's versions
+	// are ordered by serial. Without one, or for a lower serial after the
+	// env was recreated, LastModified decides.
+	if version.Serial != "" && req.Version.Serial != "" && version.EnvName == req.Version.EnvName {
+		switch version.Compare(models.Version{Serial: req.Version.Serial}) {
+		case 0:
+			return append(resp, req.Version), nil // only the timestamp changed
+		case 1:
+			return append(resp, version), nil
+		}
+	}
+
+	if !storageVersion.LastModified.Before(currentVersionTime) {
 		resp = append(resp, version)
 	}
 
@@ -27,6 +27,8 @@ var _ = Describe("Check with Terraform Backend", func() {
 		workingDir          string
 		workspacePath       string
 		expectedLineage     = "f62eee11-6a4e-4d39-b5c7-15d3dad8e5f7"
+
+		expectedTerraformVersion string
 	)
 
 	BeforeEach(func() {
@@ -54,6 +56,8 @@ var _ = Describe("Check with Terraform Backend", func() {
 			"",
 		)
 
+		expectedTerraformVersion = currentTerraformVersion()
+
 		var err error
 		workingDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-check-backend-test")
 		Expect(err).ToNot(HaveOccurred())
@@ -133,9 +137,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: currEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          currEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -175,9 +180,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: currEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          currEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -226,9 +232,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: currEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          currEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -247,9 +254,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: currEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          currEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -260,9 +268,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: currEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          currEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 
@@ -345,9 +354,10 @@ var _ = Describe("Check with Terraform Backend", func() {
 
 			expectOutput := []models.Version{
 				models.Version{
-					Serial:  "1",
-					EnvName: currEnvName,
-					Lineage: expectedLineage,
+					Serial:           "1",
+					EnvName:          currEnvName,
+					Lineage:          expectedLineage,
+					TerraformVersion: expectedTerraformVersion,
 				},
 			}
 			Expect(resp).To(Equal(expectOutput))
@@ -113,11 +113,41 @@ var _ = Describe("Check with Legacy `storage`", func() {
 				models.Version{
 					LastModified: lastModified,
 					EnvName:      currEnvName,
+					Serial:       "1",
 				},
 			}
 			Expect(resp).To(Equal(expectOutput))
 		})
 
+		It("returns the requested version when only the timestamp of the same serial changed", func() {
+			checkInput.Version = models.Version{
+				LastModified: "2006-01-02T15:04:05Z",
+				EnvName:      currEnvName,
+				Serial:       "1",
+			}
+
+			runner := check.Runner{}
+			resp, err := runner.Run(checkInput)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resp).To(Equal([]models.Version{checkInput.Version}))
+		})
+
+		It("orders versions of the same env by serial rather than timestamp", func() {
+			checkInput.Version = models.Version{
+				LastModified: time.Now().Add(time.Hour).UTC().Format(models.TimeFormat),
+				EnvName:      currEnvName,
+				Serial:       "0",
+			}
+
+			runner := check.Runner{}
+			resp, err := runner.Run(checkInput)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resp).To(HaveLen(1))
+			Expect(resp[0].Serial).To(Equal("1"))
+		})
+
 		It("returns the requested version when current version matches storage version", func() {
 			currentLastModified := awsVerifier.GetLastModifiedFromS3(bucket, pathToCurrS3Fixture)
 			checkInput.Version = models.Version{
@@ -133,6 +163,7 @@ var _ = Describe("Check with Legacy `storage`", func() {
 				models.Version{
 					LastModified: currentLastModified,
 					EnvName:      currEnvName,
+					Serial:       "1",
 				},
 			}
 			Expect(resp).To(Equal(expectOutput))
@@ -29,6 +29,8 @@ var _ = Describe("Check with Migrated From Storage", func() {
 		awsVerifier            *helpers.AWSVerifier
 		workingDir             string
 		expectedLineage        = "f62eee11-6a4e-4d39-b5c7-15d3dad8e5f7"
+
+		expectedTerraformVersion string
 	)
 
 	BeforeEach(func() {
@@ -57,6 +59,8 @@ var _ = Describe("Check with Migrated From Storage", func() {
 			"",
 		)
 
+		expectedTerraformVersion = currentTerraformVersion()
+
 		var err error
 		workingDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-check-backend-test")
 		Expect(err).ToNot(HaveOccurred())
@@ -143,9 +147,10 @@ var _ = Describe("Check with Migrated From Storage", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: backendEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          backendEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -250,9 +255,10 @@ var _ = Describe("Check with Migrated From Storage", func() {
 
 				expectOutput := []models.Version{
 					models.Version{
-						Serial:  "1",
-						EnvName: backendEnvName,
-						Lineage: expectedLineage,
+						Serial:           "1",
+						EnvName:          backendEnvName,
+						Lineage:          expectedLineage,
+						TerraformVersion: expectedTerraformVersion,
 					},
 				}
 				Expect(resp).To(Equal(expectOutput))
@@ -277,6 +283,31 @@ var _ = Describe("Check with Migrated From Storage", func() {
 				}
 				Expect(resp).To(Equal(expectOutput))
 			})
+
+			It("translates a legacy version of a migrated env into a single backend version", func() {
+				checkInput.Version = models.Version{
+					LastModified: time.Now().Add(-time.Hour).UTC().Format(models.TimeFormat),
+					EnvName:      backendEnvName,
+				}
+
+				runner := check.Runner{}
+				resp, err := runner.Run(checkInput)
+				Expect(err).ToNot(HaveOccurred())
+
+				translatedVersion := models.Version{
+					Serial:           "1",
+					EnvName:          backendEnvName,
+					Lineage:          expectedLineage,
+					TerraformVersion: expectedTerraformVersion,
+				}
+				Expect(resp).To(Equal([]models.Version{translatedVersion}))
+
+				// the next check must not emit anything Concourse sees as new
+				checkInput.Version = translatedVersion
+				resp, err = runner.Run(checkInput)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp).To(Equal([]models.Version{translatedVersion}))
+			})
 		})
 
 		Context("when watching a multiple envs with `source.env_name` unset", func() {
@@ -1,6 +1,9 @@
 package check_test
 
 import (
+	"os/exec"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +14,11 @@ func TestCheck(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Check Suite")
 }
+
+// currentTerraformVersion is the first line of `terraform -v`, which check
+// adds to each new version
+func currentTerraformVersion() string {
+	output, err := exec.Command("terraform", "-v").Output()
+	Expect(err).ToNot(HaveOccurred())
+	return strings.SplitN(string(output), "\n", 2)[0]
+}
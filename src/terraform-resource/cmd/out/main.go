@@ -27,6 +27,7 @@ func main() {
 
 	runner := out.Runner{
 		SourceDir: sourceDir,
+		OutputDir: sourceDir,
 		LogWriter: os.Stderr,
 		Namer:     namer.New(),
 	}
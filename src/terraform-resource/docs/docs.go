@@ -0,0 +1,105 @@
+package docs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/models"
+)
+
+// e.g. `provider["registry.terraform.io/hashicorp/aws"]` or
+// `module.network.provider["registry.terraform.io/hashicorp/aws"].west`
+var providerAddress = regexp.MustCompile(`provider\["([^"]+)"\]`)
+
+type state struct {
+	TerraformVersion string          `json:"terraform_version"`
+	Serial           int             `json:"serial"`
+	Resources        []stateResource `json:"resources"`
+}
+
+type stateResource struct {
+	Mode      string            `json:"mode"`
+	Type      string            `json:"type"`
+	Provider  string            `json:"provider"`
+	Instances []json.RawMessage `json:"instances"`
+}
+
+// Render summarizes an environment as Markdown: its outputs, the number of
+// managed resources of each type, and the providers in use. Outputs should
+// already be sanitized so sensitive values are masked. Declared variables
+// are not included as the config is not available to a `get`.
+func Render(envName string, outputs []models.MetadataField, rawState []byte) ([]byte, error) {
+	var tfState state
+	if err := json.Unmarshal(rawState, &tfState); err != nil {
+		return nil, fmt.Errorf("Failed to parse statefile: %s", err)
+	}
+
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, "# %s\n\n", envName)
+	fmt.Fprintf(&doc, "Terraform version `%s`, state serial `%d`.\n", tfState.TerraformVersion, tfState.Serial)
+
+	doc.WriteString("\n## Outputs\n\n")
+	if len(outputs) == 0 {
+		doc.WriteString("None.\n")
+	} else {
+		doc.WriteString("| Name | Type | Value |\n|------|------|-------|\n")
+		for _, output := range outputs {
+			fmt.Fprintf(&doc, "| `%s` | %s | %s |\n", output.Name, output.Type, tableCell(output.Value))
+		}
+	}
+
+	resourceCounts := map[string]int{}
+	providers := map[string]bool{}
+	for _, resource := range tfState.Resources {
+		if match := providerAddress.FindStringSubmatch(resource.Provider); match != nil {
+			providers[match[1]] = true
+		}
+		if resource.Mode == "managed" {
+			resourceCounts[resource.Type] += len(resource.Instances)
+		}
+	}
+
+	doc.WriteString("\n## Resources\n\n")
+	if len(resourceCounts) == 0 {
+		doc.WriteString("None.\n")
+	} else {
+		doc.WriteString("| Type | Count |\n|------|-------|\n")
+		for _, resourceType := range sortedKeys(resourceCounts) {
+			fmt.Fprintf(&doc, "| `%s` | %d |\n", resourceType, resourceCounts[resourceType])
+		}
+	}
+
+	doc.WriteString("\n## Providers\n\n")
+	if len(providers) == 0 {
+		doc.WriteString("None.\n")
+	} else {
+		providerNames := []string{}
+		for name := range providers {
+			providerNames = append(providerNames, name)
+		}
+		sort.Strings(providerNames)
+		for _, name := range providerNames {
+			fmt.Fprintf(&doc, "* `%s`\n", name)
+		}
+	}
+
+	return doc.Bytes(), nil
+}
+
+func tableCell(value string) string {
+	value = strings.Replace(value, "|", `\|`, -1)
+	return strings.Replace(value, "\n", "<br>", -1)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package docs_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/docs"
+	"github.com/ljfranklin/terraform-resource/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Docs", func() {
+
+	Describe("#Render", func() {
+		It("summarizes outputs, resources, and providers", func() {
+			rawState := []byte(`{
+  "version": 4,
+  "terraform_version": "1.5.7",
+  "serial": 12,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_subnet",
+      "name": "private",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [{}, {}]
+    },
+    {
+      "module": "module.dns",
+      "mode": "managed",
+      "type": "aws_route53_record",
+      "name": "www",
+      "provider": "module.dns.provider[\"registry.terraform.io/hashicorp/aws\"].west",
+      "instances": [{}]
+    },
+    {
+      "mode": "data",
+      "type": "http",
+      "name": "ip",
+      "provider": "provider[\"registry.terraform.io/hashicorp/http\"]",
+      "instances": [{}]
+    }
+  ]
+}`)
+			outputs := []models.MetadataField{
+				{Name: "db_password", Value: "<sensitive>", Type: models.MetadataTypeString},
+				{Name: "motd", Value: "a|b\nc", Type: models.MetadataTypeString},
+				{Name: "port", Value: "8080", Type: models.MetadataTypeNumber},
+			}
+
+			contents, err := docs.Render("staging", outputs, rawState)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(Equal("# staging\n" +
+				"\n" +
+				"Terraform version `1.5.7`, state serial `12`.\n" +
+				"\n" +
+				"## Outputs\n" +
+				"\n" +
+				"| Name | Type | Value |\n" +
+				"|------|------|-------|\n" +
+				"| `db_password` | string | <sensitive> |\n" +
+				"| `motd` | string | a\\|b<br>c |\n" +
+				"| `port` | number | 8080 |\n" +
+				"\n" +
+				"## Resources\n" +
+				"\n" +
+				"| Type | Count |\n" +
+				"|------|-------|\n" +
+				"| `aws_route53_record` | 1 |\n" +
+				"| `aws_subnet` | 2 |\n" +
+				"\n" +
+				"## Providers\n" +
+				"\n" +
+				"* `registry.terraform.io/hashicorp/aws`\n" +
+				"* `registry.terraform.io/hashicorp/http`\n",
+			))
+		})
+
+		It("renders an empty state", func() {
+			contents, err := docs.Render("staging", nil, []byte(`{"version": 4, "terraform_version": "1.5.7", "serial": 1}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(ContainSubstring("## Outputs\n\nNone.\n"))
+			Expect(string(contents)).To(ContainSubstring("## Resources\n\nNone.\n"))
+			Expect(string(contents)).To(ContainSubstring("## Providers\n\nNone.\n"))
+		})
+
+		It("returns an error if the state is invalid", func() {
+			_, err := docs.Render("staging", nil, []byte(`not-json`))
+			Expect(err).To(MatchError(ContainSubstring("Failed to parse statefile")))
+		})
+	})
+})
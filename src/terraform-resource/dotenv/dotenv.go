@@ -0,0 +1,61 @@
+package dotenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Render converts Terraform outputs into `KEY=VALUE` lines compatible with
+// Docker Compose `env_file` and `dotenv`. Values are single-quoted so they
+// are never expanded when the file is sourced by a shell; non-string values
+// are JSON encoded. Characters in output names which are not valid in an
+// environment variable name, e.g. `-`, are replaced with `_`.
+func Render(outputs map[string]interface{}) ([]byte, error) {
+	outputNames := []string{}
+	for name := range outputs {
+		outputNames = append(outputNames, name)
+	}
+	sort.Strings(outputNames)
+
+	var contents bytes.Buffer
+	seenKeys := map[string]string{}
+	for _, name := range outputNames {
+		key := invalidNameChars.ReplaceAllString(name, "_")
+		if key == "" || (key[0] >= '0' && key[0] <= '9') {
+			key = "_" + key
+		}
+		if other, ok := seenKeys[key]; ok {
+			return nil, fmt.Errorf("Outputs '%s' and '%s' both map to the env var '%s'", other, name, key)
+		}
+		seenKeys[key] = name
+
+		value, err := stringValue(outputs[name])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode output '%s': %s", name, err)
+		}
+		fmt.Fprintf(&contents, "%s=%s\n", key, shellQuote(value))
+	}
+
+	return contents.Bytes(), nil
+}
+
+func stringValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,77 @@
+package dotenv_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/dotenv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dotenv", func() {
+
+	Describe("#Render", func() {
+		It("writes a sorted, single-quoted KEY=VALUE line per output", func() {
+			contents, err := dotenv.Render(map[string]interface{}{
+				"vpc_id":      "vpc-1234",
+				"db_password": "pa$$word",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(Equal(
+				"db_password='pa$$word'\n" +
+					"vpc_id='vpc-1234'\n",
+			))
+		})
+
+		It("escapes single quotes in values", func() {
+			contents, err := dotenv.Render(map[string]interface{}{
+				"message": "it's alive",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(Equal(`message='it'\''s alive'` + "\n"))
+		})
+
+		It("JSON encodes non-string values", func() {
+			contents, err := dotenv.Render(map[string]interface{}{
+				"count":   float64(3),
+				"enabled": true,
+				"subnets": []interface{}{"subnet-1", "subnet-2"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(Equal(
+				"count='3'\n" +
+					"enabled='true'\n" +
+					`subnets='["subnet-1","subnet-2"]'` + "\n",
+			))
+		})
+
+		It("rewrites output names which are not valid env var names", func() {
+			contents, err := dotenv.Render(map[string]interface{}{
+				"vpc-id": "vpc-1234",
+				"1st":    "first",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).To(Equal(
+				"_1st='first'\n" +
+					"vpc_id='vpc-1234'\n",
+			))
+		})
+
+		It("returns an error if two outputs map to the same env var", func() {
+			_, err := dotenv.Render(map[string]interface{}{
+				"vpc-id": "vpc-1234",
+				"vpc_id": "vpc-5678",
+			})
+			Expect(err).To(MatchError(ContainSubstring("both map to the env var 'vpc_id'")))
+		})
+
+		It("returns an empty file when there are no outputs", func() {
+			contents, err := dotenv.Render(map[string]interface{}{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(BeEmpty())
+		})
+	})
+})
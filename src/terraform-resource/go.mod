@@ -1,6 +1,6 @@
 module github.com/ljfranklin/terraform-resource
 
-go 1.16
+go 1.21
 
 require (
 	github.com/Pallinder/go-randomdata v1.2.0
@@ -11,3 +11,13 @@ require (
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/nxadm/tail v1.4.4 // indirect
+	golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb // indirect
+	golang.org/x/sys v0.0.0-20210112080510-489259a85091 // indirect
+	golang.org/x/text v0.3.3 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+)
@@ -2,36 +2,95 @@ package in
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/docs"
+	"github.com/ljfranklin/terraform-resource/dotenv"
 	"github.com/ljfranklin/terraform-resource/encoder"
+	"github.com/ljfranklin/terraform-resource/k8s"
 	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/proxy"
 	"github.com/ljfranklin/terraform-resource/storage"
 	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type Runner struct {
 	OutputDir string
 	LogWriter io.Writer
+
+	span              *tracing.Span
+	caBundle          *cacert.Bundle
+	structuredLogging bool
+	proxy             proxy.Config
 }
 
 type EnvNotFoundError error
 
+// Since Terraform 0.12 the statefile only records root module outputs, so
+// there is nothing to filter by module name even with `terraform output -json`.
 var ErrOutputModule error = errors.New("the `output_module` feature was removed in Terraform 0.12.0, you must now explicitly declare all outputs in the root module")
 
 func (r Runner) Run(req models.InRequest) (models.InResponse, error) {
+	r.structuredLogging = req.Source.StructuredLogging
+	r.proxy = req.Source.Proxy
+	r.LogWriter = r.proxy.Writer(r.LogWriter)
+	tracer := tracing.New(req.Source.OTel)
+	r.span = tracer.Start("get", nil)
+	r.span.SetAttribute("env_name", req.Version.EnvName)
+
+	resp, err := r.run(req)
+	err = r.proxy.RedactError(cacert.Hint(err))
+	r.span.SetAttribute("serial", resp.Version.Serial)
+	r.span.End(err)
+
+	if flushErr := tracer.Flush(); flushErr != nil {
+		r.newLogger().Warn(fmt.Sprintf("Failed to export OpenTelemetry traces: %s", flushErr))
+	}
+
+	return resp, err
+}
+
+func (r Runner) newLogger() logger.Logger {
+	return logger.New(r.LogWriter, r.structuredLogging)
+}
+
+// httpClient trusts `ca_cert` and uses `proxy`, nil means the default client
+func (r Runner) httpClient() *http.Client {
+	return r.proxy.HTTPClient(r.caBundle.HTTPClient())
+}
+
+func (r Runner) run(req models.InRequest) (models.InResponse, error) {
 	if err := req.Version.Validate(); err != nil {
 		return models.InResponse{}, fmt.Errorf("Invalid Version request: %s", err)
 	}
+	if err := req.Params.Validate(); err != nil {
+		return models.InResponse{}, err
+	}
+
+	targetEnvName, err := req.Params.TargetEnvName()
+	if err != nil {
+		return models.InResponse{}, err
+	}
+	if targetEnvName != "" && targetEnvName != req.Version.EnvName {
+		// the serial and any plan of the version belong to the other workspace
+		r.newLogger().Info(fmt.Sprintf("Fetching workspace '%s' rather than '%s' of the version.\n", targetEnvName, req.Version.EnvName))
+		req.Version = models.Version{EnvName: targetEnvName}
+		r.span.SetAttribute("env_name", targetEnvName)
+	}
 
 	envName := req.Version.EnvName
 	nameFilepath := path.Join(r.OutputDir, "name")
@@ -56,6 +115,11 @@ func (r Runner) Run(req models.InRequest) (models.InResponse, error) {
 	}
 	defer os.RemoveAll(tmpDir)
 
+	r.caBundle, err = cacert.Write(req.Source.CACert, tmpDir)
+	if err != nil {
+		return models.InResponse{}, err
+	}
+
 	var resp models.InResponse
 	if req.Source.BackendType != "" && req.Source.MigratedFromStorage != (storage.Model{}) {
 		resp, err = r.inWithMigratedFromStorage(req, tmpDir)
@@ -67,6 +131,7 @@ func (r Runner) Run(req models.InRequest) (models.InResponse, error) {
 	if err != nil {
 		return models.InResponse{}, err
 	}
+	resp.Metadata = resp.Metadata.WithPrefix(req.Params.OutputPrefix)
 
 	if err = r.writeNameToFile(req.Version.EnvName); err != nil {
 		return models.InResponse{}, err
@@ -94,23 +159,56 @@ func (r Runner) inWithBackend(req models.InRequest, tmpDir string) (models.InRes
 	if err := terraformModel.Validate(); err != nil {
 		return models.InResponse{}, fmt.Errorf("Failed to validate terraform Model: %s", err)
 	}
+	if err := terraformModel.ParsePassEnv(); err != nil {
+		return models.InResponse{}, err
+	}
+	if err := terraformModel.ParseBackendConfigFromEnv(req.Source.BackendConfigEnvPrefix); err != nil {
+		return models.InResponse{}, err
+	}
 	terraformModel.Source = "."
+	terraformModel.PlanFileLocalPath = path.Join(tmpDir, "plan")
+	terraformModel.WorkspacePrefix = req.Source.BackendPrefix
+	terraformModel.LogJSON = req.Source.StructuredLogging
+	if r.span != nil {
+		terraformModel.Env["TRACEPARENT"] = r.span.Traceparent()
+	}
+	terraformModel.Env = r.caBundle.WithEnv(terraformModel.Env)
+	terraformModel.Env = r.proxy.WithEnv(terraformModel.Env)
+	terraformModel, err := terraformModel.WithGCSCredentials(tmpDir)
+	if err != nil {
+		return models.InResponse{}, err
+	}
 	if req.Params.OutputModule != "" {
 		return models.InResponse{}, ErrOutputModule
 	}
+	if req.Params.ReadOnly {
+		if err := terraformModel.ValidateReadOnly(); err != nil {
+			return models.InResponse{}, err
+		}
+		for i, fallback := range req.Source.FallbackBackends {
+			if err := terraformModel.Merge(fallback).ValidateReadOnly(); err != nil {
+				return models.InResponse{}, fmt.Errorf("Invalid `fallback_backends[%d]`: %s", i, err)
+			}
+		}
+		terraformModel.ReadOnly = true
+	}
+	terraformModel, err = terraform.UseTerraformVersion(terraformModel, r.httpClient(), r.LogWriter)
+	if err != nil {
+		return models.InResponse{}, err
+	}
 
 	targetEnvName := req.Version.EnvName
 
-	client := terraform.NewClient(
-		terraformModel,
-		r.LogWriter,
-	)
-
-	if err := client.InitWithBackend(); err != nil {
+	client, err := r.initWithFallbackBackends(terraformModel, req.Source.FallbackBackends)
+	if err != nil {
 		return models.InResponse{}, err
 	}
 
 	if req.Version.IsPlan() {
+		if err := r.writePlanToFile(req.Version, terraformModel.PlanFileLocalPath, client); err != nil {
+			return models.InResponse{}, err
+		}
+
 		if req.Params.OutputJSONPlanfile {
 			if err := r.writeJSONPlanToFile(targetEnvName+"-plan", client); err != nil {
 				return models.InResponse{}, err
@@ -137,37 +235,152 @@ func (r Runner) inWithBackend(req models.InRequest, tmpDir string) (models.InRes
 	return r.writeBackendOutputs(req, targetEnvName, client)
 }
 
+// initWithFallbackBackends tries each of the `fallback_backends` in order
+// if the primary backend cannot be initialized, e.g. during a regional outage.
+func (r Runner) initWithFallbackBackends(terraformModel models.Terraform, fallbacks []models.Terraform) (terraform.Client, error) {
+	initSpan := r.span.StartChild("terraform init")
+	client, err := r.attemptInitWithFallbackBackends(terraformModel, fallbacks)
+	initSpan.End(err)
+	return client, err
+}
+
+func (r Runner) attemptInitWithFallbackBackends(terraformModel models.Terraform, fallbacks []models.Terraform) (terraform.Client, error) {
+	client := terraform.NewClient(
+		terraformModel,
+		r.LogWriter,
+	)
+	initErr := client.InitWithBackend()
+	if initErr == nil {
+		return client, nil
+	}
+
+	logger := r.newLogger()
+	for i, fallback := range fallbacks {
+		logger.Warn(fmt.Sprintf("Failed to initialize backend '%s', trying `fallback_backends[%d]`...\nError: %s", terraformModel.BackendType, i, initErr))
+
+		// discard any partially initialized backend before switching to the fallback
+		if err := os.RemoveAll(path.Join(terraformModel.Source, ".terraform")); err != nil {
+			return nil, err
+		}
+
+		terraformModel = terraformModel.Merge(fallback)
+		client = terraform.NewClient(
+			terraformModel,
+			r.LogWriter,
+		)
+		if initErr = client.InitWithBackend(); initErr == nil {
+			return client, nil
+		}
+	}
+
+	return nil, initErr
+}
+
 func (r Runner) writeBackendOutputs(req models.InRequest, targetEnvName string, client terraform.Client) (models.InResponse, error) {
 	if err := r.ensureEnvExistsInBackend(targetEnvName, client); err != nil {
 		return models.InResponse{}, err
 	}
 
-	tfOutput, err := client.Output(targetEnvName)
+	stateVersion, err := client.CurrentStateVersion(targetEnvName)
 	if err != nil {
-		return models.InResponse{}, fmt.Errorf("Failed to parse terraform output.\nError: %s", err)
+		return models.InResponse{}, err
 	}
+
+	// a workspace with no state yet has no outputs, a later put will apply it
 	result := terraform.Result{
-		Output: tfOutput,
+		Output:               map[string]map[string]interface{}{},
+		SensitiveOutputNames: req.Source.Terraform.Merge(req.Params.Terraform).SensitiveOutputNames,
+	}
+	brokenOutputs := []string{}
+	if !stateVersion.Empty {
+		if req.Params.FailOnOutputErrors {
+			result.Output, err = terraform.ValidOutputs(client, targetEnvName)
+		} else {
+			result.Output, brokenOutputs, err = terraform.OutputsSkippingBroken(client, targetEnvName)
+		}
+		if err != nil {
+			return models.InResponse{}, fmt.Errorf("Failed to parse terraform output.\nError: %s", err)
+		}
+	}
+	if len(brokenOutputs) > 0 {
+		r.newLogger().Warn(fmt.Sprintf("Skipping output(s) which could not be parsed, set `fail_on_output_errors: true` to fail instead: %s", strings.Join(brokenOutputs, ", ")))
 	}
 
-	if err = r.writeRawOutputToFile(result); err != nil {
+	if err = r.writeRawOutputToFile(result, req.Params.TypedMetadata, req.Params.OutputPrefix); err != nil {
 		return models.InResponse{}, err
 	}
 
+	if req.Params.OutputK8sManifest != nil {
+		if err = r.writeK8sManifestToFile(*req.Params.OutputK8sManifest, result); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
+	if req.Params.OutputAsEnvFile {
+		if err = r.writeEnvFile(result); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
 	if req.Params.OutputStatefile {
 		if err = r.writeBackendStateToFile(targetEnvName, client); err != nil {
 			return models.InResponse{}, err
 		}
 	}
-	stateVersion, err := client.CurrentStateVersion(targetEnvName)
-	if err != nil {
-		return models.InResponse{}, err
+
+	if req.Params.OutputDocs {
+		rawState, err := client.StatePull(targetEnvName)
+		if err != nil {
+			return models.InResponse{}, err
+		}
+		if stateVersion.Empty {
+			rawState = []byte("{}")
+		}
+		if err = r.writeDocsToFile(targetEnvName, result, rawState); err != nil {
+			return models.InResponse{}, err
+		}
 	}
 
-	metadata, err := r.sanitizedOutput(result, client)
+	if req.Params.OutputInventory {
+		if err = r.writeInventoryToFile(targetEnvName, client); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
+	tfVersion, err := r.writeTerraformVersionToFile(client)
 	if err != nil {
 		return models.InResponse{}, err
 	}
+	metadata := r.sanitizedOutput(result, tfVersion)
+	if len(brokenOutputs) > 0 {
+		brokenJSON, err := json.Marshal(brokenOutputs)
+		if err != nil {
+			return models.InResponse{}, err
+		}
+		metadata = append(metadata, models.MetadataField{
+			Name:  "broken_outputs",
+			Value: string(brokenJSON),
+		})
+	}
+	if stateVersion.Empty {
+		metadata = append(metadata, models.MetadataField{
+			Name:  "bootstrap_pending",
+			Value: "true",
+		})
+	}
+
+	terraformModel := req.Source.Terraform.Merge(req.Params.Terraform)
+	terraformModel.WorkspacePrefix = req.Source.BackendPrefix
+	terraformModel.LogJSON = req.Source.StructuredLogging
+	if workspaceURL := terraformModel.WorkspaceURL(targetEnvName); workspaceURL != "" {
+		if err = r.writeWorkspaceURLToFile(workspaceURL); err != nil {
+			return models.InResponse{}, err
+		}
+		metadata = append(metadata, models.MetadataField{
+			Name:  "workspace_url",
+			Value: workspaceURL,
+		})
+	}
 
 	resp := models.InResponse{
 		Version: models.Version{
@@ -177,6 +390,12 @@ func (r Runner) writeBackendOutputs(req models.InRequest, targetEnvName string,
 		},
 		Metadata: metadata,
 	}
+	// the config hash can't be recomputed without the source, so only keep it
+	// if the state is still at the requested serial
+	if resp.Version.Serial == req.Version.Serial && resp.Version.Lineage == req.Version.Lineage {
+		resp.Version.ConfigHash = req.Version.ConfigHash
+		resp.Version.TerraformVersion = req.Version.TerraformVersion
+	}
 	return resp, nil
 }
 
@@ -208,27 +427,206 @@ func (r Runner) writeNameToFile(envName string) error {
 	return ioutil.WriteFile(nameFilepath, []byte(envName), 0644)
 }
 
-func (r Runner) writeRawOutputToFile(result terraform.Result) error {
+// writeTerraformVersionToFile writes just the version number, e.g. `1.5.7`,
+// and returns the full `terraform -v` output for the metadata
+func (r Runner) writeTerraformVersionToFile(client terraform.Client) (string, error) {
+	tfVersion, err := client.Version()
+	if err != nil {
+		return "", err
+	}
+	// the output continues with the platform and any upgrade notice
+	firstLine := strings.SplitN(tfVersion, "\n", 2)[0]
+	versionNumber := strings.TrimPrefix(strings.TrimSpace(firstLine), "Terraform v")
+
+	versionFilepath := path.Join(r.OutputDir, "terraform_version")
+	if err := ioutil.WriteFile(versionFilepath, []byte(versionNumber), 0644); err != nil {
+		return "", fmt.Errorf("Failed to create terraform_version file at path '%s': %s", versionFilepath, err)
+	}
+	return tfVersion, nil
+}
+
+func (r Runner) writeWorkspaceURLToFile(workspaceURL string) error {
+	urlFilepath := path.Join(r.OutputDir, "workspace_url")
+	if err := ioutil.WriteFile(urlFilepath, []byte(workspaceURL), 0644); err != nil {
+		return fmt.Errorf("Failed to create workspace_url file at path '%s': %s", urlFilepath, err)
+	}
+	return nil
+}
+
+func (r Runner) writeRawOutputToFile(result terraform.Result, typed bool, outputPrefix string) error {
 	outputFilepath := path.Join(r.OutputDir, "metadata")
 	outputFile, err := os.Create(outputFilepath)
 	if err != nil {
 		return fmt.Errorf("Failed to create output file at path '%s': %s", outputFilepath, err)
 	}
 
-	if err = encoder.NewJSONEncoder(outputFile).Encode(result.RawOutput()); err != nil {
+	rawOutput := map[string]interface{}{}
+	for key, value := range result.RawOutput() {
+		rawOutput[models.PrefixedName(outputPrefix, key)] = value
+	}
+	var contents interface{} = rawOutput
+	if typed {
+		contents = models.Metadata(result.TypedOutput()).WithPrefix(outputPrefix)
+	}
+	if err = encoder.NewJSONEncoder(outputFile).Encode(contents); err != nil {
 		return fmt.Errorf("Failed to write output file: %s", err)
 	}
 
 	return nil
 }
 
+func (r Runner) writeK8sManifestToFile(config models.K8sManifest, result terraform.Result) error {
+	// outputs marked as sensitive in Terraform should never end up in a ConfigMap
+	config.SecretKeys = append([]string{}, config.SecretKeys...)
+	for key, value := range result.Output {
+		if value["sensitive"] == true {
+			config.SecretKeys = append(config.SecretKeys, key)
+		}
+	}
+
+	manifest, err := k8s.Render(config, result.RawOutput())
+	if err != nil {
+		return fmt.Errorf("Failed to render Kubernetes manifest: %s", err)
+	}
+
+	manifestFilepath := path.Join(r.OutputDir, "k8s_manifest.yml")
+	if err = ioutil.WriteFile(manifestFilepath, manifest, 0644); err != nil {
+		return fmt.Errorf("Failed to create Kubernetes manifest at path '%s': %s", manifestFilepath, err)
+	}
+
+	return nil
+}
+
+func (r Runner) writeEnvFile(result terraform.Result) error {
+	contents, err := dotenv.Render(result.RawOutput())
+	if err != nil {
+		return fmt.Errorf("Failed to render env file: %s", err)
+	}
+
+	envFilepath := path.Join(r.OutputDir, ".env")
+	if err = ioutil.WriteFile(envFilepath, contents, 0600); err != nil {
+		return fmt.Errorf("Failed to create env file at path '%s': %s", envFilepath, err)
+	}
+
+	return nil
+}
+
+// masks sensitive outputs the same way as the metadata shown in the UI
+func (r Runner) writeDocsToFile(envName string, result terraform.Result, rawState []byte) error {
+	sanitizedOutput := result.SanitizedOutput()
+	outputs := result.TypedOutput()
+	for i := range outputs {
+		outputs[i].Value = sanitizedOutput[outputs[i].Name]
+	}
+
+	contents, err := docs.Render(envName, outputs, rawState)
+	if err != nil {
+		return fmt.Errorf("Failed to render docs: %s", err)
+	}
+
+	docsFilepath := path.Join(r.OutputDir, "docs.md")
+	if err = ioutil.WriteFile(docsFilepath, contents, 0644); err != nil {
+		return fmt.Errorf("Failed to create docs file at path '%s': %s", docsFilepath, err)
+	}
+
+	return nil
+}
+
+// writeInventoryToFile writes the inventory recorded by the last `put`, an
+// init by the `get` would resolve the providers and modules of today instead
+func (r Runner) writeInventoryToFile(envName string, client terraform.Client) error {
+	recorded, found, err := terraform.InventoryMarker{Client: client, EnvName: envName}.Read()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("No inventory was recorded for env '%s', set `record_inventory: true` on the `put` to record one", envName)
+	}
+
+	contents, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+	inventoryFilepath := path.Join(r.OutputDir, "inventory.json")
+	if err = ioutil.WriteFile(inventoryFilepath, contents, 0644); err != nil {
+		return fmt.Errorf("Failed to create inventory file at path '%s': %s", inventoryFilepath, err)
+	}
+
+	return nil
+}
+
 func (r Runner) writeBackendStateToFile(envName string, client terraform.Client) error {
-	stateFilePath := path.Join(r.OutputDir, "terraform.tfstate")
 	stateContents, err := client.StatePull(envName)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(stateFilePath, stateContents, 0777)
+	return r.writeStateToFiles(stateContents)
+}
+
+// writeStateToFiles writes the statefile along with `tfstate.json`, which
+// holds only its outputs so tasks can read them without jq
+func (r Runner) writeStateToFiles(stateContents []byte) error {
+	stateFilePath := path.Join(r.OutputDir, "terraform.tfstate")
+	if err := ioutil.WriteFile(stateFilePath, stateContents, 0777); err != nil {
+		return err
+	}
+
+	outputs, err := terraform.StateOutputs(stateContents)
+	if err != nil {
+		return err
+	}
+	outputsFilePath := path.Join(r.OutputDir, "tfstate.json")
+	if err = ioutil.WriteFile(outputsFilePath, outputs, 0644); err != nil {
+		return fmt.Errorf("Failed to create outputs file at path '%s': %s", outputsFilePath, err)
+	}
+	return nil
+}
+
+func (r Runner) writePlanToFile(version models.Version, localPlanPath string, client terraform.Client) error {
+	planEnvName := version.EnvName + "-plan"
+	rerunMsg := "\nRe-run the job which created the plan to generate a new one."
+
+	spaces, err := client.WorkspaceList()
+	if err != nil {
+		return err
+	}
+	foundPlan := false
+	for _, space := range spaces {
+		if space == planEnvName {
+			foundPlan = true
+		}
+	}
+	if !foundPlan {
+		return fmt.Errorf("The plan for '%s' no longer exists in the backend, it may have already been applied."+rerunMsg, version.EnvName)
+	}
+
+	if err = client.GetPlanFromBackend(planEnvName); err != nil {
+		return err
+	}
+
+	planContents, err := ioutil.ReadFile(localPlanPath)
+	if err != nil {
+		return err
+	}
+	if version.PlanChecksum != "" {
+		if checksum := fmt.Sprintf("%x", sha256.Sum256(planContents)); checksum != version.PlanChecksum {
+			return fmt.Errorf("The plan for '%s' has been superseded by a newer plan."+rerunMsg, version.EnvName)
+		}
+	}
+
+	planFilePath := path.Join(r.OutputDir, "plan.tfplan")
+	if err = ioutil.WriteFile(planFilePath, planContents, 0644); err != nil {
+		return fmt.Errorf("Failed to create plan file at path '%s': %s", planFilePath, err)
+	}
+
+	tfOutput, err := client.Output(planEnvName)
+	if err != nil {
+		return err
+	}
+	if _, ok := tfOutput[models.PlanContentText]; !ok {
+		return fmt.Errorf("The plan for '%s' was created by an older version of this resource and has no text output."+rerunMsg, version.EnvName)
+	}
+	return writeGzippedPlanToFile(tfOutput, models.PlanContentText, path.Join(r.OutputDir, "plan.txt"))
 }
 
 func (r Runner) writeJSONPlanToFile(envName string, client terraform.Client) error {
@@ -237,13 +635,15 @@ func (r Runner) writeJSONPlanToFile(envName string, client terraform.Client) err
 		return err
 	}
 
-	planFilePath := path.Join(r.OutputDir, "plan.json")
+	return writeGzippedPlanToFile(tfOutput, models.PlanContentJSON, path.Join(r.OutputDir, "plan.json"))
+}
 
+func writeGzippedPlanToFile(tfOutput map[string]map[string]interface{}, outputKey string, planFilePath string) error {
 	var encodedPlan string
-	if val, ok := tfOutput[models.PlanContentJSON]; ok {
+	if val, ok := tfOutput[outputKey]; ok {
 		encodedPlan = val["value"].(string)
 	} else {
-		return fmt.Errorf("state has no output for key %s", models.PlanContentJSON)
+		return fmt.Errorf("state has no output for key %s", outputKey)
 	}
 
 	// Base64 decode then gunzip the JSON plan
@@ -273,16 +673,7 @@ func (r Runner) writeJSONPlanToFile(envName string, client terraform.Client) err
 	return nil
 }
 
-func (r Runner) writeLegacyStateToFile(localStatefilePath string) error {
-	stateFilePath := path.Join(r.OutputDir, "terraform.tfstate")
-	stateContents, err := ioutil.ReadFile(localStatefilePath)
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(stateFilePath, stateContents, 0777)
-}
-
-func (r Runner) sanitizedOutput(result terraform.Result, client terraform.Client) ([]models.MetadataField, error) {
+func (r Runner) sanitizedOutput(result terraform.Result, tfVersion string) []models.MetadataField {
 	metadata := []models.MetadataField{}
 	for key, value := range result.SanitizedOutput() {
 		metadata = append(metadata, models.MetadataField{
@@ -291,22 +682,20 @@ func (r Runner) sanitizedOutput(result terraform.Result, client terraform.Client
 		})
 	}
 
-	tfVersion, err := client.Version()
-	if err != nil {
-		return nil, err
-	}
 	return append(metadata, models.MetadataField{
 		Name:  "terraform_version",
 		Value: tfVersion,
-	}), nil
+	})
 }
 
 func (r Runner) inWithLegacyStorage(req models.InRequest, tmpDir string) (models.InResponse, error) {
-	logger := logger.Logger{
-		Sink: r.LogWriter,
-	}
+	logger := r.newLogger()
 	logger.Warn(fmt.Sprintf("%s\n", storage.DeprecationWarning))
 
+	if req.Params.OutputInventory {
+		return models.InResponse{}, errors.New("`output_inventory` is only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use this option")
+	}
+
 	if req.Version.IsPlan() {
 		resp := models.InResponse{
 			Version: req.Version,
@@ -337,13 +726,16 @@ func (r Runner) inWithLegacyStorage(req models.InRequest, tmpDir string) (models
 		r.LogWriter,
 	)
 
-	storageVersion, err := stateFile.Download()
+	storageVersion, stateContents, err := stateFile.DownloadContents()
 	if err != nil {
 		return models.InResponse{}, fmt.Errorf("Failed to download state file from storage backend: %s", err)
 	}
-	version := models.NewVersionFromLegacyStorage(storageVersion)
+	version := models.NewVersionFromLegacyStorage(storageVersion).WithStateSerial(stateContents)
 
-	if err = client.InitWithoutBackend(); err != nil {
+	initSpan := r.span.StartChild("terraform init")
+	err = client.InitWithoutBackend()
+	initSpan.End(err)
+	if err != nil {
 		return models.InResponse{}, fmt.Errorf("Failed to initialize terraform.\nError: %s", err)
 	}
 
@@ -352,23 +744,43 @@ func (r Runner) inWithLegacyStorage(req models.InRequest, tmpDir string) (models
 		return models.InResponse{}, fmt.Errorf("Failed to parse terraform output.\nError: %s", err)
 	}
 	result := terraform.Result{
-		Output: tfOutput,
+		Output:               tfOutput,
+		SensitiveOutputNames: req.Source.Terraform.Merge(req.Params.Terraform).SensitiveOutputNames,
 	}
 
-	if err = r.writeRawOutputToFile(result); err != nil {
+	if err = r.writeRawOutputToFile(result, req.Params.TypedMetadata, req.Params.OutputPrefix); err != nil {
 		return models.InResponse{}, err
 	}
 
+	if req.Params.OutputK8sManifest != nil {
+		if err = r.writeK8sManifestToFile(*req.Params.OutputK8sManifest, result); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
+	if req.Params.OutputAsEnvFile {
+		if err = r.writeEnvFile(result); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
 	if req.Params.OutputStatefile {
-		if err = r.writeLegacyStateToFile(terraformModel.StateFileLocalPath); err != nil {
+		if err = r.writeStateToFiles(stateContents); err != nil {
 			return models.InResponse{}, err
 		}
 	}
 
-	metadata, err := r.sanitizedOutput(result, client)
+	if req.Params.OutputDocs {
+		if err = r.writeDocsToFile(version.EnvName, result, stateContents); err != nil {
+			return models.InResponse{}, err
+		}
+	}
+
+	tfVersion, err := r.writeTerraformVersionToFile(client)
 	if err != nil {
 		return models.InResponse{}, err
 	}
+	metadata := r.sanitizedOutput(result, tfVersion)
 
 	resp := models.InResponse{
 		Version:  version,
@@ -383,7 +795,12 @@ func (r Runner) stateFileFromLegacyStorage(req models.InRequest, tmpDir string)
 	if err := storageModel.Validate(); err != nil {
 		return storage.StateFile{}, fmt.Errorf("Failed to validate storage Model: %s", err)
 	}
-	storageDriver := storage.BuildDriver(storageModel)
+	storageModel.HTTPClient = r.httpClient()
+	if warning := storageModel.InsecureWarning(); warning != "" {
+		r.newLogger().Warn(warning)
+	}
+	storageDriver := storage.WithRetries(storage.BuildDriver(storageModel), storageModel.Retryer(r.newLogger()))
+	storageDriver = storage.WithTracing(storageDriver, r.span)
 
 	stateFile := storage.StateFile{
 		LocalPath:     path.Join(tmpDir, "terraform.tfstate"),
@@ -397,6 +814,9 @@ func (r Runner) stateFileFromLegacyStorage(req models.InRequest, tmpDir string)
 	}
 	if existsAsTainted {
 		stateFile = stateFile.ConvertToTainted()
+	} else {
+		// the exact statefile emitted by check, even if since overwritten
+		stateFile.VersionID = req.Version.VersionID
 	}
 
 	exists, err := stateFile.Exists()
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ljfranklin/terraform-resource/in"
@@ -172,6 +173,64 @@ var _ = Describe("In with Backend", func() {
 			nameContents, err := ioutil.ReadFile(expectedNamePath)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(nameContents)).To(Equal(prevEnvName))
+
+			expectedVersionPath := path.Join(tmpDir, "terraform_version")
+			Expect(expectedVersionPath).To(BeAnExistingFile())
+			versionContents, err := ioutil.ReadFile(expectedVersionPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(versionContents)).To(MatchRegexp(`^\d+\.\d+\.\d+\S*$`))
+		})
+
+		It("prefixes the metadata keys but not the name if `output_prefix` is given", func() {
+			inReq.Params.OutputPrefix = "prod"
+			inReq.Version = models.Version{
+				EnvName: prevEnvName,
+				Serial:  "0",
+			}
+
+			runner := in.Runner{
+				OutputDir: tmpDir,
+			}
+			resp, err := runner.Run(inReq)
+			Expect(err).ToNot(HaveOccurred())
+
+			metadata := map[string]string{}
+			for _, field := range resp.Metadata {
+				metadata[field.Name] = field.Value
+			}
+			Expect(metadata["prod_env_name"]).To(Equal("previous"))
+			Expect(metadata["prod_terraform_version"]).To(MatchRegexp("Terraform v.*"))
+			Expect(metadata).ToNot(HaveKey("env_name"))
+
+			outputContents := map[string]interface{}{}
+			rawOutput, err := ioutil.ReadFile(path.Join(tmpDir, "metadata"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(rawOutput, &outputContents)).To(Succeed())
+			Expect(outputContents["prod_env_name"]).To(Equal("previous"))
+			Expect(outputContents).ToNot(HaveKey("env_name"))
+
+			nameContents, err := ioutil.ReadFile(path.Join(tmpDir, "name"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(nameContents)).To(Equal(prevEnvName))
+		})
+
+		It("fetches the workspace given by `env_name` rather than the version's", func() {
+			inReq.Params.EnvName = prevEnvName
+			inReq.Version = models.Version{
+				EnvName: "some-other-env",
+				Serial:  "0",
+			}
+
+			runner := in.Runner{
+				OutputDir: tmpDir,
+			}
+			resp, err := runner.Run(inReq)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Version.EnvName).To(Equal(prevEnvName))
+
+			nameContents, err := ioutil.ReadFile(path.Join(tmpDir, "name"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(nameContents)).To(Equal(prevEnvName))
 		})
 
 		It("outputs the statefile if `output_statefile` is given", func() {
@@ -199,6 +258,12 @@ var _ = Describe("In with Backend", func() {
 			stateContents, err := ioutil.ReadFile(expectedStatePath)
 			Expect(err).To(BeNil())
 			Expect(string(stateContents)).To(ContainSubstring("previous"))
+
+			outputsContents, err := ioutil.ReadFile(path.Join(tmpDir, "tfstate.json"))
+			Expect(err).ToNot(HaveOccurred())
+			outputs := map[string]map[string]interface{}{}
+			Expect(json.Unmarshal(outputsContents, &outputs)).To(Succeed())
+			Expect(outputs["env_name"]["value"]).To(Equal("previous"))
 		})
 
 		It("returns an error when OutputModule is used", func() {
@@ -271,6 +336,45 @@ var _ = Describe("In with Backend", func() {
 		})
 	})
 
+	Context("when the workspace exists but no state was written", func() {
+		BeforeEach(func() {
+			// a put which failed after `workspace new` leaves an empty state object
+			awsVerifier.UploadObjectToS3(bucket, pathToCurrS3Fixture, strings.NewReader(""))
+		})
+
+		AfterEach(func() {
+			awsVerifier.DeleteObjectFromS3(bucket, pathToCurrS3Fixture)
+		})
+
+		It("returns serial 0 and marks the env as pending bootstrap", func() {
+			inReq.Version = models.Version{
+				EnvName: currEnvName,
+				Serial:  "0",
+			}
+			inReq.Params.OutputStatefile = true
+			inReq.Params.OutputDocs = true
+
+			runner := in.Runner{
+				OutputDir: tmpDir,
+			}
+			resp, err := runner.Run(inReq)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resp.Version.EnvName).To(Equal(currEnvName))
+			Expect(resp.Version.Serial).To(Equal("0"))
+
+			metadata := map[string]string{}
+			for _, field := range resp.Metadata {
+				metadata[field.Name] = field.Value
+			}
+			Expect(metadata["bootstrap_pending"]).To(Equal("true"))
+
+			Expect(path.Join(tmpDir, "metadata")).To(BeAnExistingFile())
+			Expect(path.Join(tmpDir, "terraform.tfstate")).To(BeAnExistingFile())
+			Expect(path.Join(tmpDir, "docs.md")).To(BeAnExistingFile())
+		})
+	})
+
 	Context("when state file does not exist on S3", func() {
 
 		Context("and it was called as part of the 'destroy' action", func() {
@@ -135,6 +135,7 @@ var _ = Describe("In with legacy storage", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(resp.Version.EnvName).To(Equal(prevEnvName))
+			Expect(resp.Version.Serial).To(Equal("0"))
 
 			metadata := map[string]string{}
 			for _, field := range resp.Metadata {
@@ -170,6 +171,12 @@ var _ = Describe("In with legacy storage", func() {
 			nameContents, err := ioutil.ReadFile(expectedNamePath)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(nameContents)).To(Equal(prevEnvName))
+
+			expectedVersionPath := path.Join(tmpDir, "terraform_version")
+			Expect(expectedVersionPath).To(BeAnExistingFile())
+			versionContents, err := ioutil.ReadFile(expectedVersionPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(versionContents)).To(MatchRegexp(`^\d+\.\d+\.\d+\S*$`))
 		})
 
 		It("outputs the statefile if `output_statefile` is given", func() {
@@ -194,6 +201,17 @@ var _ = Describe("In with legacy storage", func() {
 
 			expectedStatePath := path.Join(tmpDir, "terraform.tfstate")
 			Expect(expectedStatePath).To(BeAnExistingFile())
+
+			stateContents, err := ioutil.ReadFile(expectedStatePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(stateContents)).To(ContainSubstring("previous"))
+
+			outputsContents, err := ioutil.ReadFile(path.Join(tmpDir, "tfstate.json"))
+			Expect(err).ToNot(HaveOccurred())
+			outputs := map[string]map[string]interface{}{}
+			Expect(json.Unmarshal(outputsContents, &outputs)).To(Succeed())
+			Expect(outputs["env_name"]["value"]).To(Equal("previous"))
+			Expect(outputs).ToNot(HaveKey("modules"))
 		})
 
 		It("returns an error when OutputModule is used", func() {
@@ -278,6 +278,14 @@ var _ = Describe("JSON Plan", func() {
 		Expect(string(stateContents)).To(ContainSubstring("output_changes"))
 		Expect(string(stateContents)).To(ContainSubstring("resource_changes"))
 		Expect(string(stateContents)).To(ContainSubstring("\"format_version\":\"0.1\""))
+
+		By("outputs the binary and human-readable plan")
+
+		Expect(path.Join(inDir, "plan.tfplan")).To(BeAnExistingFile())
+
+		textPlanContents, err := ioutil.ReadFile(path.Join(inDir, "plan.txt"))
+		Expect(err).To(BeNil())
+		Expect(string(textPlanContents)).To(ContainSubstring("aws_s3_bucket_object.s3_object"))
 	})
 
 	It("HACK: outputs metadata file if statefile exists", func() {
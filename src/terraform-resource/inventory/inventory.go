@@ -0,0 +1,331 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	lockFile        = ".terraform.lock.hcl"
+	modulesManifest = ".terraform/modules/modules.json"
+	providersDir    = ".terraform/providers"
+)
+
+var (
+	// the lock file is always written by `terraform init` in canonical form,
+	// so a line-based parser is enough for the attributes we report
+	lockProviderRegex  = regexp.MustCompile(`^provider\s+"([^"]+)"\s*{$`)
+	lockAttributeRegex = regexp.MustCompile(`^(version|constraints)\s*=\s*"([^"]*)"$`)
+	lockHashRegex      = regexp.MustCompile(`^"([^"]+)",?$`)
+)
+
+// Inventory is a CycloneDX-style bill of materials listing the providers
+// and modules an env was applied with
+type Inventory struct {
+	BOMFormat   string      `json:"bomFormat"`
+	SpecVersion string      `json:"specVersion"`
+	Version     int         `json:"version"`
+	Metadata    Metadata    `json:"metadata"`
+	Components  []Component `json:"components"`
+}
+
+type Metadata struct {
+	Timestamp string    `json:"timestamp"`
+	Component Component `json:"component"`
+}
+
+type Component struct {
+	Type       string     `json:"type"`
+	BOMRef     string     `json:"bom-ref,omitempty"`
+	Group      string     `json:"group,omitempty"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	Hashes     []Hash     `json:"hashes,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type lockedProvider struct {
+	Address     string
+	Version     string
+	Constraints string
+	Hashes      []string
+}
+
+type moduleManifest struct {
+	Modules []struct {
+		Key     string `json:"Key"`
+		Source  string `json:"Source"`
+		Version string `json:"Version"`
+		Dir     string `json:"Dir"`
+	} `json:"Modules"`
+}
+
+// Build assembles the inventory of an initialized Terraform config in
+// sourceDir from its lock file and module manifest. Installed providers are
+// hashed and compared against the lock file, see HashMismatches.
+func Build(envName string, sourceDir string) (Inventory, error) {
+	inventory := Inventory{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Component: Component{
+				Type: "application",
+				Name: envName,
+			},
+		},
+		Components: []Component{},
+	}
+
+	providers, err := readLockFile(filepath.Join(sourceDir, lockFile))
+	if err != nil {
+		return Inventory{}, err
+	}
+	for _, provider := range providers {
+		inventory.Components = append(inventory.Components, providerComponent(sourceDir, provider))
+	}
+
+	modules, err := moduleComponents(sourceDir)
+	if err != nil {
+		return Inventory{}, err
+	}
+	inventory.Components = append(inventory.Components, modules...)
+
+	return inventory, nil
+}
+
+// HashMismatches returns the providers whose installed package did not
+// match any hash in the lock file
+func (i Inventory) HashMismatches() []string {
+	mismatches := []string{}
+	for _, component := range i.Components {
+		if component.property("terraform:hash_verified") == "false" {
+			mismatches = append(mismatches, component.BOMRef)
+		}
+	}
+	return mismatches
+}
+
+func (c Component) property(name string) string {
+	for _, property := range c.Properties {
+		if property.Name == name {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+func readLockFile(path string) ([]lockedProvider, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// configs without providers, or from before Terraform 0.14, have no lock file
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s': %s", lockFile, err)
+	}
+
+	providers := []lockedProvider{}
+	var current *lockedProvider
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := lockProviderRegex.FindStringSubmatch(line); match != nil {
+			providers = append(providers, lockedProvider{Address: match[1]})
+			current = &providers[len(providers)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if match := lockAttributeRegex.FindStringSubmatch(line); match != nil {
+			if match[1] == "version" {
+				current.Version = match[2]
+			} else {
+				current.Constraints = match[2]
+			}
+		} else if match := lockHashRegex.FindStringSubmatch(line); match != nil {
+			current.Hashes = append(current.Hashes, match[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read '%s': %s", lockFile, err)
+	}
+
+	return providers, nil
+}
+
+func providerComponent(sourceDir string, provider lockedProvider) Component {
+	// e.g. registry.terraform.io/hashicorp/aws
+	registry, namespace, name := "", "", provider.Address
+	if parts := strings.Split(provider.Address, "/"); len(parts) == 3 {
+		registry, namespace, name = parts[0], parts[1], parts[2]
+	}
+
+	component := Component{
+		Type:    "library",
+		BOMRef:  fmt.Sprintf("%s@%s", provider.Address, provider.Version),
+		Group:   namespace,
+		Name:    name,
+		Version: provider.Version,
+		Properties: []Property{
+			{Name: "terraform:kind", Value: "provider"},
+			{Name: "terraform:registry", Value: registry},
+		},
+	}
+	if provider.Constraints != "" {
+		component.Properties = append(component.Properties, Property{Name: "terraform:constraints", Value: provider.Constraints})
+	}
+
+	// `zh:` hashes are SHA-256 of the release zips, `h1:` hashes are
+	// Terraform's own hash of the unpacked package
+	lockedH1 := map[string]bool{}
+	for _, hash := range provider.Hashes {
+		if strings.HasPrefix(hash, "zh:") {
+			component.Hashes = append(component.Hashes, Hash{Alg: "SHA-256", Content: strings.TrimPrefix(hash, "zh:")})
+		} else {
+			lockedH1[hash] = true
+			component.Properties = append(component.Properties, Property{Name: "terraform:lock_hash", Value: hash})
+		}
+	}
+
+	packageDir := filepath.Join(sourceDir, providersDir, provider.Address, provider.Version, runtime.GOOS+"_"+runtime.GOARCH)
+	installedHash, err := packageHash(packageDir)
+	if err != nil {
+		component.Properties = append(component.Properties, Property{Name: "terraform:hash_error", Value: err.Error()})
+		return component
+	}
+	component.Properties = append(component.Properties,
+		Property{Name: "terraform:installed_hash", Value: installedHash},
+		Property{Name: "terraform:hash_verified", Value: fmt.Sprintf("%t", lockedH1[installedHash])},
+	)
+	return component
+}
+
+// packageHash matches Terraform's `h1:` scheme: the SHA-256 of a sorted
+// `<sha256>  <path>` line per file, base64 encoded
+func packageHash(packageDir string) (string, error) {
+	// with a plugin cache the package is a symlink into the cache
+	packageDir, err := filepath.EvalSymlinks(packageDir)
+	if err != nil {
+		return "", fmt.Errorf("provider is not installed: %s", err)
+	}
+
+	files := []string{}
+	err = filepath.Walk(packageDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(packageDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	summary := sha256.New()
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(packageDir, filepath.FromSlash(file)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", sha256.Sum256(contents), file)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+func moduleComponents(sourceDir string) ([]Component, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(sourceDir, modulesManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s': %s", modulesManifest, err)
+	}
+	var manifest moduleManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s': %s", modulesManifest, err)
+	}
+
+	components := []Component{}
+	for _, module := range manifest.Modules {
+		if module.Key == "" {
+			continue // the root module
+		}
+		component := Component{
+			Type:    "library",
+			BOMRef:  "module." + strings.Replace(module.Key, ".", ".module.", -1),
+			Name:    module.Key,
+			Version: module.Version,
+			Properties: []Property{
+				{Name: "terraform:kind", Value: "module"},
+				{Name: "terraform:source", Value: module.Source},
+			},
+		}
+		if commit := resolvedCommit(sourceDir, module.Dir); commit != "" {
+			component.Properties = append(component.Properties, Property{Name: "terraform:resolved_commit", Value: commit})
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// resolvedCommit returns the HEAD of a module downloaded from git, or an
+// empty string for other modules, e.g. local paths or registry tarballs
+func resolvedCommit(sourceDir string, moduleDir string) string {
+	dir := filepath.Join(sourceDir, moduleDir)
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Fields(string(output))
+	if len(lines) != 2 {
+		return ""
+	}
+
+	// git searches parent dirs, which for a local module finds the repo of
+	// the config itself rather than a download
+	modulesDir, err := filepath.Abs(filepath.Join(sourceDir, ".terraform", "modules"))
+	if err != nil {
+		return ""
+	}
+	if evaluated, err := filepath.EvalSymlinks(modulesDir); err == nil {
+		modulesDir = evaluated
+	}
+	if !strings.HasPrefix(lines[0], modulesDir+string(filepath.Separator)) {
+		return ""
+	}
+	return lines[1]
+}
@@ -0,0 +1,169 @@
+package inventory_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+
+	"github.com/ljfranklin/terraform-resource/inventory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory", func() {
+
+	var (
+		tmpDir     string
+		sourceDir  string
+		packageDir string
+	)
+
+	writeFile := func(filePath string, contents string) {
+		Expect(os.MkdirAll(path.Dir(filePath), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filePath, []byte(contents), 0644)).To(Succeed())
+	}
+
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		Expect(err).ToNot(HaveOccurred(), string(output))
+	}
+
+	property := func(component inventory.Component, name string) string {
+		for _, p := range component.Properties {
+			if p.Name == name {
+				return p.Value
+			}
+		}
+		return ""
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-inventory-test")
+		Expect(err).ToNot(HaveOccurred())
+		sourceDir = path.Join(tmpDir, "config")
+
+		packageDir = path.Join(sourceDir, ".terraform", "providers", "registry.terraform.io", "hashicorp", "aws", "5.31.0", runtime.GOOS+"_"+runtime.GOARCH)
+		writeFile(path.Join(packageDir, "terraform-provider-aws_v5.31.0_x5"), "fake-provider-binary")
+		writeFile(path.Join(packageDir, "LICENSE.txt"), "fake-license")
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	// computes the `h1:` hash of packageDir independently of the lock file
+	installedHash := func() string {
+		summary := fmt.Sprintf("%x  LICENSE.txt\n%x  terraform-provider-aws_v5.31.0_x5\n",
+			sha256.Sum256([]byte("fake-license")), sha256.Sum256([]byte("fake-provider-binary")))
+		sum := sha256.Sum256([]byte(summary))
+		return "h1:" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	writeLockFile := func(h1Hash string) {
+		writeFile(path.Join(sourceDir, ".terraform.lock.hcl"), fmt.Sprintf(`# This file is maintained automatically by "terraform init".
+# Manual edits may be lost in future updates.
+
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "5.31.0"
+  constraints = "~> 5.0"
+  hashes = [
+    "%s",
+    "zh:0cdb9c2083bf0902442384f7309367791e4640581652dda456f2d6d7abf0de8d",
+  ]
+}
+`, h1Hash))
+	}
+
+	It("lists the locked providers with their hashes", func() {
+		writeLockFile(installedHash())
+
+		result, err := inventory.Build("some-env", sourceDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.BOMFormat).To(Equal("CycloneDX"))
+		Expect(result.Metadata.Component.Name).To(Equal("some-env"))
+		Expect(result.Components).To(HaveLen(1))
+		provider := result.Components[0]
+		Expect(provider.BOMRef).To(Equal("registry.terraform.io/hashicorp/aws@5.31.0"))
+		Expect(provider.Group).To(Equal("hashicorp"))
+		Expect(provider.Name).To(Equal("aws"))
+		Expect(provider.Version).To(Equal("5.31.0"))
+		Expect(provider.Hashes).To(Equal([]inventory.Hash{
+			{Alg: "SHA-256", Content: "0cdb9c2083bf0902442384f7309367791e4640581652dda456f2d6d7abf0de8d"},
+		}))
+		Expect(property(provider, "terraform:registry")).To(Equal("registry.terraform.io"))
+		Expect(property(provider, "terraform:constraints")).To(Equal("~> 5.0"))
+		Expect(property(provider, "terraform:installed_hash")).To(Equal(installedHash()))
+		Expect(property(provider, "terraform:hash_verified")).To(Equal("true"))
+		Expect(result.HashMismatches()).To(BeEmpty())
+	})
+
+	It("flags providers whose installed package does not match the lock file", func() {
+		writeLockFile("h1:c29tZS1vdGhlci1oYXNo")
+
+		result, err := inventory.Build("some-env", sourceDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(property(result.Components[0], "terraform:hash_verified")).To(Equal("false"))
+		Expect(result.HashMismatches()).To(Equal([]string{"registry.terraform.io/hashicorp/aws@5.31.0"}))
+	})
+
+	It("notes providers which are not installed", func() {
+		writeLockFile(installedHash())
+		Expect(os.RemoveAll(packageDir)).To(Succeed())
+
+		result, err := inventory.Build("some-env", sourceDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(property(result.Components[0], "terraform:hash_error")).To(ContainSubstring("provider is not installed"))
+		Expect(result.HashMismatches()).To(BeEmpty())
+	})
+
+	It("lists modules with the commit of those downloaded from git", func() {
+		// the config itself is in a git repo, which must not be reported for local modules
+		writeFile(path.Join(sourceDir, "main.tf"), "")
+		git(sourceDir, "init", "-q")
+		git(sourceDir, "commit", "-q", "--allow-empty", "-m", "config")
+
+		moduleDir := path.Join(sourceDir, ".terraform", "modules", "vpc")
+		writeFile(path.Join(moduleDir, "main.tf"), "")
+		git(moduleDir, "init", "-q")
+		git(moduleDir, "add", ".")
+		git(moduleDir, "commit", "-q", "-m", "module")
+		headOutput, err := exec.Command("git", "-C", moduleDir, "rev-parse", "HEAD").Output()
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile(path.Join(sourceDir, ".terraform", "modules", "modules.json"), `{"Modules":[
+  {"Key":"","Source":"","Dir":"."},
+  {"Key":"vpc","Source":"git::https://example.com/vpc.git?ref=v1.2.0","Dir":".terraform/modules/vpc"},
+  {"Key":"vpc.subnets","Source":"./subnets","Dir":"modules/subnets"}
+]}`)
+
+		result, err := inventory.Build("some-env", sourceDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.Components).To(HaveLen(2))
+		vpc := result.Components[0]
+		Expect(vpc.BOMRef).To(Equal("module.vpc"))
+		Expect(property(vpc, "terraform:source")).To(Equal("git::https://example.com/vpc.git?ref=v1.2.0"))
+		Expect(property(vpc, "terraform:resolved_commit")).To(Equal(string(headOutput[:40])))
+
+		subnets := result.Components[1]
+		Expect(subnets.BOMRef).To(Equal("module.vpc.module.subnets"))
+		Expect(property(subnets, "terraform:resolved_commit")).To(BeEmpty())
+	})
+
+	It("returns an empty inventory for a config without a lock file or modules", func() {
+		result, err := inventory.Build("some-env", sourceDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Components).To(BeEmpty())
+	})
+})
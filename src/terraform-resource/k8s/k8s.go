@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/encoder"
+	"github.com/ljfranklin/terraform-resource/models"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	KeyMappingAnnotation = "terraform-resource/key-mapping"
+
+	maxKeyLength = 253
+)
+
+var invalidKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+type object struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   objectMetadata    `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type objectMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Render converts Terraform outputs into a ConfigMap manifest, followed by a
+// Secret manifest if any of the outputs are listed in `SecretKeys`.
+// Output names which are not valid ConfigMap keys are rewritten and the
+// mapping back to the original names is recorded in an annotation.
+func Render(config models.K8sManifest, outputs map[string]interface{}) ([]byte, error) {
+	if config.Name == "" {
+		return nil, errors.New("Missing required field `output_k8s_manifest.name`")
+	}
+
+	secretKeys := map[string]bool{}
+	for _, key := range config.SecretKeys {
+		secretKeys[key] = true
+	}
+
+	outputNames := []string{}
+	for name := range outputs {
+		outputNames = append(outputNames, name)
+	}
+	sort.Strings(outputNames)
+	keys := sanitizeKeys(outputNames)
+
+	configMap := newObject("ConfigMap", config)
+	secret := newObject("Secret", config)
+	secret.Type = "Opaque"
+	for _, name := range outputNames {
+		value, err := stringValue(outputs[name])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert output '%s': %s", name, err)
+		}
+
+		target := configMap
+		if secretKeys[name] {
+			target = secret
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		target.Data[keys[name]] = value
+		if keys[name] != name {
+			target.Metadata.Annotations[keys[name]] = name
+		}
+	}
+
+	var manifest bytes.Buffer
+	documents := []*object{configMap}
+	if len(secret.Data) > 0 {
+		documents = append(documents, secret)
+	}
+	for _, doc := range documents {
+		if err := doc.encodeKeyMapping(); err != nil {
+			return nil, err
+		}
+		contents, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest.WriteString("---\n")
+		manifest.Write(contents)
+	}
+
+	return manifest.Bytes(), nil
+}
+
+func newObject(kind string, config models.K8sManifest) *object {
+	return &object{
+		APIVersion: "v1",
+		Kind:       kind,
+		Metadata: objectMetadata{
+			Name:        config.Name,
+			Namespace:   config.Namespace,
+			Annotations: map[string]string{},
+		},
+		Data: map[string]string{},
+	}
+}
+
+// The annotations map holds sanitized key -> output name pairs while the
+// object is being built, this collapses them into a single JSON annotation.
+func (o *object) encodeKeyMapping() error {
+	if len(o.Metadata.Annotations) == 0 {
+		o.Metadata.Annotations = nil
+		return nil
+	}
+
+	mapping, err := json.Marshal(o.Metadata.Annotations)
+	if err != nil {
+		return err
+	}
+	o.Metadata.Annotations = map[string]string{
+		KeyMappingAnnotation: string(mapping),
+	}
+	return nil
+}
+
+// ConfigMap and Secret keys must match [-._a-zA-Z0-9]+. The output names are
+// expected to be sorted so that clashing names always get the same suffix.
+func sanitizeKeys(outputNames []string) map[string]string {
+	keys := map[string]string{}
+	used := map[string]bool{}
+	for _, name := range outputNames {
+		used[name] = !invalidKeyChars.MatchString(name)
+	}
+
+	for _, name := range outputNames {
+		if !invalidKeyChars.MatchString(name) && len(name) <= maxKeyLength {
+			keys[name] = name
+			continue
+		}
+
+		base := invalidKeyChars.ReplaceAllString(name, "_")
+		if len(base) > maxKeyLength {
+			base = base[:maxKeyLength]
+		}
+		key := base
+		for i := 2; used[key]; i++ {
+			suffix := fmt.Sprintf("_%d", i)
+			if len(base)+len(suffix) > maxKeyLength {
+				key = base[:maxKeyLength-len(suffix)] + suffix
+			} else {
+				key = base + suffix
+			}
+		}
+		used[key] = true
+		keys[name] = key
+	}
+
+	return keys
+}
+
+func stringValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	var contents bytes.Buffer
+	if err := encoder.NewJSONEncoder(&contents).Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(contents.String(), "\n"), nil
+}
@@ -0,0 +1,134 @@
+package k8s_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/k8s"
+	"github.com/ljfranklin/terraform-resource/models"
+	yaml "gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type manifestObject struct {
+	Kind     string `yaml:"kind"`
+	Type     string `yaml:"type"`
+	Metadata struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+	Data map[string]string `yaml:"data"`
+}
+
+var _ = Describe("K8s", func() {
+
+	Describe("#Render", func() {
+
+		var (
+			config  models.K8sManifest
+			outputs map[string]interface{}
+		)
+
+		BeforeEach(func() {
+			config = models.K8sManifest{
+				Name:      "infra-outputs",
+				Namespace: "platform",
+			}
+			outputs = map[string]interface{}{
+				"vpc_id":      "vpc-123456",
+				"db_password": "super-secret",
+				"port":        float64(5432),
+				"list":        []interface{}{"item-1", "item-2"},
+			}
+		})
+
+		It("renders all outputs into a ConfigMap", func() {
+			manifest, err := k8s.Render(config, outputs)
+			Expect(err).ToNot(HaveOccurred())
+
+			objects := parseManifest(manifest)
+			Expect(objects).To(HaveLen(1))
+			Expect(objects[0].Kind).To(Equal("ConfigMap"))
+			Expect(objects[0].Metadata.Name).To(Equal("infra-outputs"))
+			Expect(objects[0].Metadata.Namespace).To(Equal("platform"))
+			Expect(objects[0].Metadata.Annotations).To(BeEmpty())
+			Expect(objects[0].Data).To(Equal(map[string]string{
+				"vpc_id":      "vpc-123456",
+				"db_password": "super-secret",
+				"port":        "5432",
+				"list":        `["item-1","item-2"]`,
+			}))
+		})
+
+		It("moves secret keys into a base64 encoded Secret", func() {
+			config.SecretKeys = []string{"db_password"}
+
+			manifest, err := k8s.Render(config, outputs)
+			Expect(err).ToNot(HaveOccurred())
+
+			objects := parseManifest(manifest)
+			Expect(objects).To(HaveLen(2))
+			Expect(objects[0].Data).ToNot(HaveKey("db_password"))
+
+			Expect(objects[1].Kind).To(Equal("Secret"))
+			Expect(objects[1].Type).To(Equal("Opaque"))
+			Expect(objects[1].Metadata.Name).To(Equal("infra-outputs"))
+			Expect(objects[1].Metadata.Namespace).To(Equal("platform"))
+			Expect(objects[1].Data).To(HaveLen(1))
+
+			decoded, err := base64.StdEncoding.DecodeString(objects[1].Data["db_password"])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decoded)).To(Equal("super-secret"))
+		})
+
+		It("sanitizes invalid keys and records the mapping in an annotation", func() {
+			outputs = map[string]interface{}{
+				"module:vpc/id": "vpc-1",
+				"module vpc/id": "vpc-2",
+				"module_vpc_id": "vpc-3",
+			}
+
+			manifest, err := k8s.Render(config, outputs)
+			Expect(err).ToNot(HaveOccurred())
+
+			objects := parseManifest(manifest)
+			Expect(objects[0].Data).To(Equal(map[string]string{
+				"module_vpc_id":   "vpc-3",
+				"module_vpc_id_2": "vpc-2",
+				"module_vpc_id_3": "vpc-1",
+			}))
+
+			mapping := map[string]string{}
+			err = json.Unmarshal([]byte(objects[0].Metadata.Annotations[k8s.KeyMappingAnnotation]), &mapping)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mapping).To(Equal(map[string]string{
+				"module_vpc_id_2": "module vpc/id",
+				"module_vpc_id_3": "module:vpc/id",
+			}))
+		})
+
+		It("returns an error if name is missing", func() {
+			config.Name = ""
+
+			_, err := k8s.Render(config, outputs)
+			Expect(err).To(MatchError(ContainSubstring("output_k8s_manifest.name")))
+		})
+	})
+})
+
+func parseManifest(manifest []byte) []manifestObject {
+	objects := []manifestObject{}
+	for _, doc := range strings.Split(string(manifest), "---\n") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var obj manifestObject
+		Expect(yaml.Unmarshal([]byte(doc), &obj)).To(Succeed())
+		objects = append(objects, obj)
+	}
+	return objects
+}
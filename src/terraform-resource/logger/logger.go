@@ -1,74 +1,199 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 )
 
+// Logger writes coloured messages to Sink by default. Set Handler, e.g. via
+// NewJSONLogger, to send messages to any slog.Handler instead.
 type Logger struct {
-	Sink           io.Writer
-	sectionColor   color
+	Sink    io.Writer
+	Handler slog.Handler // optional
+
+	sectionLevel   slog.Level
 	sectionMessage string
 }
 
-type color int
+// slog has no success level, place it between info and warn
+const LevelSuccess = slog.LevelInfo + 2
 
-var err color = 31     // red
-var success color = 32 // green
-var warn color = 33    // yellow
-var info color = 34    // blue
+const (
+	sectionKey      = "section"
+	sectionNameKey  = "name"
+	sectionEventKey = "event"
+
+	sectionStart = "start"
+	sectionEnd   = "end"
+)
+
+// NewJSONLogger writes a JSON object per line with `level`, `message`,
+// `timestamp` and, inside a section, `section` fields for log aggregators
+func NewJSONLogger(sink io.Writer) Logger {
+	return Logger{
+		Sink: sink,
+		Handler: slog.NewJSONHandler(sink, &slog.HandlerOptions{
+			ReplaceAttr: replaceJSONAttr,
+		}),
+	}
+}
+
+// New returns a JSON logger if structured, otherwise a coloured one, see
+// `source.structured_logging`
+func New(sink io.Writer, structured bool) Logger {
+	if structured {
+		return NewJSONLogger(sink)
+	}
+	return Logger{Sink: sink}
+}
 
 func (l Logger) Info(message string) {
-	l.logWithColor(message, info)
+	l.log(slog.LevelInfo, message)
 }
 
 func (l Logger) Success(message string) {
-	l.logWithColor(message, success)
+	l.log(LevelSuccess, message)
 }
 
 func (l Logger) Warn(message string) {
-	l.logWithColor(message, warn)
+	l.log(slog.LevelWarn, message)
 }
 
 func (l Logger) Error(message string) {
-	l.logWithColor(message, err)
+	l.log(slog.LevelError, message)
 }
 
 func (l *Logger) InfoSection(message string) {
-	l.sectionMessage = message
-	l.sectionColor = info
-	l.startSection()
+	l.startSection(slog.LevelInfo, message)
 }
 
 func (l *Logger) SuccessSection(message string) {
-	l.sectionMessage = message
-	l.sectionColor = success
-	l.startSection()
+	l.startSection(LevelSuccess, message)
 }
 
 func (l *Logger) WarnSection(message string) {
-	l.sectionMessage = message
-	l.sectionColor = warn
-	l.startSection()
+	l.startSection(slog.LevelWarn, message)
 }
 
 func (l *Logger) ErrorSection(message string) {
+	l.startSection(slog.LevelError, message)
+}
+
+func (l *Logger) EndSection() {
+	l.log(l.sectionLevel, l.sectionMessage, sectionAttr(l.sectionMessage, sectionEnd))
+	l.sectionLevel = 0
+	l.sectionMessage = ""
+}
+
+func (l *Logger) startSection(level slog.Level, message string) {
 	l.sectionMessage = message
-	l.sectionColor = err
-	l.startSection()
+	l.sectionLevel = level
+	l.log(level, message, sectionAttr(message, sectionStart))
 }
 
-func (l Logger) logWithColor(message string, c color) {
-	coloredMessage := fmt.Sprintf("\033[%dm%s\033[0m\n", c, message)
-	l.Sink.Write([]byte(coloredMessage))
+// messages logged inside a section are grouped under the section name
+func (l Logger) log(level slog.Level, message string, attrs ...slog.Attr) {
+	if l.sectionMessage != "" && len(attrs) == 0 {
+		attrs = append(attrs, sectionAttr(l.sectionMessage, ""))
+	}
+	slog.New(l.handler()).LogAttrs(context.Background(), level, message, attrs...)
 }
 
-func (l *Logger) startSection() {
-	l.logWithColor(fmt.Sprintf("▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ %s ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼", l.sectionMessage), l.sectionColor)
+func (l Logger) handler() slog.Handler {
+	if l.Handler != nil {
+		return l.Handler
+	}
+	return colorHandler{sink: l.Sink}
 }
 
-func (l *Logger) EndSection() {
-	l.logWithColor(fmt.Sprintf("▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ %s ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲", l.sectionMessage), l.sectionColor)
-	l.sectionColor = 0
-	l.sectionMessage = ""
+func sectionAttr(name string, event string) slog.Attr {
+	attrs := []any{slog.String(sectionNameKey, name)}
+	if event != "" {
+		attrs = append(attrs, slog.String(sectionEventKey, event))
+	}
+	return slog.Group(sectionKey, attrs...)
+}
+
+func replaceJSONAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+	switch attr.Key {
+	case slog.LevelKey:
+		if level, ok := attr.Value.Any().(slog.Level); ok && level == LevelSuccess {
+			attr.Value = slog.StringValue("SUCCESS")
+		}
+	case slog.MessageKey:
+		attr.Key = "message"
+	case slog.TimeKey:
+		attr.Key = "timestamp"
+	}
+	return attr
+}
+
+type color int
+
+var err color = 31     // red
+var success color = 32 // green
+var warn color = 33    // yellow
+var info color = 34    // blue
+
+// colorHandler preserves the original human-readable output shown in the
+// Concourse UI, rendering section starts and ends as banners.
+type colorHandler struct {
+	sink io.Writer
+}
+
+func (h colorHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h colorHandler) Handle(_ context.Context, record slog.Record) error {
+	message := record.Message
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key != sectionKey {
+			return true
+		}
+		for _, sectionAttr := range attr.Value.Group() {
+			if sectionAttr.Key != sectionEventKey {
+				continue
+			}
+			switch sectionAttr.Value.String() {
+			case sectionStart:
+				message = fmt.Sprintf("▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ %s ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼", record.Message)
+			case sectionEnd:
+				message = fmt.Sprintf("▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ %s ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲", record.Message)
+			}
+		}
+		return false
+	})
+
+	coloredMessage := fmt.Sprintf("\033[%dm%s\033[0m\n", levelColor(record.Level), message)
+	_, err := h.sink.Write([]byte(coloredMessage))
+	return err
+}
+
+func (h colorHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h colorHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func levelColor(level slog.Level) color {
+	switch {
+	case level >= slog.LevelError:
+		return err
+	case level >= slog.LevelWarn:
+		return warn
+	case level >= LevelSuccess:
+		return success
+	case level >= slog.LevelInfo:
+		return info
+	default:
+		return 0
+	}
 }
@@ -0,0 +1,133 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var sink *bytes.Buffer
+
+	BeforeEach(func() {
+		sink = &bytes.Buffer{}
+	})
+
+	Context("by default", func() {
+		It("writes coloured messages to the sink", func() {
+			l := logger.Logger{Sink: sink}
+
+			l.Info("some-info")
+			l.Success("some-success")
+			l.Warn("some-warning")
+			l.Error("some-error")
+
+			Expect(sink.String()).To(Equal(
+				"\033[34msome-info\033[0m\n" +
+					"\033[32msome-success\033[0m\n" +
+					"\033[33msome-warning\033[0m\n" +
+					"\033[31msome-error\033[0m\n",
+			))
+		})
+
+		It("writes banners at the start and end of a section", func() {
+			l := logger.Logger{Sink: sink}
+
+			l.WarnSection("some-section")
+			l.Info("inside")
+			l.EndSection()
+
+			Expect(sink.String()).To(Equal(
+				"\033[33m▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ some-section ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼ ▼\033[0m\n" +
+					"\033[34minside\033[0m\n" +
+					"\033[33m▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ some-section ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲ ▲\033[0m\n",
+			))
+		})
+	})
+
+	Context("New", func() {
+		It("returns a coloured logger by default", func() {
+			logger.New(sink, false).Info("some-info")
+
+			Expect(sink.String()).To(Equal("\033[34msome-info\033[0m\n"))
+		})
+
+		It("returns a JSON logger if structured", func() {
+			logger.New(sink, true).Info("some-info")
+
+			record := map[string]interface{}{}
+			Expect(json.Unmarshal(sink.Bytes(), &record)).To(Succeed())
+			Expect(record).To(HaveKeyWithValue("message", "some-info"))
+		})
+	})
+
+	Context("NewJSONLogger", func() {
+		decodeLines := func() []map[string]interface{} {
+			records := []map[string]interface{}{}
+			for _, line := range strings.Split(strings.TrimSpace(sink.String()), "\n") {
+				record := map[string]interface{}{}
+				Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+				records = append(records, record)
+			}
+			return records
+		}
+
+		It("writes a JSON record per message", func() {
+			l := logger.NewJSONLogger(sink)
+
+			l.Success("some-success")
+			l.Error("some-error")
+
+			records := decodeLines()
+			Expect(records).To(HaveLen(2))
+			Expect(records[0]).To(HaveKeyWithValue("level", "SUCCESS"))
+			Expect(records[0]).To(HaveKeyWithValue("message", "some-success"))
+			Expect(records[0]).To(HaveKey("timestamp"))
+			Expect(records[1]).To(HaveKeyWithValue("level", "ERROR"))
+			Expect(records[1]).To(HaveKeyWithValue("message", "some-error"))
+		})
+
+		It("writes a JSON record for every kind of section", func() {
+			l := logger.NewJSONLogger(sink)
+
+			l.InfoSection("some-info")
+			l.EndSection()
+			l.SuccessSection("some-success")
+			l.EndSection()
+			l.WarnSection("some-warning")
+			l.EndSection()
+			l.ErrorSection("some-error")
+			l.EndSection()
+
+			records := decodeLines()
+			Expect(records).To(HaveLen(8))
+			for i, level := range []string{"INFO", "SUCCESS", "WARN", "ERROR"} {
+				Expect(records[2*i]).To(HaveKeyWithValue("level", level))
+				Expect(records[2*i]["section"]).To(HaveKeyWithValue("event", "start"))
+				Expect(records[2*i+1]).To(HaveKeyWithValue("level", level))
+				Expect(records[2*i+1]["section"]).To(HaveKeyWithValue("event", "end"))
+			}
+		})
+
+		It("groups messages inside a section", func() {
+			l := logger.NewJSONLogger(sink)
+
+			l.InfoSection("some-section")
+			l.Info("inside")
+			l.EndSection()
+			l.Info("outside")
+
+			records := decodeLines()
+			Expect(records).To(HaveLen(4))
+			Expect(records[0]["section"]).To(Equal(map[string]interface{}{"name": "some-section", "event": "start"}))
+			Expect(records[1]["section"]).To(Equal(map[string]interface{}{"name": "some-section"}))
+			Expect(records[2]["section"]).To(Equal(map[string]interface{}{"name": "some-section", "event": "end"}))
+			Expect(records[3]).ToNot(HaveKey("section"))
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const GCSBackendType = "gcs"
+
+// GCSBackendCredentials is `gcs_credentials`, how terraform authenticates to
+// the `gcs` backend. Without a key, the ambient credentials are used, e.g.
+// GKE workload identity, optionally to impersonate a service account.
+type GCSBackendCredentials struct {
+	ServiceAccountJSON        string `json:"service_account_json,omitempty"`        // optional
+	ImpersonateServiceAccount string `json:"impersonate_service_account,omitempty"` // optional
+}
+
+func (c GCSBackendCredentials) Validate() error {
+	if c.ServiceAccountJSON == "" && c.ImpersonateServiceAccount == "" {
+		return errors.New("`gcs_credentials` requires `service_account_json`, `impersonate_service_account`, or both")
+	}
+	if c.ServiceAccountJSON != "" {
+		key := map[string]interface{}{}
+		// the key itself is never included in errors
+		if err := json.Unmarshal([]byte(c.ServiceAccountJSON), &key); err != nil {
+			return errors.New("`gcs_credentials.service_account_json` must be a JSON service account key")
+		}
+	}
+	return nil
+}
+
+// WithGCSCredentials writes `gcs_credentials.service_account_json` to a file
+// in dir and points GOOGLE_APPLICATION_CREDENTIALS at it, so terraform init
+// and every later command can read the `gcs` backend. The file is removed
+// along with dir. Impersonation is set with the backend-only variable so
+// providers keep their own credentials.
+func (m Terraform) WithGCSCredentials(dir string) (Terraform, error) {
+	if m.GCSCredentials == nil || m.BackendType != GCSBackendType {
+		return m, nil
+	}
+
+	env := map[string]string{}
+	for key, value := range m.Env {
+		env[key] = value
+	}
+
+	if m.GCSCredentials.ServiceAccountJSON != "" {
+		keyFile, err := ioutil.TempFile(dir, "gcs-credentials-*.json")
+		if err != nil {
+			return Terraform{}, fmt.Errorf("Failed to create file for `gcs_credentials`: %s", err)
+		}
+		_, err = keyFile.WriteString(m.GCSCredentials.ServiceAccountJSON)
+		if closeErr := keyFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(keyFile.Name())
+			return Terraform{}, fmt.Errorf("Failed to write `gcs_credentials`: %s", err)
+		}
+		env["GOOGLE_APPLICATION_CREDENTIALS"] = keyFile.Name()
+	}
+
+	if m.GCSCredentials.ImpersonateServiceAccount != "" {
+		env["GOOGLE_BACKEND_IMPERSONATE_SERVICE_ACCOUNT"] = m.GCSCredentials.ImpersonateServiceAccount
+	}
+
+	m.Env = env
+	return m, nil
+}
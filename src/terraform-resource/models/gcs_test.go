@@ -0,0 +1,125 @@
+package models_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/ljfranklin/terraform-resource/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GCSBackendCredentials", func() {
+	var (
+		tmpDir string
+		model  models.Terraform
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-gcs-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		model = models.Terraform{
+			Source:      "fake-source",
+			BackendType: models.GCSBackendType,
+			BackendConfig: map[string]interface{}{
+				"bucket": "fake-bucket",
+			},
+			Env: map[string]string{
+				"SOME_VAR": "some-value",
+			},
+		}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Validate", func() {
+		It("accepts a service account key", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ServiceAccountJSON: `{"type": "service_account"}`,
+			}
+			Expect(model.Validate()).To(Succeed())
+		})
+
+		It("accepts impersonation alone, e.g. with workload identity", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ImpersonateServiceAccount: "terraform@fake-project.iam.gserviceaccount.com",
+			}
+			Expect(model.Validate()).To(Succeed())
+		})
+
+		It("returns error if neither field is set", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("`gcs_credentials` requires")))
+		})
+
+		It("returns error without revealing an invalid key", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ServiceAccountJSON: "not-json-secret",
+			}
+			err := model.Validate()
+			Expect(err).To(MatchError("`gcs_credentials.service_account_json` must be a JSON service account key"))
+			Expect(err.Error()).ToNot(ContainSubstring("not-json-secret"))
+		})
+
+		It("returns error if the backend isn't gcs", func() {
+			model.BackendType = "s3"
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ServiceAccountJSON: `{"type": "service_account"}`,
+			}
+			Expect(model.Validate()).To(MatchError("`gcs_credentials` can only be used with `backend_type: gcs`"))
+		})
+	})
+
+	Describe("#WithGCSCredentials", func() {
+		It("writes the key to a file and sets GOOGLE_APPLICATION_CREDENTIALS", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ServiceAccountJSON: `{"type": "service_account"}`,
+			}
+
+			withCredentials, err := model.WithGCSCredentials(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			keyPath := withCredentials.Env["GOOGLE_APPLICATION_CREDENTIALS"]
+			Expect(keyPath).To(HavePrefix(tmpDir))
+			contents, err := ioutil.ReadFile(keyPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(`{"type": "service_account"}`))
+
+			info, err := os.Stat(keyPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			Expect(withCredentials.Env["SOME_VAR"]).To(Equal("some-value"))
+			Expect(withCredentials.Env).ToNot(HaveKey("GOOGLE_BACKEND_IMPERSONATE_SERVICE_ACCOUNT"))
+			Expect(model.Env).ToNot(HaveKey("GOOGLE_APPLICATION_CREDENTIALS"))
+		})
+
+		It("sets the backend impersonation variable", func() {
+			model.GCSCredentials = &models.GCSBackendCredentials{
+				ImpersonateServiceAccount: "terraform@fake-project.iam.gserviceaccount.com",
+			}
+
+			withCredentials, err := model.WithGCSCredentials(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(withCredentials.Env).To(Equal(map[string]string{
+				"SOME_VAR": "some-value",
+				"GOOGLE_BACKEND_IMPERSONATE_SERVICE_ACCOUNT": "terraform@fake-project.iam.gserviceaccount.com",
+			}))
+		})
+
+		It("leaves the env unchanged without `gcs_credentials`", func() {
+			withCredentials, err := model.WithGCSCredentials(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(withCredentials.Env).To(Equal(model.Env))
+
+			files, err := ioutil.ReadDir(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+	})
+})
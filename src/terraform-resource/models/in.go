@@ -1,5 +1,12 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
 type InRequest struct {
 	Source  Source   `json:"source"`
 	Version Version  `json:"version,omitempty"` // absent on initial request
@@ -12,8 +19,49 @@ type InResponse struct {
 }
 
 type InParams struct {
-	Action             string `json:"action,omitempty"`           // optional
-	OutputStatefile    bool   `json:"output_statefile,omitempty"` // optional
-	OutputJSONPlanfile bool   `json:"output_planfile,omitempty"`  // optional
+	Action             string       `json:"action,omitempty"`                // optional
+	OutputStatefile    bool         `json:"output_statefile,omitempty"`      // optional
+	OutputJSONPlanfile bool         `json:"output_planfile,omitempty"`       // optional
+	OutputK8sManifest  *K8sManifest `json:"output_k8s_manifest,omitempty"`   // optional
+	TypedMetadata      bool         `json:"typed_metadata,omitempty"`        // optional
+	OutputAsEnvFile    bool         `json:"output_as_env_file,omitempty"`    // optional
+	OutputDocs         bool         `json:"output_docs,omitempty"`           // optional
+	OutputInventory    bool         `json:"output_inventory,omitempty"`      // optional
+	FailOnOutputErrors bool         `json:"fail_on_output_errors,omitempty"` // optional
+	ReadOnly           bool         `json:"read_only,omitempty"`             // optional
+	OutputPrefix       string       `json:"output_prefix,omitempty"`         // optional
+	EnvName            string       `json:"env_name,omitempty"`              // optional
+	EnvNameFile        string       `json:"env_name_file,omitempty"`         // optional
 	Terraform
 }
+
+func (p InParams) Validate() error {
+	if p.EnvName != "" && p.EnvNameFile != "" {
+		return errors.New("Cannot specify both `env_name` and `env_name_file` in `get` params.")
+	}
+	return nil
+}
+
+// TargetEnvName is the workspace named by `env_name` or `env_name_file`,
+// which overrides the version's `env_name`, or empty if neither is set
+func (p InParams) TargetEnvName() (string, error) {
+	if p.EnvNameFile == "" {
+		return strings.TrimSpace(p.EnvName), nil
+	}
+
+	contents, err := ioutil.ReadFile(p.EnvNameFile)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read `env_name_file`: %s", err)
+	}
+	envName := strings.TrimSpace(string(contents))
+	if envName == "" {
+		return "", fmt.Errorf("The `env_name_file` '%s' is empty", p.EnvNameFile)
+	}
+	return envName, nil
+}
+
+type K8sManifest struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace,omitempty"`   // optional
+	SecretKeys []string `json:"secret_keys,omitempty"` // optional
+}
@@ -0,0 +1,67 @@
+package models_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ljfranklin/terraform-resource/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InParams Model", func() {
+
+	Describe("#Validate", func() {
+		It("allows either `env_name` or `env_name_file`", func() {
+			Expect(models.InParams{EnvName: "some-env"}.Validate()).To(Succeed())
+			Expect(models.InParams{EnvNameFile: "some-file"}.Validate()).To(Succeed())
+		})
+
+		It("returns error if both `env_name` and `env_name_file` are set", func() {
+			params := models.InParams{
+				EnvName:     "some-env",
+				EnvNameFile: "some-file",
+			}
+			Expect(params.Validate()).To(MatchError("Cannot specify both `env_name` and `env_name_file` in `get` params."))
+		})
+	})
+
+	Describe("#TargetEnvName", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-in-params-test")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("returns empty if neither `env_name` nor `env_name_file` is set", func() {
+			Expect(models.InParams{}.TargetEnvName()).To(BeEmpty())
+		})
+
+		It("returns `env_name`", func() {
+			Expect(models.InParams{EnvName: "some-env"}.TargetEnvName()).To(Equal("some-env"))
+		})
+
+		It("returns the trimmed contents of `env_name_file`", func() {
+			nameFile := path.Join(tmpDir, "name")
+			Expect(ioutil.WriteFile(nameFile, []byte("some-env\n"), 0644)).To(Succeed())
+
+			Expect(models.InParams{EnvNameFile: nameFile}.TargetEnvName()).To(Equal("some-env"))
+		})
+
+		It("returns error if `env_name_file` is empty", func() {
+			nameFile := path.Join(tmpDir, "name")
+			Expect(ioutil.WriteFile(nameFile, []byte("\n"), 0644)).To(Succeed())
+
+			_, err := models.InParams{EnvNameFile: nameFile}.TargetEnvName()
+			Expect(err).To(MatchError(ContainSubstring("is empty")))
+		})
+	})
+})
@@ -2,7 +2,39 @@ package models
 
 type Metadata []MetadataField
 
+// WithPrefix returns a copy with each Name prefixed, see `output_prefix`
+func (m Metadata) WithPrefix(prefix string) Metadata {
+	if prefix == "" {
+		return m
+	}
+	prefixed := make(Metadata, 0, len(m))
+	for _, field := range m {
+		field.Name = PrefixedName(prefix, field.Name)
+		prefixed = append(prefixed, field)
+	}
+	return prefixed
+}
+
+// PrefixedName returns `<prefix>_<name>`, or name for an empty prefix, so
+// the outputs of several puts can share a directory without colliding
+func PrefixedName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "_" + name
+}
+
 type MetadataField struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
+	Type  string `json:"type,omitempty"` // only set for `typed_metadata`
 }
+
+const (
+	MetadataTypeString = "string"
+	MetadataTypeNumber = "number"
+	MetadataTypeBool   = "bool"
+	MetadataTypeList   = "list"
+	MetadataTypeMap    = "map"
+	MetadataTypeNull   = "null"
+)
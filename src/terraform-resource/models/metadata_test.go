@@ -0,0 +1,31 @@
+package models_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+
+	Describe("#WithPrefix", func() {
+		It("prefixes every name without modifying the original", func() {
+			metadata := models.Metadata{
+				{Name: "vpc_id", Value: "vpc-123"},
+				{Name: "terraform_version", Value: "Terraform v1.5.7"},
+			}
+
+			Expect(metadata.WithPrefix("prod")).To(Equal(models.Metadata{
+				{Name: "prod_vpc_id", Value: "vpc-123"},
+				{Name: "prod_terraform_version", Value: "Terraform v1.5.7"},
+			}))
+			Expect(metadata[0].Name).To(Equal("vpc_id"))
+		})
+
+		It("returns the metadata unchanged without a prefix", func() {
+			metadata := models.Metadata{{Name: "vpc_id", Value: "vpc-123"}}
+			Expect(metadata.WithPrefix("")).To(Equal(metadata))
+		})
+	})
+})
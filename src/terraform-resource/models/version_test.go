@@ -82,4 +82,72 @@ var _ = Describe("Version", func() {
 			Expect(model.LastModifiedTime().Unix()).To(Equal(now.Unix()))
 		})
 	})
+
+	Describe("#IsLegacy", func() {
+		It("returns true for versions identified by LastModified", func() {
+			model := models.Version{
+				LastModified: "2006-01-02T15:04:05Z",
+				EnvName:      "fake-env",
+			}
+			Expect(model.IsLegacy()).To(BeTrue())
+		})
+
+		It("returns true for legacy versions which also carry the statefile serial", func() {
+			model := models.Version{
+				LastModified: "2006-01-02T15:04:05Z",
+				EnvName:      "fake-env",
+				Serial:       "3",
+			}
+			Expect(model.IsLegacy()).To(BeTrue())
+		})
+
+		It("returns false for versions identified by serial", func() {
+			model := models.Version{
+				Serial:  "1",
+				EnvName: "fake-env",
+			}
+			Expect(model.IsLegacy()).To(BeFalse())
+		})
+	})
+
+	Describe("#WithStateSerial", func() {
+		It("sets the serial from the statefile", func() {
+			model := models.Version{EnvName: "fake-env"}.WithStateSerial([]byte(`{"version": 3, "serial": 12, "modules": []}`))
+			Expect(model.Serial).To(Equal("12"))
+			Expect(model.EnvName).To(Equal("fake-env"))
+		})
+
+		It("leaves the version unchanged for a statefile without a serial", func() {
+			model := models.Version{EnvName: "fake-env"}
+			Expect(model.WithStateSerial([]byte(`not-json`))).To(Equal(model))
+			Expect(model.WithStateSerial([]byte(`{"version": 4}`))).To(Equal(model))
+		})
+	})
+
+	Describe("#Compare", func() {
+		It("orders by serial first", func() {
+			older := models.Version{Serial: "9", ConfigHash: "bbb"}
+			newer := models.Version{Serial: "10", ConfigHash: "aaa"}
+
+			Expect(older.Compare(newer)).To(Equal(-1))
+			Expect(newer.Compare(older)).To(Equal(1))
+		})
+
+		It("uses the config hash as a tie-breaker", func() {
+			version := models.Version{Serial: "1", ConfigHash: "aaa"}
+			otherVersion := models.Version{Serial: "1", ConfigHash: "bbb"}
+
+			Expect(version.Compare(otherVersion)).To(Equal(-1))
+			Expect(version.Compare(version)).To(Equal(0))
+		})
+
+		It("compares versions without a config hash", func() {
+			oldVersion := models.Version{Serial: "1", EnvName: "fake-env"}
+			newVersion := models.Version{Serial: "1", EnvName: "fake-env", ConfigHash: "aaa"}
+
+			Expect(oldVersion.Validate()).To(Succeed())
+			Expect(oldVersion.Compare(oldVersion)).To(Equal(0))
+			Expect(oldVersion.Compare(newVersion)).To(Equal(-1))
+		})
+	})
 })
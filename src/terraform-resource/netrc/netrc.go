@@ -0,0 +1,107 @@
+package netrc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Entry is a `machine` in a netrc file, used by terraform to authenticate
+// module downloads over HTTPS
+type Entry struct {
+	Machine  string `json:"machine"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// String omits the password so an Entry is safe to log
+func (e Entry) String() string {
+	return fmt.Sprintf("machine %s login %s", e.Machine, e.Login)
+}
+
+// Validate checks each entry is complete and can be written as netrc tokens,
+// which are separated by whitespace
+func Validate(entries []Entry) error {
+	for i, entry := range entries {
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{"machine", entry.Machine},
+			{"login", entry.Login},
+			{"password", entry.Password},
+		}
+		for _, field := range fields {
+			if field.value == "" {
+				return fmt.Errorf("Must specify `netrc[%d].%s`.", i, field.name)
+			}
+			if strings.ContainsAny(field.value, " \t\r\n") {
+				// the password itself is never included in errors
+				return fmt.Errorf("`netrc[%d].%s` must not contain whitespace.", i, field.name)
+			}
+		}
+	}
+	return nil
+}
+
+// Write creates a netrc file in dir with the entries followed by the contents
+// of the existing netrc file, if any, so the configured entries take
+// precedence for the same machine. It returns an empty path if there are no
+// entries.
+func Write(entries []Entry, dir string) (string, error) {
+	if len(entries) == 0 {
+		return "", nil
+	}
+
+	contents := bytes.Buffer{}
+	for _, entry := range entries {
+		fmt.Fprintf(&contents, "machine %s\n  login %s\n  password %s\n", entry.Machine, entry.Login, entry.Password)
+	}
+	existing, err := readExisting()
+	if err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		contents.WriteString("\n")
+		contents.Write(existing)
+	}
+
+	netrcFile, err := ioutil.TempFile(dir, "netrc-*")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create netrc file: %s", err)
+	}
+	defer netrcFile.Close()
+	if err = netrcFile.Chmod(0600); err != nil {
+		os.Remove(netrcFile.Name())
+		return "", fmt.Errorf("Failed to create netrc file: %s", err)
+	}
+	if _, err = netrcFile.Write(contents.Bytes()); err != nil {
+		os.Remove(netrcFile.Name())
+		return "", fmt.Errorf("Failed to write netrc file: %s", err)
+	}
+	return netrcFile.Name(), nil
+}
+
+// readExisting returns the netrc file terraform would otherwise use, from
+// NETRC or the home directory
+func readExisting() ([]byte, error) {
+	existingPath := os.Getenv("NETRC")
+	if existingPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		existingPath = filepath.Join(home, ".netrc")
+	}
+	contents, err := ioutil.ReadFile(existingPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read existing netrc file '%s': %s", existingPath, err)
+	}
+	return contents, nil
+}
@@ -0,0 +1,13 @@
+package netrc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNetrc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Netrc Suite")
+}
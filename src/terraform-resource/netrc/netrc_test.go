@@ -0,0 +1,119 @@
+package netrc_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ljfranklin/terraform-resource/netrc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Netrc", func() {
+
+	var (
+		tmpDir       string
+		originalHome string
+		entries      []netrc.Entry
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-netrc-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		// isolate the tests from any netrc on the machine running them
+		originalHome = os.Getenv("HOME")
+		Expect(os.Setenv("HOME", tmpDir)).To(Succeed())
+		Expect(os.Unsetenv("NETRC")).To(Succeed())
+
+		entries = []netrc.Entry{
+			{Machine: "artifacts.example.com", Login: "ci", Password: "super-secret"},
+			{Machine: "modules.example.com", Login: "deploy", Password: "other-secret"},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.Setenv("HOME", originalHome)).To(Succeed())
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Validate", func() {
+		It("accepts complete entries", func() {
+			Expect(netrc.Validate(entries)).To(Succeed())
+		})
+
+		It("requires each field", func() {
+			entries[1].Login = ""
+			Expect(netrc.Validate(entries)).To(MatchError("Must specify `netrc[1].login`."))
+		})
+
+		It("rejects whitespace without revealing the password", func() {
+			entries[0].Password = "super secret"
+
+			err := netrc.Validate(entries)
+			Expect(err).To(MatchError("`netrc[0].password` must not contain whitespace."))
+			Expect(err.Error()).ToNot(ContainSubstring("super"))
+		})
+	})
+
+	Describe("#Write", func() {
+		It("returns an empty path if there are no entries", func() {
+			netrcPath, err := netrc.Write(nil, tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(netrcPath).To(BeEmpty())
+		})
+
+		It("writes each entry to a file only readable by the owner", func() {
+			netrcPath, err := netrc.Write(entries, tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(netrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(
+				"machine artifacts.example.com\n  login ci\n  password super-secret\n" +
+					"machine modules.example.com\n  login deploy\n  password other-secret\n",
+			))
+
+			fileInfo, err := os.Stat(netrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("merges with the existing netrc in HOME", func() {
+			existing := "machine github.com login octocat password gh-token\n"
+			Expect(ioutil.WriteFile(path.Join(tmpDir, ".netrc"), []byte(existing), 0600)).To(Succeed())
+
+			netrcPath, err := netrc.Write(entries[:1], tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(netrcPath).ToNot(Equal(path.Join(tmpDir, ".netrc")))
+
+			contents, err := ioutil.ReadFile(netrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(
+				"machine artifacts.example.com\n  login ci\n  password super-secret\n\n" + existing,
+			))
+		})
+
+		It("merges with the netrc given by NETRC", func() {
+			existingPath := path.Join(tmpDir, "custom-netrc")
+			Expect(ioutil.WriteFile(existingPath, []byte("machine github.com login octocat password gh-token\n"), 0600)).To(Succeed())
+			Expect(os.Setenv("NETRC", existingPath)).To(Succeed())
+			defer os.Unsetenv("NETRC")
+
+			netrcPath, err := netrc.Write(entries[:1], tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(netrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("machine github.com"))
+		})
+	})
+
+	It("omits the password when an entry is logged", func() {
+		Expect(fmt.Sprint(entries[0])).To(Equal("machine artifacts.example.com login ci"))
+	})
+})
@@ -25,11 +25,11 @@ func (b BackendEnvNamer) EnvName() (string, error) {
 
 	envName := ""
 	if len(params.EnvNameFile) > 0 {
-		contents, err := ioutil.ReadFile(params.EnvNameFile)
+		var err error
+		envName, err = readEnvNameFile(params)
 		if err != nil {
-			return "", fmt.Errorf("Failed to read `env_name_file`: %s", err)
+			return "", err
 		}
-		envName = string(contents)
 	} else if params.GenerateRandomName {
 		var err error
 		envName, err = b.generateRandomName()
@@ -48,7 +48,7 @@ func (b BackendEnvNamer) EnvName() (string, error) {
 	envName = strings.TrimSpace(envName)
 	envName = strings.Replace(envName, " ", "-", -1)
 
-	return envName, nil
+	return b.Req.Source.DecorateEnvName(envName), nil
 }
 
 func (b BackendEnvNamer) generateRandomName() (string, error) {
@@ -66,7 +66,7 @@ func (b BackendEnvNamer) generateRandomName() (string, error) {
 		randomName := b.Namer.RandomName()
 		clash := false
 		for _, e := range existingEnvs {
-			if e == randomName {
+			if e == b.Req.Source.DecorateEnvName(randomName) {
 				clash = true
 				break
 			}
@@ -152,11 +152,11 @@ func (l LegacyStorageEnvNamer) EnvName() (string, error) {
 	envName := ""
 	params := l.Req.Params
 	if len(params.EnvNameFile) > 0 {
-		contents, err := ioutil.ReadFile(params.EnvNameFile)
+		var err error
+		envName, err = readEnvNameFile(params)
 		if err != nil {
-			return "", fmt.Errorf("Failed to read `env_name_file`: %s", err)
+			return "", err
 		}
-		envName = string(contents)
 	} else if len(params.EnvName) > 0 {
 		envName = params.EnvName
 	} else if params.GenerateRandomName {
@@ -188,6 +188,18 @@ func (l LegacyStorageEnvNamer) EnvName() (string, error) {
 	return envName, nil
 }
 
+func readEnvNameFile(params models.OutParams) (string, error) {
+	contents, err := ioutil.ReadFile(params.EnvNameFile)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read `env_name_file`: %s", err)
+	}
+	envName := strings.TrimSpace(string(contents))
+	if len(envName) == 0 {
+		return "", fmt.Errorf("The `env_name_file` '%s' is empty", params.EnvNameFile)
+	}
+	return params.DecorateEnvNameFile(envName), nil
+}
+
 func doesEnvNameClashWithLegacyEnv(envName string, storageDriver storage.Storage) (bool, error) {
 	filename := fmt.Sprintf("%s.tfstate", envName)
 	version, err := storageDriver.Version(filename)
@@ -1,43 +1,119 @@
 package out
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
+	"strconv"
 
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/encoder"
 	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
 	"github.com/ljfranklin/terraform-resource/namer"
+	"github.com/ljfranklin/terraform-resource/netrc"
+	"github.com/ljfranklin/terraform-resource/preflight"
+	"github.com/ljfranklin/terraform-resource/proxy"
 	"github.com/ljfranklin/terraform-resource/ssh"
 	"github.com/ljfranklin/terraform-resource/storage"
 	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type Runner struct {
 	SourceDir string
+	OutputDir string
 	Namer     namer.Namer
 	LogWriter io.Writer
+
+	span              *tracing.Span
+	caBundle          *cacert.Bundle
+	structuredLogging bool
+	proxy             proxy.Config
 }
 
 func (r Runner) Run(req models.OutRequest) (models.OutResponse, error) {
+	r.structuredLogging = req.Source.StructuredLogging
+	r.proxy = req.Source.Proxy
+	r.LogWriter = r.proxy.Writer(r.LogWriter)
+	tracer := tracing.New(req.Source.OTel)
+	r.span = tracer.Start("put", nil)
+
+	resp, err := r.run(req)
+	err = r.proxy.RedactError(cacert.Hint(err))
+	r.span.SetAttribute("env_name", resp.Version.EnvName)
+	r.span.SetAttribute("serial", resp.Version.Serial)
+	r.span.End(err)
+
+	if flushErr := tracer.Flush(); flushErr != nil {
+		r.newLogger().Warn(fmt.Sprintf("Failed to export OpenTelemetry traces: %s", flushErr))
+	}
+
+	return resp, err
+}
+
+func (r Runner) newLogger() logger.Logger {
+	return logger.New(r.LogWriter, r.structuredLogging)
+}
+
+// httpClient trusts `ca_cert` and uses `proxy`, nil means the default client
+func (r Runner) httpClient() *http.Client {
+	return r.proxy.HTTPClient(r.caBundle.HTTPClient())
+}
+
+func (r Runner) run(req models.OutRequest) (models.OutResponse, error) {
 	if err := req.Source.Validate(); err != nil {
 		return models.OutResponse{}, err
 	}
+	if err := req.Params.Validate(); err != nil {
+		return models.OutResponse{}, err
+	}
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "terraform-resource-out")
 	if err != nil {
 		return models.OutResponse{}, fmt.Errorf("Failed to create tmp dir at '%s'", os.TempDir())
 	}
 	defer os.RemoveAll(tmpDir)
 
+	r.caBundle, err = cacert.Write(req.Source.CACert, tmpDir)
+	if err != nil {
+		return models.OutResponse{}, err
+	}
+
 	req.Source.Terraform = req.Source.Terraform.Merge(req.Params.Terraform)
+	if req.Params.RollbackSource != "" {
+		req.Source.Terraform.Source = req.Params.RollbackSource
+	}
+	if req.Params.Action == models.ApplyPlanAction {
+		// the stored plan is the one made by a previous `plan_only` put
+		req.Source.Terraform.PlanRun = true
+	}
 	terraformModel, err := r.buildTerraformModel(req, tmpDir)
 	if err != nil {
 		return models.OutResponse{}, err
 	}
 
+	envAction := req.Params.EnvAction()
+	if terraformModel.UsesPlanEnv(envAction) {
+		logger := r.newLogger()
+		logger.Warn(fmt.Sprintf("The `%s` will run with the same values as `env_per_action.plan`, set `env_per_action.%s` if the plan credentials are read-only.\n", envAction, envAction))
+	}
+	terraformModel.Env = terraformModel.EnvForAction(envAction)
+
+	if req.Params.EnvName != "" && req.Params.EnvNameFile != "" {
+		logger := r.newLogger()
+		logger.Warn("Both `env_name` and `env_name_file` are set, using the name from `env_name_file`.\n")
+	}
+
+	if terraformModel.SkipRefresh() && req.Params.Action == models.DestroyAction {
+		logger := r.newLogger()
+		logger.Warn("Ignoring `refresh: false` for the `destroy` action, skipping the refresh could destroy resources based on stale state.\n")
+	}
+
 	if terraformModel.PrivateKey != "" {
 		agent, err := ssh.SpawnAgent()
 		if err != nil {
@@ -52,6 +128,13 @@ func (r Runner) Run(req models.OutRequest) (models.OutResponse, error) {
 		if err = os.Setenv("SSH_AUTH_SOCK", agent.SSHAuthSock()); err != nil {
 			return models.OutResponse{}, err
 		}
+
+		// an explicit GIT_SSH_COMMAND in `env` takes precedence
+		if gitSSHCommand := terraformModel.GitSSHCommand(); gitSSHCommand != "" {
+			if _, ok := terraformModel.Env["GIT_SSH_COMMAND"]; !ok {
+				terraformModel.Env["GIT_SSH_COMMAND"] = gitSSHCommand
+			}
+		}
 	}
 
 	if req.Source.BackendType == "local" {
@@ -59,15 +142,101 @@ func (r Runner) Run(req models.OutRequest) (models.OutResponse, error) {
 			errors.New("backend type 'local' is not supported, Concourse requires that state is persisted outside the container; use one of the other backend types listed here: https://www.terraform.io/docs/backends/types/index.html")
 	}
 
+	// a failed rollback must not destroy the env it was meant to restore
+	if req.Params.Action == models.RollbackAction && terraformModel.DeleteOnFailure {
+		return models.OutResponse{},
+			errors.New("Cannot specify `delete_on_failure` with the `rollback` action.")
+	}
+
+	// these rely on workspaces, locking, or state outputs which the legacy
+	// `storage` statefiles don't have
+	backendOnly := []struct {
+		enabled bool
+		name    string
+		kind    string
+	}{
+		{req.Params.Action == models.RefreshOnlyAction, models.RefreshOnlyAction, "action"},
+		{req.Params.Action == models.StateMvAction, models.StateMvAction, "action"},
+		{req.Params.Action == models.ForceUnlockAction, models.ForceUnlockAction, "action"},
+		{req.Params.Action == models.ApplyPlanAction, models.ApplyPlanAction, "action"},
+		{req.Params.Action == models.RollbackAction, models.RollbackAction, "action"},
+		{req.Params.MaxChanges != nil, "max_changes", "option"},
+		{len(req.Params.StateManipulations) > 0, "state_manipulations", "option"},
+		{req.Params.TagState, "tag_state", "option"},
+		{req.Params.FailOnDeferred, "fail_on_deferred", "option"},
+		{req.Params.RunValidate, "run_validate", "option"},
+		{req.Params.RecordInventory, "record_inventory", "option"},
+		{req.Params.RecordProvenance, "record_provenance", "option"},
+		{terraformModel.LockRetry != nil, "lock_retry", "option"},
+		{req.Params.ForceUnlock != "", "force_unlock", "option"},
+		{req.Params.AutoForceUnlock, "auto_force_unlock", "option"},
+	}
+	for _, feature := range backendOnly {
+		if !feature.enabled {
+			continue
+		}
+		if err := requireBackend(req.Source, feature.name, feature.kind); err != nil {
+			return models.OutResponse{}, err
+		}
+	}
+
+	if req.Source.PreflightCredentialsCheck && req.Source.BackendType != "" {
+		err := preflight.CheckCredentials(req.Source.BackendType, terraformModel.BackendConfig, terraformModel.Env)
+		if err == preflight.ErrUnsupportedBackend {
+			r.newLogger().Warn(fmt.Sprintf("Skipping `preflight_credentials_check`: %s.\n", err))
+		} else if err != nil {
+			return models.OutResponse{}, err
+		}
+	}
+
+	// computed up front as later steps write files into the source dir
+	configHash, err := terraformModel.ConfigHash()
+	if err != nil {
+		return models.OutResponse{}, err
+	}
+
+	var resp models.OutResponse
 	if req.Source.BackendType != "" && req.Source.MigratedFromStorage != (storage.Model{}) {
-		return r.runWithMigratedFromStorage(req, terraformModel)
+		resp, err = r.runWithMigratedFromStorage(req, terraformModel)
 	} else if req.Source.BackendType == "" {
-		return r.runWithLegacyStorage(req, terraformModel)
+		resp, err = r.runWithLegacyStorage(req, terraformModel)
+	} else {
+		resp, err = r.runWithBackend(req, terraformModel, configHash)
 	}
-	return r.runWithBackend(req, terraformModel)
+	if err != nil {
+		return models.OutResponse{}, err
+	}
+	resp.Version.ConfigHash = configHash
+
+	// make it obvious in the UI that only part of the config was applied
+	targeted := len(terraformModel.Targets) > 0 && !terraformModel.PlanOnly && !terraformModel.PlanRun
+	if targeted && req.Params.Action != models.RefreshOnlyAction && req.Params.Action != models.StateMvAction && req.Params.Action != models.ForceUnlockAction {
+		targets, err := json.Marshal(terraformModel.Targets)
+		if err != nil {
+			return models.OutResponse{}, err
+		}
+		resp.Metadata = append(resp.Metadata, models.MetadataField{
+			Name:  "targets",
+			Value: string(targets),
+		})
+	}
+
+	if len(terraformModel.OverrideFiles) > 0 {
+		overrideFiles, err := json.Marshal(terraformModel.OverrideFiles)
+		if err != nil {
+			return models.OutResponse{}, err
+		}
+		resp.Metadata = append(resp.Metadata, models.MetadataField{
+			Name:  "override_files",
+			Value: string(overrideFiles),
+		})
+	}
+	resp.Metadata = resp.Metadata.WithPrefix(req.Params.OutputPrefix)
+
+	return resp, nil
 }
 
-func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terraform) (models.OutResponse, error) {
+func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terraform, configHash string) (models.OutResponse, error) {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "terraform-resource-out")
 	if err != nil {
 		return models.OutResponse{}, fmt.Errorf("Failed to create tmp dir at '%s'", os.TempDir())
@@ -82,6 +251,7 @@ func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terr
 	terraformModel.Env["TF_VAR_env_name"] = envName
 	terraformModel.PlanFileLocalPath = path.Join(tmpDir, "plan")
 	terraformModel.JSONPlanFileLocalPath = path.Join(tmpDir, "plan.json")
+	terraformModel.TextPlanFileLocalPath = path.Join(tmpDir, "plan.txt")
 
 	client := terraform.NewClient(
 		terraformModel,
@@ -89,12 +259,37 @@ func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terr
 	)
 
 	action := terraform.Action{
-		Client:  client,
-		EnvName: envName,
-		Model:   terraformModel,
-		Logger: logger.Logger{
-			Sink: r.LogWriter,
-		},
+		Client:                 client,
+		EnvName:                envName,
+		Model:                  terraformModel,
+		Logger:                 r.newLogger(),
+		Span:                   r.span,
+		DeleteOnFailureTimeout: terraformModel.DeleteOnFailureTimeoutDuration(),
+		MaxChanges:             req.Params.MaxChanges,
+		FailOnDeferred:         req.Params.FailOnDeferred,
+		RequireConverged:       req.Source.RequireConverged,
+		RunValidate:            req.Params.RunValidate,
+		RecordInventory:        req.Params.RecordInventory,
+		VerifyBackend:          req.Source.VerifyBackend,
+		RecordProvenance:       req.Params.RecordProvenance || req.Params.Action == models.RollbackAction,
+		ConfigHash:             configHash,
+		ForceUnlockID:          req.Params.ForceUnlock,
+		AutoForceUnlock:        req.Params.AutoForceUnlock,
+		VerifyPlan:             req.Params.Action == models.ApplyPlanAction,
+		StateManipulations:     terraform.NewStateManipulations(req.Params.StateManipulations),
+	}
+	// BUILD_ID is only unset when run outside of Concourse
+	if !req.Params.AllowParallelPuts && os.Getenv("BUILD_ID") != "" {
+		action.PutIntent = terraform.NewPutIntent(client, envName)
+		defer func() {
+			if err := action.PutIntent.Release(); err != nil {
+				r.newLogger().Warn(fmt.Sprintf("Failed to remove `put` intent marker for env '%s': %s", envName, err))
+			}
+		}()
+	}
+	if req.Params.TagState {
+		tags := terraform.NewStateTags()
+		action.StateTags = &tags
 	}
 
 	var result terraform.Result
@@ -104,12 +299,24 @@ func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terr
 		result, actionErr = action.Plan()
 	} else if req.Params.Action == models.DestroyAction {
 		result, actionErr = action.Destroy()
+	} else if req.Params.Action == models.RefreshOnlyAction {
+		result, actionErr = action.RefreshOnly()
+	} else if req.Params.Action == models.StateMvAction {
+		result, actionErr = action.StateMv(req.Params.StateMoves)
+	} else if req.Params.Action == models.ForceUnlockAction {
+		result, actionErr = action.ForceUnlock(req.Params.LockID)
+	} else if req.Params.Action == models.RollbackAction {
+		result, actionErr = action.Rollback(*req.Params.ToSerial)
 	} else {
 		result, actionErr = action.Apply()
+		if actionErr != nil && req.Params.OutputOnFailure {
+			r.writePartialOutputs(envName, client, terraformModel.SensitiveOutputNames, req.Params.OutputPrefix)
+		}
 	}
 	if actionErr != nil {
 		return models.OutResponse{}, actionErr
 	}
+	result.SensitiveOutputNames = terraformModel.SensitiveOutputNames
 
 	version := result.Version
 	if req.Params.PlanOnly {
@@ -120,6 +327,51 @@ func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terr
 	if err != nil {
 		return models.OutResponse{}, actionErr
 	}
+	metadata = append(metadata, backendChangeMetadata(client)...)
+
+	if req.Params.Action == models.RefreshOnlyAction {
+		drifted, err := json.Marshal(append([]string{}, result.DriftedAttributes...))
+		if err != nil {
+			return models.OutResponse{}, err
+		}
+		metadata = append(metadata, models.MetadataField{
+			Name:  "drifted_attributes",
+			Value: string(drifted),
+		})
+	}
+
+	if req.Params.Action == models.RollbackAction {
+		metadata = append(metadata, models.MetadataField{
+			Name:  "rollback_to_serial",
+			Value: strconv.Itoa(*req.Params.ToSerial),
+		})
+	}
+
+	if result.AlreadyDestroyed {
+		metadata = append(metadata, alreadyDestroyedMetadata)
+	}
+
+	if result.PlanHasChanges != nil {
+		metadata = append(metadata, hasChangesMetadata(*result.PlanHasChanges))
+	}
+
+	if result.PlanChanges != nil {
+		metadata = append(metadata, models.MetadataField{
+			Name:  "deferred_actions",
+			Value: strconv.Itoa(result.PlanChanges.Deferred),
+		})
+	}
+
+	if result.AppliedChanges != nil {
+		metadata = append(metadata, appliedChangesMetadata(*result.AppliedChanges)...)
+	}
+
+	if workspaceURL := terraformModel.WorkspaceURL(envName); workspaceURL != "" {
+		metadata = append(metadata, models.MetadataField{
+			Name:  "workspace_url",
+			Value: workspaceURL,
+		})
+	}
 
 	resp := models.OutResponse{
 		Version:  version,
@@ -130,9 +382,7 @@ func (r Runner) runWithBackend(req models.OutRequest, terraformModel models.Terr
 }
 
 func (r Runner) runWithLegacyStorage(req models.OutRequest, terraformModel models.Terraform) (models.OutResponse, error) {
-	logger := logger.Logger{
-		Sink: r.LogWriter,
-	}
+	logger := r.newLogger()
 	logger.Warn(fmt.Sprintf("%s\n", storage.DeprecationWarning))
 
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "terraform-resource-out")
@@ -145,7 +395,15 @@ func (r Runner) runWithLegacyStorage(req models.OutRequest, terraformModel model
 	if err = storageModel.Validate(); err != nil {
 		return models.OutResponse{}, fmt.Errorf("Failed to validate storage Model: %s", err)
 	}
-	storageDriver := storage.BuildDriver(storageModel)
+	storageModel.HTTPClient = r.httpClient()
+	if warning := storageModel.InsecureWarning(); warning != "" {
+		logger.Warn(warning)
+	}
+	if encryption := storageModel.DescribeEncryption(); encryption != "" {
+		logger.Info(encryption + "\n")
+	}
+	storageDriver := storage.WithRetries(storage.BuildDriver(storageModel), storageModel.Retryer(logger))
+	storageDriver = storage.WithTracing(storageDriver, r.span)
 
 	envName, err := r.buildEnvNameFromLegacyStorage(req, storageDriver)
 	if err != nil {
@@ -173,11 +431,13 @@ func (r Runner) runWithLegacyStorage(req models.OutRequest, terraformModel model
 		StorageDriver: storageDriver,
 	}
 	action := terraform.LegacyStorageAction{
-		Client:    client,
-		StateFile: stateFile,
-		PlanFile:  planFile,
-		Model:     terraformModel,
-		Logger:    logger,
+		Client:                 client,
+		StateFile:              stateFile,
+		PlanFile:               planFile,
+		Model:                  terraformModel,
+		Logger:                 logger,
+		Span:                   r.span,
+		DeleteOnFailureTimeout: terraformModel.DeleteOnFailureTimeoutDuration(),
 	}
 
 	var result terraform.LegacyStorageResult
@@ -193,16 +453,25 @@ func (r Runner) runWithLegacyStorage(req models.OutRequest, terraformModel model
 	if actionErr != nil {
 		return models.OutResponse{}, actionErr
 	}
+	result.SensitiveOutputNames = terraformModel.SensitiveOutputNames
 
 	version := models.NewVersionFromLegacyStorage(result.Version)
 	if req.Params.PlanOnly {
 		version.PlanOnly = "true" // Concourse demands version fields are strings
+	} else if req.Params.Action != models.DestroyAction {
+		// matches the version emitted by check for the uploaded statefile
+		if rawState, err := ioutil.ReadFile(terraformModel.StateFileLocalPath); err == nil {
+			version = version.WithStateSerial(rawState)
+		}
 	}
 
 	metadata, err := r.buildMetadata(result.SanitizedOutput(), client)
 	if err != nil {
 		return models.OutResponse{}, actionErr
 	}
+	if result.AlreadyDestroyed {
+		metadata = append(metadata, alreadyDestroyedMetadata)
+	}
 
 	resp := models.OutResponse{
 		Version:  version,
@@ -223,7 +492,15 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 	if err = storageModel.Validate(); err != nil {
 		return models.OutResponse{}, fmt.Errorf("Failed to validate storage Model: %s", err)
 	}
-	storageDriver := storage.BuildDriver(storageModel)
+	storageModel.HTTPClient = r.httpClient()
+	if warning := storageModel.InsecureWarning(); warning != "" {
+		r.newLogger().Warn(warning)
+	}
+	if encryption := storageModel.DescribeEncryption(); encryption != "" {
+		r.newLogger().Info(encryption + "\n")
+	}
+	storageDriver := storage.WithRetries(storage.BuildDriver(storageModel), storageModel.Retryer(r.newLogger()))
+	storageDriver = storage.WithTracing(storageDriver, r.span)
 
 	envName, err := r.buildEnvNameFromMigrated(req, terraformModel, storageDriver)
 	if err != nil {
@@ -233,6 +510,7 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 	terraformModel.Env["TF_VAR_env_name"] = envName
 	terraformModel.PlanFileLocalPath = path.Join(tmpDir, "plan")
 	terraformModel.JSONPlanFileLocalPath = path.Join(tmpDir, "plan.json")
+	terraformModel.TextPlanFileLocalPath = path.Join(tmpDir, "plan.txt")
 
 	client := terraform.NewClient(
 		terraformModel,
@@ -248,13 +526,13 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 		StorageDriver: storageDriver,
 	}
 	action := terraform.MigratedFromStorageAction{
-		StateFile: stateFile,
-		Client:    client,
-		EnvName:   envName,
-		Model:     terraformModel,
-		Logger: logger.Logger{
-			Sink: r.LogWriter,
-		},
+		StateFile:              stateFile,
+		Client:                 client,
+		EnvName:                envName,
+		Model:                  terraformModel,
+		Logger:                 r.newLogger(),
+		Span:                   r.span,
+		DeleteOnFailureTimeout: terraformModel.DeleteOnFailureTimeoutDuration(),
 	}
 
 	var result terraform.Result
@@ -266,10 +544,14 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 		result, actionErr = action.Destroy()
 	} else {
 		result, actionErr = action.Apply()
+		if actionErr != nil && req.Params.OutputOnFailure {
+			r.writePartialOutputs(envName, client, terraformModel.SensitiveOutputNames, req.Params.OutputPrefix)
+		}
 	}
 	if actionErr != nil {
 		return models.OutResponse{}, actionErr
 	}
+	result.SensitiveOutputNames = terraformModel.SensitiveOutputNames
 
 	version := result.Version
 	if req.Params.PlanOnly {
@@ -280,6 +562,13 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 	if err != nil {
 		return models.OutResponse{}, actionErr
 	}
+	metadata = append(metadata, backendChangeMetadata(client)...)
+	if result.AlreadyDestroyed {
+		metadata = append(metadata, alreadyDestroyedMetadata)
+	}
+	if result.PlanHasChanges != nil {
+		metadata = append(metadata, hasChangesMetadata(*result.PlanHasChanges))
+	}
 
 	resp := models.OutResponse{
 		Version:  version,
@@ -289,6 +578,56 @@ func (r Runner) runWithMigratedFromStorage(req models.OutRequest, terraformModel
 	return resp, nil
 }
 
+// writePartialOutputs is best-effort, any errors are logged rather than
+// returned so the original apply error is still surfaced to the user
+func (r Runner) writePartialOutputs(envName string, client terraform.Client, sensitiveOutputNames []string, outputPrefix string) {
+	logger := r.newLogger()
+
+	stateVersion, err := client.CurrentStateVersion(envName)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to read state for `output_on_failure`: %s", err))
+		return
+	}
+	if stateVersion.Serial == 0 {
+		logger.Warn("No state was written before the failure, skipping `output_on_failure`")
+		return
+	}
+
+	tfOutput, err := client.Output(envName)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to read outputs for `output_on_failure`: %s", err))
+		return
+	}
+	result := terraform.Result{
+		Output:               tfOutput,
+		SensitiveOutputNames: sensitiveOutputNames,
+	}
+
+	partialMetadataPath := path.Join(r.OutputDir, "partial_metadata.json")
+	partialMetadataFile, err := os.Create(partialMetadataPath)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to create partial metadata file at path '%s': %s", partialMetadataPath, err))
+		return
+	}
+	defer partialMetadataFile.Close()
+
+	rawOutput := map[string]interface{}{}
+	for key, value := range result.RawOutput() {
+		rawOutput[models.PrefixedName(outputPrefix, key)] = value
+	}
+	if err = encoder.NewJSONEncoder(partialMetadataFile).Encode(rawOutput); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to write partial metadata file at path '%s': %s", partialMetadataPath, err))
+		return
+	}
+
+	sanitizedOutput, err := json.MarshalIndent(result.SanitizedOutput(), "", "  ")
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to marshal partial outputs: %s", err))
+		return
+	}
+	logger.Warn(fmt.Sprintf("Wrote partial outputs to '%s':\n%s", partialMetadataPath, sanitizedOutput))
+}
+
 func (r Runner) buildEnvName(req models.OutRequest, terraformModel models.Terraform) (string, error) {
 	tfClientWithoutWorkspace := terraform.NewClient(
 		terraformModel,
@@ -299,7 +638,11 @@ func (r Runner) buildEnvName(req models.OutRequest, terraformModel models.Terraf
 		TerraformClient: tfClientWithoutWorkspace,
 		Namer:           r.Namer,
 	}
-	return namer.EnvName()
+	envName, err := namer.EnvName()
+	if err != nil {
+		return "", err
+	}
+	return envName, terraform.ValidateEnvName(envName)
 }
 
 func (r Runner) buildEnvNameFromLegacyStorage(req models.OutRequest, storageDriver storage.Storage) (string, error) {
@@ -327,6 +670,8 @@ func (r Runner) buildEnvNameFromMigrated(req models.OutRequest, terraformModel m
 
 func (r Runner) buildTerraformModel(req models.OutRequest, tmpDir string) (models.Terraform, error) {
 	terraformModel := req.Source.Terraform
+	terraformModel.WorkspacePrefix = req.Source.BackendPrefix
+	terraformModel.LogJSON = req.Source.StructuredLogging
 	if terraformModel.VarFiles != nil {
 		for i := range terraformModel.VarFiles {
 			terraformModel.VarFiles[i] = path.Join(r.SourceDir, terraformModel.VarFiles[i])
@@ -338,6 +683,23 @@ func (r Runner) buildTerraformModel(req models.OutRequest, tmpDir string) (model
 	if err := terraformModel.ParseImportsFromFile(); err != nil {
 		return models.Terraform{}, fmt.Errorf("Failed to parse `terraform.imports_file`: %s", err)
 	}
+	if req.Params.ImportFromStateFile != "" {
+		if err := terraformModel.ParseImportsFromStateFile(req.Params.ImportFromStateFile); err != nil {
+			return models.Terraform{}, fmt.Errorf("Failed to parse `import_from_state_file`: %s", err)
+		}
+	}
+	if err := terraformModel.Validate(); err != nil {
+		return models.Terraform{}, fmt.Errorf("Failed to validate terraform Model: %s", err)
+	}
+	if err := terraformModel.ValidatePluginDir(); err != nil {
+		return models.Terraform{}, err
+	}
+	if err := terraformModel.ParsePassEnv(); err != nil {
+		return models.Terraform{}, err
+	}
+	if err := terraformModel.ParseBackendConfigFromEnv(req.Source.BackendConfigEnvPrefix); err != nil {
+		return models.Terraform{}, err
+	}
 
 	if len(terraformModel.Source) == 0 {
 		return models.Terraform{}, errors.New("Missing required field `terraform.source`")
@@ -350,9 +712,68 @@ func (r Runner) buildTerraformModel(req models.OutRequest, tmpDir string) (model
 	terraformModel.Env["TF_VAR_build_team_name"] = os.Getenv("BUILD_TEAM_NAME")
 	terraformModel.Env["TF_VAR_atc_external_url"] = os.Getenv("ATC_EXTERNAL_URL")
 
+	if r.span != nil {
+		terraformModel.Env["TRACEPARENT"] = r.span.Traceparent()
+	}
+	terraformModel.Env = r.caBundle.WithEnv(terraformModel.Env)
+	terraformModel.Env = r.proxy.WithEnv(terraformModel.Env)
+
+	// terraform reads NETRC when downloading modules over HTTPS, the file is
+	// removed along with tmpDir
+	netrcPath, err := netrc.Write(req.Source.Netrc, tmpDir)
+	if err != nil {
+		return models.Terraform{}, err
+	}
+	if netrcPath != "" {
+		terraformModel.Env["NETRC"] = netrcPath
+	}
+
+	terraformModel, err = terraformModel.WithGCSCredentials(tmpDir)
+	if err != nil {
+		return models.Terraform{}, err
+	}
+
 	terraformModel.DownloadPlugins = true
 
-	return terraformModel, nil
+	return terraform.UseTerraformVersion(terraformModel, r.httpClient(), r.LogWriter)
+}
+
+// alreadyDestroyedMetadata marks a destroy which found nothing left to destroy
+var alreadyDestroyedMetadata = models.MetadataField{
+	Name:  "already_destroyed",
+	Value: "true",
+}
+
+// hasChangesMetadata reports whether a `plan_only` plan would change anything
+func hasChangesMetadata(hasChanges bool) models.MetadataField {
+	return models.MetadataField{
+		Name:  "has_changes",
+		Value: strconv.FormatBool(hasChanges),
+	}
+}
+
+// appliedChangesMetadata reports how many resources an apply added, changed
+// and destroyed
+func appliedChangesMetadata(applied terraform.AppliedChanges) []models.MetadataField {
+	return []models.MetadataField{
+		{Name: "resources_added", Value: strconv.Itoa(applied.Add)},
+		{Name: "resources_changed", Value: strconv.Itoa(applied.Change)},
+		{Name: "resources_destroyed", Value: strconv.Itoa(applied.Destroy)},
+	}
+}
+
+// backendChangeMetadata makes a backend change approved with
+// `approve_backend_change` visible in the UI
+func backendChangeMetadata(client terraform.Client) []models.MetadataField {
+	change := client.BackendChange()
+	if change == nil {
+		return nil
+	}
+	return []models.MetadataField{
+		{Name: "previous_backend_type", Value: change.PreviousType},
+		{Name: "backend_type", Value: change.Type},
+		{Name: "backend_change_mode", Value: change.Mode},
+	}
 }
 
 func (r Runner) buildMetadata(outputs map[string]string, client terraform.Client) ([]models.MetadataField, error) {
@@ -373,3 +794,15 @@ func (r Runner) buildMetadata(outputs map[string]string, client terraform.Client
 		Value: tfVersion,
 	}), nil
 }
+
+// requireBackend errors if source still reads state from `storage`, kind is
+// either "action" or "option"
+func requireBackend(source models.Source, name string, kind string) error {
+	if source.BackendType != "" && source.MigratedFromStorage == (storage.Model{}) {
+		return nil
+	}
+	if kind == "action" {
+		return fmt.Errorf("the `%s` action is only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use this action", name)
+	}
+	return fmt.Errorf("`%s` is only supported with `backend_type`, finish migrating away from `storage` and `migrated_from_storage` to use this option", name)
+}
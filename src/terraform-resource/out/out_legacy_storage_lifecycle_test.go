@@ -182,6 +182,14 @@ var _ = Describe("Out Legacy Storage Lifecycle", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(deletedVersion).To(BeTemporally(">", updatedVersion))
 		Expect(deleteOutput.Version.EnvName).To(Equal(outRequest.Params.EnvName))
+
+		By("re-running 'out' to delete the already deleted state file")
+
+		redeleteOutput, err := runner.Run(outRequest)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(redeleteOutput.Version.EnvName).To(Equal(outRequest.Params.EnvName))
+		Expect(redeleteOutput.Metadata).To(ContainElement(models.MetadataField{Name: "already_destroyed", Value: "true"}))
 	})
 
 	It("can delete after a failed put", func() {
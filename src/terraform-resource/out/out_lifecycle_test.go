@@ -188,6 +188,17 @@ var _ = Describe("Out Backend Lifecycle", func() {
 		)
 
 		Expect(deleteOutput.Version.EnvName).To(Equal(outRequest.Params.EnvName))
+		Expect(deleteOutput.Metadata).ToNot(ContainElement(models.MetadataField{Name: "already_destroyed", Value: "true"}))
+
+		By("re-running 'out' to delete the already deleted environment")
+
+		resetWorkingDir()
+
+		redeleteOutput, err := runner.Run(outRequest)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(redeleteOutput.Version.EnvName).To(Equal(outRequest.Params.EnvName))
+		Expect(redeleteOutput.Metadata).To(ContainElement(models.MetadataField{Name: "already_destroyed", Value: "true"}))
 	})
 
 	It("can delete after a failed put", func() {
@@ -68,8 +68,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "fixtures/aws"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "modules/aws"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -121,8 +121,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/", "dst": "fixtures/aws"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/", "dst": "modules/aws"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -164,8 +164,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "fixtures/aws/example.tf"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "modules/aws/example.tf"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -186,7 +186,7 @@ var _ = Describe("Out Module Override", func() {
 		_, err := runner.Run(req)
 		Expect(err).To(HaveOccurred())
 
-		Expect(err.Error()).To(ContainSubstring("override destination 'fixtures/aws/example.tf' is a file, must pass directory instead"))
+		Expect(err.Error()).To(ContainSubstring("override destination 'modules/aws/example.tf' is a file, must pass directory instead"))
 	})
 
 	It("errors when given an invalid path for source", func() {
@@ -207,8 +207,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "does-not-exist", "dst": "fixtures/aws"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "does-not-exist", "dst": "modules/aws"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -232,7 +232,7 @@ var _ = Describe("Out Module Override", func() {
 		Expect(err.Error()).To(ContainSubstring("override source file 'does-not-exist' does not exist"))
 	})
 
-	It("errors when given an invalid path for destination", func() {
+	It("errors when destination is outside of the source", func() {
 		req := models.OutRequest{
 			Source: models.Source{
 				Terraform: models.Terraform{
@@ -250,8 +250,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "does-not-exist"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf", "dst": "../aws"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -272,7 +272,7 @@ var _ = Describe("Out Module Override", func() {
 		_, err := runner.Run(req)
 		Expect(err).To(HaveOccurred())
 
-		Expect(err.Error()).To(ContainSubstring("override destination directory 'does-not-exist' does not exist"))
+		Expect(err.Error()).To(ContainSubstring("`module_override_files` dst must not be outside of `terraform_source`, got '../aws'"))
 	})
 
 	It("errors when src key is missing", func() {
@@ -293,8 +293,8 @@ var _ = Describe("Out Module Override", func() {
 			Params: models.OutParams{
 				EnvName: envName,
 				Terraform: models.Terraform{
-					ModuleOverrideFiles: []map[string]string{map[string]string{"dst": "fixtures/aws"}},
-					Source:              "fixtures/module/",
+					ModuleOverrideFiles: []map[string]string{map[string]string{"dst": "modules/aws"}},
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
@@ -337,7 +337,7 @@ var _ = Describe("Out Module Override", func() {
 				EnvName: envName,
 				Terraform: models.Terraform{
 					ModuleOverrideFiles: []map[string]string{map[string]string{"src": "fixtures/override/example_override.tf"}},
-					Source:              "fixtures/module/",
+					Source:              "fixtures/nested-module/",
 					Vars: map[string]interface{}{
 						"access_key":     accessKey,
 						"secret_key":     secretKey,
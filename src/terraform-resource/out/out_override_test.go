@@ -104,6 +104,7 @@ var _ = Describe("Out Override", func() {
 		Expect(fields["object_content"]).To(Equal("OVERRIDE"))
 		expectedMD5 := fmt.Sprintf("%x", md5.Sum([]byte("OVERRIDE")))
 		Expect(fields["content_md5"]).To(Equal(expectedMD5))
+		Expect(fields["override_files"]).To(Equal(`["fixtures/override/example_override.tf"]`))
 
 		awsVerifier.ExpectS3FileToExist(bucket, s3ObjectPath)
 	})
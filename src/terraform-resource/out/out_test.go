@@ -3,6 +3,7 @@ package out_test
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -662,6 +663,35 @@ map_of_maps = {
 		Expect(logWriter.String()).To(ContainSubstring("bucket"))
 	})
 
+	It("returns the validate errors without creating a workspace if `run_validate` is true", func() {
+		req := models.OutRequest{
+			Source: models.Source{
+				Terraform: models.Terraform{
+					BackendType:   backendType,
+					BackendConfig: backendConfig,
+				},
+			},
+			Params: models.OutParams{
+				EnvName:     envName,
+				RunValidate: true,
+				Terraform: models.Terraform{
+					Source: "fixtures/invalid/",
+				},
+			},
+		}
+
+		runner := out.Runner{
+			SourceDir: workingDir,
+			LogWriter: &logWriter,
+			Namer:     &namer,
+		}
+		_, err := runner.Run(req)
+		Expect(err).To(MatchError(ContainSubstring("Terraform configuration is invalid")))
+		Expect(err).To(MatchError(ContainSubstring("on main.tf line 7")))
+
+		awsVerifier.ExpectS3FileToNotExist(bucket, path.Join(workspacePath, envName, stateFileName))
+	})
+
 	It("replaces spaces in env_name with hyphens", func() {
 		spaceName := strings.Replace(envName, "-", " ", -1)
 		req := models.OutRequest{
@@ -772,6 +802,107 @@ map_of_maps = {
 
 			assertOutBehavior(req, expectedMetadata)
 		})
+
+		It("returns an error if env_name_file is empty", func() {
+			Expect(ioutil.WriteFile(envNameFile, []byte(" \n"), 0644)).To(Succeed())
+
+			req := models.OutRequest{
+				Source: models.Source{
+					Terraform: models.Terraform{
+						BackendType:   backendType,
+						BackendConfig: backendConfig,
+					},
+				},
+				Params: models.OutParams{
+					EnvNameFile: envNameFile,
+					Terraform: models.Terraform{
+						Source: "fixtures/aws/",
+					},
+				},
+			}
+
+			runner := out.Runner{
+				SourceDir: workingDir,
+				LogWriter: GinkgoWriter,
+				Namer:     &namer,
+			}
+			_, err := runner.Run(req)
+			Expect(err).To(MatchError(ContainSubstring("is empty")))
+		})
+
+		It("adds workspace_name_prefix and workspace_name_suffix to the name from env_name_file", func() {
+			undecoratedName := envName
+			envName = fmt.Sprintf("pr-%s-staging", undecoratedName)
+			stateFilePath = path.Join(workspacePath, envName, stateFileName)
+
+			req := models.OutRequest{
+				Source: models.Source{
+					Terraform: models.Terraform{
+						BackendType:   backendType,
+						BackendConfig: backendConfig,
+					},
+				},
+				Params: models.OutParams{
+					EnvNameFile:         envNameFile,
+					WorkspaceNamePrefix: "pr-",
+					WorkspaceNameSuffix: "-staging",
+					Terraform: models.Terraform{
+						Source: "fixtures/aws/",
+						Vars: map[string]interface{}{
+							"access_key":     accessKey,
+							"secret_key":     secretKey,
+							"bucket":         bucket,
+							"object_key":     s3ObjectPath,
+							"object_content": "terraform-is-neat",
+							"region":         region,
+						},
+					},
+				},
+			}
+			expectedMetadata := map[string]string{
+				"env_name": envName,
+			}
+
+			assertOutBehavior(req, expectedMetadata)
+			awsVerifier.ExpectS3FileToExist(bucket, stateFilePath)
+		})
+	})
+
+	It("decorates the env name with env_name_prefix and env_name_suffix", func() {
+		undecoratedName := envName
+		envName = fmt.Sprintf("team-a-%s-east", undecoratedName)
+		stateFilePath = path.Join(workspacePath, envName, stateFileName)
+
+		req := models.OutRequest{
+			Source: models.Source{
+				EnvNamePrefix: "team-a-",
+				EnvNameSuffix: "-east",
+				Terraform: models.Terraform{
+					BackendType:   backendType,
+					BackendConfig: backendConfig,
+				},
+			},
+			Params: models.OutParams{
+				EnvName: undecoratedName,
+				Terraform: models.Terraform{
+					Source: "fixtures/aws/",
+					Vars: map[string]interface{}{
+						"access_key":     accessKey,
+						"secret_key":     secretKey,
+						"bucket":         bucket,
+						"object_key":     s3ObjectPath,
+						"object_content": "terraform-is-neat",
+						"region":         region,
+					},
+				},
+			},
+		}
+		expectedMetadata := map[string]string{
+			"env_name": envName,
+		}
+
+		assertOutBehavior(req, expectedMetadata)
+		awsVerifier.ExpectS3FileToExist(bucket, stateFilePath)
 	})
 
 	It("creates an env with a random name when generate_random_name is true", func() {
@@ -1071,6 +1202,35 @@ map_of_maps = {
 			awsVerifier.ExpectS3FileToNotExist(bucket, originalStateFilePath)
 			awsVerifier.ExpectS3FileToNotExist(bucket, stateFilePath)
 		})
+
+		It("writes partial outputs on failure if output_on_failure is true", func() {
+			req.Params.OutputOnFailure = true
+
+			runner := out.Runner{
+				SourceDir: workingDir,
+				OutputDir: workingDir,
+				LogWriter: &logWriter,
+			}
+			_, err := runner.Run(req)
+
+			Expect(err).To(HaveOccurred())
+			Expect(logWriter.String()).To(ContainSubstring("invalid_object"))
+
+			partialMetadataPath := path.Join(workingDir, "partial_metadata.json")
+			Expect(partialMetadataPath).To(BeAnExistingFile())
+			partialMetadata, err := ioutil.ReadFile(partialMetadataPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			outputs := map[string]interface{}{}
+			Expect(json.Unmarshal(partialMetadata, &outputs)).To(Succeed())
+			Expect(outputs["object_key"]).To(Equal(s3ObjectPath))
+
+			// cleanup
+			req.Params.Action = models.DestroyAction
+			_, err = runner.Run(req)
+			Expect(err).ToNot(HaveOccurred())
+			awsVerifier.ExpectS3FileToNotExist(bucket, s3ObjectPath)
+		})
 	})
 
 	assertOutBehavior = func(outRequest models.OutRequest, expectedMetadata map[string]string) {
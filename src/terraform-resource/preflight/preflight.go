@@ -0,0 +1,93 @@
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	awsSession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const defaultRegion = "us-east-1"
+
+var ErrUnsupportedBackend = errors.New("credentials can only be checked for the `s3` backend")
+
+// CredentialsError is returned when the backend rejects the credentials,
+// as opposed to the check itself failing to run.
+type CredentialsError struct {
+	BackendType string
+	Err         error
+}
+
+func (e CredentialsError) Error() string {
+	return fmt.Sprintf("The credentials for the `%s` backend are invalid: %s", e.BackendType, e.Err)
+}
+
+// CheckCredentials makes a lightweight call to verify the credentials in
+// backendConfig, falling back to the AWS_* vars in env as `terraform init`
+// would, so expired or wrong credentials fail fast with a clear error.
+func CheckCredentials(backendType string, backendConfig map[string]interface{}, env map[string]string) error {
+	switch backendType {
+	case "s3":
+		return checkS3Credentials(backendConfig, env)
+	default:
+		return ErrUnsupportedBackend
+	}
+}
+
+func checkS3Credentials(backendConfig map[string]interface{}, env map[string]string) error {
+	config := func(key string) string {
+		value, _ := backendConfig[key].(string)
+		return value
+	}
+
+	awsConfig := &aws.Config{
+		Region: aws.String(defaultRegion),
+	}
+	if region := config("region"); region != "" {
+		awsConfig.Region = aws.String(region)
+	}
+	if endpoint := config("sts_endpoint"); endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+	if accessKey := config("access_key"); accessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(accessKey, config("secret_key"), config("token"))
+	} else if accessKey := env["AWS_ACCESS_KEY_ID"]; accessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(accessKey, env["AWS_SECRET_ACCESS_KEY"], env["AWS_SESSION_TOKEN"])
+	}
+
+	options := awsSession.Options{
+		Config:  *awsConfig,
+		Profile: config("profile"),
+	}
+	// set from `source.ca_cert`, the process env is not updated
+	if caBundlePath := env["AWS_CA_BUNDLE"]; caBundlePath != "" {
+		caBundle, err := os.Open(caBundlePath)
+		if err != nil {
+			return fmt.Errorf("Failed to open CA bundle: %s", err)
+		}
+		defer caBundle.Close()
+		options.CustomCABundle = caBundle
+	}
+
+	session, err := awsSession.NewSessionWithOptions(options)
+	if err != nil {
+		return fmt.Errorf("Failed to configure AWS session: %s", err)
+	}
+	if roleARN := config("role_arn"); roleARN != "" {
+		session.Config.Credentials = stscreds.NewCredentials(session, roleARN)
+	}
+
+	if _, err := sts.New(session).GetCallerIdentity(&sts.GetCallerIdentityInput{}); err != nil {
+		return CredentialsError{
+			BackendType: "s3",
+			Err:         err,
+		}
+	}
+
+	return nil
+}
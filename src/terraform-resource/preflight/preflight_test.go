@@ -0,0 +1,111 @@
+package preflight_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/ljfranklin/terraform-resource/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	callerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/ci</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata><RequestId>fake-request-id</RequestId></ResponseMetadata>
+</GetCallerIdentityResponse>`
+
+	invalidTokenResponse = `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>InvalidClientTokenId</Code>
+    <Message>The security token included in the request is invalid.</Message>
+  </Error>
+  <RequestId>fake-request-id</RequestId>
+</ErrorResponse>`
+)
+
+var _ = Describe("Preflight", func() {
+
+	Describe("CheckCredentials", func() {
+		var (
+			server         *httptest.Server
+			statusCode     int
+			responseBody   string
+			receivedAction string
+			receivedAuth   string
+		)
+
+		BeforeEach(func() {
+			statusCode = http.StatusOK
+			responseBody = callerIdentityResponse
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				values, _ := url.ParseQuery(string(body))
+				receivedAction = values.Get("Action")
+				receivedAuth = r.Header.Get("Authorization")
+				w.WriteHeader(statusCode)
+				_, _ = w.Write([]byte(responseBody))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		s3Config := func() map[string]interface{} {
+			return map[string]interface{}{
+				"bucket":       "some-bucket",
+				"key":          "terraform.tfstate",
+				"region":       "us-west-2",
+				"access_key":   "config-access-key",
+				"secret_key":   "config-secret-key",
+				"sts_endpoint": server.URL,
+			}
+		}
+
+		It("calls GetCallerIdentity with the backend_config credentials", func() {
+			err := preflight.CheckCredentials("s3", s3Config(), map[string]string{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(receivedAction).To(Equal("GetCallerIdentity"))
+			Expect(receivedAuth).To(ContainSubstring("Credential=config-access-key/"))
+		})
+
+		It("falls back to credentials in env", func() {
+			config := s3Config()
+			delete(config, "access_key")
+			delete(config, "secret_key")
+
+			err := preflight.CheckCredentials("s3", config, map[string]string{
+				"AWS_ACCESS_KEY_ID":     "env-access-key",
+				"AWS_SECRET_ACCESS_KEY": "env-secret-key",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(receivedAuth).To(ContainSubstring("Credential=env-access-key/"))
+		})
+
+		It("returns a CredentialsError if the credentials are rejected", func() {
+			statusCode = http.StatusForbidden
+			responseBody = invalidTokenResponse
+
+			err := preflight.CheckCredentials("s3", s3Config(), map[string]string{})
+			Expect(err).To(BeAssignableToTypeOf(preflight.CredentialsError{}))
+			Expect(err.Error()).To(ContainSubstring("The credentials for the `s3` backend are invalid"))
+			Expect(err.Error()).To(ContainSubstring("The security token included in the request is invalid."))
+		})
+
+		It("returns ErrUnsupportedBackend for other backends", func() {
+			err := preflight.CheckCredentials("gcs", map[string]interface{}{}, map[string]string{})
+			Expect(err).To(Equal(preflight.ErrUnsupportedBackend))
+		})
+	})
+})
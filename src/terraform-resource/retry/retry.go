@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+)
+
+// maxDelay caps the back-off so a large `max_retries` doesn't stall a build
+// for hours between attempts
+const maxDelay = 5 * time.Minute
+
+// transientMessages are found in backend errors which are likely to succeed
+// if the request is simply tried again
+var transientMessages = []string{
+	"RequestError",
+	"TooManyRequests",
+	"Throttling",
+	"SlowDown",
+	"RequestLimitExceeded",
+	"i/o timeout",
+	"connection reset by peer",
+	"TLS handshake timeout",
+}
+
+// Retryer runs an operation again after a transient error, doubling Delay
+// after each attempt. Zero MaxRetries runs the operation once.
+type Retryer struct {
+	MaxRetries int
+	Delay      time.Duration
+	Logger     logger.Logger
+
+	// Jitter waits a random duration between half and all of each delay, so
+	// builds which failed together don't all retry at the same moment
+	Jitter bool
+}
+
+// Do runs op until it succeeds, fails with an error which isTransient
+// rejects, or runs out of retries. The last error is returned unchanged.
+func (r Retryer) Do(description string, op func() error, isTransient func(error) bool) error {
+	delay := r.Delay
+	for retry := 1; ; retry++ {
+		err := op()
+		if err == nil || retry > r.MaxRetries || !isTransient(err) {
+			return err
+		}
+
+		wait := delay
+		if r.Jitter {
+			wait = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		}
+		r.Logger.Warn(fmt.Sprintf("%s failed with a transient error, retrying in %s (retry %d of %d): %s", description, wait, retry, r.MaxRetries, err))
+		time.Sleep(wait)
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// IsTransient is true if output, e.g. an error message or terraform's
+// stderr, mentions a known transient backend error
+func IsTransient(output string) bool {
+	for _, message := range transientMessages {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTransientError is an isTransient func for Do which checks err's message
+func IsTransientError(err error) bool {
+	return IsTransient(err.Error())
+}
@@ -0,0 +1,84 @@
+package retry_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/retry"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retryer", func() {
+
+	var (
+		logWriter *bytes.Buffer
+		retryer   retry.Retryer
+		attempts  int
+	)
+
+	BeforeEach(func() {
+		logWriter = &bytes.Buffer{}
+		retryer = retry.Retryer{
+			MaxRetries: 3,
+			Delay:      time.Millisecond,
+			Logger:     logger.Logger{Sink: logWriter},
+		}
+		attempts = 0
+	})
+
+	failTimes := func(n int, err error) func() error {
+		return func() error {
+			attempts++
+			if attempts <= n {
+				return err
+			}
+			return nil
+		}
+	}
+
+	It("retries transient errors until the operation succeeds", func() {
+		err := retryer.Do("apply", failTimes(2, errors.New("RequestError: send request failed")), retry.IsTransientError)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(attempts).To(Equal(3))
+		Expect(logWriter.String()).To(ContainSubstring("apply failed with a transient error, retrying in 1ms (retry 1 of 3)"))
+		Expect(logWriter.String()).To(ContainSubstring("retrying in 2ms (retry 2 of 3)"))
+	})
+
+	It("returns the original error once retries are exhausted", func() {
+		originalErr := errors.New("TooManyRequests")
+
+		err := retryer.Do("apply", failTimes(10, originalErr), retry.IsTransientError)
+		Expect(err).To(BeIdenticalTo(originalErr))
+		Expect(attempts).To(Equal(4))
+	})
+
+	It("does not retry other errors", func() {
+		originalErr := errors.New("Invalid reference")
+
+		err := retryer.Do("apply", failTimes(10, originalErr), retry.IsTransientError)
+		Expect(err).To(BeIdenticalTo(originalErr))
+		Expect(attempts).To(Equal(1))
+	})
+
+	It("waits between half and all of each delay with Jitter", func() {
+		retryer.Delay = 100 * time.Millisecond
+		retryer.Jitter = true
+
+		start := time.Now()
+		err := retryer.Do("apply", failTimes(1, errors.New("SlowDown")), retry.IsTransientError)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(logWriter.String()).To(ContainSubstring("apply failed with a transient error, retrying in"))
+	})
+
+	It("runs the operation once by default", func() {
+		err := retry.Retryer{}.Do("apply", failTimes(10, errors.New("i/o timeout")), retry.IsTransientError)
+		Expect(err).To(HaveOccurred())
+		Expect(attempts).To(Equal(1))
+	})
+})
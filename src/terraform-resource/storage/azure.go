@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azureAPIVersion = "2020-10-02"
+
+	// AzureBlockSize is the largest chunk sent in a single request, larger
+	// state files are uploaded as a list of blocks of this size
+	AzureBlockSize = 4 * 1024 * 1024
+
+	azureCopyPollInterval = time.Second
+	azureCopyTimeout      = 5 * time.Minute
+)
+
+type azure struct {
+	client   *http.Client
+	model    Model
+	baseURL  *url.URL
+	sasQuery url.Values
+}
+
+func NewAzure(m Model) (Storage, error) {
+	endpoint := m.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", m.StorageAccountName)
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid `storage.endpoint` '%s': %s", endpoint, err)
+	}
+
+	sasQuery, err := url.ParseQuery(strings.TrimPrefix(m.SASToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid `storage.sas_token`: %w", err)
+	}
+	if m.AccessKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(m.AccessKey); err != nil {
+			return nil, fmt.Errorf("Invalid `storage.access_key`, expected a base64 encoded key: %w", err)
+		}
+	}
+
+	client := m.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &azure{
+		client:   client,
+		model:    m,
+		baseURL:  baseURL,
+		sasQuery: sasQuery,
+	}, nil
+}
+
+func (a *azure) Download(filename string, destination io.Writer) (Version, error) {
+	resp, err := a.do(http.MethodGet, a.blobPath(filename), nil, nil, nil)
+	if err != nil {
+		return Version{}, fmt.Errorf("Get Blob request failed.\nError: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err = io.Copy(destination, resp.Body); err != nil {
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %w", err)
+	}
+
+	return azureVersion(filename, resp.Header)
+}
+
+// Upload sends content in a single Put Blob request if it fits in one block,
+// otherwise as blocks committed by a final Put Block List so state files of
+// any size are supported
+func (a *azure) Upload(filename string, content io.Reader) (Version, error) {
+	blobPath := a.blobPath(filename)
+
+	block := make([]byte, AzureBlockSize)
+	n, err := io.ReadFull(content, block)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		headers := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+		resp, err := a.do(http.MethodPut, blobPath, nil, headers, block[:n])
+		if err != nil {
+			return Version{}, fmt.Errorf("Failed to Upload to Azure: %w", err)
+		}
+		resp.Body.Close()
+		return a.Version(filename)
+	}
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to read upload content: %w", err)
+	}
+
+	blockIDs := []string{}
+	for n > 0 {
+		// IDs must all be the same length within a blob
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(blockIDs))))
+		query := url.Values{"comp": {"block"}, "blockid": {blockID}}
+		resp, err := a.do(http.MethodPut, blobPath, query, nil, block[:n])
+		if err != nil {
+			return Version{}, fmt.Errorf("Failed to Upload block %d to Azure: %w", len(blockIDs), err)
+		}
+		resp.Body.Close()
+		blockIDs = append(blockIDs, blockID)
+
+		n, err = io.ReadFull(content, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return Version{}, fmt.Errorf("Failed to read upload content: %w", err)
+		}
+	}
+
+	blockList, err := xml.Marshal(azureBlockList{Latest: blockIDs})
+	if err != nil {
+		return Version{}, err
+	}
+	resp, err := a.do(http.MethodPut, blobPath, url.Values{"comp": {"blocklist"}}, nil, blockList)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to commit block list to Azure: %w", err)
+	}
+	resp.Body.Close()
+
+	return a.Version(filename)
+}
+
+func (a *azure) Delete(filename string) error {
+	resp, err := a.do(http.MethodDelete, a.blobPath(filename), nil, nil, nil)
+	if err != nil {
+		if isAzureStatus(err, http.StatusNotFound) {
+			return nil // already gone
+		}
+		return fmt.Errorf("Delete Blob request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Move copies then deletes as blob storage has no native rename, so a failure
+// between the two requests leaves both blobs behind rather than neither
+func (a *azure) Move(srcKey string, dstKey string) error {
+	existing, err := a.Version(dstKey)
+	if err != nil {
+		return err
+	}
+	if !existing.IsZero() {
+		return ErrMoveConflict
+	}
+
+	source := a.blobURL(a.blobPath(srcKey))
+	if len(a.sasQuery) > 0 {
+		source.RawQuery = a.sasQuery.Encode()
+	}
+	headers := http.Header{
+		"X-Ms-Copy-Source": {source.String()},
+		// guards against a blob created since the check above
+		"If-None-Match": {"*"},
+	}
+	resp, err := a.do(http.MethodPut, a.blobPath(dstKey), nil, headers, nil)
+	if err != nil {
+		if isAzureStatus(err, http.StatusConflict) || isAzureStatus(err, http.StatusPreconditionFailed) {
+			return ErrMoveConflict
+		}
+		return fmt.Errorf("Copy Blob request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+
+	if err := a.waitForCopy(dstKey, resp.Header.Get("X-Ms-Copy-Status")); err != nil {
+		return err
+	}
+
+	return a.Delete(srcKey)
+}
+
+// waitForCopy polls until a Copy Blob completes, which is usually immediate
+// within the same storage account but may be reported as `pending`
+func (a *azure) waitForCopy(dstKey string, status string) error {
+	deadline := time.Now().Add(azureCopyTimeout)
+	for status == "pending" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out after %s waiting for the copy to '%s' to complete", azureCopyTimeout, dstKey)
+		}
+		time.Sleep(azureCopyPollInterval)
+
+		resp, err := a.do(http.MethodHead, a.blobPath(dstKey), nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("Get Blob Properties request failed.\nError: %w", err)
+		}
+		resp.Body.Close()
+		status = resp.Header.Get("X-Ms-Copy-Status")
+	}
+	if status != "" && status != "success" {
+		return fmt.Errorf("Copy to '%s' did not succeed, status: %s", dstKey, status)
+	}
+	return nil
+}
+
+func (a *azure) Version(filename string) (Version, error) {
+	resp, err := a.do(http.MethodHead, a.blobPath(filename), nil, nil, nil)
+	if err != nil {
+		if isAzureStatus(err, http.StatusNotFound) {
+			return Version{}, nil // no versions exist
+		}
+		return Version{}, fmt.Errorf("Get Blob Properties request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+
+	return azureVersion(filename, resp.Header)
+}
+
+func (a *azure) LatestVersion(filterRegex string) (Version, error) {
+	regex := regexp.MustCompile(filterRegex)
+
+	var latest *azureBlob
+	marker := ""
+	for {
+		query := url.Values{
+			"restype": {"container"},
+			"comp":    {"list"},
+			"prefix":  {a.model.BucketPath},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := a.do(http.MethodGet, a.model.Container, query, nil, nil)
+		if err != nil {
+			return Version{}, fmt.Errorf("List Blobs request failed.\nError: %w", err)
+		}
+		var results azureEnumerationResults
+		err = xml.NewDecoder(resp.Body).Decode(&results)
+		resp.Body.Close()
+		if err != nil {
+			return Version{}, fmt.Errorf("Failed to parse List Blobs response: %w", err)
+		}
+
+		for i, blob := range results.Blobs {
+			if !regex.MatchString(blob.Name) {
+				continue
+			}
+			lastModified, err := http.ParseTime(blob.Properties.LastModified)
+			if err != nil {
+				return Version{}, fmt.Errorf("Failed to parse Last-Modified of blob '%s': %s", blob.Name, err)
+			}
+			results.Blobs[i].lastModified = lastModified
+			if latest == nil || latest.lastModified.Before(lastModified) {
+				latest = &results.Blobs[i]
+			}
+		}
+
+		marker = results.NextMarker
+		if marker == "" {
+			break
+		}
+	}
+	if latest == nil {
+		return Version{}, nil // no versions exist
+	}
+
+	return Version{
+		LastModified: latest.lastModified,
+		StateFile:    path.Base(latest.Name),
+		ETag:         latest.Properties.ETag,
+	}, nil
+}
+
+func (a *azure) blobPath(filename string) string {
+	return path.Join(a.model.Container, a.model.BucketPath, filename)
+}
+
+func (a *azure) blobURL(resourcePath string) *url.URL {
+	u := *a.baseURL
+	u.Path = u.Path + "/" + resourcePath
+	return &u
+}
+
+// do sends a request for the container or blob at resourcePath, returning an
+// azureError for any non-2xx response
+func (a *azure) do(method string, resourcePath string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	u := a.blobURL(resourcePath)
+	allQuery := url.Values{}
+	for key, values := range query {
+		allQuery[key] = values
+	}
+	for key, values := range a.sasQuery {
+		allQuery[key] = values
+	}
+	u.RawQuery = allQuery.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	req.ContentLength = int64(len(body))
+	if a.model.AccessKey != "" {
+		if err := a.signSharedKey(req, query); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, azureError{
+			StatusCode: resp.StatusCode,
+			Code:       resp.Header.Get("X-Ms-Error-Code"),
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+	return resp, nil
+}
+
+// signSharedKey adds the Shared Key Authorization header described in
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (a *azure) signSharedKey(req *http.Request, query url.Values) error {
+	key, err := base64.StdEncoding.DecodeString(a.model.AccessKey)
+	if err != nil {
+		return err
+	}
+
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	msHeaders := []string{}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	canonicalHeaders := ""
+	for _, name := range msHeaders {
+		canonicalHeaders += fmt.Sprintf("%s:%s\n", name, strings.TrimSpace(req.Header.Get(name)))
+	}
+
+	canonicalResource := "/" + a.model.StorageAccountName + req.URL.EscapedPath()
+	queryNames := []string{}
+	for name := range query {
+		queryNames = append(queryNames, strings.ToLower(name))
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		canonicalResource += fmt.Sprintf("\n%s:%s", name, strings.Join(values, ","))
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders + canonicalResource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", a.model.StorageAccountName, signature))
+	return nil
+}
+
+func azureVersion(filename string, header http.Header) (Version, error) {
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to parse Last-Modified of blob '%s': %s", filename, err)
+	}
+	return Version{
+		LastModified: lastModified,
+		StateFile:    filename,
+		ETag:         header.Get("ETag"),
+	}, nil
+}
+
+type azureError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e azureError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func isAzureStatus(err error, statusCode int) bool {
+	azureErr, ok := err.(azureError)
+	return ok && azureErr.StatusCode == statusCode
+}
+
+type azureBlockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+type azureEnumerationResults struct {
+	Blobs      []azureBlob `xml:"Blobs>Blob"`
+	NextMarker string      `xml:"NextMarker"`
+}
+
+type azureBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified string `xml:"Last-Modified"`
+		ETag         string `xml:"Etag"`
+	} `xml:"Properties"`
+
+	lastModified time.Time
+}
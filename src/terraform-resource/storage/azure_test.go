@@ -0,0 +1,309 @@
+package storage_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeBlobService implements enough of the Azure Blob REST API for the driver
+type fakeBlobService struct {
+	mu           sync.Mutex
+	blobs        map[string][]byte
+	modified     map[string]time.Time
+	blocks       map[string][]byte
+	requests     []*http.Request
+	etagCounter  int
+	etags        map[string]string
+	listPageSize int
+}
+
+func newFakeBlobService() *fakeBlobService {
+	return &fakeBlobService{
+		blobs:        map[string][]byte{},
+		modified:     map[string]time.Time{},
+		blocks:       map[string][]byte{},
+		etags:        map[string]string{},
+		listPageSize: 1000,
+	}
+}
+
+func (f *fakeBlobService) put(name string, content []byte, modified time.Time) {
+	f.blobs[name] = content
+	f.modified[name] = modified
+	f.etagCounter++
+	f.etags[name] = fmt.Sprintf(`"0x%d"`, f.etagCounter)
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	writeProperties := func(name string) {
+		w.Header().Set("Last-Modified", f.modified[name].Format(http.TimeFormat))
+		w.Header().Set("ETag", f.etags[name])
+	}
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		f.list(w, name, query)
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		f.blocks[name+"/"+query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		Expect(xml.Unmarshal(body, &list)).To(Succeed())
+		content := []byte{}
+		for _, id := range list.Latest {
+			content = append(content, f.blocks[name+"/"+id]...)
+		}
+		f.put(name, content, time.Now())
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.Header.Get("X-Ms-Copy-Source") != "":
+		if _, ok := f.blobs[name]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		source := strings.SplitN(r.Header.Get("X-Ms-Copy-Source"), "/", 4)[3]
+		source = strings.SplitN(source, "?", 2)[0]
+		f.put(name, f.blobs[source], time.Now())
+		w.Header().Set("X-Ms-Copy-Status", "success")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut:
+		f.put(name, body, time.Now())
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.blobs[name]
+		if !ok {
+			w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeProperties(name)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeBlobService) list(w http.ResponseWriter, container string, query map[string][]string) {
+	prefix := container + "/" + strings.Join(query["prefix"], "")
+	names := []string{}
+	for name := range f.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, strings.TrimPrefix(name, container+"/"))
+		}
+	}
+	sort.Strings(names)
+
+	start := 0
+	if marker := strings.Join(query["marker"], ""); marker != "" {
+		start = sort.SearchStrings(names, marker)
+	}
+	end := start + f.listPageSize
+	nextMarker := ""
+	if end < len(names) {
+		nextMarker = names[end]
+	} else {
+		end = len(names)
+	}
+
+	fmt.Fprint(w, "<EnumerationResults><Blobs>")
+	for _, name := range names[start:end] {
+		fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Etag>%s</Etag></Properties></Blob>",
+			name, f.modified[container+"/"+name].Format(http.TimeFormat), f.etags[container+"/"+name])
+	}
+	fmt.Fprintf(w, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", nextMarker)
+}
+
+var _ = Describe("Azure", func() {
+	var (
+		server *httptest.Server
+		fake   *fakeBlobService
+		model  storage.Model
+		driver storage.Storage
+	)
+
+	BeforeEach(func() {
+		fake = newFakeBlobService()
+		server = httptest.NewServer(fake)
+
+		model = storage.Model{
+			Driver:             storage.AzureDriver,
+			StorageAccountName: "fakeaccount",
+			Container:          "fake-container",
+			BucketPath:         "fake-path",
+			AccessKey:          "ZmFrZS1hY2Nlc3Mta2V5",
+			Endpoint:           server.URL,
+		}
+	})
+
+	JustBeforeEach(func() {
+		driver = storage.BuildDriver(model)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("when `driver` is the `azure-blob` alias", func() {
+		BeforeEach(func() {
+			model.Driver = storage.AzureBlobDriver
+		})
+
+		It("builds the azure driver", func() {
+			_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fake.blobs).To(HaveKey("fake-container/fake-path/staging.tfstate"))
+		})
+	})
+
+	It("uploads and downloads a state file with its last-modified and ETag", func() {
+		uploaded, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uploaded.StateFile).To(Equal("staging.tfstate"))
+		Expect(uploaded.LastModified).ToNot(BeZero())
+		Expect(uploaded.ETag).ToNot(BeEmpty())
+		Expect(fake.blobs).To(HaveKey("fake-container/fake-path/staging.tfstate"))
+
+		contents := &bytes.Buffer{}
+		downloaded, err := driver.Download("staging.tfstate", contents)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents.String()).To(Equal("fake-state"))
+		Expect(downloaded).To(Equal(uploaded))
+	})
+
+	It("signs requests with the shared key", func() {
+		_, err := driver.Version("staging.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fake.requests).To(HaveLen(1))
+		Expect(fake.requests[0].Header.Get("Authorization")).To(HavePrefix("SharedKey fakeaccount:"))
+		Expect(fake.requests[0].Header.Get("X-Ms-Version")).ToNot(BeEmpty())
+	})
+
+	It("uploads large state files as a list of blocks", func() {
+		content := bytes.Repeat([]byte("a"), 2*storage.AzureBlockSize+10)
+
+		_, err := driver.Upload("large.tfstate", bytes.NewReader(content))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.blobs["fake-container/fake-path/large.tfstate"]).To(Equal(content))
+
+		blockRequests := 0
+		for _, req := range fake.requests {
+			if req.URL.Query().Get("comp") == "block" {
+				blockRequests++
+			}
+		}
+		Expect(blockRequests).To(Equal(3))
+	})
+
+	It("returns an empty version if the blob doesn't exist", func() {
+		version, err := driver.Version("missing.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.IsZero()).To(BeTrue())
+	})
+
+	It("ignores deleting a blob which doesn't exist", func() {
+		Expect(driver.Delete("missing.tfstate")).To(Succeed())
+	})
+
+	It("deletes a blob", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(fake.blobs).To(BeEmpty())
+	})
+
+	It("moves a blob", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Move("staging.tfstate", "production.tfstate")).To(Succeed())
+		Expect(fake.blobs).To(Equal(map[string][]byte{
+			"fake-container/fake-path/production.tfstate": []byte("fake-state"),
+		}))
+	})
+
+	It("refuses to move a blob onto an existing one", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = driver.Upload("production.tfstate", strings.NewReader("other-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Move("staging.tfstate", "production.tfstate")).To(MatchError(storage.ErrMoveConflict))
+		Expect(fake.blobs).To(HaveLen(2))
+	})
+
+	It("returns the latest matching version across pages", func() {
+		fake.listPageSize = 1
+		now := time.Now().UTC().Truncate(time.Second)
+		fake.put("fake-container/fake-path/a.tfstate", []byte("a"), now.Add(-2*time.Hour))
+		fake.put("fake-container/fake-path/b.tfstate", []byte("b"), now)
+		fake.put("fake-container/fake-path/c.tfstate", []byte("c"), now.Add(-time.Hour))
+		fake.put("fake-container/fake-path/d.plan", []byte("d"), now.Add(time.Hour))
+
+		version, err := driver.LatestVersion(`\.tfstate$`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.StateFile).To(Equal("b.tfstate"))
+		Expect(version.LastModified).To(Equal(now))
+		Expect(version.ETag).To(Equal(fake.etags["fake-container/fake-path/b.tfstate"]))
+	})
+
+	Context("when a SAS token is given", func() {
+		BeforeEach(func() {
+			model.AccessKey = ""
+			model.SASToken = "?sv=2020-10-02&sig=fake-signature"
+		})
+
+		It("adds the token to each request instead of signing", func() {
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fake.requests).To(HaveLen(1))
+			Expect(fake.requests[0].Header.Get("Authorization")).To(BeEmpty())
+			Expect(fake.requests[0].URL.Query().Get("sig")).To(Equal("fake-signature"))
+		})
+	})
+
+	Context("when the driver is unknown", func() {
+		BeforeEach(func() {
+			model.Driver = "azrue"
+		})
+
+		It("fails each operation listing the supported drivers", func() {
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).To(MatchError("Unknown value for `storage.driver`: 'azrue', Supported driver values: '', 's3', 'azure', 'azure-blob', 'swift', 'local'"))
+		})
+	})
+})
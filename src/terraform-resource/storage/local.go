@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// local stores each file under `base_path`, e.g. a bind-mounted volume
+type local struct {
+	model Model
+}
+
+// localTempPrefix marks partial uploads, which are never listed as versions
+const localTempPrefix = ".terraform-resource-upload-"
+
+func NewLocal(m Model) Storage {
+	return &local{
+		model: m,
+	}
+}
+
+func (l *local) Download(filename string, destination io.Writer) (Version, error) {
+	file, err := os.Open(l.path(filename))
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to open '%s': %s", l.path(filename), err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Version{}, err
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(destination, hash), file); err != nil {
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %s", err)
+	}
+
+	return Version{
+		LastModified: info.ModTime(),
+		StateFile:    filename,
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Upload writes to a temp file in the same directory then renames it into
+// place, so a reader never sees a partially written file
+func (l *local) Upload(filename string, content io.Reader) (Version, error) {
+	destination := l.path(filename)
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return Version{}, fmt.Errorf("Failed to create directory for '%s': %s", destination, err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(destination), localTempPrefix)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to create temp file for '%s': %s", destination, err)
+	}
+	defer os.Remove(tmpFile.Name()) // no-op after the rename
+
+	_, err = io.Copy(tmpFile, content)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to write '%s': %s", destination, err)
+	}
+	// TempFile creates the file with 0600
+	if err = os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return Version{}, err
+	}
+
+	if err = os.Rename(tmpFile.Name(), destination); err != nil {
+		return Version{}, fmt.Errorf("Failed to move upload into place at '%s': %s", destination, err)
+	}
+
+	return l.Version(filename)
+}
+
+func (l *local) Delete(filename string) error {
+	err := os.Remove(l.path(filename))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to delete '%s': %s", l.path(filename), err)
+	}
+	return nil // nil if already gone
+}
+
+// Move hard links the file to its new name before removing the old one, as
+// unlike a rename the link fails rather than replacing an existing file
+func (l *local) Move(srcKey string, dstKey string) error {
+	destination := l.path(dstKey)
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory for '%s': %s", destination, err)
+	}
+
+	if err := os.Link(l.path(srcKey), destination); err != nil {
+		if os.IsExist(err) {
+			return ErrMoveConflict
+		}
+		return fmt.Errorf("Failed to move '%s' to '%s': %s", l.path(srcKey), destination, err)
+	}
+
+	return l.Delete(srcKey)
+}
+
+func (l *local) Version(filename string) (Version, error) {
+	return l.version(l.path(filename), filename)
+}
+
+func (l *local) LatestVersion(filterRegex string) (Version, error) {
+	regex := regexp.MustCompile(filterRegex)
+
+	latestPath := ""
+	var latest os.FileInfo
+	err := filepath.Walk(l.model.BasePath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), localTempPrefix) {
+			return nil
+		}
+		relPath, err := filepath.Rel(l.model.BasePath, filePath)
+		if err != nil {
+			return err
+		}
+		if !regex.MatchString(filepath.ToSlash(relPath)) {
+			return nil
+		}
+		if latest == nil || latest.ModTime().Before(info.ModTime()) {
+			latestPath = filePath
+			latest = info
+		}
+		return nil
+	})
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to list files in '%s': %s", l.model.BasePath, err)
+	}
+	if latest == nil {
+		return Version{}, nil // no versions exist
+	}
+
+	return l.version(latestPath, filepath.Base(latestPath))
+}
+
+func (l *local) path(filename string) string {
+	return filepath.Join(l.model.BasePath, filename)
+}
+
+// version is the mtime and a SHA-256 of the contents of filePath, or the
+// zero Version if it doesn't exist
+func (l *local) version(filePath string, stateFile string) (Version, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Version{}, nil // no versions exist
+		}
+		return Version{}, fmt.Errorf("Failed to open '%s': %s", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Version{}, err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return Version{}, fmt.Errorf("Failed to read '%s': %s", filePath, err)
+	}
+
+	return Version{
+		LastModified: info.ModTime(),
+		StateFile:    stateFile,
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// validateBasePath checks `base_path` is an existing directory this process
+// can create files in
+func validateBasePath(basePath string) error {
+	info, err := os.Stat(basePath)
+	if err != nil {
+		return fmt.Errorf("`storage.base_path` '%s' must be an existing directory: %s", basePath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("`storage.base_path` '%s' must be a directory", basePath)
+	}
+
+	probe, err := ioutil.TempFile(basePath, localTempPrefix)
+	if err != nil {
+		return fmt.Errorf("`storage.base_path` '%s' must be writable: %s", basePath, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,139 @@
+package storage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Local", func() {
+	var (
+		basePath string
+		driver   storage.Storage
+	)
+
+	BeforeEach(func() {
+		var err error
+		basePath, err = ioutil.TempDir(os.TempDir(), "terraform-resource-local-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		driver = storage.BuildDriver(storage.Model{
+			Driver:   storage.LocalDriver,
+			BasePath: basePath,
+		})
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(basePath)
+	})
+
+	It("uploads and downloads a state file with its mtime and hash", func() {
+		uploaded, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uploaded.StateFile).To(Equal("staging.tfstate"))
+		Expect(uploaded.LastModified).ToNot(BeZero())
+		// sha256 of "fake-state"
+		Expect(uploaded.ETag).To(HaveLen(64))
+
+		contents, err := ioutil.ReadFile(path.Join(basePath, "staging.tfstate"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("fake-state"))
+
+		downloaded := &bytes.Buffer{}
+		version, err := driver.Download("staging.tfstate", downloaded)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(downloaded.String()).To(Equal("fake-state"))
+		Expect(version).To(Equal(uploaded))
+	})
+
+	It("leaves no temp files behind after an upload", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		files, err := ioutil.ReadDir(basePath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+	})
+
+	It("returns an empty version if the file doesn't exist", func() {
+		version, err := driver.Version("missing.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.IsZero()).To(BeTrue())
+	})
+
+	It("deletes a file and ignores one which doesn't exist", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(path.Join(basePath, "staging.tfstate")).ToNot(BeAnExistingFile())
+	})
+
+	It("moves a file, refusing to overwrite an existing one", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = driver.Upload("other.tfstate", strings.NewReader("other-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Move("staging.tfstate", "other.tfstate")).To(MatchError(storage.ErrMoveConflict))
+
+		Expect(driver.Move("staging.tfstate", "production.tfstate")).To(Succeed())
+		Expect(path.Join(basePath, "staging.tfstate")).ToNot(BeAnExistingFile())
+		contents, err := ioutil.ReadFile(path.Join(basePath, "production.tfstate"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("fake-state"))
+	})
+
+	It("returns the latest matching version", func() {
+		now := time.Now().Truncate(time.Second)
+		for name, modified := range map[string]time.Time{
+			"a.tfstate": now.Add(-2 * time.Hour),
+			"b.tfstate": now,
+			"c.tfstate": now.Add(-time.Hour),
+			"d.tfplan":  now.Add(time.Hour),
+		} {
+			_, err := driver.Upload(name, strings.NewReader(name))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Chtimes(path.Join(basePath, name), modified, modified)).To(Succeed())
+		}
+
+		version, err := driver.LatestVersion(`.*\.tfstate$`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.StateFile).To(Equal("b.tfstate"))
+		Expect(version.LastModified).To(BeTemporally("==", now))
+	})
+
+	Describe("Model#Validate", func() {
+		It("accepts an existing writable base_path", func() {
+			model := storage.Model{Driver: storage.LocalDriver, BasePath: basePath}
+			Expect(model.Validate()).To(Succeed())
+		})
+
+		It("requires base_path", func() {
+			model := storage.Model{Driver: storage.LocalDriver}
+			Expect(model.Validate()).To(MatchError("Missing fields: 'storage.base_path'"))
+		})
+
+		It("returns error if base_path doesn't exist", func() {
+			model := storage.Model{Driver: storage.LocalDriver, BasePath: path.Join(basePath, "missing")}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("must be an existing directory")))
+		})
+
+		It("returns error if base_path is a file", func() {
+			filePath := path.Join(basePath, "some-file")
+			Expect(ioutil.WriteFile(filePath, []byte{}, 0644)).To(Succeed())
+
+			model := storage.Model{Driver: storage.LocalDriver, BasePath: filePath}
+			Expect(model.Validate()).To(MatchError(ContainSubstring("must be a directory")))
+		})
+	})
+})
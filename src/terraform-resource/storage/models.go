@@ -2,17 +2,41 @@ package storage
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
+
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/retry"
 )
 
 const (
-	S3Driver = "s3"
+	S3Driver    = "s3"
+	AzureDriver = "azure"
+	SwiftDriver = "swift"
+	LocalDriver = "local"
+
+	// AzureBlobDriver is an alias of AzureDriver
+	AzureBlobDriver = "azure-blob"
 )
 
+// KnownDrivers are the valid values of `storage.driver`, where empty means s3
+var KnownDrivers = []string{
+	"",
+	S3Driver,
+	AzureDriver,
+	AzureBlobDriver,
+	SwiftDriver,
+	LocalDriver,
+}
+
 type Model struct {
 	Driver string `json:"driver"`
 
+	// Retries of transient errors, for every driver
+	MaxRetries *int `json:"max_retries,omitempty"` // optional, defaults to DefaultMaxRetries
+
 	// S3 driver
 	Bucket               string `json:"bucket"`
 	BucketPath           string `json:"bucket_path"`
@@ -24,36 +48,100 @@ type Model struct {
 	UseSigningV4         bool   `json:"use_signing_v4,omitempty"`         // optional
 	ServerSideEncryption string `json:"server_side_encryption,omitempty"` //optional
 	SSEKMSKeyId          string `json:"sse_kms_key_id,omitempty"`         //optional
+	KMSKeyID             string `json:"kms_key_id,omitempty"`             // optional, requires server_side_encryption: aws:kms
+	CACert               string `json:"ca_cert,omitempty"`                // optional, PEM encoded CA of the `endpoint`
+	UsePathStyle         *bool  `json:"use_path_style,omitempty"`         // optional, defaults to true
+	InsecureSkipVerify   bool   `json:"insecure_skip_verify,omitempty"`   // optional
+
+	// Azure driver, also uses `bucket_path` and `endpoint`, e.g. for Azurite
+	StorageAccountName string `json:"storage_account_name,omitempty"`
+	Container          string `json:"container,omitempty"`
+	AccessKey          string `json:"access_key,omitempty"` // either access_key or sas_token
+	SASToken           string `json:"sas_token,omitempty"`
+
+	// Swift driver with Keystone v3 auth, also uses `container`,
+	// `bucket_path`, `region_name`, and `endpoint` to skip the catalog
+	AuthURL                     string `json:"auth_url,omitempty"`
+	Username                    string `json:"username,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	UserDomainName              string `json:"user_domain_name,omitempty"` // optional
+	ProjectName                 string `json:"project_name,omitempty"`
+	ProjectDomainName           string `json:"project_domain_name,omitempty"` // optional
+	ApplicationCredentialID     string `json:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+
+	// Local driver, a directory which must already exist
+	BasePath string `json:"base_path,omitempty"`
+
+	// Replaces the access keys with a role assumed via OIDC, e.g. IRSA
+	WebIdentityTokenFile string `json:"web_identity_token_file,omitempty"` // optional
+	OIDCRoleARN          string `json:"oidc_role_arn,omitempty"`           // optional
+
+	// Without access keys or a web identity, the credentials are found by
+	// the default AWS chain: env vars, shared config, then instance metadata
+	Profile string `json:"profile,omitempty"` // optional, a shared config profile
+
+	// Exchanges the credentials for a role's credentials
+	AssumeRole *AssumeRole `json:"assume_role,omitempty"` // optional
+
+	// HTTPClient is set from `source.ca_cert`, nil uses the default client
+	HTTPClient *http.Client `json:"-"`
+}
+
+// AssumeRole is the role the S3 driver assumes with STS before accessing the
+// bucket, e.g. in another account
+type AssumeRole struct {
+	RoleARN     string `json:"role_arn"`
+	SessionName string `json:"session_name,omitempty"` // optional
+	ExternalID  string `json:"external_id,omitempty"`  // optional
+	Duration    string `json:"duration,omitempty"`     // optional, e.g. "1h"
+}
+
+// minAssumeRoleDuration is the shortest session STS allows
+const minAssumeRoleDuration = 15 * time.Minute
+
+// DurationValue is zero when Duration is unset, to use the STS default
+func (a AssumeRole) DurationValue() time.Duration {
+	duration, _ := time.ParseDuration(a.Duration) // checked by Validate
+	return duration
+}
+
+func (a AssumeRole) validate(fieldPrefix string) error {
+	if a.RoleARN == "" {
+		return fmt.Errorf("Missing fields: '%s.assume_role.role_arn'", fieldPrefix)
+	}
+	if a.Duration == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(a.Duration)
+	if err != nil {
+		return fmt.Errorf("Invalid `%s.assume_role.duration` '%s': %s", fieldPrefix, a.Duration, err)
+	}
+	if duration < minAssumeRoleDuration {
+		return fmt.Errorf("Invalid `%s.assume_role.duration` '%s', must be at least %s", fieldPrefix, a.Duration, minAssumeRoleDuration)
+	}
+	return nil
 }
 
 type Version struct {
 	LastModified time.Time
 	StateFile    string
 	PlanFile     string
+	// ETag is only set by drivers which report one, e.g. azure
+	ETag string
+	// VersionID is only set by s3 for a bucket with versioning enabled, and
+	// identifies this exact object even after a newer upload to the key
+	VersionID string
 }
 
 func (m Model) Validate() error {
 
-	knownDrivers := []string{
-		"",
-		S3Driver,
-	}
-	isUnknownDriver := true
-	for _, driver := range knownDrivers {
-		if driver == m.Driver {
-			isUnknownDriver = false
-			break
-		}
+	if err := unknownDriverError(m.Driver); err != nil {
+		return err
 	}
-	if isUnknownDriver {
-		for i, value := range knownDrivers {
-			knownDrivers[i] = fmt.Sprintf("'%s'", value)
-		}
-		return fmt.Errorf(
-			"Unknown value for `storage.driver`: '%s', Supported driver values: %s",
-			m.Driver,
-			strings.Join(knownDrivers, ", "),
-		)
+
+	if m.MaxRetries != nil && *m.MaxRetries < 0 {
+		return fmt.Errorf("`storage.max_retries` must not be negative, got '%d'", *m.MaxRetries)
 	}
 
 	missingFields := []string{}
@@ -65,11 +153,106 @@ func (m Model) Validate() error {
 		if m.BucketPath == "" {
 			missingFields = append(missingFields, fmt.Sprintf("%s.bucket_path", fieldPrefix))
 		}
-		if m.AccessKeyID == "" {
-			missingFields = append(missingFields, fmt.Sprintf("%s.access_key_id", fieldPrefix))
+		if m.KMSKeyID != "" && m.ServerSideEncryption != KMSEncryption {
+			return fmt.Errorf("`%[1]s.kms_key_id` requires `%[1]s.server_side_encryption: %[2]s`", fieldPrefix, KMSEncryption)
+		}
+		if m.KMSKeyID != "" && m.SSEKMSKeyId != "" && m.KMSKeyID != m.SSEKMSKeyId {
+			return fmt.Errorf("`%[1]s.kms_key_id` and `%[1]s.sse_kms_key_id` must not name different keys", fieldPrefix)
+		}
+		if m.CACert != "" {
+			if _, err := cacert.Parse(m.CACert); err != nil {
+				return fmt.Errorf("Invalid `%s.ca_cert`: %s", fieldPrefix, err)
+			}
+			if m.InsecureSkipVerify {
+				return fmt.Errorf("Cannot specify both `%[1]s.ca_cert` and `%[1]s.insecure_skip_verify`", fieldPrefix)
+			}
+		}
+		if m.AssumeRole != nil {
+			if err := m.AssumeRole.validate(fieldPrefix); err != nil {
+				return err
+			}
+		}
+		if (m.WebIdentityTokenFile == "") != (m.OIDCRoleARN == "") {
+			return fmt.Errorf("`%[1]s.web_identity_token_file` and `%[1]s.oidc_role_arn` must be set together", fieldPrefix)
+		}
+		if m.Profile != "" && (m.AccessKeyID != "" || m.SecretAccessKey != "" || m.UsesWebIdentity()) {
+			return fmt.Errorf("Cannot specify `%[1]s.profile` with `%[1]s.access_key_id` or `%[1]s.web_identity_token_file`", fieldPrefix)
+		}
+		if !m.UsesWebIdentity() && (m.AccessKeyID != "" || m.SecretAccessKey != "") {
+			if m.AccessKeyID == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.access_key_id", fieldPrefix))
+			}
+			if m.SecretAccessKey == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.secret_access_key", fieldPrefix))
+			}
+		}
+		// the default chain only finds a region in a shared config profile
+		if m.UsesDefaultCredentials() && m.RegionName == "" && m.Profile == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.region_name", fieldPrefix))
+		}
+	}
+
+	if m.Driver == AzureDriver || m.Driver == AzureBlobDriver {
+		fieldPrefix := "storage"
+		if m.StorageAccountName == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.storage_account_name", fieldPrefix))
+		}
+		if m.Container == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.container", fieldPrefix))
+		}
+		if m.BucketPath == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.bucket_path", fieldPrefix))
+		}
+		if m.AccessKey != "" && m.SASToken != "" {
+			return fmt.Errorf("Cannot specify both `%[1]s.access_key` and `%[1]s.sas_token`", fieldPrefix)
 		}
-		if m.SecretAccessKey == "" {
-			missingFields = append(missingFields, fmt.Sprintf("%s.secret_access_key", fieldPrefix))
+		if m.AccessKey == "" && m.SASToken == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%[1]s.access_key' or '%[1]s.sas_token", fieldPrefix))
+		}
+	}
+
+	if m.Driver == SwiftDriver {
+		fieldPrefix := "storage"
+		if m.AuthURL == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.auth_url", fieldPrefix))
+		}
+		if m.Container == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.container", fieldPrefix))
+		}
+		if m.BucketPath == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.bucket_path", fieldPrefix))
+		}
+		usesPassword := m.Username != "" || m.Password != "" || m.ProjectName != ""
+		usesApplicationCredential := m.ApplicationCredentialID != "" || m.ApplicationCredentialSecret != ""
+		if usesPassword && usesApplicationCredential {
+			return fmt.Errorf("Cannot specify both `%[1]s.username` and `%[1]s.application_credential_id`", fieldPrefix)
+		}
+		if usesApplicationCredential {
+			if m.ApplicationCredentialID == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.application_credential_id", fieldPrefix))
+			}
+			if m.ApplicationCredentialSecret == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.application_credential_secret", fieldPrefix))
+			}
+		} else {
+			if m.Username == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.username", fieldPrefix))
+			}
+			if m.Password == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.password", fieldPrefix))
+			}
+			if m.ProjectName == "" {
+				missingFields = append(missingFields, fmt.Sprintf("%s.project_name", fieldPrefix))
+			}
+		}
+	}
+
+	if m.Driver == LocalDriver {
+		fieldPrefix := "storage"
+		if m.BasePath == "" {
+			missingFields = append(missingFields, fmt.Sprintf("%s.base_path", fieldPrefix))
+		} else if err := validateBasePath(m.BasePath); err != nil {
+			return err
 		}
 	}
 
@@ -82,6 +265,104 @@ func (m Model) Validate() error {
 	return nil
 }
 
+// unknownDriverError lists the supported drivers if driver isn't one of them
+func unknownDriverError(driver string) error {
+	for _, known := range KnownDrivers {
+		if known == driver {
+			return nil
+		}
+	}
+
+	quoted := make([]string, len(KnownDrivers))
+	for i, value := range KnownDrivers {
+		quoted[i] = fmt.Sprintf("'%s'", value)
+	}
+	return fmt.Errorf(
+		"Unknown value for `storage.driver`: '%s', Supported driver values: %s",
+		driver,
+		strings.Join(quoted, ", "),
+	)
+}
+
+// DefaultMaxRetries is how many times a storage operation is retried after a
+// transient error if `max_retries` is unset
+const DefaultMaxRetries = 5
+
+// retryDelay is the delay before the first retry, doubled after each one
+const retryDelay = 1 * time.Second
+
+// Retryer retries transient errors up to `max_retries` times, logging each
+// retry to logger
+func (m Model) Retryer(logger logger.Logger) retry.Retryer {
+	maxRetries := DefaultMaxRetries
+	if m.MaxRetries != nil {
+		maxRetries = *m.MaxRetries
+	}
+	return retry.Retryer{
+		MaxRetries: maxRetries,
+		Delay:      retryDelay,
+		Logger:     logger,
+		Jitter:     true,
+	}
+}
+
+// KMSEncryption is the `server_side_encryption` which uses a KMS key
+const KMSEncryption = "aws:kms"
+
+// Encryption returns the server-side encryption and KMS key ID, if any, the
+// S3 driver sets on each object it writes. `sse_kms_key_id` implies aws:kms.
+func (m Model) Encryption() (string, string) {
+	kmsKeyID := m.KMSKeyID
+	if kmsKeyID == "" {
+		kmsKeyID = m.SSEKMSKeyId
+	}
+	if kmsKeyID != "" {
+		return KMSEncryption, kmsKeyID
+	}
+	return m.ServerSideEncryption, ""
+}
+
+// DescribeEncryption is safe to log as a KMS key ID isn't a secret, and is
+// empty if objects aren't encrypted by the driver
+func (m Model) DescribeEncryption() string {
+	sse, kmsKeyID := m.Encryption()
+	if kmsKeyID != "" {
+		return fmt.Sprintf("Storage objects are written with server-side encryption %s using KMS key '%s'", sse, kmsKeyID)
+	}
+	if sse != "" {
+		return fmt.Sprintf("Storage objects are written with server-side encryption %s", sse)
+	}
+	return ""
+}
+
+// InsecureWarning is non-empty if the S3 driver skips verifying the
+// endpoint's certificate, so the risk is visible in the build log
+func (m Model) InsecureWarning() string {
+	if !m.InsecureSkipVerify || (m.Driver != "" && m.Driver != S3Driver) {
+		return ""
+	}
+	return "`storage.insecure_skip_verify` is set: TLS certificates of the storage endpoint are NOT verified, " +
+		"so the statefile and credentials can be intercepted. Set `storage.ca_cert` instead."
+}
+
+// ShouldUsePathStyle is true unless `use_path_style: false` asks for
+// virtual-hosted-style addressing, i.e. `<bucket>.<endpoint>/<key>`
+func (m Model) ShouldUsePathStyle() bool {
+	return m.UsePathStyle == nil || *m.UsePathStyle
+}
+
+// UsesWebIdentity is true if the S3 driver should assume OIDCRoleARN with
+// the token in WebIdentityTokenFile rather than use static access keys
+func (m Model) UsesWebIdentity() bool {
+	return m.WebIdentityTokenFile != "" && m.OIDCRoleARN != ""
+}
+
+// UsesDefaultCredentials is true if the S3 driver has neither access keys
+// nor a web identity, so uses the default AWS credential chain
+func (m Model) UsesDefaultCredentials() bool {
+	return m.AccessKeyID == "" && m.SecretAccessKey == "" && !m.UsesWebIdentity()
+}
+
 func (m Model) ShouldUseSigningV2() bool {
 	// Many s3-compatible endpoints do not support v4 signing
 	// Use v4 with AWS, default to v2 if other endpoint is set
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/storage"
 )
 
@@ -33,8 +34,7 @@ var _ = Describe("Storage Models", func() {
 				requiredFields := []string{
 					"storage.bucket",
 					"storage.bucket_path",
-					"storage.access_key_id",
-					"storage.secret_access_key",
+					"storage.region_name",
 				}
 
 				model := storage.Model{}
@@ -45,6 +45,176 @@ var _ = Describe("Storage Models", func() {
 				}
 			})
 
+			It("uses the default credential chain without access keys", func() {
+				model := storage.Model{
+					Bucket:     "fake-bucket",
+					BucketPath: "fake-bucket-path",
+					RegionName: "eu-west-1",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+				Expect(model.UsesDefaultCredentials()).To(BeTrue())
+			})
+
+			It("reads the region from `profile` without access keys", func() {
+				model := storage.Model{
+					Bucket:     "fake-bucket",
+					BucketPath: "fake-bucket-path",
+					Profile:    "ci",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+			})
+
+			It("returns error if only one of the access keys is set", func() {
+				model := storage.Model{
+					Bucket:      "fake-bucket",
+					BucketPath:  "fake-bucket-path",
+					AccessKeyID: "fake-access-key",
+				}
+
+				Expect(model.Validate()).To(MatchError("Missing fields: 'storage.secret_access_key'"))
+			})
+
+			It("returns error if `profile` is combined with access keys", func() {
+				model := storage.Model{
+					Bucket:          "fake-bucket",
+					BucketPath:      "fake-bucket-path",
+					AccessKeyID:     "fake-access-key",
+					SecretAccessKey: "fake-secret-key",
+					Profile:         "ci",
+				}
+
+				Expect(model.Validate()).To(MatchError("Cannot specify `storage.profile` with `storage.access_key_id` or `storage.web_identity_token_file`"))
+			})
+
+			It("does not require access keys with a web identity", func() {
+				model := storage.Model{
+					Driver:               storage.S3Driver,
+					Bucket:               "fake-bucket",
+					BucketPath:           "fake-bucket-path",
+					WebIdentityTokenFile: "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
+					OIDCRoleARN:          "arn:aws:iam::123456789012:role/fake-role",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+				Expect(model.UsesWebIdentity()).To(BeTrue())
+			})
+
+			It("returns error if only one of the web identity fields is set", func() {
+				model := storage.Model{
+					Driver:          storage.S3Driver,
+					Bucket:          "fake-bucket",
+					BucketPath:      "fake-bucket-path",
+					AccessKeyID:     "fake-access-key",
+					SecretAccessKey: "fake-secret-key",
+					OIDCRoleARN:     "arn:aws:iam::123456789012:role/fake-role",
+				}
+
+				err := model.Validate()
+				Expect(err).To(MatchError("`storage.web_identity_token_file` and `storage.oidc_role_arn` must be set together"))
+			})
+
+			It("accepts `kms_key_id` with aws:kms encryption", func() {
+				model := storage.Model{
+					Bucket:               "fake-bucket",
+					BucketPath:           "fake-bucket-path",
+					AccessKeyID:          "fake-access-key",
+					SecretAccessKey:      "fake-secret-key",
+					ServerSideEncryption: "aws:kms",
+					KMSKeyID:             "fake-key-id",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+				sse, kmsKeyID := model.Encryption()
+				Expect(sse).To(Equal("aws:kms"))
+				Expect(kmsKeyID).To(Equal("fake-key-id"))
+				Expect(model.DescribeEncryption()).To(Equal("Storage objects are written with server-side encryption aws:kms using KMS key 'fake-key-id'"))
+			})
+
+			It("returns error if `kms_key_id` is set without aws:kms encryption", func() {
+				model := storage.Model{
+					Bucket:               "fake-bucket",
+					BucketPath:           "fake-bucket-path",
+					AccessKeyID:          "fake-access-key",
+					SecretAccessKey:      "fake-secret-key",
+					ServerSideEncryption: "AES256",
+					KMSKeyID:             "fake-key-id",
+				}
+
+				Expect(model.Validate()).To(MatchError("`storage.kms_key_id` requires `storage.server_side_encryption: aws:kms`"))
+			})
+
+			It("returns error if `ca_cert` is not a PEM encoded certificate", func() {
+				model := storage.Model{
+					Bucket:          "fake-bucket",
+					BucketPath:      "fake-bucket-path",
+					AccessKeyID:     "fake-access-key",
+					SecretAccessKey: "fake-secret-key",
+					CACert:          "not-a-cert",
+				}
+
+				Expect(model.Validate()).To(MatchError("Invalid `storage.ca_cert`: `ca_cert` does not contain any PEM encoded certificates"))
+			})
+
+			It("warns loudly about `insecure_skip_verify`", func() {
+				model := storage.Model{
+					Bucket:             "fake-bucket",
+					BucketPath:         "fake-bucket-path",
+					AccessKeyID:        "fake-access-key",
+					SecretAccessKey:    "fake-secret-key",
+					InsecureSkipVerify: true,
+				}
+
+				Expect(model.Validate()).To(Succeed())
+				Expect(model.InsecureWarning()).To(ContainSubstring("NOT verified"))
+				Expect(storage.Model{}.InsecureWarning()).To(BeEmpty())
+			})
+
+			It("uses path-style addressing unless `use_path_style` is false", func() {
+				pathStyle := false
+
+				Expect(storage.Model{}.ShouldUsePathStyle()).To(BeTrue())
+				Expect(storage.Model{UsePathStyle: &pathStyle}.ShouldUsePathStyle()).To(BeFalse())
+			})
+
+			It("returns error if `assume_role` has no role_arn", func() {
+				model := storage.Model{
+					Bucket:          "fake-bucket",
+					BucketPath:      "fake-bucket-path",
+					AccessKeyID:     "fake-access-key",
+					SecretAccessKey: "fake-secret-key",
+					AssumeRole:      &storage.AssumeRole{SessionName: "ci"},
+				}
+
+				Expect(model.Validate()).To(MatchError("Missing fields: 'storage.assume_role.role_arn'"))
+			})
+
+			It("returns error if the `assume_role` duration is shorter than STS allows", func() {
+				model := storage.Model{
+					Bucket:          "fake-bucket",
+					BucketPath:      "fake-bucket-path",
+					AccessKeyID:     "fake-access-key",
+					SecretAccessKey: "fake-secret-key",
+					AssumeRole: &storage.AssumeRole{
+						RoleARN:  "arn:aws:iam::123456789012:role/state-access",
+						Duration: "5m",
+					},
+				}
+
+				Expect(model.Validate()).To(MatchError("Invalid `storage.assume_role.duration` '5m', must be at least 15m0s"))
+			})
+
+			It("keeps `sse_kms_key_id` implying aws:kms encryption", func() {
+				model := storage.Model{
+					SSEKMSKeyId: "fake-key-id",
+				}
+
+				sse, kmsKeyID := model.Encryption()
+				Expect(sse).To(Equal("aws:kms"))
+				Expect(kmsKeyID).To(Equal("fake-key-id"))
+			})
+
 			It("returns error if storage driver is unknown", func() {
 				model := storage.Model{
 					Driver: "bad-driver",
@@ -53,6 +223,99 @@ var _ = Describe("Storage Models", func() {
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("bad-driver"))
 			})
+
+			It("returns nil if all azure fields are provided", func() {
+				model := storage.Model{
+					Driver:             storage.AzureDriver,
+					StorageAccountName: "fakeaccount",
+					Container:          "fake-container",
+					BucketPath:         "fake-bucket-path",
+					SASToken:           "sv=2020-10-02&sig=fake-signature",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+			})
+
+			It("returns error if azure fields are missing", func() {
+				model := storage.Model{
+					Driver: storage.AzureDriver,
+				}
+
+				err := model.Validate()
+				Expect(err).To(MatchError("Missing fields: 'storage.storage_account_name', 'storage.container', 'storage.bucket_path', 'storage.access_key' or 'storage.sas_token'"))
+			})
+
+			It("returns error if max_retries is negative", func() {
+				maxRetries := -1
+				model := storage.Model{
+					Driver:             storage.AzureDriver,
+					StorageAccountName: "fakeaccount",
+					Container:          "fake-container",
+					BucketPath:         "fake-bucket-path",
+					SASToken:           "sv=2020-10-02&sig=fake-signature",
+					MaxRetries:         &maxRetries,
+				}
+
+				Expect(model.Validate()).To(MatchError("`storage.max_retries` must not be negative, got '-1'"))
+			})
+
+			It("validates the azure fields for the `azure-blob` alias", func() {
+				model := storage.Model{
+					Driver: storage.AzureBlobDriver,
+				}
+
+				err := model.Validate()
+				Expect(err).To(MatchError("Missing fields: 'storage.storage_account_name', 'storage.container', 'storage.bucket_path', 'storage.access_key' or 'storage.sas_token'"))
+			})
+
+			It("returns error if swift fields are missing", func() {
+				model := storage.Model{
+					Driver: storage.SwiftDriver,
+				}
+
+				err := model.Validate()
+				Expect(err).To(MatchError("Missing fields: 'storage.auth_url', 'storage.container', 'storage.bucket_path', 'storage.username', 'storage.password', 'storage.project_name'"))
+			})
+
+			It("does not require a password with a swift application credential", func() {
+				model := storage.Model{
+					Driver:                      storage.SwiftDriver,
+					AuthURL:                     "https://keystone.example.com/v3",
+					Container:                   "fake-container",
+					BucketPath:                  "fake-bucket-path",
+					ApplicationCredentialID:     "fake-id",
+					ApplicationCredentialSecret: "fake-secret",
+				}
+
+				Expect(model.Validate()).To(Succeed())
+			})
+
+			It("returns error if both an azure access key and SAS token are given", func() {
+				model := storage.Model{
+					Driver:             storage.AzureDriver,
+					StorageAccountName: "fakeaccount",
+					Container:          "fake-container",
+					BucketPath:         "fake-bucket-path",
+					AccessKey:          "ZmFrZS1hY2Nlc3Mta2V5",
+					SASToken:           "sv=2020-10-02&sig=fake-signature",
+				}
+
+				Expect(model.Validate()).To(MatchError("Cannot specify both `storage.access_key` and `storage.sas_token`"))
+			})
+		})
+
+		Describe("#Retryer", func() {
+			It("retries DefaultMaxRetries times with jitter by default", func() {
+				retryer := storage.Model{}.Retryer(logger.Logger{})
+				Expect(retryer.MaxRetries).To(Equal(storage.DefaultMaxRetries))
+				Expect(retryer.Jitter).To(BeTrue())
+			})
+
+			It("can disable retries with max_retries: 0", func() {
+				maxRetries := 0
+				retryer := storage.Model{MaxRetries: &maxRetries}.Retryer(logger.Logger{})
+				Expect(retryer.MaxRetries).To(BeZero())
+			})
 		})
 
 		Describe("#ShouldUseSigningV2", func() {
@@ -5,24 +5,38 @@ import (
 	"io"
 )
 
-type null struct{}
+// null fails every operation with err, e.g. why the driver couldn't be built
+type null struct {
+	err error
+}
 
 func (n null) Download(key string, destination io.Writer) (Version, error) {
-	return Version{}, errors.New("Not Implemented")
+	return Version{}, n.error()
 }
 
 func (n null) Upload(key string, content io.Reader) (Version, error) {
-	return Version{}, errors.New("Not Implemented")
+	return Version{}, n.error()
 }
 
 func (n null) Delete(key string) error {
-	return errors.New("Not Implemented")
+	return n.error()
+}
+
+func (n null) Move(srcKey string, dstKey string) error {
+	return n.error()
 }
 
 func (n null) Version(key string) (Version, error) {
-	return Version{}, errors.New("Not Implemented")
+	return Version{}, n.error()
 }
 
 func (n null) LatestVersion(filterRegex string) (Version, error) {
-	return Version{}, errors.New("Not Implemented")
+	return Version{}, n.error()
+}
+
+func (n null) error() error {
+	if n.err == nil {
+		return errors.New("Not Implemented")
+	}
+	return n.err
 }
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ljfranklin/terraform-resource/retry"
+)
+
+type retrying struct {
+	driver  Storage
+	retryer retry.Retryer
+}
+
+// WithRetries retries each storage operation after a transient error, see
+// IsRetryable. Move is not retried as a partial move can't safely be
+// repeated. The driver is returned unchanged if retryer has no retries.
+func WithRetries(driver Storage, retryer retry.Retryer) Storage {
+	if retryer.MaxRetries == 0 {
+		return driver
+	}
+	return retrying{
+		driver:  driver,
+		retryer: retryer,
+	}
+}
+
+// Download buffers each attempt so a failed attempt doesn't leave a partial
+// statefile in destination
+func (r retrying) Download(key string, destination io.Writer) (Version, error) {
+	return r.download(key, destination, func(buffer io.Writer) (Version, error) {
+		return r.driver.Download(key, buffer)
+	})
+}
+
+func (r retrying) DownloadVersion(key string, versionID string, destination io.Writer) (Version, error) {
+	return r.download(key, destination, func(buffer io.Writer) (Version, error) {
+		return DownloadVersion(r.driver, key, versionID, buffer)
+	})
+}
+
+func (r retrying) download(key string, destination io.Writer, download func(io.Writer) (Version, error)) (Version, error) {
+	var buffer bytes.Buffer
+	var version Version
+	err := r.retryer.Do(fmt.Sprintf("Storage download of '%s'", key), func() error {
+		buffer.Reset()
+		var err error
+		version, err = download(&buffer)
+		return err
+	}, IsRetryable)
+	if err != nil {
+		return Version{}, err
+	}
+
+	if _, err := io.Copy(destination, &buffer); err != nil {
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %s", err)
+	}
+	return version, nil
+}
+
+// Upload reads content once so each attempt can send it again
+func (r retrying) Upload(key string, content io.Reader) (Version, error) {
+	contents, err := ioutil.ReadAll(content)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to read upload content: %s", err)
+	}
+
+	var version Version
+	err = r.retryer.Do(fmt.Sprintf("Storage upload of '%s'", key), func() error {
+		var err error
+		version, err = r.driver.Upload(key, bytes.NewReader(contents))
+		return err
+	}, IsRetryable)
+	return version, err
+}
+
+func (r retrying) Delete(key string) error {
+	return r.retryer.Do(fmt.Sprintf("Storage delete of '%s'", key), func() error {
+		return r.driver.Delete(key)
+	}, IsRetryable)
+}
+
+func (r retrying) Move(srcKey string, dstKey string) error {
+	return r.driver.Move(srcKey, dstKey)
+}
+
+func (r retrying) Version(key string) (Version, error) {
+	var version Version
+	err := r.retryer.Do(fmt.Sprintf("Storage version of '%s'", key), func() error {
+		var err error
+		version, err = r.driver.Version(key)
+		return err
+	}, IsRetryable)
+	return version, err
+}
+
+func (r retrying) LatestVersion(filterRegex string) (Version, error) {
+	var version Version
+	err := r.retryer.Do("Storage listing", func() error {
+		var err error
+		version, err = r.driver.LatestVersion(filterRegex)
+		return err
+	}, IsRetryable)
+	return version, err
+}
+
+// IsRetryable is true for errors which are likely to succeed if the request
+// is simply sent again: 5xx responses, timeouts, and connection resets. Other
+// responses, e.g. 403 or 404, are never retried.
+func IsRetryable(err error) bool {
+	if statusCode, ok := responseStatusCode(err); ok {
+		return statusCode >= 500
+	}
+
+	for err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true
+		}
+		if errors.Is(err, syscall.ECONNRESET) {
+			return true
+		}
+
+		// awserr.Error doesn't implement Unwrap
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) {
+			return false
+		}
+		err = awsErr.OrigErr()
+	}
+	return false
+}
+
+// responseStatusCode is the HTTP status of a request which got a response,
+// false if e.g. the connection failed
+func responseStatusCode(err error) (int, bool) {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() != 0 {
+		return requestFailure.StatusCode(), true
+	}
+	var azureErr azureError
+	if errors.As(err, &azureErr) {
+		return azureErr.StatusCode, true
+	}
+	var swiftErr swiftError
+	if errors.As(err, &swiftErr) {
+		return swiftErr.StatusCode, true
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/retry"
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithRetries", func() {
+	var (
+		logWriter *bytes.Buffer
+		fake      *flakyDriver
+		driver    storage.Storage
+	)
+
+	serverError := awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Please reduce your request rate.", nil), 503, "fake-request-id")
+
+	BeforeEach(func() {
+		logWriter = &bytes.Buffer{}
+		fake = &flakyDriver{}
+		driver = storage.WithRetries(fake, retry.Retryer{
+			MaxRetries: 3,
+			Delay:      time.Millisecond,
+			Logger:     logger.Logger{Sink: logWriter},
+		})
+	})
+
+	It("retries a download until it succeeds, keeping only the last attempt's contents", func() {
+		fake.failures = 2
+		fake.err = serverError
+
+		contents := &bytes.Buffer{}
+		version, err := driver.Download("staging.tfstate", contents)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.StateFile).To(Equal("staging.tfstate"))
+		Expect(contents.String()).To(Equal("fake-state"))
+		Expect(fake.attempts).To(Equal(3))
+		Expect(logWriter.String()).To(ContainSubstring("Storage download of 'staging.tfstate' failed with a transient error, retrying in 1ms (retry 1 of 3)"))
+		Expect(logWriter.String()).To(ContainSubstring("retrying in 2ms (retry 2 of 3)"))
+	})
+
+	It("sends the whole content on each upload attempt", func() {
+		fake.failures = 1
+		fake.err = serverError
+
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.uploads).To(Equal([]string{"fake-state", "fake-state"}))
+	})
+
+	It("retries version lookups and deletes", func() {
+		fake.failures = 1
+		fake.err = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+		_, err := driver.Version("staging.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.attempts).To(Equal(2))
+
+		fake.attempts = 0
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(fake.attempts).To(Equal(2))
+	})
+
+	It("returns the last error once retries are exhausted", func() {
+		fake.failures = 10
+		fake.err = serverError
+
+		_, err := driver.Version("staging.tfstate")
+		Expect(err).To(MatchError(ContainSubstring("ServiceUnavailable")))
+		Expect(fake.attempts).To(Equal(4))
+	})
+
+	It("does not retry a 403", func() {
+		fake.failures = 10
+		fake.err = awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "fake-request-id")
+
+		_, err := driver.Download("staging.tfstate", &bytes.Buffer{})
+		Expect(err).To(HaveOccurred())
+		Expect(fake.attempts).To(Equal(1))
+		Expect(logWriter.String()).To(BeEmpty())
+	})
+
+	It("returns the driver unchanged without retries", func() {
+		Expect(storage.WithRetries(fake, retry.Retryer{})).To(BeIdenticalTo(fake))
+	})
+
+	Describe("IsRetryable", func() {
+		It("retries 5xx responses", func() {
+			Expect(storage.IsRetryable(fmt.Errorf("GetObject request failed.\nError: %w", serverError))).To(BeTrue())
+		})
+
+		It("never retries 403 or 404 responses", func() {
+			for _, statusCode := range []int{403, 404} {
+				err := awserr.NewRequestFailure(awserr.New("Forbidden", "fake-message", nil), statusCode, "fake-request-id")
+				Expect(storage.IsRetryable(err)).To(BeFalse())
+			}
+		})
+
+		It("retries timeouts and connection resets, including those wrapped by the AWS SDK", func() {
+			timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+			Expect(storage.IsRetryable(timeout)).To(BeTrue())
+
+			reset := awserr.New("RequestError", "send request failed", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET})
+			Expect(storage.IsRetryable(fmt.Errorf("HeadObject request failed.\nError: %w", reset))).To(BeTrue())
+		})
+
+		It("does not retry other errors", func() {
+			Expect(storage.IsRetryable(errors.New("NoSuchBucket"))).To(BeFalse())
+			Expect(storage.IsRetryable(awserr.New("RequestError", "send request failed", errors.New("no such host")))).To(BeFalse())
+		})
+	})
+})
+
+// flakyDriver fails the first failures attempts with err, then succeeds
+type flakyDriver struct {
+	failures int
+	err      error
+	attempts int
+	uploads  []string
+}
+
+func (f *flakyDriver) attempt() error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyDriver) Download(key string, destination io.Writer) (storage.Version, error) {
+	// a partial download before the failure
+	destination.Write([]byte("fake-"))
+	if err := f.attempt(); err != nil {
+		return storage.Version{}, err
+	}
+	destination.Write([]byte("state"))
+	return storage.Version{StateFile: key}, nil
+}
+
+func (f *flakyDriver) Upload(key string, content io.Reader) (storage.Version, error) {
+	contents, _ := ioutil.ReadAll(content)
+	f.uploads = append(f.uploads, string(contents))
+	return storage.Version{StateFile: key}, f.attempt()
+}
+
+func (f *flakyDriver) Delete(key string) error {
+	return f.attempt()
+}
+
+func (f *flakyDriver) Move(srcKey string, dstKey string) error {
+	return f.attempt()
+}
+
+func (f *flakyDriver) Version(key string) (storage.Version, error) {
+	return storage.Version{StateFile: key}, f.attempt()
+}
+
+func (f *flakyDriver) LatestVersion(filterRegex string) (storage.Version, error) {
+	return storage.Version{}, f.attempt()
+}
@@ -1,18 +1,27 @@
 package storage
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	awsSession "github.com/aws/aws-sdk-go/aws/session"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/ljfranklin/terraform-resource/cacert"
 )
 
 type s3 struct {
@@ -23,29 +32,68 @@ type s3 struct {
 const (
 	maxRetries    = 10
 	defaultRegion = "us-east-1"
+
+	webIdentitySessionName = "terraform-resource"
+	assumeRoleExpiryWindow = time.Minute
 )
 
 func NewS3(m Model) Storage {
 
-	creds := credentials.NewStaticCredentials(m.AccessKeyID, m.SecretAccessKey, "")
+	var region *string
+	if len(m.RegionName) > 0 {
+		region = aws.String(m.RegionName)
+	} else if !m.UsesDefaultCredentials() {
+		region = aws.String(defaultRegion)
+	} // else the region of the shared config `profile`, checked by Validate
+
+	// STS is always AWS, so don't send it to a custom S3 `endpoint`
+	stsConfig := &aws.Config{
+		Region:     region,
+		MaxRetries: aws.Int(maxRetries),
+		HTTPClient: m.HTTPClient,
+	}
+
+	var creds *credentials.Credentials
+	if m.UsesWebIdentity() {
+		creds = stscreds.NewWebIdentityCredentials(awsSession.New(stsConfig), m.OIDCRoleARN, webIdentitySessionName, m.WebIdentityTokenFile)
+	} else if !m.UsesDefaultCredentials() {
+		creds = credentials.NewStaticCredentials(m.AccessKeyID, m.SecretAccessKey, "")
+	}
 
-	regionName := m.RegionName
-	if len(regionName) == 0 {
-		regionName = defaultRegion
+	if m.AssumeRole != nil {
+		// the credentials above are the source identity which assumes the role
+		sourceConfig := stsConfig.Copy(&aws.Config{Credentials: creds})
+		creds = stscreds.NewCredentials(newAWSSession(m, sourceConfig), m.AssumeRole.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = m.AssumeRole.SessionName
+			if p.RoleSessionName == "" {
+				p.RoleSessionName = webIdentitySessionName
+			}
+			if m.AssumeRole.ExternalID != "" {
+				p.ExternalID = aws.String(m.AssumeRole.ExternalID)
+			}
+			if duration := m.AssumeRole.DurationValue(); duration > 0 {
+				p.Duration = duration
+			}
+			// refreshed before expiry so a long apply never uses stale keys
+			p.ExpiryWindow = assumeRoleExpiryWindow
+		})
 	}
 
 	awsConfig := &aws.Config{
-		Region:           aws.String(regionName),
+		Region:           region,
 		Credentials:      creds,
-		S3ForcePathStyle: aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(m.ShouldUsePathStyle()),
 		MaxRetries:       aws.Int(maxRetries),
 		Logger:           nil,
 	}
 	if len(m.Endpoint) > 0 {
 		awsConfig.Endpoint = aws.String(m.Endpoint)
 	}
+	if client := endpointHTTPClient(m); client != nil {
+		awsConfig.HTTPClient = client
+	}
 
-	session := awsSession.New(awsConfig)
+	session := newAWSSession(m, awsConfig)
 	client := awss3.New(session, awsConfig)
 	if m.ShouldUseSigningV2() {
 		Setv2Handlers(client)
@@ -57,6 +105,73 @@ func NewS3(m Model) Storage {
 	}
 }
 
+// newAWSSession falls back to the default credential chain, including the
+// shared config `profile`, if config has no credentials. As with
+// awsSession.New, an invalid shared config fails each request.
+func newAWSSession(m Model, config *aws.Config) *awsSession.Session {
+	if config.Credentials != nil {
+		return awsSession.New(config)
+	}
+	session, err := awsSession.NewSessionWithOptions(awsSession.Options{
+		Config:            *config,
+		Profile:           m.Profile,
+		SharedConfigState: awsSession.SharedConfigEnable,
+	})
+	if err != nil {
+		session = awsSession.New(config)
+		session.Handlers.Validate.PushBack(func(r *request.Request) {
+			r.Error = fmt.Errorf("Failed to load the AWS shared config: %w", err)
+		})
+	}
+	return session
+}
+
+// endpointHTTPClient adds the `ca_cert` and `insecure_skip_verify` TLS
+// settings to m.HTTPClient, which is returned as is without either
+func endpointHTTPClient(m Model) *http.Client {
+	if m.CACert == "" && !m.InsecureSkipVerify {
+		return m.HTTPClient
+	}
+
+	client := &http.Client{}
+	if m.HTTPClient != nil {
+		*client = *m.HTTPClient
+	}
+	var transport *http.Transport
+	if base, ok := client.Transport.(*http.Transport); ok {
+		transport = base.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	tlsConfig := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+
+	if m.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	} else {
+		pool := tlsConfig.RootCAs
+		if pool == nil {
+			pool, _ = x509.SystemCertPool()
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		} else {
+			pool = pool.Clone()
+		}
+		certs, _ := cacert.Parse(m.CACert) // checked by Validate
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client
+}
+
 func (s *s3) Download(filename string, destination io.Writer) (Version, error) {
 	key := path.Join(s.model.BucketPath, filename)
 	params := &awss3.GetObjectInput{
@@ -66,22 +181,59 @@ func (s *s3) Download(filename string, destination io.Writer) (Version, error) {
 
 	resp, err := s.client.GetObject(params)
 	if err != nil {
-		return Version{}, fmt.Errorf("GetObject request failed.\nError: %s", err.Error())
+		return Version{}, fmt.Errorf("GetObject request failed.\nError: %w", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(destination, resp.Body)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %w", err)
+	}
+
+	version := Version{
+		LastModified: *resp.LastModified,
+		StateFile:    filename,
+		VersionID:    objectVersionID(resp.VersionId),
+	}
+	return version, nil
+}
+
+func (s *s3) DownloadVersion(filename string, versionID string, destination io.Writer) (Version, error) {
+	key := path.Join(s.model.BucketPath, filename)
+	params := &awss3.GetObjectInput{
+		Bucket:    aws.String(s.model.Bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	}
+
+	resp, err := s.client.GetObject(params)
+	if err != nil {
+		return Version{}, fmt.Errorf("GetObject request for version '%s' failed.\nError: %s", versionID, err.Error())
 	}
 	defer resp.Body.Close()
 
 	_, err = io.Copy(destination, resp.Body)
 	if err != nil {
-		return Version{}, fmt.Errorf("Failed to copy download to local file: %s", err)
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %w", err)
 	}
 
 	version := Version{
 		LastModified: *resp.LastModified,
 		StateFile:    filename,
+		VersionID:    objectVersionID(resp.VersionId),
 	}
 	return version, nil
 }
 
+// objectVersionID is empty unless the bucket has versioning enabled, S3
+// reports "null" for objects written while versioning was off
+func objectVersionID(versionID *string) string {
+	if versionID == nil || *versionID == "null" {
+		return ""
+	}
+	return *versionID
+}
+
 func (s *s3) Upload(filename string, content io.Reader) (Version, error) {
 
 	uploader := s3manager.NewUploaderWithClient(s.client)
@@ -92,17 +244,17 @@ func (s *s3) Upload(filename string, content io.Reader) (Version, error) {
 		Key:    aws.String(key),
 		Body:   content,
 	}
-	if s.model.ServerSideEncryption != "" {
-		uploadInput.ServerSideEncryption = aws.String(s.model.ServerSideEncryption)
+	sse, kmsKeyID := s.model.Encryption()
+	if sse != "" {
+		uploadInput.ServerSideEncryption = aws.String(sse)
 	}
-	if s.model.SSEKMSKeyId != "" {
-		uploadInput.ServerSideEncryption = aws.String("aws:kms")
-		uploadInput.SSEKMSKeyId = aws.String(s.model.SSEKMSKeyId)
+	if kmsKeyID != "" {
+		uploadInput.SSEKMSKeyId = aws.String(kmsKeyID)
 	}
 
 	_, err := uploader.Upload(uploadInput)
 	if err != nil {
-		return Version{}, fmt.Errorf("Failed to Upload to S3: %s", err.Error())
+		return Version{}, fmt.Errorf("Failed to Upload to S3: %w", err)
 	}
 
 	version, err := s.Version(filename)
@@ -124,12 +276,48 @@ func (s *s3) Delete(filename string) error {
 		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == 404 {
 			return nil // already gone
 		}
-		return fmt.Errorf("DeleteObject request failed.\nError: %s", err.Error())
+		return fmt.Errorf("DeleteObject request failed.\nError: %w", err)
 	}
 
 	return nil
 }
 
+// Move copies then deletes as S3 has no native rename, so a failure between
+// the two requests leaves both keys behind rather than neither
+func (s *s3) Move(srcKey string, dstKey string) error {
+	existing, err := s.Version(dstKey)
+	if err != nil {
+		return err
+	}
+	if !existing.IsZero() {
+		return ErrMoveConflict
+	}
+
+	// CopySource must be URL encoded but S3 expects the slashes as-is
+	copySource := strings.Split(path.Join(s.model.Bucket, s.model.BucketPath, srcKey), "/")
+	for i, segment := range copySource {
+		copySource[i] = url.PathEscape(segment)
+	}
+	params := &awss3.CopyObjectInput{
+		Bucket:     aws.String(s.model.Bucket),
+		Key:        aws.String(path.Join(s.model.BucketPath, dstKey)),
+		CopySource: aws.String(strings.Join(copySource, "/")),
+	}
+	sse, kmsKeyID := s.model.Encryption()
+	if sse != "" {
+		params.ServerSideEncryption = aws.String(sse)
+	}
+	if kmsKeyID != "" {
+		params.SSEKMSKeyId = aws.String(kmsKeyID)
+	}
+
+	if _, err := s.client.CopyObject(params); err != nil {
+		return fmt.Errorf("CopyObject request failed.\nError: %w", err)
+	}
+
+	return s.Delete(srcKey)
+}
+
 func (s *s3) Version(filename string) (Version, error) {
 	key := path.Join(s.model.BucketPath, filename)
 	params := &awss3.HeadObjectInput{
@@ -142,12 +330,13 @@ func (s *s3) Version(filename string) (Version, error) {
 		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == 404 {
 			return Version{}, nil // no versions exist
 		}
-		return Version{}, fmt.Errorf("HeadObject request failed.\nError: %s", err.Error())
+		return Version{}, fmt.Errorf("HeadObject request failed.\nError: %w", err)
 	}
 
 	version := Version{
 		LastModified: *resp.LastModified,
 		StateFile:    filename,
+		VersionID:    objectVersionID(resp.VersionId),
 	}
 	return version, nil
 }
@@ -162,7 +351,7 @@ func (s *s3) LatestVersion(filterRegex string) (Version, error) {
 
 	resp, err := s.client.ListObjects(params)
 	if err != nil {
-		return Version{}, fmt.Errorf("ListObjects request failed.\nError: %s", err)
+		return Version{}, fmt.Errorf("ListObjects request failed.\nError: %w", err)
 	}
 
 	filteredObjects := resp.Contents[:0]
@@ -178,9 +367,17 @@ func (s *s3) LatestVersion(filterRegex string) (Version, error) {
 
 	latest := filteredObjects[len(filteredObjects)-1]
 	stateFile := path.Base(*latest.Key)
+
+	// ListObjects doesn't report the VersionId of a versioned bucket
+	head, err := s.Version(stateFile)
+	if err != nil {
+		return Version{}, err
+	}
+
 	version := Version{
 		LastModified: *latest.LastModified,
 		StateFile:    stateFile,
+		VersionID:    head.VersionID,
 	}
 	return version, nil
 }
@@ -0,0 +1,490 @@
+package storage_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/cacert"
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3", func() {
+
+	Context("when the endpoint uses a private CA", func() {
+		var (
+			server       *httptest.Server
+			tmpDir       string
+			requestPaths []string
+		)
+
+		BeforeEach(func() {
+			requestPaths = []string{}
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPaths = append(requestPaths, r.URL.Path)
+				w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			var err error
+			tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-s3-test")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("trusts the CA given by `ca_cert`", func() {
+			caPEM := pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.Certificate().Raw,
+			})
+			bundle, err := cacert.Write(string(caPEM), tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			driver := storage.NewS3(storage.Model{
+				Bucket:          "fake-bucket",
+				BucketPath:      "fake-path",
+				AccessKeyID:     "fake-access-key",
+				SecretAccessKey: "fake-secret-key",
+				Endpoint:        server.URL,
+				HTTPClient:      bundle.HTTPClient(),
+			})
+
+			version, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.StateFile).To(Equal("staging.tfstate"))
+			Expect(requestPaths).To(Equal([]string{"/fake-bucket/fake-path/staging.tfstate"}))
+		})
+
+		It("trusts the CA given by `storage.ca_cert` for HEAD requests and multipart uploads", func() {
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPaths = append(requestPaths, r.Method+" "+r.URL.Path)
+				switch {
+				case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+					w.Write([]byte("<InitiateMultipartUploadResult><UploadId>fake-upload-id</UploadId></InitiateMultipartUploadResult>"))
+				case r.Method == http.MethodPost:
+					w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+				case r.Method == http.MethodPut:
+					_, _ = ioutil.ReadAll(r.Body)
+					w.Header().Set("ETag", `"fake-etag"`)
+				default:
+					w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				}
+			})
+			caPEM := pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.Certificate().Raw,
+			})
+
+			driver := storage.NewS3(storage.Model{
+				Bucket:          "fake-bucket",
+				BucketPath:      "fake-path",
+				AccessKeyID:     "fake-access-key",
+				SecretAccessKey: "fake-secret-key",
+				Endpoint:        server.URL,
+				UseSigningV4:    true,
+				CACert:          string(caPEM),
+			})
+
+			// larger than the minimum part size, so uploaded in two parts
+			content := strings.Repeat("x", 6*1024*1024)
+			version, err := driver.Upload("staging.tfstate", strings.NewReader(content))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.StateFile).To(Equal("staging.tfstate"))
+			Expect(requestPaths).To(Equal([]string{
+				"POST /fake-bucket/fake-path/staging.tfstate",
+				"PUT /fake-bucket/fake-path/staging.tfstate",
+				"PUT /fake-bucket/fake-path/staging.tfstate",
+				"POST /fake-bucket/fake-path/staging.tfstate",
+				"HEAD /fake-bucket/fake-path/staging.tfstate",
+			}))
+		})
+
+		It("skips verification with `insecure_skip_verify`", func() {
+			driver := storage.NewS3(storage.Model{
+				Bucket:             "fake-bucket",
+				BucketPath:         "fake-path",
+				AccessKeyID:        "fake-access-key",
+				SecretAccessKey:    "fake-secret-key",
+				Endpoint:           server.URL,
+				InsecureSkipVerify: true,
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when `assume_role` is set", func() {
+		var (
+			server     *httptest.Server
+			stsForms   []url.Values
+			s3Headers  []http.Header
+			stsFailure string
+			httpClient *http.Client
+		)
+
+		BeforeEach(func() {
+			stsForms = []url.Values{}
+			s3Headers = []http.Header{}
+			stsFailure = ""
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Host != "sts.us-east-1.amazonaws.com" && r.Host != "sts.amazonaws.com" {
+					s3Headers = append(s3Headers, r.Header)
+					w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+					return
+				}
+				Expect(r.ParseForm()).To(Succeed())
+				stsForms = append(stsForms, r.PostForm)
+				if stsFailure != "" {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(stsFailure))
+					return
+				}
+				w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult>
+<Credentials>
+  <AccessKeyId>ASIA-ASSUMED-KEY</AccessKeyId>
+  <SecretAccessKey>assumed-secret</SecretAccessKey>
+  <SessionToken>assumed-token</SessionToken>
+  <Expiration>2099-01-01T00:00:00Z</Expiration>
+</Credentials>
+</AssumeRoleResult></AssumeRoleResponse>`))
+			}))
+
+			// sends the STS requests, which always go to AWS, to the fake server
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			httpClient = &http.Client{
+				Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					r.Host = r.URL.Host
+					r.URL.Scheme = serverURL.Scheme
+					r.URL.Host = serverURL.Host
+					return http.DefaultTransport.RoundTrip(r)
+				}),
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("accesses the bucket with the role's credentials, using the access keys as the source identity", func() {
+			driver := storage.NewS3(storage.Model{
+				Bucket:          "fake-bucket",
+				BucketPath:      "fake-path",
+				AccessKeyID:     "fake-access-key",
+				SecretAccessKey: "fake-secret-key",
+				Endpoint:        server.URL,
+				UseSigningV4:    true,
+				HTTPClient:      httpClient,
+				AssumeRole: &storage.AssumeRole{
+					RoleARN:     "arn:aws:iam::123456789012:role/state-access",
+					SessionName: "ci",
+					ExternalID:  "fake-external-id",
+					Duration:    "1h",
+				},
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stsForms).To(HaveLen(1))
+			Expect(stsForms[0].Get("Action")).To(Equal("AssumeRole"))
+			Expect(stsForms[0].Get("RoleArn")).To(Equal("arn:aws:iam::123456789012:role/state-access"))
+			Expect(stsForms[0].Get("RoleSessionName")).To(Equal("ci"))
+			Expect(stsForms[0].Get("ExternalId")).To(Equal("fake-external-id"))
+			Expect(stsForms[0].Get("DurationSeconds")).To(Equal("3600"))
+
+			Expect(s3Headers).To(HaveLen(1))
+			Expect(s3Headers[0].Get("Authorization")).To(ContainSubstring("Credential=ASIA-ASSUMED-KEY/"))
+			Expect(s3Headers[0].Get("X-Amz-Security-Token")).To(Equal("assumed-token"))
+		})
+
+		It("returns the AssumeRole error verbatim", func() {
+			stsFailure = `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>User: arn:aws:iam::111111111111:user/ci is not authorized to perform: sts:AssumeRole</Message></Error></ErrorResponse>`
+
+			driver := storage.NewS3(storage.Model{
+				Bucket:          "fake-bucket",
+				BucketPath:      "fake-path",
+				AccessKeyID:     "fake-access-key",
+				SecretAccessKey: "fake-secret-key",
+				Endpoint:        server.URL,
+				HTTPClient:      httpClient,
+				AssumeRole: &storage.AssumeRole{
+					RoleARN: "arn:aws:iam::123456789012:role/state-access",
+				},
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).To(MatchError(ContainSubstring("AccessDenied: User: arn:aws:iam::111111111111:user/ci is not authorized to perform: sts:AssumeRole")))
+			Expect(s3Headers).To(BeEmpty())
+		})
+	})
+
+	Context("when no access keys are configured", func() {
+		var (
+			server      *httptest.Server
+			tmpDir      string
+			authHeaders []string
+			originalEnv map[string]string
+		)
+
+		envVars := []string{
+			"AWS_ACCESS_KEY_ID",
+			"AWS_SECRET_ACCESS_KEY",
+			"AWS_SHARED_CREDENTIALS_FILE",
+			"AWS_CONFIG_FILE",
+			"AWS_PROFILE",
+			"AWS_REGION",
+		}
+
+		BeforeEach(func() {
+			authHeaders = []string{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+				w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			}))
+
+			var err error
+			tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-s3-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			originalEnv = map[string]string{}
+			for _, name := range envVars {
+				originalEnv[name] = os.Getenv(name)
+				Expect(os.Unsetenv(name)).To(Succeed())
+			}
+			// keeps the chain from reaching a real config or instance metadata
+			Expect(os.Setenv("AWS_SHARED_CREDENTIALS_FILE", path.Join(tmpDir, "credentials"))).To(Succeed())
+			Expect(os.Setenv("AWS_CONFIG_FILE", path.Join(tmpDir, "config"))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for name, value := range originalEnv {
+				if value == "" {
+					Expect(os.Unsetenv(name)).To(Succeed())
+				} else {
+					Expect(os.Setenv(name, value)).To(Succeed())
+				}
+			}
+			server.Close()
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("uses the credentials from the environment", func() {
+			Expect(os.Setenv("AWS_ACCESS_KEY_ID", "env-access-key")).To(Succeed())
+			Expect(os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret-key")).To(Succeed())
+
+			driver := storage.NewS3(storage.Model{
+				Bucket:       "fake-bucket",
+				BucketPath:   "fake-path",
+				RegionName:   "eu-west-1",
+				Endpoint:     server.URL,
+				UseSigningV4: true,
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(authHeaders).To(HaveLen(1))
+			Expect(authHeaders[0]).To(ContainSubstring("Credential=env-access-key/"))
+			Expect(authHeaders[0]).To(ContainSubstring("/eu-west-1/s3/"))
+		})
+
+		It("uses the credentials and region of the shared config `profile`", func() {
+			credentials := "[ci]\naws_access_key_id = profile-access-key\naws_secret_access_key = profile-secret-key\n"
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "credentials"), []byte(credentials), 0600)).To(Succeed())
+			config := "[profile ci]\nregion = ap-southeast-2\n"
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "config"), []byte(config), 0600)).To(Succeed())
+
+			driver := storage.NewS3(storage.Model{
+				Bucket:       "fake-bucket",
+				BucketPath:   "fake-path",
+				Profile:      "ci",
+				Endpoint:     server.URL,
+				UseSigningV4: true,
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(authHeaders).To(HaveLen(1))
+			Expect(authHeaders[0]).To(ContainSubstring("Credential=profile-access-key/"))
+			Expect(authHeaders[0]).To(ContainSubstring("/ap-southeast-2/s3/"))
+		})
+
+		It("fails without sending a request if the `profile` doesn't exist", func() {
+			driver := storage.NewS3(storage.Model{
+				Bucket:     "fake-bucket",
+				BucketPath: "fake-path",
+				Profile:    "missing",
+				Endpoint:   server.URL,
+			})
+
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).To(HaveOccurred())
+			Expect(authHeaders).To(BeEmpty())
+		})
+	})
+
+	Context("when a KMS key is configured", func() {
+		var (
+			server     *httptest.Server
+			putHeaders []http.Header
+		)
+
+		BeforeEach(func() {
+			putHeaders = []http.Header{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					putHeaders = append(putHeaders, r.Header)
+				}
+				w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				w.WriteHeader(http.StatusOK)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("encrypts uploads and copies with the key", func() {
+			driver := storage.NewS3(storage.Model{
+				Bucket:               "fake-bucket",
+				BucketPath:           "fake-path",
+				AccessKeyID:          "fake-access-key",
+				SecretAccessKey:      "fake-secret-key",
+				Endpoint:             server.URL,
+				ServerSideEncryption: storage.KMSEncryption,
+				KMSKeyID:             "arn:aws:kms:us-east-1:123456789012:key/fake-key",
+			})
+
+			_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+			Expect(err).ToNot(HaveOccurred())
+
+			// the destination must not exist for the copy
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if r.Method == http.MethodPut {
+					putHeaders = append(putHeaders, r.Header)
+					w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+			Expect(driver.Move("staging.tfstate", "production.tfstate")).To(Succeed())
+
+			Expect(putHeaders).To(HaveLen(2))
+			for _, header := range putHeaders {
+				Expect(header.Get("X-Amz-Server-Side-Encryption")).To(Equal("aws:kms"))
+				Expect(header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")).To(Equal("arn:aws:kms:us-east-1:123456789012:key/fake-key"))
+			}
+		})
+	})
+
+	Context("when the bucket has versioning enabled", func() {
+		var (
+			server      *httptest.Server
+			getVersions []string
+			driver      storage.Storage
+		)
+
+		BeforeEach(func() {
+			getVersions = []string{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				versionID := r.URL.Query().Get("versionId")
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/fake-bucket"):
+					w.Write([]byte(`<ListBucketResult><Contents><Key>fake-path/staging.tfstate</Key><LastModified>2006-01-02T15:04:05.000Z</LastModified></Contents></ListBucketResult>`))
+				case r.Method == http.MethodHead:
+					w.Header().Set("X-Amz-Version-Id", "fake-latest-version")
+				case versionID != "":
+					getVersions = append(getVersions, versionID)
+					w.Header().Set("X-Amz-Version-Id", versionID)
+					w.Write([]byte("older-state"))
+				default:
+					getVersions = append(getVersions, versionID)
+					w.Header().Set("X-Amz-Version-Id", "fake-latest-version")
+					w.Write([]byte("latest-state"))
+				}
+			}))
+			driver = storage.NewS3(storage.Model{
+				Bucket:          "fake-bucket",
+				BucketPath:      "fake-path",
+				AccessKeyID:     "fake-access-key",
+				SecretAccessKey: "fake-secret-key",
+				Endpoint:        server.URL,
+			})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reports the object VersionId as the VersionID", func() {
+			version, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.VersionID).To(Equal("fake-latest-version"))
+
+			version, err = driver.LatestVersion(`.*\.tfstate$`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.StateFile).To(Equal("staging.tfstate"))
+			Expect(version.VersionID).To(Equal("fake-latest-version"))
+		})
+
+		It("downloads the given version rather than the latest", func() {
+			contents := &strings.Builder{}
+			version, err := storage.DownloadVersion(driver, "staging.tfstate", "fake-older-version", contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version.VersionID).To(Equal("fake-older-version"))
+			Expect(contents.String()).To(Equal("older-state"))
+			Expect(getVersions).To(Equal([]string{"fake-older-version"}))
+		})
+
+		It("downloads the latest version without a VersionID", func() {
+			contents := &strings.Builder{}
+			_, err := storage.DownloadVersion(driver, "staging.tfstate", "", contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents.String()).To(Equal("latest-state"))
+			Expect(getVersions).To(Equal([]string{""}))
+		})
+	})
+
+	It("ignores the 'null' VersionId of a bucket without versioning", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			w.Header().Set("X-Amz-Version-Id", "null")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		driver := storage.NewS3(storage.Model{
+			Bucket:          "fake-bucket",
+			AccessKeyID:     "fake-access-key",
+			SecretAccessKey: "fake-secret-key",
+			Endpoint:        server.URL,
+		})
+		version, err := driver.Version("staging.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.VersionID).To(BeEmpty())
+	})
+})
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -11,7 +13,10 @@ type StateFile struct {
 	LocalPath     string
 	RemotePath    string
 	StorageDriver Storage
-	isTainted     bool
+	// VersionID downloads that version rather than the latest, if set and
+	// the driver keeps versions
+	VersionID string
+	isTainted bool
 }
 
 func (s StateFile) Exists() (bool, error) {
@@ -61,13 +66,32 @@ func (s StateFile) LatestVersion() (Version, error) {
 }
 
 func (s StateFile) Download() (Version, error) {
+	return s.download(nil)
+}
+
+// DownloadContents also returns the state as it was downloaded, so callers
+// don't depend on LocalPath being left untouched afterwards
+func (s StateFile) DownloadContents() (Version, []byte, error) {
+	contents := &bytes.Buffer{}
+	version, err := s.download(contents)
+	if err != nil {
+		return Version{}, nil, err
+	}
+	return version, contents.Bytes(), nil
+}
+
+func (s StateFile) download(copyTo io.Writer) (Version, error) {
 	stateFile, createErr := os.Create(s.LocalPath)
 	if createErr != nil {
 		return Version{}, fmt.Errorf("Failed to create state file at '%s': %s", s.LocalPath, createErr)
 	}
 	defer stateFile.Close()
 
-	version, err := s.StorageDriver.Download(s.RemotePath, stateFile)
+	var destination io.Writer = stateFile
+	if copyTo != nil {
+		destination = io.MultiWriter(stateFile, copyTo)
+	}
+	version, err := DownloadVersion(s.StorageDriver, s.RemotePath, s.VersionID, destination)
 	if err != nil {
 		return Version{}, err
 	}
@@ -141,6 +165,19 @@ func (s StateFile) Delete() (Version, error) {
 	return version, nil
 }
 
+// MoveToMigrated renames the remote state file once its env has been
+// migrated into a backend workspace, keeping it as a backup
+func (s StateFile) MoveToMigrated() error {
+	migrated := s.ConvertToMigrated()
+	err := s.StorageDriver.Move(s.RemotePath, migrated.RemotePath)
+	if err == ErrMoveConflict {
+		return fmt.Errorf("Failed to move state file '%s' to '%s', a state file from an earlier migration already exists. Remove or rename it and try again.", s.RemotePath, migrated.RemotePath)
+	} else if err != nil {
+		return fmt.Errorf("Failed to move state file '%s' to '%s': %s", s.RemotePath, migrated.RemotePath, err)
+	}
+	return nil
+}
+
 func (s StateFile) IsTainted() bool {
 	return s.isTainted
 }
@@ -0,0 +1,146 @@
+package storage_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// memoryStorage maps keys to contents, Move follows the same contract as s3
+type memoryStorage struct {
+	files   map[string][]byte
+	moveErr error
+}
+
+func (m *memoryStorage) Download(key string, destination io.Writer) (storage.Version, error) {
+	_, err := destination.Write(m.files[key])
+	return storage.Version{LastModified: time.Now(), StateFile: key}, err
+}
+
+func (m *memoryStorage) Upload(key string, content io.Reader) (storage.Version, error) {
+	contents, err := ioutil.ReadAll(content)
+	if err != nil {
+		return storage.Version{}, err
+	}
+	m.files[key] = contents
+	return storage.Version{LastModified: time.Now(), StateFile: key}, nil
+}
+
+func (m *memoryStorage) Delete(key string) error {
+	delete(m.files, key)
+	return nil
+}
+
+func (m *memoryStorage) Move(srcKey string, dstKey string) error {
+	if m.moveErr != nil {
+		return m.moveErr
+	}
+	if _, ok := m.files[dstKey]; ok {
+		return storage.ErrMoveConflict
+	}
+	m.files[dstKey] = m.files[srcKey]
+	delete(m.files, srcKey)
+	return nil
+}
+
+func (m *memoryStorage) Version(key string) (storage.Version, error) {
+	if _, ok := m.files[key]; !ok {
+		return storage.Version{}, nil
+	}
+	return storage.Version{LastModified: time.Now(), StateFile: key}, nil
+}
+
+func (m *memoryStorage) LatestVersion(filterRegex string) (storage.Version, error) {
+	return storage.Version{}, errors.New("Not Implemented")
+}
+
+var _ = Describe("StateFile", func() {
+
+	Describe("#DownloadContents", func() {
+		var (
+			tmpDir    string
+			stateFile storage.StateFile
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-statefile-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			stateFile = storage.StateFile{
+				LocalPath:  path.Join(tmpDir, "terraform.tfstate"),
+				RemotePath: "staging.tfstate",
+				StorageDriver: &memoryStorage{
+					files: map[string][]byte{
+						"staging.tfstate": []byte("some-state"),
+					},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("returns the downloaded state and writes it to LocalPath", func() {
+			version, contents, err := stateFile.DownloadContents()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(version.StateFile).To(Equal("staging.tfstate"))
+			Expect(contents).To(Equal([]byte("some-state")))
+
+			localContents, err := ioutil.ReadFile(stateFile.LocalPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(localContents).To(Equal([]byte("some-state")))
+		})
+	})
+
+	Describe("#MoveToMigrated", func() {
+		var (
+			driver    *memoryStorage
+			stateFile storage.StateFile
+		)
+
+		BeforeEach(func() {
+			driver = &memoryStorage{
+				files: map[string][]byte{
+					"staging.tfstate": []byte("some-state"),
+				},
+			}
+			stateFile = storage.StateFile{
+				RemotePath:    "staging.tfstate",
+				StorageDriver: driver,
+			}
+		})
+
+		It("renames the state file with a .migrated suffix", func() {
+			Expect(stateFile.MoveToMigrated()).To(Succeed())
+
+			Expect(driver.files).ToNot(HaveKey("staging.tfstate"))
+			Expect(driver.files).To(HaveKeyWithValue("staging.tfstate.migrated", []byte("some-state")))
+		})
+
+		It("refuses to overwrite the state file from an earlier migration", func() {
+			driver.files["staging.tfstate.migrated"] = []byte("earlier-state")
+
+			err := stateFile.MoveToMigrated()
+			Expect(err).To(MatchError(ContainSubstring("from an earlier migration already exists")))
+			Expect(driver.files).To(HaveKeyWithValue("staging.tfstate", []byte("some-state")))
+			Expect(driver.files).To(HaveKeyWithValue("staging.tfstate.migrated", []byte("earlier-state")))
+		})
+
+		It("returns other errors from the driver", func() {
+			driver.moveErr = errors.New("access-denied")
+
+			Expect(stateFile.MoveToMigrated()).To(MatchError(ContainSubstring("access-denied")))
+		})
+	})
+})
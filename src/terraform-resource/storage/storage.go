@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"io"
 	"time"
 )
@@ -12,14 +13,33 @@ const (
 	DeprecationWarning = "The `storage` parameter is deprecated. Please migrate to using built-in Terraform backends as described here: https://github.com/ljfranklin/terraform-resource#backend-migration."
 )
 
+// ErrMoveConflict is returned by Move rather than overwriting an existing key
+var ErrMoveConflict = errors.New("Cannot move state file, the destination already exists")
+
 type Storage interface {
 	Download(string, io.Writer) (Version, error)
 	Upload(string, io.Reader) (Version, error)
 	Delete(string) error
+	Move(srcKey string, dstKey string) error
 	Version(string) (Version, error)
 	LatestVersion(string) (Version, error)
 }
 
+// VersionedStorage is implemented by drivers which can download an earlier
+// version of a file, see Version.VersionID
+type VersionedStorage interface {
+	DownloadVersion(filename string, versionID string, destination io.Writer) (Version, error)
+}
+
+// DownloadVersion downloads the given version of filename, or the latest
+// version if versionID is empty or the driver doesn't keep versions
+func DownloadVersion(driver Storage, filename string, versionID string, destination io.Writer) (Version, error) {
+	if versioned, ok := driver.(VersionedStorage); ok && versionID != "" {
+		return versioned.DownloadVersion(filename, versionID, destination)
+	}
+	return driver.Download(filename, destination)
+}
+
 func BuildDriver(m Model) Storage {
 	driverType := m.Driver
 	if driverType == "" {
@@ -30,9 +50,19 @@ func BuildDriver(m Model) Storage {
 	switch driverType {
 	case S3Driver:
 		storageDriver = NewS3(m)
+	case LocalDriver:
+		storageDriver = NewLocal(m)
+	case SwiftDriver:
+		storageDriver = NewSwift(m)
+	case AzureDriver, AzureBlobDriver:
+		var err error
+		if storageDriver, err = NewAzure(m); err != nil {
+			return null{err: err}
+		}
 	default:
-		// calling model.Validate will throw error for this case
-		return null{}
+		// model.Validate returns the same error before a driver is built,
+		// this covers callers which skipped it
+		return null{err: unknownDriverError(driverType)}
 	}
 
 	return storageDriver
@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSwiftDomain = "Default"
+
+	// Swift lists object times in UTC without a zone
+	swiftListTimeFormat = "2006-01-02T15:04:05.999999"
+)
+
+type swift struct {
+	client *http.Client
+	model  Model
+
+	token    string
+	endpoint string
+}
+
+func NewSwift(m Model) Storage {
+	client := m.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &swift{
+		client: client,
+		model:  m,
+	}
+}
+
+func (s *swift) Download(filename string, destination io.Writer) (Version, error) {
+	resp, err := s.do(http.MethodGet, s.objectPath(filename), nil, nil, nil)
+	if err != nil {
+		return Version{}, fmt.Errorf("GET object request failed.\nError: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err = io.Copy(destination, resp.Body); err != nil {
+		return Version{}, fmt.Errorf("Failed to copy download to local file: %w", err)
+	}
+
+	return swiftVersion(filename, resp.Header)
+}
+
+func (s *swift) Upload(filename string, content io.Reader) (Version, error) {
+	// buffered so the upload can be re-sent if the token has expired
+	body, err := ioutil.ReadAll(content)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to read upload content: %w", err)
+	}
+
+	resp, err := s.do(http.MethodPut, s.objectPath(filename), nil, nil, body)
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to Upload to Swift: %w", err)
+	}
+	resp.Body.Close()
+
+	return s.Version(filename)
+}
+
+func (s *swift) Delete(filename string) error {
+	resp, err := s.do(http.MethodDelete, s.objectPath(filename), nil, nil, nil)
+	if err != nil {
+		if isSwiftStatus(err, http.StatusNotFound) {
+			return nil // already gone
+		}
+		return fmt.Errorf("DELETE object request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Move copies then deletes as Swift has no native rename, so a failure
+// between the two requests leaves both objects behind rather than neither
+func (s *swift) Move(srcKey string, dstKey string) error {
+	existing, err := s.Version(dstKey)
+	if err != nil {
+		return err
+	}
+	if !existing.IsZero() {
+		return ErrMoveConflict
+	}
+
+	headers := http.Header{
+		"X-Copy-From": {s.objectPath(srcKey)},
+		// guards against an object created since the check above
+		"If-None-Match": {"*"},
+	}
+	resp, err := s.do(http.MethodPut, s.objectPath(dstKey), nil, headers, nil)
+	if err != nil {
+		if isSwiftStatus(err, http.StatusPreconditionFailed) {
+			return ErrMoveConflict
+		}
+		return fmt.Errorf("Copy object request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+
+	return s.Delete(srcKey)
+}
+
+func (s *swift) Version(filename string) (Version, error) {
+	resp, err := s.do(http.MethodHead, s.objectPath(filename), nil, nil, nil)
+	if err != nil {
+		if isSwiftStatus(err, http.StatusNotFound) {
+			return Version{}, nil // no versions exist
+		}
+		return Version{}, fmt.Errorf("HEAD object request failed.\nError: %w", err)
+	}
+	resp.Body.Close()
+
+	return swiftVersion(filename, resp.Header)
+}
+
+func (s *swift) LatestVersion(filterRegex string) (Version, error) {
+	regex := regexp.MustCompile(filterRegex)
+
+	latest := Version{}
+	marker := ""
+	for {
+		query := url.Values{
+			"format": {"json"},
+			"prefix": {s.model.BucketPath},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := s.do(http.MethodGet, s.model.Container, query, nil, nil)
+		if err != nil {
+			return Version{}, fmt.Errorf("GET container request failed.\nError: %w", err)
+		}
+		var objects []swiftObject
+		err = json.NewDecoder(resp.Body).Decode(&objects)
+		resp.Body.Close()
+		if err != nil {
+			return Version{}, fmt.Errorf("Failed to parse container listing: %w", err)
+		}
+		if len(objects) == 0 {
+			break
+		}
+
+		for _, object := range objects {
+			if !regex.MatchString(object.Name) {
+				continue
+			}
+			lastModified, err := time.Parse(swiftListTimeFormat, object.LastModified)
+			if err != nil {
+				return Version{}, fmt.Errorf("Failed to parse last_modified of object '%s': %s", object.Name, err)
+			}
+			if latest.IsZero() || latest.LastModified.Before(lastModified) {
+				latest = Version{
+					LastModified: lastModified,
+					StateFile:    path.Base(object.Name),
+					ETag:         object.Hash,
+				}
+			}
+		}
+		marker = objects[len(objects)-1].Name
+	}
+
+	return latest, nil // zero if no versions exist
+}
+
+func (s *swift) objectPath(filename string) string {
+	return path.Join(s.model.Container, s.model.BucketPath, filename)
+}
+
+// do sends an authenticated request for the container or object at
+// resourcePath, authenticating again once if the token has expired
+func (s *swift) do(method string, resourcePath string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	if s.token == "" {
+		if err := s.authenticate(); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := s.send(method, resourcePath, query, headers, body)
+	if isSwiftStatus(err, http.StatusUnauthorized) {
+		if err := s.authenticate(); err != nil {
+			return nil, err
+		}
+		resp, err = s.send(method, resourcePath, query, headers, body)
+	}
+	return resp, err
+}
+
+func (s *swift) send(method string, resourcePath string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.endpoint, "/") + "/" + resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("X-Auth-Token", s.token)
+	req.ContentLength = int64(len(body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, swiftError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+	return resp, nil
+}
+
+// authenticate requests a Keystone v3 token, using the object-store endpoint
+// from its catalog in `region_name` unless `endpoint` is set
+func (s *swift) authenticate() error {
+	authRequest := keystoneAuthRequest{}
+	if s.model.ApplicationCredentialID != "" {
+		authRequest.Auth.Identity.Methods = []string{"application_credential"}
+		authRequest.Auth.Identity.ApplicationCredential = &keystoneApplicationCredential{
+			ID:     s.model.ApplicationCredentialID,
+			Secret: s.model.ApplicationCredentialSecret,
+		}
+	} else {
+		authRequest.Auth.Identity.Methods = []string{"password"}
+		authRequest.Auth.Identity.Password = &keystonePassword{}
+		authRequest.Auth.Identity.Password.User.Name = s.model.Username
+		authRequest.Auth.Identity.Password.User.Password = s.model.Password
+		authRequest.Auth.Identity.Password.User.Domain.Name = withDefaultDomain(s.model.UserDomainName)
+		authRequest.Auth.Scope = &keystoneScope{}
+		authRequest.Auth.Scope.Project.Name = s.model.ProjectName
+		authRequest.Auth.Scope.Project.Domain.Name = withDefaultDomain(s.model.ProjectDomainName)
+	}
+	body, err := json.Marshal(authRequest)
+	if err != nil {
+		return err
+	}
+
+	tokensURL := strings.TrimSuffix(s.model.AuthURL, "/")
+	if !strings.HasSuffix(tokensURL, "/v3") {
+		tokensURL += "/v3"
+	}
+	tokensURL += "/auth/tokens"
+	req, err := http.NewRequest(http.MethodPost, tokensURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Keystone authentication request failed.\nError: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Keystone authentication failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var authResponse keystoneAuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
+		return fmt.Errorf("Failed to parse Keystone authentication response: %w", err)
+	}
+
+	endpoint := s.model.Endpoint
+	if endpoint == "" {
+		endpoint = authResponse.objectStoreEndpoint(s.model.RegionName)
+	}
+	if endpoint == "" {
+		return fmt.Errorf("The Keystone catalog has no public `object-store` endpoint in region '%s', set `storage.endpoint` to the Swift URL", s.model.RegionName)
+	}
+
+	s.token = resp.Header.Get("X-Subject-Token")
+	s.endpoint = endpoint
+	return nil
+}
+
+func withDefaultDomain(domain string) string {
+	if domain == "" {
+		return defaultSwiftDomain
+	}
+	return domain
+}
+
+func swiftVersion(filename string, header http.Header) (Version, error) {
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return Version{}, fmt.Errorf("Failed to parse Last-Modified of object '%s': %s", filename, err)
+	}
+	return Version{
+		LastModified: lastModified,
+		StateFile:    filename,
+		ETag:         header.Get("ETag"),
+	}, nil
+}
+
+type swiftError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e swiftError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+func isSwiftStatus(err error, statusCode int) bool {
+	swiftErr, ok := err.(swiftError)
+	return ok && swiftErr.StatusCode == statusCode
+}
+
+type swiftObject struct {
+	Name         string `json:"name"`
+	Hash         string `json:"hash"`
+	LastModified string `json:"last_modified"`
+}
+
+type keystoneAuthRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods               []string                       `json:"methods"`
+			Password              *keystonePassword              `json:"password,omitempty"`
+			ApplicationCredential *keystoneApplicationCredential `json:"application_credential,omitempty"`
+		} `json:"identity"`
+		// application credentials are already scoped to a project
+		Scope *keystoneScope `json:"scope,omitempty"`
+	} `json:"auth"`
+}
+
+type keystonePassword struct {
+	User struct {
+		Name     string         `json:"name"`
+		Password string         `json:"password"`
+		Domain   keystoneDomain `json:"domain"`
+	} `json:"user"`
+}
+
+type keystoneApplicationCredential struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+type keystoneScope struct {
+	Project struct {
+		Name   string         `json:"name"`
+		Domain keystoneDomain `json:"domain"`
+	} `json:"project"`
+}
+
+type keystoneDomain struct {
+	Name string `json:"name"`
+}
+
+type keystoneAuthResponse struct {
+	Token struct {
+		Catalog []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+func (r keystoneAuthResponse) objectStoreEndpoint(region string) string {
+	for _, service := range r.Token.Catalog {
+		if service.Type != "object-store" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == "public" && (region == "" || endpoint.Region == region) {
+				return endpoint.URL
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package storage_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeSwift implements Keystone v3 token requests under /identity and enough
+// of the Swift object API under /swift for the driver
+type fakeSwift struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	modified     map[string]time.Time
+	authRequests []map[string]interface{}
+	tokens       int
+	validToken   string
+	listPageSize int
+	url          string
+}
+
+func newFakeSwift() *fakeSwift {
+	return &fakeSwift{
+		objects:      map[string][]byte{},
+		modified:     map[string]time.Time{},
+		listPageSize: 1000,
+	}
+}
+
+func (f *fakeSwift) put(name string, content []byte, modified time.Time) {
+	f.objects[name] = content
+	f.modified[name] = modified
+}
+
+func (f *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/identity/v3/auth/tokens" {
+		f.authenticate(w, r)
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != f.validToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/swift/v1/")
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("format") == "json":
+		f.list(w, name, r.URL.Query().Get("prefix"), r.URL.Query().Get("marker"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Copy-From") != "":
+		if _, ok := f.objects[name]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		f.put(name, f.objects[r.Header.Get("X-Copy-From")], time.Now())
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		f.put(name, body, time.Now())
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", f.modified[name].Format(http.TimeFormat))
+		w.Header().Set("ETag", fmt.Sprintf("%x", len(content)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := f.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeSwift) authenticate(w http.ResponseWriter, r *http.Request) {
+	authRequest := map[string]interface{}{}
+	Expect(json.NewDecoder(r.Body).Decode(&authRequest)).To(Succeed())
+	f.authRequests = append(f.authRequests, authRequest)
+
+	f.tokens++
+	f.validToken = fmt.Sprintf("fake-token-%d", f.tokens)
+	w.Header().Set("X-Subject-Token", f.validToken)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"token": {"catalog": [
+		{"type": "identity", "endpoints": [{"interface": "public", "region": "RegionOne", "url": "%[1]s/identity"}]},
+		{"type": "object-store", "endpoints": [
+			{"interface": "internal", "region": "RegionOne", "url": "http://internal.example.com"},
+			{"interface": "public", "region": "RegionTwo", "url": "http://region-two.example.com"},
+			{"interface": "public", "region": "RegionOne", "url": "%[1]s/swift/v1"}
+		]}
+	]}}`, f.url)
+}
+
+func (f *fakeSwift) list(w http.ResponseWriter, container string, prefix string, marker string) {
+	names := []string{}
+	for name := range f.objects {
+		if strings.HasPrefix(name, container+"/"+prefix) {
+			names = append(names, strings.TrimPrefix(name, container+"/"))
+		}
+	}
+	sort.Strings(names)
+
+	objects := []map[string]string{}
+	for _, name := range names {
+		if name <= marker || len(objects) == f.listPageSize {
+			continue
+		}
+		objects = append(objects, map[string]string{
+			"name":          name,
+			"hash":          fmt.Sprintf("hash-of-%s", name),
+			"last_modified": f.modified[container+"/"+name].UTC().Format("2006-01-02T15:04:05.000000"),
+		})
+	}
+	Expect(json.NewEncoder(w).Encode(objects)).To(Succeed())
+}
+
+var _ = Describe("Swift", func() {
+	var (
+		server *httptest.Server
+		fake   *fakeSwift
+		model  storage.Model
+		driver storage.Storage
+	)
+
+	BeforeEach(func() {
+		fake = newFakeSwift()
+		server = httptest.NewServer(fake)
+		fake.url = server.URL
+
+		model = storage.Model{
+			Driver:      storage.SwiftDriver,
+			AuthURL:     server.URL + "/identity",
+			Username:    "fake-user",
+			Password:    "fake-password",
+			ProjectName: "fake-project",
+			RegionName:  "RegionOne",
+			Container:   "fake-container",
+			BucketPath:  "fake-path",
+		}
+	})
+
+	JustBeforeEach(func() {
+		driver = storage.BuildDriver(model)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("uploads and downloads a state file", func() {
+		uploaded, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uploaded.StateFile).To(Equal("staging.tfstate"))
+		Expect(uploaded.LastModified).ToNot(BeZero())
+		Expect(fake.objects).To(HaveKey("fake-container/fake-path/staging.tfstate"))
+
+		contents := &bytes.Buffer{}
+		downloaded, err := driver.Download("staging.tfstate", contents)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents.String()).To(Equal("fake-state"))
+		Expect(downloaded).To(Equal(uploaded))
+	})
+
+	It("authenticates with a project scoped password and the default domains", func() {
+		_, err := driver.Version("staging.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fake.authRequests).To(HaveLen(1))
+		authRequest, err := json.Marshal(fake.authRequests[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(authRequest).To(MatchJSON(`{"auth": {
+			"identity": {
+				"methods": ["password"],
+				"password": {"user": {"name": "fake-user", "password": "fake-password", "domain": {"name": "Default"}}}
+			},
+			"scope": {"project": {"name": "fake-project", "domain": {"name": "Default"}}}
+		}}`))
+	})
+
+	It("returns an empty version if the object doesn't exist", func() {
+		version, err := driver.Version("missing.tfstate")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version.IsZero()).To(BeTrue())
+	})
+
+	It("authenticates again if the token has expired", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		fake.validToken = "a-newer-token"
+
+		_, err = driver.Upload("staging.tfstate", strings.NewReader("newer-state"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fake.authRequests).To(HaveLen(2))
+		Expect(fake.objects["fake-container/fake-path/staging.tfstate"]).To(Equal([]byte("newer-state")))
+	})
+
+	It("deletes an object and ignores one which doesn't exist", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(driver.Delete("staging.tfstate")).To(Succeed())
+		Expect(fake.objects).To(BeEmpty())
+	})
+
+	It("moves an object, refusing to overwrite an existing one", func() {
+		_, err := driver.Upload("staging.tfstate", strings.NewReader("fake-state"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = driver.Upload("other.tfstate", strings.NewReader("other-state"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(driver.Move("staging.tfstate", "other.tfstate")).To(MatchError(storage.ErrMoveConflict))
+
+		Expect(driver.Move("staging.tfstate", "production.tfstate")).To(Succeed())
+		Expect(fake.objects).To(Equal(map[string][]byte{
+			"fake-container/fake-path/production.tfstate": []byte("fake-state"),
+			"fake-container/fake-path/other.tfstate":      []byte("other-state"),
+		}))
+	})
+
+	It("returns the latest matching version across pages", func() {
+		fake.listPageSize = 1
+		now := time.Now().UTC().Truncate(time.Second)
+		fake.put("fake-container/fake-path/a.tfstate", []byte("a"), now.Add(-2*time.Hour))
+		fake.put("fake-container/fake-path/b.tfstate", []byte("b"), now)
+		fake.put("fake-container/fake-path/c.tfstate", []byte("c"), now.Add(-time.Hour))
+		fake.put("fake-container/fake-path/d.plan", []byte("d"), now.Add(time.Hour))
+
+		version, err := driver.LatestVersion(`\.tfstate$`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version).To(Equal(storage.Version{
+			LastModified: now,
+			StateFile:    "b.tfstate",
+			ETag:         "hash-of-fake-path/b.tfstate",
+		}))
+	})
+
+	Context("when an application credential is given", func() {
+		BeforeEach(func() {
+			model.Username = ""
+			model.Password = ""
+			model.ProjectName = ""
+			model.ApplicationCredentialID = "fake-id"
+			model.ApplicationCredentialSecret = "fake-secret"
+		})
+
+		It("authenticates with the credential without a scope", func() {
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).ToNot(HaveOccurred())
+
+			authRequest, err := json.Marshal(fake.authRequests[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(authRequest).To(MatchJSON(`{"auth": {"identity": {
+				"methods": ["application_credential"],
+				"application_credential": {"id": "fake-id", "secret": "fake-secret"}
+			}}}`))
+		})
+	})
+
+	Context("when the catalog has no object-store in the region", func() {
+		BeforeEach(func() {
+			model.RegionName = "RegionThree"
+		})
+
+		It("suggests setting the endpoint", func() {
+			_, err := driver.Version("staging.tfstate")
+			Expect(err).To(MatchError(ContainSubstring("set `storage.endpoint`")))
+		})
+	})
+})
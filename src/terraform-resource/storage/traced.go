@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"io"
+
+	"github.com/ljfranklin/terraform-resource/tracing"
+)
+
+type traced struct {
+	driver Storage
+	span   *tracing.Span
+}
+
+// WithTracing records a child span of the given span for each storage
+// operation. The driver is returned unchanged if tracing is disabled.
+func WithTracing(driver Storage, span *tracing.Span) Storage {
+	if span == nil {
+		return driver
+	}
+	return traced{
+		driver: driver,
+		span:   span,
+	}
+}
+
+func (t traced) Download(key string, destination io.Writer) (Version, error) {
+	span := t.start("storage download", key)
+	version, err := t.driver.Download(key, destination)
+	span.End(err)
+	return version, err
+}
+
+func (t traced) DownloadVersion(key string, versionID string, destination io.Writer) (Version, error) {
+	span := t.start("storage download", key)
+	span.SetAttribute("storage.version_id", versionID)
+	version, err := DownloadVersion(t.driver, key, versionID, destination)
+	span.End(err)
+	return version, err
+}
+
+func (t traced) Upload(key string, content io.Reader) (Version, error) {
+	span := t.start("storage upload", key)
+	version, err := t.driver.Upload(key, content)
+	span.End(err)
+	return version, err
+}
+
+func (t traced) Delete(key string) error {
+	span := t.start("storage delete", key)
+	err := t.driver.Delete(key)
+	span.End(err)
+	return err
+}
+
+func (t traced) Move(srcKey string, dstKey string) error {
+	span := t.start("storage move", srcKey)
+	span.SetAttribute("storage.destination_key", dstKey)
+	err := t.driver.Move(srcKey, dstKey)
+	span.End(err)
+	return err
+}
+
+func (t traced) Version(key string) (Version, error) {
+	span := t.start("storage version", key)
+	version, err := t.driver.Version(key)
+	span.End(err)
+	return version, err
+}
+
+func (t traced) LatestVersion(filterRegex string) (Version, error) {
+	span := t.start("storage latest version", filterRegex)
+	version, err := t.driver.LatestVersion(filterRegex)
+	span.End(err)
+	return version, err
+}
+
+func (t traced) start(name string, key string) *tracing.Span {
+	span := t.span.StartChild(name)
+	span.SetAttribute("storage.key", key)
+	return span
+}
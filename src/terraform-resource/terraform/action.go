@@ -1,15 +1,23 @@
 package terraform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/inventory"
 	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type Action struct {
@@ -18,11 +26,92 @@ type Action struct {
 	Logger    logger.Logger
 	EnvName   string
 	SourceDir string
+	Span      *tracing.Span
+
+	// DeleteOnFailureTimeout bounds the destroy run by `delete_on_failure`,
+	// zero means no timeout
+	DeleteOnFailureTimeout time.Duration
+
+	// MaxChanges aborts an apply whose plan exceeds the budget, nil means
+	// no limit
+	MaxChanges *models.ChangeBudget
+
+	// StateManipulations run in order after imports and before apply
+	StateManipulations []StateManipulation
+
+	// StateTags are added to the state as outputs after a successful apply,
+	// nil disables tagging
+	StateTags *StateTags
+
+	// FailOnDeferred fails the put after an apply which left deferred actions
+	FailOnDeferred bool
+
+	// RequireConverged keeps reporting the last fully converged version
+	// while applies leave deferred actions, see ConvergenceMarker
+	RequireConverged bool
+
+	// RunValidate runs `terraform validate` after init so an invalid config
+	// fails before anything takes the state lock
+	RunValidate bool
+
+	// RecordInventory stores the providers and modules of a successful apply
+	// in an InventoryMarker, which a destroy removes
+	RecordInventory bool
+
+	// RecordProvenance stores the ConfigHash and source revision of each
+	// applied serial in a ProvenanceMarker, which Rollback checks against
+	RecordProvenance bool
+
+	// ConfigHash is the models.Terraform ConfigHash of this put's inputs
+	ConfigHash string
+
+	// VerifyBackend compares the backend against the BackendMarker recorded
+	// by the last apply, see `approve_backend_change`
+	VerifyBackend bool
+
+	// VerifyPlan checks the plan fetched by `plan_run` can be read with
+	// `terraform show -json` before applying it, see `apply_plan`
+	VerifyPlan bool
+
+	// ForceUnlockID is a state lock released before the first command which
+	// takes the lock, see `force_unlock`
+	ForceUnlockID string
+
+	// AutoForceUnlock releases a lock held on this env's state and retries
+	// the command once, see `auto_force_unlock`
+	AutoForceUnlock bool
+
+	// PutIntent is claimed once the backend is initialized, nil disables it.
+	// The caller releases it after the last action of the put.
+	PutIntent *PutIntent
+
+	forceUnlocked bool
 }
 
+// maxReportedAddresses limits how many resources are listed per exceeded
+// budget so a runaway for_each doesn't flood the build log
+const maxReportedAddresses = 20
+
 type Result struct {
-	Version models.Version
-	Output  map[string]map[string]interface{}
+	Version           models.Version
+	Output            map[string]map[string]interface{}
+	DriftedAttributes []string
+
+	// AlreadyDestroyed is true if a destroy found the workspace already gone
+	AlreadyDestroyed bool
+
+	// PlanChanges is nil unless the JSON plan was inspected
+	PlanChanges *PlanChanges
+
+	// PlanHasChanges is nil unless a plan was saved for `plan_only`
+	PlanHasChanges *bool
+
+	// AppliedChanges is nil unless terraform reported the counts of an apply
+	AppliedChanges *AppliedChanges
+
+	// SensitiveOutputNames are masked by SanitizedOutput in addition to the
+	// outputs marked sensitive in the state, see `sensitive_output_names`
+	SensitiveOutputNames []string
 }
 
 func (r Result) RawOutput() map[string]interface{} {
@@ -35,9 +124,13 @@ func (r Result) RawOutput() map[string]interface{} {
 }
 
 func (r Result) SanitizedOutput() map[string]string {
+	return sanitizeOutput(r.Output, r.SensitiveOutputNames)
+}
+
+func sanitizeOutput(outputs map[string]map[string]interface{}, sensitiveOutputNames []string) map[string]string {
 	output := map[string]string{}
-	for key, value := range r.Output {
-		if value["sensitive"] == true {
+	for key, value := range outputs {
+		if value["sensitive"] == true || matchesAny(key, sensitiveOutputNames) {
 			output[key] = "<sensitive>"
 		} else {
 			jsonValue, err := json.Marshal(value["value"])
@@ -51,6 +144,67 @@ func (r Result) SanitizedOutput() map[string]string {
 	return output
 }
 
+// matchesAny uses path.Match, the patterns are validated with the model
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// TypedOutput returns the unsanitized outputs sorted by name, with a `Type`
+// so consumers can decode each `Value` without guessing, e.g. to tell the
+// number 42 apart from the string "42". Non-string values are JSON encoded.
+func (r Result) TypedOutput() []models.MetadataField {
+	keys := []string{}
+	for key := range r.Output {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := []models.MetadataField{}
+	for _, key := range keys {
+		value := r.Output[key]["value"]
+
+		var valueType string
+		switch value.(type) {
+		case string:
+			valueType = models.MetadataTypeString
+		case float64, int:
+			valueType = models.MetadataTypeNumber
+		case bool:
+			valueType = models.MetadataTypeBool
+		case []interface{}:
+			valueType = models.MetadataTypeList
+		case map[string]interface{}:
+			valueType = models.MetadataTypeMap
+		case nil:
+			valueType = models.MetadataTypeNull
+		}
+
+		var encodedValue string
+		if s, ok := value.(string); ok {
+			encodedValue = s
+		} else {
+			jsonValue, err := json.Marshal(value)
+			if err != nil {
+				jsonValue = []byte(fmt.Sprintf("Unable to parse output value for key '%s': %s", key, err))
+			}
+			encodedValue = string(jsonValue)
+		}
+
+		fields = append(fields, models.MetadataField{
+			Name:  key,
+			Value: encodedValue,
+			Type:  valueType,
+		})
+	}
+
+	return fields
+}
+
 func LinkToThirdPartyPluginDir(sourceDir string) error {
 	possiblePluginDir := filepath.Join(sourceDir, "terraform.d")
 	if _, err := os.Stat(possiblePluginDir); err == nil {
@@ -69,7 +223,65 @@ func (a *Action) Apply() (Result, error) {
 		return Result{}, err
 	}
 
+	return a.apply()
+}
+
+// Rollback re-applies the config of toSerial. The current inputs must have
+// the ConfigHash recorded for that serial, otherwise the apply would not
+// reproduce it.
+func (a *Action) Rollback(toSerial int) (Result, error) {
+	err := a.setup()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := a.verifyRollback(toSerial); err != nil {
+		a.Logger.Error("Refusing To Roll Back!")
+		return Result{}, fmt.Errorf("Rollback Error: %s", err)
+	}
+
+	return a.apply()
+}
+
+func (a *Action) verifyRollback(toSerial int) error {
+	if err := a.Client.WorkspaceSelect(a.EnvName); errors.Is(err, ErrWorkspaceNotFound) {
+		return fmt.Errorf("Env '%s' does not exist", a.EnvName)
+	} else if err != nil {
+		return err
+	}
+	current, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return err
+	}
+	if toSerial >= current.Serial {
+		return fmt.Errorf("`to_serial` %d must be older than the current serial %d of env '%s'", toSerial, current.Serial, a.EnvName)
+	}
+
+	record, found, err := ProvenanceMarker{Client: a.Client, EnvName: a.EnvName}.Find(toSerial)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("No provenance is recorded for serial %d of env '%s', the inputs it was applied with can't be reconstructed. "+
+			"Only the last %d serials applied with `record_provenance: true` can be rolled back to.", toSerial, a.EnvName, maxProvenanceRecords)
+	}
+	// a new lineage means the state was replaced and the serials restarted
+	if record.Lineage != current.Lineage {
+		return fmt.Errorf("Serial %d was applied to state lineage '%s' but env '%s' now has lineage '%s'", toSerial, record.Lineage, a.EnvName, current.Lineage)
+	}
+	if record.ConfigHash != a.ConfigHash {
+		return fmt.Errorf("`terraform_source` and vars don't match those %s was applied with. "+
+			"Pin the inputs to that revision or pass it as `rollback_source`.", record)
+	}
+
+	a.Logger.Warn(fmt.Sprintf("Rolling back env '%s' from serial %d to the config of %s\n", a.EnvName, current.Serial, record))
+	return nil
+}
+
+func (a *Action) apply() (Result, error) {
+	applySpan := a.Span.StartChild("terraform apply")
 	result, err := a.attemptApply()
+	applySpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Apply!")
 		err = fmt.Errorf("Apply Error: %s", err)
@@ -78,13 +290,22 @@ func (a *Action) Apply() (Result, error) {
 	if err != nil && a.Model.DeleteOnFailure {
 		a.Logger.Warn("Cleaning Up Partially Created Resources...")
 
-		_, destroyErr := a.attemptDestroy()
+		ctx, cancel := deleteOnFailureContext(a.DeleteOnFailureTimeout)
+		_, destroyErr := a.attemptDestroy(ctx)
+		destroyErr = deleteOnFailureTimeoutError(ctx, a.DeleteOnFailureTimeout, destroyErr)
+		cancel()
 		if destroyErr != nil {
 			a.Logger.Error("Failed To Run Terraform Destroy!")
 			err = fmt.Errorf("%s\nDestroy Error: %s", err, destroyErr)
 		}
 	}
 
+	// checked after delete_on_failure, the apply itself succeeded
+	if err == nil && a.FailOnDeferred && result.PlanChanges != nil && result.PlanChanges.Deferred > 0 {
+		a.Logger.Error("Terraform Apply Deferred Actions!")
+		err = deferredActionsError(*result.PlanChanges)
+	}
+
 	if err == nil {
 		a.Logger.Success("Successfully Ran Terraform Apply!")
 	}
@@ -92,28 +313,127 @@ func (a *Action) Apply() (Result, error) {
 	return result, err
 }
 
+func deferredActionsError(changes PlanChanges) error {
+	message := fmt.Sprintf("Apply left %d deferred action(s), run the `put` again to apply them or unset `fail_on_deferred`:", changes.Deferred)
+	for i, address := range changes.DeferredAddresses {
+		if i == maxReportedAddresses {
+			message += fmt.Sprintf("\n  ... and %d more", len(changes.DeferredAddresses)-maxReportedAddresses)
+			break
+		}
+		message += fmt.Sprintf("\n  %s", address)
+	}
+	return errors.New(message)
+}
+
+func deleteOnFailureContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func deleteOnFailureTimeoutError(ctx context.Context, timeout time.Duration, destroyErr error) error {
+	if destroyErr == nil || ctx.Err() != context.DeadlineExceeded {
+		return destroyErr
+	}
+	return fmt.Errorf("Timed out after %s, the environment may be partially created and need to be cleaned up manually: %s", timeout, destroyErr)
+}
+
 func (a *Action) attemptApply() (Result, error) {
 	a.Logger.InfoSection("Terraform Apply")
 	defer a.Logger.EndSection()
 
+	if a.VerifyPlan {
+		if err := a.verifyPlanExists(); err != nil {
+			return Result{}, err
+		}
+	}
+
 	if a.Model.PlanRun {
 		if err := a.Client.GetPlanFromBackend(a.planNameForEnv()); err != nil {
 			return Result{}, err
 		}
 	}
 
+	if a.VerifyPlan {
+		if err := a.verifyPlan(); err != nil {
+			return Result{}, err
+		}
+	}
+
 	if err := a.Client.WorkspaceNewIfNotExists(a.EnvName); err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.Import(a.EnvName); err != nil {
+	backendMarker := BackendMarker{Client: a.Client, EnvName: a.EnvName}
+	var recordedBackend BackendFingerprint
+	if a.VerifyBackend {
+		var err error
+		if recordedBackend, err = a.verifyBackend(backendMarker); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if err := a.withStateLock(func() error { return a.Client.Import(a.EnvName) }); err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.Apply(); err != nil {
+	for _, manipulation := range a.StateManipulations {
+		if err := a.withStateLock(func() error { return manipulation.Manipulate(a.Client, a.EnvName) }); err != nil {
+			return Result{}, err
+		}
+	}
+
+	var changes *PlanChanges
+	if a.MaxChanges != nil || a.FailOnDeferred || a.RequireConverged {
+		savedChanges, err := a.savedPlanChanges()
+		if err != nil {
+			return Result{}, err
+		}
+		changes = &savedChanges
+	}
+
+	if a.MaxChanges != nil {
+		if err := checkChangeBudget(*a.MaxChanges, *changes); err != nil {
+			return Result{}, err
+		}
+	}
+
+	convergence := ConvergenceMarker{Client: a.Client, EnvName: a.EnvName}
+	if a.RequireConverged && changes.Deferred > 0 {
+		// written before apply so a failed apply also counts as unconverged
+		converged, err := a.Client.CurrentStateVersion(a.EnvName)
+		if err != nil {
+			return Result{}, err
+		}
+		if converged.Empty {
+			converged = StateVersion{} // a new env has never converged
+		}
+		if err := convergence.Write(converged); err != nil {
+			return Result{}, err
+		}
+		// creating the marker workspace selects it, and apply runs against
+		// the selected workspace
+		if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if err := a.withStateLock(a.Client.Apply); err != nil {
 		return Result{}, err
 	}
 
+	applied := a.Client.AppliedChanges()
+	if applied != nil {
+		a.Logger.Info(fmt.Sprintf("Resources: %d added, %d changed, %d destroyed\n", applied.Add, applied.Change, applied.Destroy))
+	}
+
+	if a.StateTags != nil {
+		if err := tagState(a.Client, a.EnvName, *a.StateTags); err != nil {
+			return Result{}, fmt.Errorf("Failed to tag state: %s", err)
+		}
+	}
+
 	stateVersion, err := a.Client.CurrentStateVersion(a.EnvName)
 	if err != nil {
 		return Result{}, err
@@ -127,6 +447,45 @@ func (a *Action) attemptApply() (Result, error) {
 		return Result{}, err
 	}
 
+	if a.RecordInventory {
+		if err := a.recordInventory(); err != nil {
+			return Result{}, fmt.Errorf("Failed to record inventory: %s", err)
+		}
+	}
+
+	if a.RecordProvenance {
+		record := NewProvenanceRecord(a.ConfigHash, a.Model.Source)
+		record.Serial = stateVersion.Serial
+		record.Lineage = stateVersion.Lineage
+		if err := (ProvenanceMarker{Client: a.Client, EnvName: a.EnvName}).Add(record); err != nil {
+			return Result{}, fmt.Errorf("Failed to record provenance: %s", err)
+		}
+	}
+
+	if a.VerifyBackend {
+		if err := a.recordBackend(backendMarker, recordedBackend, stateVersion.Lineage); err != nil {
+			return Result{}, fmt.Errorf("Failed to record backend: %s", err)
+		}
+	}
+
+	if a.RequireConverged {
+		if changes.Deferred == 0 {
+			if err := convergence.Clear(); err != nil {
+				return Result{}, err
+			}
+		} else {
+			// a new version would trigger downstream jobs before the env converges
+			converged, found, err := convergence.Read()
+			if err != nil {
+				return Result{}, err
+			}
+			if found && converged != (StateVersion{}) {
+				a.Logger.Warn(fmt.Sprintf("Reporting the last converged serial %d until the deferred actions are applied", converged.Serial))
+				stateVersion = converged
+			}
+		}
+	}
+
 	return Result{
 		Output: clientOutput,
 		Version: models.Version{
@@ -134,16 +493,23 @@ func (a *Action) attemptApply() (Result, error) {
 			Serial:  strconv.Itoa(stateVersion.Serial),
 			Lineage: stateVersion.Lineage,
 		},
+		PlanChanges:    changes,
+		AppliedChanges: applied,
 	}, nil
 }
 
 func (a *Action) Destroy() (Result, error) {
 	err := a.setup()
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return alreadyDestroyed(a.EnvName, a.Logger), nil
+	}
 	if err != nil {
 		return Result{}, err
 	}
 
-	result, err := a.attemptDestroy()
+	destroySpan := a.Span.StartChild("terraform destroy")
+	result, err := a.attemptDestroy(context.Background())
+	destroySpan.End(err)
 	if err == nil {
 		a.Logger.Success("Successfully Ran Terraform Destroy!")
 	}
@@ -151,23 +517,29 @@ func (a *Action) Destroy() (Result, error) {
 	return result, err
 }
 
-func (a *Action) attemptDestroy() (Result, error) {
+func (a *Action) attemptDestroy(ctx context.Context) (Result, error) {
 	a.Logger.WarnSection("Terraform Destroy")
 	defer a.Logger.EndSection()
 
-	if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+	if err := a.Client.WorkspaceSelect(a.EnvName); errors.Is(err, ErrWorkspaceNotFound) {
+		if err := a.deletePlanWorkspaceIfExists(); err != nil {
+			return Result{}, err
+		}
+		return alreadyDestroyed(a.EnvName, a.Logger), nil
+	} else if err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.Import(a.EnvName); err != nil {
+	if err := a.withStateLock(func() error { return a.Client.Import(a.EnvName) }); err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.Destroy(); err != nil {
+	if err := a.withStateLock(func() error { return a.Client.Destroy(ctx) }); err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.WorkspaceDelete(a.EnvName); err != nil {
+	// a concurrent destroy may have deleted the workspace in the meantime
+	if err := a.Client.WorkspaceDelete(a.EnvName); err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
 		return Result{}, err
 	}
 
@@ -175,10 +547,219 @@ func (a *Action) attemptDestroy() (Result, error) {
 		return Result{}, err
 	}
 
+	if a.RecordInventory {
+		if err := (InventoryMarker{Client: a.Client, EnvName: a.EnvName}).Clear(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if a.RecordProvenance {
+		if err := (ProvenanceMarker{Client: a.Client, EnvName: a.EnvName}).Clear(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if a.VerifyBackend {
+		if err := (BackendMarker{Client: a.Client, EnvName: a.EnvName}).Clear(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// otherwise `check` would keep reporting the destroyed env's last
+	// converged version once the env is recreated
+	if a.RequireConverged {
+		if err := (ConvergenceMarker{Client: a.Client, EnvName: a.EnvName}).Clear(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	return Result{
+		Output: map[string]map[string]interface{}{},
+		Version: models.Version{
+			EnvName: a.EnvName,
+		},
+	}, nil
+}
+
+// alreadyDestroyed lets a retriggered destroy succeed once the workspace
+// is gone, the desired end state has been reached either way
+func alreadyDestroyed(envName string, logger logger.Logger) Result {
+	logger.Warn(fmt.Sprintf("Workspace '%s' does not exist, assuming it was already destroyed", envName))
 	return Result{
 		Output: map[string]map[string]interface{}{},
+		Version: models.Version{
+			EnvName: envName,
+		},
+		AlreadyDestroyed: true,
+	}
+}
+
+func (a *Action) RefreshOnly() (Result, error) {
+	err := a.setup()
+	if err != nil {
+		return Result{}, err
+	}
+
+	refreshSpan := a.Span.StartChild("terraform refresh")
+	result, err := a.attemptRefreshOnly()
+	refreshSpan.End(err)
+	if err != nil {
+		a.Logger.Error("Failed To Run Terraform Refresh!")
+		err = fmt.Errorf("Refresh Error: %s", err)
+	}
+
+	if err == nil {
+		a.Logger.Success("Successfully Ran Terraform Refresh!")
+	}
+
+	return result, err
+}
+
+func (a *Action) attemptRefreshOnly() (Result, error) {
+	a.Logger.InfoSection("Terraform Refresh")
+	defer a.Logger.EndSection()
+
+	if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+		return Result{}, err
+	}
+
+	var drifted []string
+	err := a.withStateLock(func() (err error) {
+		drifted, err = a.Client.RefreshOnly()
+		return err
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	stateVersion, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+	clientOutput, err := a.Client.Output(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Output:            clientOutput,
+		DriftedAttributes: drifted,
 		Version: models.Version{
 			EnvName: a.EnvName,
+			Serial:  strconv.Itoa(stateVersion.Serial),
+			Lineage: stateVersion.Lineage,
+		},
+	}, nil
+}
+
+// StateMv moves each resource in order, e.g. after renaming it in the config,
+// without planning or applying
+func (a *Action) StateMv(moves []models.StateMove) (Result, error) {
+	err := a.setup()
+	if err != nil {
+		return Result{}, err
+	}
+
+	stateMvSpan := a.Span.StartChild("terraform state mv")
+	result, err := a.attemptStateMv(moves)
+	stateMvSpan.End(err)
+	if err != nil {
+		a.Logger.Error("Failed To Run Terraform State Mv!")
+		err = fmt.Errorf("State Mv Error: %s", err)
+	}
+
+	if err == nil {
+		a.Logger.Success("Successfully Ran Terraform State Mv!")
+	}
+
+	return result, err
+}
+
+// ForceUnlock releases the given state lock of the env, e.g. one left
+// behind by a worker which died mid-apply, see the `force_unlock` action
+func (a *Action) ForceUnlock(lockID string) (Result, error) {
+	err := a.setup()
+	if err != nil {
+		return Result{}, err
+	}
+
+	forceUnlockSpan := a.Span.StartChild("terraform force-unlock")
+	result, err := a.attemptForceUnlock(lockID)
+	forceUnlockSpan.End(err)
+	if err != nil {
+		a.Logger.Error("Failed To Run Terraform Force Unlock!")
+		err = fmt.Errorf("Force Unlock Error: %s", err)
+	}
+
+	if err == nil {
+		a.Logger.Success("Successfully Ran Terraform Force Unlock!")
+	}
+
+	return result, err
+}
+
+func (a *Action) attemptForceUnlock(lockID string) (Result, error) {
+	a.Logger.WarnSection("Terraform Force Unlock")
+	defer a.Logger.EndSection()
+
+	if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+		return Result{}, err
+	}
+
+	if err := a.Client.ForceUnlock(lockID); err != nil {
+		return Result{}, err
+	}
+
+	stateVersion, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+	clientOutput, err := a.Client.Output(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Output: clientOutput,
+		Version: models.Version{
+			EnvName: a.EnvName,
+			Serial:  strconv.Itoa(stateVersion.Serial),
+			Lineage: stateVersion.Lineage,
+		},
+	}, nil
+}
+
+func (a *Action) attemptStateMv(moves []models.StateMove) (Result, error) {
+	a.Logger.InfoSection("Terraform State Mv")
+	defer a.Logger.EndSection()
+
+	if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+		return Result{}, err
+	}
+
+	for _, move := range moves {
+		a.Logger.Info(fmt.Sprintf("Moving %s to %s", move.From, move.To))
+		manipulation := StateMvManipulation{From: move.From, To: move.To}
+		if err := manipulation.Manipulate(a.Client, a.EnvName); err != nil {
+			return Result{}, err
+		}
+	}
+
+	stateVersion, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+	clientOutput, err := a.Client.Output(a.EnvName)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Output: clientOutput,
+		Version: models.Version{
+			EnvName: a.EnvName,
+			Serial:  strconv.Itoa(stateVersion.Serial),
+			Lineage: stateVersion.Lineage,
 		},
 	}, nil
 }
@@ -189,7 +770,12 @@ func (a *Action) Plan() (Result, error) {
 		return Result{}, err
 	}
 
+	planSpan := a.Span.StartChild("terraform plan")
 	result, err := a.attemptPlan()
+	if err == nil {
+		recordPlanChanges(planSpan, a.Model.JSONPlanFileLocalPath)
+	}
+	planSpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Plan!")
 		err = fmt.Errorf("Plan Error: %s", err)
@@ -210,7 +796,12 @@ func (a *Action) attemptPlan() (Result, error) {
 		return Result{}, err
 	}
 
-	checksum, err := a.Client.Plan()
+	var checksum string
+	var hasChanges bool
+	err := a.withStateLock(func() (err error) {
+		checksum, hasChanges, err = a.Client.Plan()
+		return err
+	})
 	if err != nil {
 		return Result{}, err
 	}
@@ -220,16 +811,31 @@ func (a *Action) attemptPlan() (Result, error) {
 		return Result{}, err
 	}
 
+	err = a.Client.TextPlan()
+	if err != nil {
+		return Result{}, err
+	}
+
 	if err = a.Client.SavePlanToBackend(a.planNameForEnv()); err != nil {
 		return Result{}, err
 	}
 
+	// best-effort, the counts are informational for a plan
+	var changes *PlanChanges
+	if rawPlan, err := ioutil.ReadFile(a.Model.JSONPlanFileLocalPath); err == nil {
+		if planned, err := planChanges(rawPlan); err == nil {
+			changes = &planned
+		}
+	}
+
 	return Result{
 		Output: map[string]map[string]interface{}{},
 		Version: models.Version{
 			EnvName:      a.EnvName,
 			PlanChecksum: checksum,
 		},
+		PlanChanges:    changes,
+		PlanHasChanges: &hasChanges,
 	}, nil
 }
 
@@ -238,21 +844,211 @@ func (a *Action) setup() error {
 		return err
 	}
 
-	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source); err != nil {
+	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source, a.Logger); err != nil {
 		return err
 	}
 
-	if err := copyOverrideFilesIntoSourceDir(a.Model.ModuleOverrideFiles); err != nil {
+	if err := copyOverrideFilesIntoSourceDir(a.Model.ModuleOverrideFiles, a.Model.Source, a.Logger); err != nil {
 		return err
 	}
 
-	if err := a.Client.InitWithBackend(); err != nil {
+	initSpan := a.Span.StartChild("terraform init")
+	err := withSSHKeyFile(a.Model, a.Client.InitWithBackend)
+	initSpan.End(err)
+	if err != nil {
 		return err
 	}
 
+	if a.PutIntent != nil {
+		if err := a.PutIntent.Claim(); err != nil {
+			return err
+		}
+	}
+
+	if a.RunValidate {
+		validateSpan := a.Span.StartChild("terraform validate")
+		err = a.Client.Validate()
+		validateSpan.End(err)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// recordPlanChanges is best-effort, a missing or unparseable plan
+// shouldn't fail the build just because tracing is enabled
+func recordPlanChanges(span *tracing.Span, jsonPlanPath string) {
+	if span == nil {
+		return
+	}
+
+	rawPlan, err := ioutil.ReadFile(jsonPlanPath)
+	if err != nil {
+		return
+	}
+	changes, err := planChanges(rawPlan)
+	if err != nil {
+		return
+	}
+
+	span.SetAttribute("changes.add", changes.Add)
+	span.SetAttribute("changes.change", changes.Change)
+	span.SetAttribute("changes.destroy", changes.Destroy)
+}
+
+// withStateLock runs op, a command which takes the state lock of the
+// selected workspace. The `force_unlock` lock is released before the first
+// such command. While the lock is held, op is retried as configured by
+// `lock_retry`. With `auto_force_unlock`, a lock still held on this env's
+// state is then released and op retried once, other locks may belong to a
+// concurrent put so are left alone.
+func (a *Action) withStateLock(op func() error) error {
+	if a.ForceUnlockID != "" && !a.forceUnlocked {
+		a.Logger.Warn(fmt.Sprintf("Releasing the state lock '%s' from `force_unlock`, remove `force_unlock` once the put succeeds.\n", a.ForceUnlockID))
+		if err := a.Client.ForceUnlock(a.ForceUnlockID); err != nil {
+			return err
+		}
+		a.forceUnlocked = true
+	}
+
+	err := a.withLockRetry(op)
+	var lockErr *StateLockedError
+	if !a.AutoForceUnlock || !errors.As(err, &lockErr) {
+		return err
+	}
+
+	workspace := a.Model.WorkspacePrefix + a.EnvName
+	if !lockErr.HeldForWorkspace(workspace) {
+		return fmt.Errorf("%s\nNot releasing the state lock '%s' with `auto_force_unlock` as its path '%s' doesn't belong to env '%s', "+
+			"set `force_unlock: %s` if the lock was left behind", err, lockErr.ID, lockErr.Path, a.EnvName, lockErr.ID)
+	}
+
+	a.Logger.Warn(fmt.Sprintf("Releasing the state lock '%s' on env '%s' held by '%s' since '%s' with `auto_force_unlock`.\n",
+		lockErr.ID, a.EnvName, lockErr.Who, lockErr.Created))
+	if err := a.Client.ForceUnlock(lockErr.ID); err != nil {
+		return err
+	}
+	return op()
+}
+
+// withLockRetry runs op again after each failure to acquire the state lock,
+// up to `lock_retry.attempts` times, other errors are returned immediately.
+// Once the attempts are exhausted the error includes the lock info.
+func (a *Action) withLockRetry(op func() error) error {
+	err := op()
+	if a.Model.LockRetry == nil {
+		return err
+	}
+
+	lockRetry := *a.Model.LockRetry
+	interval := lockRetry.IntervalDuration()
+	var lockErr *StateLockedError
+	for attempt := 1; errors.As(err, &lockErr); attempt++ {
+		if attempt > lockRetry.Attempts {
+			exhausted := *lockErr
+			exhausted.Err = fmt.Errorf("%s\nThe state lock was still held after %d attempt(s) every %s, Lock Info: %s",
+				lockErr.Err, lockRetry.Attempts, interval, lockErr.LockInfo())
+			return &exhausted
+		}
+		a.Logger.Warn(fmt.Sprintf("The state lock is held by another operation, retrying in %s (attempt %d of %d), Lock Info: %s\n",
+			interval, attempt, lockRetry.Attempts, lockErr.LockInfo()))
+		time.Sleep(interval)
+		err = op()
+	}
+	return err
+}
+
+// savedPlanChanges inspects the plan which will actually be applied. Without
+// `plan_run` a plan is saved first and applied the same way as `plan_run`.
+func (a *Action) savedPlanChanges() (PlanChanges, error) {
+	if !a.Model.PlanRun {
+		// terraform rejects -target when applying a saved plan
+		if len(a.Model.Targets) > 0 {
+			return PlanChanges{}, errors.New("`max_changes`, `fail_on_deferred`, and `require_converged` cannot be combined with `targets` unless using `plan_run`")
+		}
+		err := a.withStateLock(func() error {
+			_, _, err := a.Client.Plan()
+			return err
+		})
+		if err != nil {
+			return PlanChanges{}, err
+		}
+		planRunModel := a.Model
+		planRunModel.PlanRun = true
+		a.Client.SetModel(planRunModel)
+	}
+
+	if err := a.Client.JSONPlan(); err != nil {
+		return PlanChanges{}, err
+	}
+	rawPlan, err := ioutil.ReadFile(a.Model.JSONPlanFileLocalPath)
+	if err != nil {
+		return PlanChanges{}, fmt.Errorf("Failed to read JSON plan: %s", err)
+	}
+	return planChanges(rawPlan)
+}
+
+// verifyPlanExists fails with a clearer error than selecting the missing
+// plan workspace
+func (a *Action) verifyPlanExists() error {
+	workspaces, err := a.Client.WorkspaceList()
+	if err != nil {
+		return err
+	}
+	for _, space := range workspaces {
+		if space == a.planNameForEnv() {
+			return nil
+		}
+	}
+	return fmt.Errorf("No plan found for '%s', it may have already been applied. Run a `plan_only` put before `apply_plan`.", a.EnvName)
+}
+
+// verifyPlan confirms the fetched plan file can be read by this terraform
+// and its providers, and logs what applying it will do
+func (a *Action) verifyPlan() error {
+	if err := a.Client.JSONPlan(); err != nil {
+		return fmt.Errorf("The plan for '%s' cannot be applied, run a `plan_only` put again: %s", a.EnvName, err)
+	}
+	rawPlan, err := ioutil.ReadFile(a.Model.JSONPlanFileLocalPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read JSON plan: %s", err)
+	}
+	changes, err := planChanges(rawPlan)
+	if err != nil {
+		return fmt.Errorf("The plan for '%s' cannot be applied, run a `plan_only` put again: %s", a.EnvName, err)
+	}
+	a.Logger.Info(fmt.Sprintf("Applying the stored plan: %d to add, %d to change, %d to destroy\n", changes.Add, changes.Change, changes.Destroy))
+	return nil
+}
+
+func checkChangeBudget(budget models.ChangeBudget, changes PlanChanges) error {
+	exceeded := []string{}
+	check := func(verb string, limit *int, count int, addresses []string) {
+		if limit == nil || count <= *limit {
+			return
+		}
+		message := fmt.Sprintf("%d to %s exceeds the limit of %d:", count, verb, *limit)
+		for i, address := range addresses {
+			if i == maxReportedAddresses {
+				message += fmt.Sprintf("\n  ... and %d more", len(addresses)-maxReportedAddresses)
+				break
+			}
+			message += fmt.Sprintf("\n  %s", address)
+		}
+		exceeded = append(exceeded, message)
+	}
+	check("add", budget.Add, changes.Add, changes.AddAddresses)
+	check("change", budget.Change, changes.Change, changes.ChangeAddresses)
+	check("destroy", budget.Destroy, changes.Destroy, changes.DestroyAddresses)
+
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Aborting apply, the plan exceeds `max_changes`:\n%s", strings.Join(exceeded, "\n"))
+}
+
 func (a *Action) deletePlanWorkspaceIfExists() error {
 	workspaces, err := a.Client.WorkspaceList()
 
@@ -273,7 +1069,7 @@ func (a *Action) deletePlanWorkspaceIfExists() error {
 	return nil
 }
 
-func copyOverrideFilesIntoSource(overrideFiles []string, sourceDir string) error {
+func copyOverrideFilesIntoSource(overrideFiles []string, sourceDir string, logger logger.Logger) error {
 	for _, overridePath := range overrideFiles {
 		if fileInfo, err := os.Stat(overridePath); os.IsNotExist(err) {
 			return fmt.Errorf("override file '%s' does not exist", overridePath)
@@ -286,7 +1082,20 @@ func copyOverrideFilesIntoSource(overrideFiles []string, sourceDir string) error
 		if err != nil {
 			return err
 		}
-		err = os.Symlink(absOverridePath, path.Join(sourceDir, path.Base(absOverridePath)))
+
+		dstPath := path.Join(sourceDir, path.Base(absOverridePath))
+		if _, err := os.Lstat(dstPath); err == nil {
+			// already linked by an earlier setup in this put
+			if link, err := os.Readlink(dstPath); err == nil && link == absOverridePath {
+				continue
+			}
+			logger.Warn(fmt.Sprintf("Overwriting '%s' in `terraform_source` with override file '%s'", path.Base(dstPath), overridePath))
+			if err := os.Remove(dstPath); err != nil {
+				return err
+			}
+		}
+
+		err = os.Symlink(absOverridePath, dstPath)
 		if err != nil {
 			return err
 		}
@@ -295,8 +1104,11 @@ func copyOverrideFilesIntoSource(overrideFiles []string, sourceDir string) error
 	return nil
 }
 
-func copyOverrideFilesIntoSourceDir(ModuleOverrideFiles []map[string]string) error {
-	for i, overrideMap := range ModuleOverrideFiles {
+// copyOverrideFilesIntoSourceDir links each `src` file into the `dst`
+// directory, relative to sourceDir, creating it if needed. Validate has
+// already rejected a `dst` outside of sourceDir.
+func copyOverrideFilesIntoSourceDir(moduleOverrideFiles []map[string]string, sourceDir string, logger logger.Logger) error {
+	for i, overrideMap := range moduleOverrideFiles {
 
 		overrideSrcPath, ok := overrideMap["src"]
 		if !ok {
@@ -314,26 +1126,35 @@ func copyOverrideFilesIntoSourceDir(ModuleOverrideFiles []map[string]string) err
 		overrideDstPath, ok := overrideMap["dst"]
 		if !ok {
 			return fmt.Errorf("override map '%d' does not include dst key", i)
-		} else {
-			if fileInfo, err := os.Stat(overrideDstPath); os.IsNotExist(err) {
-				return fmt.Errorf("override destination directory '%s' does not exist", overrideDstPath)
-			} else if err != nil {
-				return err
-			} else if !fileInfo.IsDir() {
-				return fmt.Errorf("override destination '%s' is a file, must pass directory instead", overrideDstPath)
-			}
+		}
+		dstDir := filepath.Join(sourceDir, overrideDstPath)
+		if fileInfo, err := os.Stat(dstDir); err == nil && !fileInfo.IsDir() {
+			return fmt.Errorf("override destination '%s' is a file, must pass directory instead", overrideDstPath)
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.MkdirAll(dstDir, 0755); err != nil {
+			return fmt.Errorf("Failed to create override destination directory '%s': %s", overrideDstPath, err)
 		}
 
 		absOverrideSrcPath, err := filepath.Abs(overrideSrcPath)
 		if err != nil {
 			return err
 		}
-		absOverrideDstPath, err := filepath.Abs(overrideDstPath)
-		if err != nil {
-			return err
+
+		dstPath := filepath.Join(dstDir, filepath.Base(absOverrideSrcPath))
+		if _, err := os.Lstat(dstPath); err == nil {
+			// already linked by an earlier setup in this put
+			if link, err := os.Readlink(dstPath); err == nil && link == absOverrideSrcPath {
+				continue
+			}
+			logger.Warn(fmt.Sprintf("Overwriting '%s' in `terraform_source` with module override file '%s'", filepath.Join(overrideDstPath, filepath.Base(dstPath)), overrideSrcPath))
+			if err := os.Remove(dstPath); err != nil {
+				return err
+			}
 		}
 
-		err = os.Symlink(absOverrideSrcPath, path.Join(absOverrideDstPath, path.Base(absOverrideSrcPath)))
+		err = os.Symlink(absOverrideSrcPath, dstPath)
 		if err != nil {
 			return err
 		}
@@ -342,6 +1163,99 @@ func copyOverrideFilesIntoSourceDir(ModuleOverrideFiles []map[string]string) err
 	return nil
 }
 
+// recordInventory flags providers whose installed package doesn't match the
+// lock file in the inventory rather than failing, the apply already succeeded
+func (a *Action) recordInventory() error {
+	applied, err := inventory.Build(a.EnvName, a.Model.Source)
+	if err != nil {
+		return err
+	}
+	if mismatches := applied.HashMismatches(); len(mismatches) > 0 {
+		a.Logger.Warn(fmt.Sprintf("Installed provider(s) do not match the hashes in .terraform.lock.hcl: %s", strings.Join(mismatches, ", ")))
+	}
+	return InventoryMarker{Client: a.Client, EnvName: a.EnvName}.Write(applied)
+}
+
+// verifyBackend catches a changed backend on a fresh checkout, where
+// InitWithBackend has no `.terraform` directory to compare against. It
+// returns the recorded fingerprint, which is zero for an env without one.
+func (a *Action) verifyBackend(marker BackendMarker) (BackendFingerprint, error) {
+	recorded, found, err := marker.Read()
+	if err != nil {
+		return BackendFingerprint{}, err
+	}
+	current, err := NewBackendFingerprint(a.Model)
+	if err != nil {
+		return BackendFingerprint{}, err
+	}
+	if !found {
+		return BackendFingerprint{}, a.verifyUnrecordedBackend(current)
+	}
+	// an approved change detected by init has already had its lineage checked
+	if current.SameBackend(recorded) || a.Client.BackendChange() != nil {
+		return recorded, nil
+	}
+
+	if !a.Model.ApproveBackendChange {
+		return BackendFingerprint{}, fmt.Errorf("the backend configuration has changed since env '%s' was last applied with the '%s' backend. "+
+			"Set `put.params.approve_backend_change: true` to proceed.", a.EnvName, recorded.Type)
+	}
+	state, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return BackendFingerprint{}, err
+	}
+	if state.Lineage != recorded.Lineage {
+		return BackendFingerprint{}, fmt.Errorf("Expected state lineage '%s' after changing backend but got '%s', "+
+			"the new backend configuration may point at a different statefile", recorded.Lineage, state.Lineage)
+	}
+
+	a.Logger.WarnSection("Backend Changed")
+	a.Logger.Warn(fmt.Sprintf("Env '%s' was last applied with a different '%s' backend configuration, the statefile lineage is unchanged", a.EnvName, recorded.Type))
+	a.Logger.EndSection()
+	return recorded, nil
+}
+
+// verifyUnrecordedBackend handles an env without a marker. An env with state
+// was applied before markers were recorded and is trusted. An empty env is
+// only trusted if another env recorded the same backend, as a renamed prefix
+// or new bucket leaves every marker behind at the old location.
+func (a *Action) verifyUnrecordedBackend(current BackendFingerprint) error {
+	state, err := a.Client.CurrentStateVersion(a.EnvName)
+	if err != nil {
+		return err
+	}
+	if !state.Empty {
+		return nil
+	}
+	known, err := backendRecordedByAnyEnv(a.Client, current)
+	if err != nil || known {
+		return err
+	}
+
+	if !a.Model.ApproveBackendChange {
+		return fmt.Errorf("env '%s' has no state and no env has been applied with this '%s' backend configuration before, "+
+			"so a changed prefix or bucket cannot be ruled out. "+
+			"Set `put.params.approve_backend_change: true` to apply to an empty env.", a.EnvName, current.Type)
+	}
+	a.Logger.WarnSection("Backend Unverified")
+	a.Logger.Warn(fmt.Sprintf("Applying env '%s' with empty state to a '%s' backend configuration no env has been applied with before", a.EnvName, current.Type))
+	a.Logger.EndSection()
+	return nil
+}
+
+// recordBackend only rewrites the marker if the backend or lineage changed
+func (a *Action) recordBackend(marker BackendMarker, recorded BackendFingerprint, lineage string) error {
+	current, err := NewBackendFingerprint(a.Model)
+	if err != nil {
+		return err
+	}
+	current.Lineage = lineage
+	if current == recorded {
+		return nil
+	}
+	return marker.Write(current)
+}
+
 func (a *Action) planNameForEnv() string {
-	return fmt.Sprintf("%s-plan", a.EnvName)
+	return fmt.Sprintf("%s%s", a.EnvName, planSuffix)
 }
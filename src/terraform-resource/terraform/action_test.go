@@ -0,0 +1,1450 @@
+package terraform_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Result", func() {
+
+	Describe("#SanitizedOutput", func() {
+		It("masks outputs matching SensitiveOutputNames but leaves RawOutput intact", func() {
+			result := terraform.Result{
+				Output: map[string]map[string]interface{}{
+					"db_password":  {"value": "hunter2"},
+					"api_token":    {"value": "abc123"},
+					"secret":       {"value": "super-secret", "sensitive": true},
+					"public_value": {"value": "visible"},
+				},
+				SensitiveOutputNames: []string{"*_password", "api_token"},
+			}
+
+			Expect(result.SanitizedOutput()).To(Equal(map[string]string{
+				"db_password":  "<sensitive>",
+				"api_token":    "<sensitive>",
+				"secret":       "<sensitive>",
+				"public_value": "visible",
+			}))
+			Expect(result.RawOutput()).To(HaveKeyWithValue("db_password", "hunter2"))
+			Expect(result.RawOutput()).To(HaveKeyWithValue("api_token", "abc123"))
+		})
+	})
+
+	Describe("#TypedOutput", func() {
+		It("preserves the type of each output value", func() {
+			result := terraform.Result{
+				Output: map[string]map[string]interface{}{
+					"string": {"value": "42"},
+					"number": {"value": float64(42)},
+					"bool":   {"value": true},
+					"list":   {"value": []interface{}{"item-1", "item-2"}},
+					"map":    {"value": map[string]interface{}{"key-1": "value-1"}},
+					"null":   {"value": nil},
+					"secret": {"value": "super-secret", "sensitive": true},
+				},
+			}
+
+			Expect(result.TypedOutput()).To(Equal([]models.MetadataField{
+				{Name: "bool", Value: "true", Type: models.MetadataTypeBool},
+				{Name: "list", Value: `["item-1","item-2"]`, Type: models.MetadataTypeList},
+				{Name: "map", Value: `{"key-1":"value-1"}`, Type: models.MetadataTypeMap},
+				{Name: "null", Value: "null", Type: models.MetadataTypeNull},
+				{Name: "number", Value: "42", Type: models.MetadataTypeNumber},
+				{Name: "secret", Value: "super-secret", Type: models.MetadataTypeString},
+				{Name: "string", Value: "42", Type: models.MetadataTypeString},
+			}))
+		})
+	})
+})
+
+var _ = Describe("Action", func() {
+
+	Describe("#Apply", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+		)
+
+		BeforeEach(func() {
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.ApplyReturns(errors.New("apply-failed"))
+			fakeClient.DestroyStub = func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					DeleteOnFailure: true,
+				},
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				DeleteOnFailureTimeout: 50 * time.Millisecond,
+			}
+		})
+
+		It("cancels the delete_on_failure destroy once the timeout elapses", func() {
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("apply-failed"))
+			Expect(err.Error()).To(ContainSubstring("Timed out after 50ms"))
+			Expect(err.Error()).To(ContainSubstring("may be partially created"))
+		})
+
+		It("reports a destroy error without a timeout message if the destroy fails in time", func() {
+			fakeClient.DestroyStub = nil
+			fakeClient.DestroyReturns(errors.New("destroy-failed"))
+
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("destroy-failed"))
+			Expect(err.Error()).ToNot(ContainSubstring("Timed out"))
+		})
+	})
+
+	Describe("#Apply with MaxChanges", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			tmpDir     string
+		)
+
+		intPtr := func(i int) *int {
+			return &i
+		}
+
+		writePlan := func(changes map[string][]string) {
+			resourceChanges := []map[string]interface{}{}
+			for address, actions := range changes {
+				resourceChanges = append(resourceChanges, map[string]interface{}{
+					"address": address,
+					"change":  map[string]interface{}{"actions": actions},
+				})
+			}
+			contents, err := json.Marshal(map[string]interface{}{
+				"resource_changes": resourceChanges,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			fakeClient.JSONPlanStub = func() error {
+				return ioutil.WriteFile(action.Model.JSONPlanFileLocalPath, contents, 0644)
+			}
+		}
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "terraform-resource-action-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeClient = &terraformfakes.FakeClient{}
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					JSONPlanFileLocalPath: path.Join(tmpDir, "plan.json"),
+				},
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				MaxChanges: &models.ChangeBudget{
+					Add:     intPtr(2),
+					Destroy: intPtr(0),
+				},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("applies the saved plan when within budget", func() {
+			writePlan(map[string][]string{
+				"aws_instance.a": {"create"},
+				"aws_instance.b": {"create"},
+				"aws_instance.c": {"update"},
+			})
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.PlanCallCount()).To(Equal(1))
+			Expect(fakeClient.SetModelCallCount()).To(Equal(1))
+			Expect(fakeClient.SetModelArgsForCall(0).PlanRun).To(BeTrue())
+			Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+		})
+
+		It("aborts with the counts and offending addresses when over budget", func() {
+			writePlan(map[string][]string{
+				"aws_instance.a": {"create"},
+				"aws_instance.b": {"create"},
+				"aws_instance.c": {"create"},
+				"aws_instance.d": {"delete", "create"},
+			})
+
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("4 to add exceeds the limit of 2"))
+			Expect(err.Error()).To(ContainSubstring("1 to destroy exceeds the limit of 0"))
+			Expect(err.Error()).To(ContainSubstring("aws_instance.d"))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+
+		It("lists at most 20 offending addresses per budget", func() {
+			changes := map[string][]string{}
+			for i := 0; i < 25; i++ {
+				changes[fmt.Sprintf("aws_instance.a[%d]", i)] = []string{"create"}
+			}
+			writePlan(changes)
+
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+			Expect(strings.Count(err.Error(), "aws_instance.a[")).To(Equal(20))
+			Expect(err.Error()).To(ContainSubstring("and 5 more"))
+		})
+
+		It("checks the plan fetched by plan_run without planning again", func() {
+			action.Model.PlanRun = true
+			writePlan(map[string][]string{
+				"aws_instance.a": {"delete"},
+			})
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("1 to destroy exceeds the limit of 0")))
+			Expect(fakeClient.PlanCallCount()).To(Equal(0))
+		})
+
+		It("rejects targets without plan_run", func() {
+			action.Model.Targets = []string{"aws_instance.a"}
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("`targets`")))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with VerifyPlan", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			tmpDir     string
+			logs       *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "terraform-resource-action-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			logs = &bytes.Buffer{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.WorkspaceListReturns([]string{"default", "some-env", "some-env-plan"}, nil)
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					PlanRun:               true,
+					JSONPlanFileLocalPath: path.Join(tmpDir, "plan.json"),
+				},
+				Logger: logger.Logger{
+					Sink: logs,
+				},
+				VerifyPlan: true,
+			}
+			fakeClient.JSONPlanStub = func() error {
+				plan := `{"resource_changes": [{"address": "aws_instance.a", "change": {"actions": ["delete", "create"]}}]}`
+				return ioutil.WriteFile(action.Model.JSONPlanFileLocalPath, []byte(plan), 0644)
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("reads the stored plan with terraform show before applying it", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.GetPlanFromBackendArgsForCall(0)).To(Equal("some-env-plan"))
+			Expect(fakeClient.JSONPlanCallCount()).To(Equal(1))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+			Expect(logs.String()).To(ContainSubstring("Applying the stored plan: 1 to add, 0 to change, 1 to destroy"))
+		})
+
+		It("fails without applying if there is no stored plan", func() {
+			fakeClient.WorkspaceListReturns([]string{"default", "some-env"}, nil)
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("No plan found for 'some-env'")))
+			Expect(fakeClient.GetPlanFromBackendCallCount()).To(Equal(0))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+
+		It("fails without applying if terraform can't read the stored plan", func() {
+			fakeClient.JSONPlanStub = nil
+			fakeClient.JSONPlanReturns(errors.New("plan file was created by a different version"))
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("The plan for 'some-env' cannot be applied")))
+			Expect(err).To(MatchError(ContainSubstring("plan file was created by a different version")))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with deferred actions", func() {
+		var (
+			fakeClient    *terraformfakes.FakeClient
+			action        terraform.Action
+			tmpDir        string
+			currentSerial int
+			// fake backend mapping workspace name to its outputs
+			backend map[string]map[string]map[string]interface{}
+		)
+
+		writePlan := func(deferred ...string) {
+			deferredChanges := []map[string]interface{}{}
+			for _, address := range deferred {
+				deferredChanges = append(deferredChanges, map[string]interface{}{
+					"reason":          "provider_config_unknown",
+					"resource_change": map[string]interface{}{"address": address},
+				})
+			}
+			contents, err := json.Marshal(map[string]interface{}{
+				"resource_changes": []interface{}{},
+				"deferred_changes": deferredChanges,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			fakeClient.JSONPlanStub = func() error {
+				return ioutil.WriteFile(action.Model.JSONPlanFileLocalPath, contents, 0644)
+			}
+		}
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "terraform-resource-action-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			currentSerial = 5
+			backend = map[string]map[string]map[string]interface{}{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.CurrentStateVersionStub = func(string) (terraform.StateVersion, error) {
+				return terraform.StateVersion{Serial: currentSerial, Lineage: "some-lineage"}, nil
+			}
+			fakeClient.ApplyStub = func() error {
+				currentSerial++
+				return nil
+			}
+			fakeClient.WorkspaceListStub = func() ([]string, error) {
+				spaces := []string{}
+				for space := range backend {
+					spaces = append(spaces, space)
+				}
+				return spaces, nil
+			}
+			fakeClient.OutputStub = func(space string) (map[string]map[string]interface{}, error) {
+				return backend[space], nil
+			}
+			fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+				contents, err := ioutil.ReadFile(stateFilePath)
+				Expect(err).ToNot(HaveOccurred())
+				state := struct {
+					Outputs map[string]map[string]interface{} `json:"outputs"`
+				}{}
+				Expect(json.Unmarshal(contents, &state)).To(Succeed())
+				backend[space] = state.Outputs
+				return nil
+			}
+			fakeClient.WorkspaceDeleteWithForceStub = func(space string) error {
+				delete(backend, space)
+				return nil
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					JSONPlanFileLocalPath: path.Join(tmpDir, "plan.json"),
+				},
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("does not inspect the plan by default", func() {
+			result, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.PlanChanges).To(BeNil())
+			Expect(fakeClient.PlanCallCount()).To(Equal(0))
+		})
+
+		Context("when FailOnDeferred is set", func() {
+			BeforeEach(func() {
+				action.FailOnDeferred = true
+				action.Model.DeleteOnFailure = true
+			})
+
+			It("applies the saved plan and then fails listing the deferred actions", func() {
+				writePlan("aws_eks_addon.dns", "kubernetes_namespace.app")
+
+				result, err := action.Apply()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("2 deferred action(s)"))
+				Expect(err.Error()).To(ContainSubstring("kubernetes_namespace.app"))
+
+				Expect(fakeClient.SetModelArgsForCall(0).PlanRun).To(BeTrue())
+				Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+				Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+				Expect(result.PlanChanges.Deferred).To(Equal(2))
+			})
+
+			It("succeeds when nothing was deferred", func() {
+				writePlan()
+
+				result, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.PlanChanges.Deferred).To(Equal(0))
+			})
+		})
+
+		Context("when RequireConverged is set", func() {
+			BeforeEach(func() {
+				action.RequireConverged = true
+			})
+
+			It("keeps reporting the version from before the first unconverged apply", func() {
+				writePlan("kubernetes_namespace.app")
+
+				result, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Version.Serial).To(Equal("5"))
+				Expect(backend).To(HaveKey("some-env__tfr_unconverged"))
+
+				result, err = action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(currentSerial).To(Equal(7))
+				Expect(result.Version.Serial).To(Equal("5"))
+			})
+
+			It("selects the env again after writing the marker and before applying", func() {
+				selected := ""
+				fakeClient.WorkspaceSelectStub = func(space string) error {
+					selected = space
+					return nil
+				}
+				writeMarker := fakeClient.WorkspaceNewFromExistingStateFileStub
+				fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+					selected = space
+					return writeMarker(space, stateFilePath)
+				}
+				appliedIn := ""
+				fakeClient.ApplyStub = func() error {
+					appliedIn = selected
+					currentSerial++
+					return nil
+				}
+				writePlan("kubernetes_namespace.app")
+
+				_, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(backend).To(HaveKey("some-env__tfr_unconverged"))
+				Expect(appliedIn).To(Equal("some-env"))
+			})
+
+			It("reports the new version and clears the marker once converged", func() {
+				writePlan("kubernetes_namespace.app")
+				_, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+
+				writePlan()
+				result, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Version.Serial).To(Equal("7"))
+				Expect(backend).ToNot(HaveKey("some-env__tfr_unconverged"))
+			})
+
+			It("reports the new version of a new env which has never converged", func() {
+				fakeClient.CurrentStateVersionStub = func(string) (terraform.StateVersion, error) {
+					if fakeClient.ApplyCallCount() == 0 {
+						return terraform.StateVersion{Empty: true}, nil
+					}
+					return terraform.StateVersion{Serial: currentSerial, Lineage: "some-lineage"}, nil
+				}
+				writePlan("kubernetes_namespace.app")
+
+				result, err := action.Apply()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Version.Serial).To(Equal("6"))
+
+				marker := terraform.ConvergenceMarker{Client: fakeClient, EnvName: "some-env"}
+				converged, found, err := marker.Read()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found).To(BeTrue())
+				Expect(converged).To(Equal(terraform.StateVersion{}))
+			})
+		})
+	})
+
+	Describe("#Apply with StateManipulations", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.ImportStub = func(envName string) error {
+				calls = append(calls, "import")
+				return nil
+			}
+			fakeClient.StateMvStub = func(envName string, from string, to string) error {
+				calls = append(calls, fmt.Sprintf("mv %s %s %s", envName, from, to))
+				return nil
+			}
+			fakeClient.StateRmStub = func(envName string, address string) error {
+				calls = append(calls, fmt.Sprintf("rm %s %s", envName, address))
+				return nil
+			}
+			fakeClient.TaintStub = func(envName string, address string) error {
+				calls = append(calls, fmt.Sprintf("taint %s %s", envName, address))
+				return nil
+			}
+			fakeClient.ApplyStub = func() error {
+				calls = append(calls, "apply")
+				return nil
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				StateManipulations: terraform.NewStateManipulations([]models.StateChange{
+					{Mv: &models.StateMove{From: "aws_instance.old", To: "aws_instance.new"}},
+					{Rm: "aws_instance.orphan"},
+					{Taint: "aws_instance.web"},
+				}),
+			}
+		})
+
+		It("runs each manipulation in order between import and apply", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{
+				"import",
+				"mv some-env aws_instance.old aws_instance.new",
+				"rm some-env aws_instance.orphan",
+				"taint some-env aws_instance.web",
+				"apply",
+			}))
+		})
+
+		It("stops before apply if a manipulation fails", func() {
+			fakeClient.StateRmStub = func(string, string) error {
+				return errors.New("rm-failed")
+			}
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("rm-failed")))
+			Expect(calls).ToNot(ContainElement("apply"))
+			Expect(fakeClient.TaintCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with RunValidate", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.InitWithBackendStub = func() error {
+				calls = append(calls, "init")
+				return nil
+			}
+			fakeClient.ValidateStub = func() error {
+				calls = append(calls, "validate")
+				return nil
+			}
+			fakeClient.WorkspaceNewIfNotExistsStub = func(string) error {
+				calls = append(calls, "workspace")
+				return nil
+			}
+			fakeClient.ApplyStub = func() error {
+				calls = append(calls, "apply")
+				return nil
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				RunValidate: true,
+			}
+		})
+
+		It("validates after init and before selecting the workspace", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{"init", "validate", "workspace", "apply"}))
+		})
+
+		It("stops before apply if the config is invalid", func() {
+			fakeClient.ValidateReturns(errors.New("Terraform configuration is invalid"))
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("Terraform configuration is invalid")))
+			Expect(fakeClient.WorkspaceNewIfNotExistsCallCount()).To(Equal(0))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+
+		It("does not validate by default", func() {
+			action.RunValidate = false
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.ValidateCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with PutIntent", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.InitWithBackendStub = func() error {
+				calls = append(calls, "init")
+				return nil
+			}
+			fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, _ string) error {
+				calls = append(calls, space)
+				return nil
+			}
+			fakeClient.WorkspaceNewIfNotExistsStub = func(string) error {
+				calls = append(calls, "workspace")
+				return nil
+			}
+			fakeClient.ApplyStub = func() error {
+				calls = append(calls, "apply")
+				return nil
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				PutIntent: &terraform.PutIntent{
+					Client:  fakeClient,
+					EnvName: "some-env",
+					BuildID: "1234",
+				},
+			}
+		})
+
+		It("claims the intent once after the action's own init", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{"init", "some-env__tfr_put_intent", "workspace", "apply"}))
+		})
+
+		It("stops before selecting the workspace if a sibling put holds the intent", func() {
+			fakeClient.WorkspaceListReturns([]string{"default", "some-env", "some-env__tfr_put_intent"}, nil)
+			fakeClient.OutputReturns(map[string]map[string]interface{}{
+				"build_id": {"value": "1234"},
+				"host":     {"value": "container-b"},
+				"token":    {"value": "other-token"},
+			}, nil)
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("already running in this build")))
+			Expect(fakeClient.WorkspaceNewIfNotExistsCallCount()).To(Equal(0))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with force unlocking", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+			lockErr    *terraform.StateLockedError
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			lockErr = &terraform.StateLockedError{
+				Err:  errors.New("Failed to run Terraform command: exit status 1"),
+				ID:   "fake-lock-id",
+				Path: "tfstate-bucket/env:/team-a-some-env/terraform.tfstate",
+				Who:  "root@7f3c2a1b",
+			}
+
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.ForceUnlockStub = func(lockID string) error {
+				calls = append(calls, "unlock "+lockID)
+				return nil
+			}
+			fakeClient.ApplyStub = func() error {
+				calls = append(calls, "apply")
+				return nil
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					WorkspacePrefix: "team-a-",
+				},
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+		})
+
+		It("releases the force_unlock lock before applying", func() {
+			action.ForceUnlockID = "fake-lock-id"
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{"unlock fake-lock-id", "apply"}))
+		})
+
+		It("releases the lock and retries once with AutoForceUnlock if it's held on this env", func() {
+			action.AutoForceUnlock = true
+			fakeClient.ApplyReturnsOnCall(0, lockErr)
+			fakeClient.ApplyReturnsOnCall(1, nil)
+			fakeClient.ApplyStub = nil
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.ForceUnlockCallCount()).To(Equal(1))
+			Expect(fakeClient.ForceUnlockArgsForCall(0)).To(Equal("fake-lock-id"))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(2))
+		})
+
+		It("leaves a lock held on another env with AutoForceUnlock", func() {
+			action.AutoForceUnlock = true
+			lockErr.Path = "tfstate-bucket/env:/team-a-some-env-plan/terraform.tfstate"
+			fakeClient.ApplyStub = nil
+			fakeClient.ApplyReturns(lockErr)
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("Not releasing the state lock 'fake-lock-id' with `auto_force_unlock`")))
+
+			Expect(fakeClient.ForceUnlockCallCount()).To(Equal(0))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+		})
+
+		It("doesn't release locks by default", func() {
+			fakeClient.ApplyStub = nil
+			fakeClient.ApplyReturns(lockErr)
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("Failed to run Terraform command: exit status 1")))
+
+			Expect(fakeClient.ForceUnlockCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#ForceUnlock", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.InitWithBackendStub = func() error {
+				calls = append(calls, "init")
+				return nil
+			}
+			fakeClient.WorkspaceSelectStub = func(envName string) error {
+				calls = append(calls, "select "+envName)
+				return nil
+			}
+			fakeClient.ForceUnlockStub = func(lockID string) error {
+				calls = append(calls, "unlock "+lockID)
+				return nil
+			}
+			fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Serial: 7, Lineage: "some-lineage"}, nil)
+			fakeClient.OutputReturns(map[string]map[string]interface{}{"vpc_id": {"value": "vpc-123"}}, nil)
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+		})
+
+		It("releases the lock in the env's workspace and returns its current version", func() {
+			result, err := action.ForceUnlock("fake-lock-id")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{"init", "select some-env", "unlock fake-lock-id"}))
+			Expect(result.Version).To(Equal(models.Version{EnvName: "some-env", Serial: "7", Lineage: "some-lineage"}))
+			Expect(result.RawOutput()).To(Equal(map[string]interface{}{"vpc_id": "vpc-123"}))
+		})
+
+		It("doesn't unlock if the workspace can't be selected", func() {
+			fakeClient.WorkspaceSelectStub = nil
+			fakeClient.WorkspaceSelectReturns(errors.New("Workspace \"some-env\" doesn't exist."))
+
+			_, err := action.ForceUnlock("fake-lock-id")
+			Expect(err).To(MatchError(ContainSubstring("Force Unlock Error")))
+
+			Expect(fakeClient.ForceUnlockCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with LockRetry", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			logSink    *bytes.Buffer
+			lockErr    *terraform.StateLockedError
+		)
+
+		BeforeEach(func() {
+			lockErr = &terraform.StateLockedError{
+				Err:  errors.New("Failed to run Terraform command: exit status 1"),
+				ID:   "fake-lock-id",
+				Path: "tfstate-bucket/env:/some-env/terraform.tfstate",
+				Who:  "root@7f3c2a1b",
+			}
+
+			fakeClient = &terraformfakes.FakeClient{}
+			logSink = &bytes.Buffer{}
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					LockRetry: &models.LockRetry{Attempts: 3, Interval: "1ms"},
+				},
+				Logger: logger.Logger{
+					Sink: logSink,
+				},
+			}
+		})
+
+		It("retries apply until the lock is released", func() {
+			fakeClient.ApplyReturnsOnCall(0, lockErr)
+			fakeClient.ApplyReturnsOnCall(1, lockErr)
+			fakeClient.ApplyReturnsOnCall(2, nil)
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.ApplyCallCount()).To(Equal(3))
+			Expect(logSink.String()).To(ContainSubstring("retrying in 1ms (attempt 1 of 3), Lock Info: ID: fake-lock-id"))
+			Expect(logSink.String()).To(ContainSubstring("(attempt 2 of 3)"))
+		})
+
+		It("retries imports until the lock is released", func() {
+			fakeClient.ImportReturnsOnCall(0, lockErr)
+			fakeClient.ImportReturnsOnCall(1, nil)
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.ImportCallCount()).To(Equal(2))
+		})
+
+		It("returns the error with the lock info once the attempts are exhausted", func() {
+			fakeClient.DestroyReturns(lockErr)
+
+			_, err := action.Destroy()
+			Expect(err).To(MatchError(ContainSubstring("Failed to run Terraform command: exit status 1")))
+			Expect(err).To(MatchError(ContainSubstring("The state lock was still held after 3 attempt(s) every 1ms, Lock Info: ID: fake-lock-id, Path: tfstate-bucket/env:/some-env/terraform.tfstate")))
+
+			Expect(fakeClient.DestroyCallCount()).To(Equal(4))
+		})
+
+		It("does not retry other errors", func() {
+			fakeClient.ApplyReturns(errors.New("Error: Invalid reference"))
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("Invalid reference")))
+
+			Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+		})
+
+		It("does not retry without LockRetry", func() {
+			action.Model.LockRetry = nil
+			fakeClient.ApplyReturns(lockErr)
+
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+
+			Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("#Apply with SSHPrivateKey", func() {
+		var (
+			fakeClient    *terraformfakes.FakeClient
+			action        terraform.Action
+			logSink       *bytes.Buffer
+			gitSSHCommand string
+			keyPath       string
+			keyContents   string
+		)
+
+		BeforeEach(func() {
+			Expect(os.Unsetenv("GIT_SSH_COMMAND")).To(Succeed())
+			gitSSHCommand, keyPath, keyContents = "", "", ""
+
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.InitWithBackendStub = func() error {
+				gitSSHCommand = os.Getenv("GIT_SSH_COMMAND")
+				fields := strings.Fields(gitSSHCommand)
+				Expect(len(fields)).To(BeNumerically(">", 2))
+				keyPath = strings.Trim(fields[2], "'")
+				contents, err := ioutil.ReadFile(keyPath)
+				Expect(err).ToNot(HaveOccurred())
+				keyContents = string(contents)
+				return nil
+			}
+
+			logSink = &bytes.Buffer{}
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					SSHPrivateKey: "fake-private-key",
+				},
+				Logger: logger.Logger{
+					Sink: logSink,
+				},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("GIT_SSH_COMMAND")).To(Succeed())
+		})
+
+		It("sets GIT_SSH_COMMAND to use the key during init", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(gitSSHCommand).To(Equal(fmt.Sprintf("ssh -i '%s' -o IdentitiesOnly=yes", keyPath)))
+			Expect(keyContents).To(Equal("fake-private-key\n"))
+			Expect(keyPath).ToNot(BeAnExistingFile())
+			Expect(os.LookupEnv("GIT_SSH_COMMAND")).To(BeEmpty())
+			Expect(logSink.String()).ToNot(ContainSubstring("fake-private-key"))
+		})
+
+		It("logs in as PrivateKeyUser if set", func() {
+			action.Model.PrivateKeyUser = "svc-terraform"
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(gitSSHCommand).To(HaveSuffix(" -l svc-terraform"))
+		})
+
+		It("removes the key and restores GIT_SSH_COMMAND even if init fails", func() {
+			Expect(os.Setenv("GIT_SSH_COMMAND", "ssh -v")).To(Succeed())
+			stub := fakeClient.InitWithBackendStub
+			fakeClient.InitWithBackendStub = func() error {
+				Expect(stub()).To(Succeed())
+				return errors.New("Failed to download module")
+			}
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("Failed to download module")))
+
+			Expect(keyPath).ToNot(BeEmpty())
+			Expect(keyPath).ToNot(BeAnExistingFile())
+			Expect(os.Getenv("GIT_SSH_COMMAND")).To(Equal("ssh -v"))
+		})
+
+		It("leaves GIT_SSH_COMMAND alone without a key", func() {
+			action.Model.SSHPrivateKey = ""
+			fakeClient.InitWithBackendStub = func() error {
+				gitSSHCommand = os.Getenv("GIT_SSH_COMMAND")
+				return nil
+			}
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gitSSHCommand).To(BeEmpty())
+		})
+	})
+
+	Describe("#Plan", func() {
+		It("reports whether the plan has changes", func() {
+			fakeClient := &terraformfakes.FakeClient{}
+			fakeClient.PlanReturns("fake-checksum", true, nil)
+			action := terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					JSONPlanFileLocalPath: path.Join(os.TempDir(), "missing-plan.json"),
+				},
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+
+			result, err := action.Plan()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.Version.PlanChecksum).To(Equal("fake-checksum"))
+			Expect(result.PlanHasChanges).ToNot(BeNil())
+			Expect(*result.PlanHasChanges).To(BeTrue())
+		})
+	})
+
+	Describe("#StateMv", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			calls      []string
+		)
+
+		BeforeEach(func() {
+			calls = []string{}
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.WorkspaceSelectStub = func(envName string) error {
+				calls = append(calls, fmt.Sprintf("select %s", envName))
+				return nil
+			}
+			fakeClient.StateMvStub = func(envName string, from string, to string) error {
+				calls = append(calls, fmt.Sprintf("mv %s %s %s", envName, from, to))
+				return nil
+			}
+			fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Serial: 8, Lineage: "some-lineage"}, nil)
+			fakeClient.OutputReturns(map[string]map[string]interface{}{
+				"web_ip": {"value": "10.0.0.1"},
+			}, nil)
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+		})
+
+		It("moves each address in order and reports the resulting state", func() {
+			result, err := action.StateMv([]models.StateMove{
+				{From: "aws_instance.old", To: "aws_instance.new"},
+				{From: "module.a", To: "module.b"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(calls).To(Equal([]string{
+				"select some-env",
+				"mv some-env aws_instance.old aws_instance.new",
+				"mv some-env module.a module.b",
+			}))
+			Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+			Expect(fakeClient.PlanCallCount()).To(Equal(0))
+			Expect(result.Version).To(Equal(models.Version{EnvName: "some-env", Serial: "8", Lineage: "some-lineage"}))
+			Expect(result.RawOutput()).To(Equal(map[string]interface{}{"web_ip": "10.0.0.1"}))
+		})
+
+		It("stops at the first failed move", func() {
+			fakeClient.StateMvReturnsOnCall(0, errors.New("no matching resource"))
+
+			_, err := action.StateMv([]models.StateMove{
+				{From: "aws_instance.missing", To: "aws_instance.new"},
+				{From: "module.a", To: "module.b"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("State Mv Error: no matching resource")))
+			Expect(fakeClient.StateMvCallCount()).To(Equal(1))
+		})
+
+		It("fails if the workspace does not exist", func() {
+			fakeClient.WorkspaceSelectReturns(errors.New("workspace does not exist"))
+
+			_, err := action.StateMv([]models.StateMove{{From: "aws_instance.old", To: "aws_instance.new"}})
+			Expect(err).To(MatchError(ContainSubstring("workspace does not exist")))
+			Expect(fakeClient.StateMvCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Destroy", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+		)
+
+		workspaceNotFound := fmt.Errorf("Error running `workspace select`: exit status 1, Output: Workspace \"some-env\" doesn't exist.: %w", terraform.ErrWorkspaceNotFound)
+
+		BeforeEach(func() {
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.WorkspaceListReturns([]string{"default", "some-env-plan"}, nil)
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+			}
+		})
+
+		It("destroys and deletes the workspace", func() {
+			result, err := action.Destroy()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.AlreadyDestroyed).To(BeFalse())
+			Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+			Expect(fakeClient.WorkspaceDeleteArgsForCall(0)).To(Equal("some-env"))
+		})
+
+		It("removes the convergence marker with RequireConverged", func() {
+			fakeClient.WorkspaceListReturns([]string{"default", "some-env", "some-env__tfr_unconverged"}, nil)
+			action.RequireConverged = true
+
+			_, err := action.Destroy()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.WorkspaceDeleteWithForceCallCount()).To(Equal(1))
+			Expect(fakeClient.WorkspaceDeleteWithForceArgsForCall(0)).To(Equal("some-env__tfr_unconverged"))
+		})
+
+		It("succeeds without destroying if the workspace no longer exists", func() {
+			fakeClient.WorkspaceSelectReturns(workspaceNotFound)
+
+			result, err := action.Destroy()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.AlreadyDestroyed).To(BeTrue())
+			Expect(result.Version.EnvName).To(Equal("some-env"))
+			Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+			Expect(fakeClient.WorkspaceDeleteCallCount()).To(Equal(0))
+			Expect(fakeClient.WorkspaceDeleteWithForceArgsForCall(0)).To(Equal("some-env-plan"))
+		})
+
+		It("succeeds if init fails because the selected workspace no longer exists", func() {
+			fakeClient.InitWithBackendReturns(workspaceNotFound)
+
+			result, err := action.Destroy()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.AlreadyDestroyed).To(BeTrue())
+			Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+		})
+
+		It("succeeds if the workspace was deleted after the destroy", func() {
+			fakeClient.WorkspaceDeleteReturns(workspaceNotFound)
+
+			result, err := action.Destroy()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.AlreadyDestroyed).To(BeFalse())
+			Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+		})
+
+		It("returns other workspace errors", func() {
+			fakeClient.WorkspaceSelectReturns(errors.New("backend-unavailable"))
+
+			_, err := action.Destroy()
+			Expect(err).To(MatchError("backend-unavailable"))
+			Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("#Apply with StateTags", func() {
+		var (
+			fakeClient  *terraformfakes.FakeClient
+			action      terraform.Action
+			pushedState map[string]interface{}
+		)
+
+		BeforeEach(func() {
+			pushedState = nil
+			fakeClient = &terraformfakes.FakeClient{}
+			fakeClient.StatePullReturns([]byte(`{
+				"version": 4,
+				"serial": 7,
+				"lineage": "some-lineage",
+				"outputs": {"vpc_id": {"value": "vpc-123", "type": "string"}},
+				"resources": [{"instances": [{"attributes": {"account_id": 123456789012345678}}]}]
+			}`), nil)
+			fakeClient.StatePushStub = func(envName string, stateFilePath string) error {
+				contents, err := ioutil.ReadFile(stateFilePath)
+				Expect(err).ToNot(HaveOccurred())
+				return json.Unmarshal(contents, &pushedState)
+			}
+
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Logger: logger.Logger{
+					Sink: &bytes.Buffer{},
+				},
+				StateTags: &terraform.StateTags{
+					PipelineName: "some-pipeline",
+					JobName:      "some-job",
+					BuildID:      "1234",
+					AppliedAt:    time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC),
+				},
+			}
+		})
+
+		It("pushes the state with the tags added as outputs and the serial bumped", func() {
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.StatePushCallCount()).To(Equal(1))
+			envName, _ := fakeClient.StatePushArgsForCall(0)
+			Expect(envName).To(Equal("some-env"))
+
+			Expect(pushedState["serial"]).To(BeNumerically("==", 8))
+			Expect(pushedState["lineage"]).To(Equal("some-lineage"))
+			outputs := pushedState["outputs"].(map[string]interface{})
+			Expect(outputs["vpc_id"]).To(HaveKeyWithValue("value", "vpc-123"))
+			Expect(outputs["concourse_pipeline_name"]).To(HaveKeyWithValue("value", "some-pipeline"))
+			Expect(outputs["concourse_job_name"]).To(HaveKeyWithValue("value", "some-job"))
+			Expect(outputs["concourse_build_id"]).To(HaveKeyWithValue("value", "1234"))
+			Expect(outputs["concourse_applied_at"]).To(HaveKeyWithValue("value", "2020-01-02T03:04:05Z"))
+		})
+
+		It("pushes after apply and before reading the version", func() {
+			fakeClient.ApplyStub = func() error {
+				Expect(fakeClient.StatePushCallCount()).To(Equal(0))
+				return nil
+			}
+			fakeClient.CurrentStateVersionStub = func(string) (terraform.StateVersion, error) {
+				Expect(fakeClient.StatePushCallCount()).To(Equal(1))
+				return terraform.StateVersion{Serial: 8}, nil
+			}
+
+			result, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Version.Serial).To(Equal("8"))
+		})
+
+		It("keeps large numbers in the state exact", func() {
+			fakeClient.StatePushStub = func(envName string, stateFilePath string) error {
+				contents, err := ioutil.ReadFile(stateFilePath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("123456789012345678"))
+				return nil
+			}
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not tag the state if apply fails", func() {
+			fakeClient.ApplyReturns(errors.New("apply-failed"))
+
+			_, err := action.Apply()
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.StatePushCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("OverrideFiles", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			logs       *bytes.Buffer
+			tmpDir     string
+			sourceDir  string
+			override   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "terraform-resource-action-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			sourceDir = path.Join(tmpDir, "source")
+			Expect(os.Mkdir(sourceDir, 0755)).To(Succeed())
+			override = path.Join(tmpDir, "example_override.tf")
+			Expect(ioutil.WriteFile(override, []byte("# override"), 0644)).To(Succeed())
+
+			fakeClient = &terraformfakes.FakeClient{}
+			logs = &bytes.Buffer{}
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					Source:        sourceDir,
+					OverrideFiles: []string{override},
+				},
+				Logger: logger.Logger{
+					Sink: logs,
+				},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("links each override file into the source before init", func() {
+			fakeClient.InitWithBackendStub = func() error {
+				contents, err := ioutil.ReadFile(path.Join(sourceDir, "example_override.tf"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(Equal("# override"))
+				return nil
+			}
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.InitWithBackendCallCount()).To(Equal(1))
+			Expect(logs.String()).ToNot(ContainSubstring("Overwriting"))
+		})
+
+		It("overwrites a file with the same name and logs a warning", func() {
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "example_override.tf"), []byte("# original"), 0644)).To(Succeed())
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(path.Join(sourceDir, "example_override.tf"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("# override"))
+			Expect(logs.String()).To(ContainSubstring("Overwriting 'example_override.tf'"))
+		})
+
+		It("returns an error if an override file is missing", func() {
+			action.Model.OverrideFiles = []string{path.Join(tmpDir, "missing_override.tf")}
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("does not exist")))
+			Expect(fakeClient.InitWithBackendCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("ModuleOverrideFiles", func() {
+		var (
+			fakeClient *terraformfakes.FakeClient
+			action     terraform.Action
+			logs       *bytes.Buffer
+			tmpDir     string
+			sourceDir  string
+			override   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "terraform-resource-action-test")
+			Expect(err).ToNot(HaveOccurred())
+
+			sourceDir = path.Join(tmpDir, "source")
+			Expect(os.Mkdir(sourceDir, 0755)).To(Succeed())
+			override = path.Join(tmpDir, "net_override.tf")
+			Expect(ioutil.WriteFile(override, []byte("# override"), 0644)).To(Succeed())
+
+			fakeClient = &terraformfakes.FakeClient{}
+			logs = &bytes.Buffer{}
+			action = terraform.Action{
+				Client:  fakeClient,
+				EnvName: "some-env",
+				Model: models.Terraform{
+					Source: sourceDir,
+					ModuleOverrideFiles: []map[string]string{
+						{"src": override, "dst": "modules/network"},
+					},
+				},
+				Logger: logger.Logger{
+					Sink: logs,
+				},
+			}
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(tmpDir)
+		})
+
+		It("creates missing nested directories and links the file before init", func() {
+			fakeClient.InitWithBackendStub = func() error {
+				contents, err := ioutil.ReadFile(path.Join(sourceDir, "modules", "network", "net_override.tf"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(contents)).To(Equal("# override"))
+				return nil
+			}
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.InitWithBackendCallCount()).To(Equal(1))
+			Expect(logs.String()).ToNot(ContainSubstring("Overwriting"))
+		})
+
+		It("overwrites a file with the same name and logs a warning", func() {
+			moduleDir := path.Join(sourceDir, "modules", "network")
+			Expect(os.MkdirAll(moduleDir, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(moduleDir, "net_override.tf"), []byte("# original"), 0644)).To(Succeed())
+
+			_, err := action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(path.Join(moduleDir, "net_override.tf"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("# override"))
+			Expect(logs.String()).To(ContainSubstring("Overwriting 'modules/network/net_override.tf'"))
+		})
+
+		It("does not warn when the file was already linked by an earlier setup", func() {
+			_, err := action.Plan()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = action.Apply()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(logs.String()).ToNot(ContainSubstring("Overwriting"))
+		})
+
+		It("returns an error if dst is a file", func() {
+			Expect(os.MkdirAll(path.Join(sourceDir, "modules"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(sourceDir, "modules", "network"), []byte(""), 0644)).To(Succeed())
+
+			_, err := action.Apply()
+			Expect(err).To(MatchError(ContainSubstring("is a file, must pass directory instead")))
+			Expect(fakeClient.InitWithBackendCallCount()).To(Equal(0))
+		})
+	})
+})
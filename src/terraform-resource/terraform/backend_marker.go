@@ -0,0 +1,134 @@
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/models"
+)
+
+const backendSuffix = markerNamespace + "backend"
+
+// backendCredentialKeys are left out of the config hash so rotating
+// credentials isn't mistaken for a change of backend
+var backendCredentialKeys = []string{
+	"access_key",
+	"secret_key",
+	"token",
+	"sas_token",
+	"client_secret",
+	"credentials",
+	"access_token",
+	"password",
+}
+
+// BackendFingerprint identifies the backend an env was applied with without
+// storing the backend config itself, which may hold secrets.
+type BackendFingerprint struct {
+	Type       string
+	ConfigHash string
+	Lineage    string
+}
+
+// NewBackendFingerprint hashes the backend config of model. Lineage is left
+// empty as it is only known once the state has been pulled.
+func NewBackendFingerprint(model models.Terraform) (BackendFingerprint, error) {
+	config := map[string]interface{}{}
+	for key, value := range model.BackendConfig {
+		config[key] = value
+	}
+	for _, key := range backendCredentialKeys {
+		delete(config, key)
+	}
+
+	// encoding/json sorts map keys so equal configs give equal hashes
+	contents, err := json.Marshal(config)
+	if err != nil {
+		return BackendFingerprint{}, err
+	}
+	hash := sha256.Sum256(contents)
+	return BackendFingerprint{
+		Type:       model.BackendType,
+		ConfigHash: hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// SameBackend ignores Lineage, which is checked separately
+func (f BackendFingerprint) SameBackend(other BackendFingerprint) bool {
+	return f.Type == other.Type && f.ConfigHash == other.ConfigHash
+}
+
+// BackendMarker records the backend an env was last applied with. The
+// `.terraform` directory written by `terraform init` holds the same
+// information but is missing from the fresh checkout each `put` starts with,
+// so the marker is stored as the outputs of a separate workspace, similar to
+// InventoryMarker.
+type BackendMarker struct {
+	Client  Client
+	EnvName string
+}
+
+// Read returns the recorded fingerprint. The bool is false if the env was
+// never applied by a version of the resource which records it.
+func (m BackendMarker) Read() (BackendFingerprint, bool, error) {
+	values, found, err := readMarkerWorkspace(m.Client, m.workspace())
+	if err != nil || !found {
+		return BackendFingerprint{}, false, err
+	}
+	return BackendFingerprint{
+		Type:       values["backend_type"],
+		ConfigHash: values["backend_config_hash"],
+		Lineage:    values["lineage"],
+	}, true, nil
+}
+
+// Write replaces any fingerprint recorded by an earlier apply.
+func (m BackendMarker) Write(fingerprint BackendFingerprint) error {
+	if err := m.Clear(); err != nil {
+		return err
+	}
+	return writeMarkerWorkspace(m.Client, m.workspace(), map[string]string{
+		"backend_type":        fingerprint.Type,
+		"backend_config_hash": fingerprint.ConfigHash,
+		"lineage":             fingerprint.Lineage,
+	})
+}
+
+// Clear removes the fingerprint, e.g. once the env is destroyed.
+func (m BackendMarker) Clear() error {
+	if _, found, err := readMarkerWorkspace(m.Client, m.workspace()); err != nil || !found {
+		return err
+	}
+	return m.Client.WorkspaceDeleteWithForce(m.workspace())
+}
+
+func (m BackendMarker) workspace() string {
+	return fmt.Sprintf("%s%s", m.EnvName, backendSuffix)
+}
+
+// backendRecordedByAnyEnv reports whether any env in the backend has a marker for
+// the same backend as fingerprint. A new env has no marker of its own, so
+// this is the only way to tell a backend the resource has applied to before
+// from one whose prefix or bucket was changed and which is therefore empty.
+func backendRecordedByAnyEnv(client Client, fingerprint BackendFingerprint) (bool, error) {
+	spaces, err := client.WorkspaceList()
+	if err != nil {
+		return false, err
+	}
+	for _, space := range spaces {
+		if !strings.HasSuffix(space, backendSuffix) {
+			continue
+		}
+		recorded, found, err := BackendMarker{Client: client, EnvName: strings.TrimSuffix(space, backendSuffix)}.Read()
+		if err != nil {
+			return false, err
+		}
+		if found && recorded.SameBackend(fingerprint) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
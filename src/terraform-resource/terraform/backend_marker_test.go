@@ -0,0 +1,199 @@
+package terraform_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BackendMarker", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+		// fake backend mapping workspace name to its outputs
+		backend   map[string]map[string]map[string]interface{}
+		sourceDir string
+		logWriter *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		backend = map[string]map[string]map[string]interface{}{}
+		fakeClient = &terraformfakes.FakeClient{}
+		fakeClient.WorkspaceListStub = func() ([]string, error) {
+			spaces := []string{}
+			for space := range backend {
+				spaces = append(spaces, space)
+			}
+			return spaces, nil
+		}
+		fakeClient.OutputStub = func(space string) (map[string]map[string]interface{}, error) {
+			return backend[space], nil
+		}
+		fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+			if _, ok := backend[space]; ok {
+				return fmt.Errorf("Workspace %q already exists", space)
+			}
+			contents, err := ioutil.ReadFile(stateFilePath)
+			if err != nil {
+				return err
+			}
+			state := struct {
+				Outputs map[string]map[string]interface{} `json:"outputs"`
+			}{}
+			if err := json.Unmarshal(contents, &state); err != nil {
+				return err
+			}
+			backend[space] = state.Outputs
+			return nil
+		}
+		fakeClient.WorkspaceDeleteWithForceStub = func(space string) error {
+			delete(backend, space)
+			return nil
+		}
+		fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Serial: 1, Lineage: "some-lineage"}, nil)
+
+		// each put starts from a fresh checkout without a `.terraform` directory
+		var err error
+		sourceDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-backend-marker-test")
+		Expect(err).ToNot(HaveOccurred())
+		logWriter = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(sourceDir)
+	})
+
+	newAction := func(backendConfig map[string]interface{}) terraform.Action {
+		return terraform.Action{
+			Client:  fakeClient,
+			EnvName: "some-env",
+			Model: models.Terraform{
+				Source:        sourceDir,
+				BackendType:   "s3",
+				BackendConfig: backendConfig,
+			},
+			Logger:        logger.Logger{Sink: logWriter},
+			VerifyBackend: true,
+		}
+	}
+
+	It("records the backend and lineage on the first apply", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "key": "some-key"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		recorded, found, err := terraform.BackendMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(recorded.Type).To(Equal("s3"))
+		Expect(recorded.ConfigHash).ToNot(BeEmpty())
+		Expect(recorded.Lineage).To(Equal("some-lineage"))
+		Expect(terraform.IsMarkerWorkspace("some-env__tfr_backend")).To(BeTrue())
+	})
+
+	It("refuses to apply after the backend config changed without a .terraform directory", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "key": "some-key"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(path.Join(sourceDir, ".terraform")).ToNot(BeADirectory())
+
+		action = newAction(map[string]interface{}{"bucket": "some-bucket", "key": "other-key"})
+		_, err = action.Apply()
+		Expect(err).To(MatchError(ContainSubstring("approve_backend_change")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+	})
+
+	It("ignores a change of credentials", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "secret_key": "some-secret"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		action = newAction(map[string]interface{}{"bucket": "some-bucket", "secret_key": "rotated-secret"})
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("applies an approved change if the lineage is unchanged", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "key": "some-key"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		previous, _, err := terraform.BackendMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+
+		action = newAction(map[string]interface{}{"bucket": "some-bucket", "key": "other-key"})
+		action.Model.ApproveBackendChange = true
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logWriter.String()).To(ContainSubstring("Backend Changed"))
+
+		recorded, _, err := terraform.BackendMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorded.ConfigHash).ToNot(Equal(previous.ConfigHash))
+	})
+
+	It("refuses an approved change which points at a different statefile", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "key": "some-key"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Empty: true}, nil)
+		action = newAction(map[string]interface{}{"bucket": "some-bucket", "key": "other-key"})
+		action.Model.ApproveBackendChange = true
+		_, err = action.Apply()
+		Expect(err).To(MatchError(ContainSubstring("Expected state lineage 'some-lineage'")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+	})
+
+	It("refuses to apply to an empty env after the key prefix was renamed", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket", "workspace_key_prefix": "team-a"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		// the renamed prefix points at an empty location, the marker stays behind
+		backend = map[string]map[string]map[string]interface{}{}
+		fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Empty: true}, nil)
+		action = newAction(map[string]interface{}{"bucket": "some-bucket", "workspace_key_prefix": "team-b"})
+		_, err = action.Apply()
+		Expect(err).To(MatchError(ContainSubstring("approve_backend_change")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(1))
+
+		action.Model.ApproveBackendChange = true
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logWriter.String()).To(ContainSubstring("Backend Unverified"))
+	})
+
+	It("applies a new env to a backend another env recorded", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket"})
+		action.EnvName = "other-env"
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		fakeClient.CurrentStateVersionReturns(terraform.StateVersion{Empty: true}, nil)
+		action = newAction(map[string]interface{}{"bucket": "some-bucket"})
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(backend).To(HaveKey("some-env__tfr_backend"))
+	})
+
+	It("removes the marker when the env is destroyed", func() {
+		action := newAction(map[string]interface{}{"bucket": "some-bucket"})
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = action.Destroy()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(backend).ToNot(HaveKey("some-env__tfr_backend"))
+	})
+})
@@ -0,0 +1,124 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidOutputs returns the env's outputs like Client.Output, but fails if any
+// of them contains invalid UTF-8, which json.Unmarshal silently replaces with
+// U+FFFD. Only the get checks for this, so a put isn't failed by a broken
+// output it doesn't need.
+func ValidOutputs(client Client, envName string) (map[string]map[string]interface{}, error) {
+	outputs, err := client.Output(envName)
+	if err != nil {
+		return nil, err
+	}
+	// the state is only pulled when an output might have been replaced
+	if !containsReplacementChar(outputs) {
+		return outputs, nil
+	}
+
+	rawState, err := client.StatePull(envName)
+	if err != nil {
+		return nil, err
+	}
+	rawOutputs, err := StateOutputs(rawState)
+	if err != nil {
+		return nil, err
+	}
+	stateOutputs := map[string]json.RawMessage{}
+	if err = json.Unmarshal(rawOutputs, &stateOutputs); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal JSON output.\nError: %s", err)
+	}
+	invalid := []string{}
+	for name := range outputs {
+		if !utf8.Valid(stateOutputs[name]) {
+			invalid = append(invalid, name)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return nil, fmt.Errorf("Failed to unmarshal JSON output '%s'.\nError: output contains invalid UTF-8", strings.Join(invalid, "', '"))
+	}
+	return outputs, nil
+}
+
+func containsReplacementChar(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.ContainsRune(v, utf8.RuneError)
+	case []interface{}:
+		for _, item := range v {
+			if containsReplacementChar(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if containsReplacementChar(item) {
+				return true
+			}
+		}
+	case map[string]map[string]interface{}:
+		for _, output := range v {
+			if containsReplacementChar(output["value"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OutputsSkippingBroken returns the env's outputs like Client.Output. If they
+// can't be parsed together, e.g. a provider bug left invalid UTF-8 in one of
+// them, each output named in the state is retrieved on its own and the names
+// of those which still fail are returned instead of an error.
+func OutputsSkippingBroken(client Client, envName string) (map[string]map[string]interface{}, []string, error) {
+	outputs, outputErr := ValidOutputs(client, envName)
+	if outputErr == nil {
+		return outputs, nil, nil
+	}
+
+	rawState, err := client.StatePull(envName)
+	if err != nil {
+		return nil, nil, outputErr
+	}
+	rawOutputs, err := StateOutputs(rawState)
+	if err != nil {
+		return nil, nil, outputErr
+	}
+	stateOutputs := map[string]struct {
+		Sensitive bool        `json:"sensitive"`
+		Type      interface{} `json:"type"`
+	}{}
+	if err = json.Unmarshal(rawOutputs, &stateOutputs); err != nil {
+		return nil, nil, outputErr
+	}
+
+	names := []string{}
+	for name := range stateOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	outputs = map[string]map[string]interface{}{}
+	broken := []string{}
+	for _, name := range names {
+		value, err := client.OutputValue(envName, name)
+		if err != nil {
+			broken = append(broken, name)
+			continue
+		}
+		outputs[name] = map[string]interface{}{
+			"value":     value,
+			"sensitive": stateOutputs[name].Sensitive,
+			"type":      stateOutputs[name].Type,
+		}
+	}
+
+	return outputs, broken, nil
+}
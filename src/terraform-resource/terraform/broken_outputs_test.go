@@ -0,0 +1,128 @@
+package terraform_test
+
+import (
+	"errors"
+
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OutputsSkippingBroken", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+	)
+
+	BeforeEach(func() {
+		fakeClient = &terraformfakes.FakeClient{}
+		fakeClient.OutputReturns(nil, errors.New("Failed to unmarshal JSON output.\nError: output contains invalid UTF-8"))
+		fakeClient.StatePullReturns([]byte("{\"version\": 4, \"outputs\": {"+
+			"\"bucket\": {\"value\": \"some-bucket\", \"type\": \"string\"},"+
+			"\"password\": {\"value\": \"some-password\", \"type\": \"string\", \"sensitive\": true},"+
+			"\"broken\": {\"value\": \"caf\xe9\", \"type\": \"string\"}"+
+			"}}"), nil)
+		fakeClient.OutputValueStub = func(envName string, name string) (interface{}, error) {
+			switch name {
+			case "bucket":
+				return "some-bucket", nil
+			case "password":
+				return "some-password", nil
+			}
+			return nil, errors.New("Failed to unmarshal JSON output 'broken'.\nError: output contains invalid UTF-8")
+		}
+	})
+
+	It("returns the outputs if they can all be parsed", func() {
+		fakeClient.OutputReturns(map[string]map[string]interface{}{
+			"bucket": {"value": "some-bucket"},
+		}, nil)
+
+		outputs, broken, err := terraform.OutputsSkippingBroken(fakeClient, "some-env")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(HaveKey("bucket"))
+		Expect(broken).To(BeEmpty())
+		Expect(fakeClient.OutputValueCallCount()).To(Equal(0))
+	})
+
+	It("retrieves each output in the state on its own and skips the broken ones", func() {
+		outputs, broken, err := terraform.OutputsSkippingBroken(fakeClient, "some-env")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(broken).To(Equal([]string{"broken"}))
+		Expect(outputs).To(Equal(map[string]map[string]interface{}{
+			"bucket":   {"value": "some-bucket", "sensitive": false, "type": "string"},
+			"password": {"value": "some-password", "sensitive": true, "type": "string"},
+		}))
+		Expect(fakeClient.StatePullArgsForCall(0)).To(Equal("some-env"))
+	})
+
+	It("skips an output which Output silently replaced invalid UTF-8 in", func() {
+		fakeClient.OutputReturns(map[string]map[string]interface{}{
+			"bucket": {"value": "some-bucket", "sensitive": false, "type": "string"},
+			"broken": {"value": "caf\uFFFD", "sensitive": false, "type": "string"},
+		}, nil)
+
+		outputs, broken, err := terraform.OutputsSkippingBroken(fakeClient, "some-env")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(broken).To(Equal([]string{"broken"}))
+		Expect(outputs).ToNot(HaveKey("broken"))
+		Expect(outputs).To(HaveKey("bucket"))
+	})
+
+	It("returns the original error if the state can't be read", func() {
+		fakeClient.StatePullReturns(nil, errors.New("state-pull-failed"))
+
+		_, _, err := terraform.OutputsSkippingBroken(fakeClient, "some-env")
+		Expect(err).To(MatchError(ContainSubstring("output contains invalid UTF-8")))
+	})
+})
+
+var _ = Describe("ValidOutputs", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+	)
+
+	BeforeEach(func() {
+		fakeClient = &terraformfakes.FakeClient{}
+	})
+
+	It("returns the outputs without pulling the state if none could have been replaced", func() {
+		fakeClient.OutputReturns(map[string]map[string]interface{}{
+			"list": {"value": []interface{}{"item-1", map[string]interface{}{"key": "value"}}},
+		}, nil)
+
+		outputs, err := terraform.ValidOutputs(fakeClient, "some-env")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(HaveKey("list"))
+		Expect(fakeClient.StatePullCallCount()).To(Equal(0))
+	})
+
+	It("fails if an output contains invalid UTF-8 in the state", func() {
+		fakeClient.OutputReturns(map[string]map[string]interface{}{
+			"name": {"value": []interface{}{"caf\uFFFD"}},
+		}, nil)
+		fakeClient.StatePullReturns([]byte("{\"version\": 4, \"outputs\": {"+
+			"\"name\": {\"value\": [\"caf\xe9\"], \"type\": [\"list\", \"string\"]}"+
+			"}}"), nil)
+
+		_, err := terraform.ValidOutputs(fakeClient, "some-env")
+		Expect(err).To(MatchError(ContainSubstring("Failed to unmarshal JSON output 'name'")))
+		Expect(err).To(MatchError(ContainSubstring("output contains invalid UTF-8")))
+	})
+
+	It("accepts an output which really contains U+FFFD", func() {
+		fakeClient.OutputReturns(map[string]map[string]interface{}{
+			"vpc_id": {"value": "caf\uFFFD"},
+		}, nil)
+		fakeClient.StatePullReturns([]byte(`{"version": 4, "outputs": {`+
+			`"vpc_id": {"value": "caf\ufffd", "type": "string"}`+
+			`}}`), nil)
+
+		outputs, err := terraform.ValidOutputs(fakeClient, "some-env")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(HaveKey("vpc_id"))
+	})
+})
@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,23 +16,69 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/retry"
 )
 
 const defaultWorkspace = "default"
 
+// workspace subcommands report `Workspace "x" doesn't exist.` while init
+// reports `Currently selected workspace "x" does not exist`
+var workspaceNotFoundRegex = regexp.MustCompile(`(?i)workspace "[^"]*" (doesn't|does not) exist`)
+
+// Terraform Cloud/Enterprise only accepts these workspace names, which the
+// `remote` backend otherwise reports as an API error on `workspace new`
+var remoteWorkspaceNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+const maxRemoteWorkspaceNameLength = 90
+
+// interruptGracePeriod is how long terraform may take to stop after its
+// context is cancelled before it is killed
+const interruptGracePeriod = 2 * time.Minute
+
+// ErrWorkspaceNotFound matches, via errors.Is, the errors of commands which
+// failed only because the workspace is gone, e.g. deleted by an earlier destroy
+var ErrWorkspaceNotFound = errors.New("workspace does not exist")
+
+// workspaceNotFoundError keeps terraform's own message for the build log
+type workspaceNotFoundError struct {
+	error
+}
+
+func (e workspaceNotFoundError) Is(target error) bool {
+	return target == ErrWorkspaceNotFound
+}
+
+func workspaceError(err error, output []byte) error {
+	if workspaceNotFoundRegex.Match(output) {
+		return workspaceNotFoundError{err}
+	}
+	return err
+}
+
 //go:generate counterfeiter . Client
 
 type Client interface {
 	InitWithBackend() error
 	InitWithoutBackend() error
 	Apply() error
-	Destroy() error
-	Plan() (string, error)
+	Destroy(ctx context.Context) error
+	Plan() (string, bool, error)
+	RefreshOnly() ([]string, error)
 	JSONPlan() error
+	TextPlan() error
+	Validate() error
 	Output(string) (map[string]map[string]interface{}, error)
+	OutputValue(envName string, name string) (interface{}, error)
 	OutputWithLegacyStorage() (map[string]map[string]interface{}, error)
 	Version() (string, error)
 	Import(string) error
@@ -42,30 +90,140 @@ type Client interface {
 	WorkspaceDelete(string) error
 	WorkspaceDeleteWithForce(string) error
 	StatePull(string) ([]byte, error)
+	StatePush(envName string, stateFilePath string) error
+	StateMv(envName string, from string, to string) error
+	StateRm(envName string, address string) error
+	Taint(envName string, address string) error
+	ForceUnlock(lockID string) error
 	CurrentStateVersion(string) (StateVersion, error)
 	SavePlanToBackend(string) error
 	GetPlanFromBackend(string) error
 	SetModel(models.Terraform)
+	BackendChange() *BackendChange
+	AppliedChanges() *AppliedChanges
 }
 
 type client struct {
-	model     models.Terraform
-	logWriter io.Writer
+	model          models.Terraform
+	logWriter      io.Writer
+	backendChange  *BackendChange
+	appliedChanges *AppliedChanges
+}
+
+// BackendChange is an approved change of backend made by InitWithBackend,
+// see `approve_backend_change`
+type BackendChange struct {
+	PreviousType string
+	Type         string
+	Mode         string
 }
 
 type StateVersion struct {
 	Serial  int
 	Lineage string
+
+	// Empty is true if the workspace exists but no state has been written,
+	// e.g. a put failed between `workspace new` and apply. Serial is zero.
+	Empty bool
 }
 
 func NewClient(model models.Terraform, logWriter io.Writer) Client {
 	return &client{
-		model:     model,
+		model:     resolvePaths(model),
 		logWriter: logWriter,
 	}
 }
 
+// resolvePaths makes a relative `terraform_binary_path`, `backend_config_file`,
+// `backend_config_files` and `plugin_cache_dir` absolute while still in the
+// build dir, as terraform runs from the source dir
+func resolvePaths(model models.Terraform) models.Terraform {
+	if model.TerraformBinaryPath != "" {
+		if absPath, err := filepath.Abs(model.TerraformBinaryPath); err == nil {
+			model.TerraformBinaryPath = absPath
+		}
+	}
+	if model.BackendConfigFile != "" {
+		if absPath, err := filepath.Abs(model.BackendConfigFile); err == nil {
+			model.BackendConfigFile = absPath
+		}
+	}
+	if len(model.BackendConfigFiles) > 0 {
+		configFiles := []string{}
+		for _, configFile := range model.BackendConfigFiles {
+			if absPath, err := filepath.Abs(configFile); err == nil {
+				configFile = absPath
+			}
+			configFiles = append(configFiles, configFile)
+		}
+		model.BackendConfigFiles = configFiles
+	}
+	if model.PluginCacheDir != "" {
+		if absPath, err := filepath.Abs(model.PluginCacheDir); err == nil {
+			model.PluginCacheDir = absPath
+		}
+	}
+	return model
+}
+
+// pluginCacheDir is TF_PLUGIN_CACHE_DIR, `plugin_cache_dir` takes precedence
+// over the plugins dir of `download_cache_path`
+func (c *client) pluginCacheDir() string {
+	if c.model.PluginCacheDir != "" {
+		return c.model.PluginCacheDir
+	}
+	if c.model.DownloadCachePath != "" {
+		return downloadCache{path: c.model.DownloadCachePath}.pluginDir()
+	}
+	return ""
+}
+
+// createPluginCacheDir must only ever add to the dir, it may be a cache volume
+// shared with concurrent builds. Terraform ignores a missing cache dir.
+func (c *client) createPluginCacheDir() error {
+	if c.model.PluginCacheDir != "" {
+		if err := os.MkdirAll(c.model.PluginCacheDir, 0755); err != nil {
+			return fmt.Errorf("Failed to create `plugin_cache_dir`: %s", err)
+		}
+	}
+	return nil
+}
+
 func (c *client) InitWithBackend() error {
+	previousType, backendChanged, err := c.backendChanged()
+	if err != nil {
+		return err
+	}
+	expectedLineage := ""
+	if backendChanged {
+		if !c.model.ApproveBackendChange {
+			return errors.New("the backend configuration has changed since `terraform init` was last run in `terraform_source`. " +
+				"Set `put.params.approve_backend_change: true` and `put.params.backend_change_mode` to `migrate_state` or `reconfigure` to proceed.")
+		}
+		if expectedLineage, err = c.currentLineage(); err != nil {
+			return err
+		}
+	}
+
+	// restored before writing the override so the config key is unaffected
+	getModules := true
+	moduleStats := moduleCacheStats{}
+	if err := c.createPluginCacheDir(); err != nil {
+		return err
+	}
+	if c.model.DownloadCachePath != "" {
+		cache := downloadCache{path: c.model.DownloadCachePath}
+		if err := os.MkdirAll(cache.pluginDir(), 0755); err != nil {
+			return fmt.Errorf("Failed to create `download_cache_path`: %s", err)
+		}
+		restored, stats, err := cache.restoreModules(c.model.Source)
+		if err != nil {
+			return err
+		}
+		getModules = !restored
+		moduleStats.Hits = stats.Hits
+	}
+
 	if err := c.writeBackendOverride(c.model.Source); err != nil {
 		return err
 	}
@@ -74,21 +232,106 @@ func (c *client) InitWithBackend() error {
 		return err
 	}
 
+	err = c.runInitWithBackend(backendConfigPath, backendChanged, getModules)
+	if err != nil && !getModules {
+		// e.g. a restored module no longer matches the config
+		getModules = true
+		moduleStats.Hits = 0
+		err = c.runInitWithBackend(backendConfigPath, backendChanged, getModules)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.model.DownloadCachePath != "" {
+		if getModules {
+			cache := downloadCache{path: c.model.DownloadCachePath}
+			downloaded, err := cache.saveModules(c.model.Source)
+			if err != nil {
+				c.logWriter.Write([]byte(fmt.Sprintf("Failed to update `download_cache_path`, continuing without it: %s\n", err)))
+			}
+			moduleStats.Misses = downloaded
+		}
+		c.logWriter.Write([]byte(fmt.Sprintf("Terraform init: %d module(s) restored from `download_cache_path`, %d downloaded\n", moduleStats.Hits, moduleStats.Misses)))
+	}
+
+	if expectedLineage != "" {
+		lineage, err := c.currentLineage()
+		if err != nil {
+			return err
+		}
+		if lineage != expectedLineage {
+			return fmt.Errorf("Expected state lineage '%s' after changing backend but got '%s', "+
+				"the new backend configuration may point at a different statefile", expectedLineage, lineage)
+		}
+	}
+
+	if backendChanged {
+		c.backendChange = &BackendChange{
+			PreviousType: previousType,
+			Type:         c.model.BackendType,
+			Mode:         c.model.BackendChangeMode,
+		}
+		if c.backendChange.Mode == "" {
+			c.backendChange.Mode = models.BackendChangeMigrateState
+		}
+		c.warnBackendChange()
+	}
+
+	return nil
+}
+
+// BackendChange returns nil unless the last InitWithBackend changed backend
+func (c *client) BackendChange() *BackendChange {
+	return c.backendChange
+}
+
+// AppliedChanges returns nil unless the last Apply reported its counts
+func (c *client) AppliedChanges() *AppliedChanges {
+	return c.appliedChanges
+}
+
+func (c *client) warnBackendChange() {
+	logger := logger.New(c.logWriter, c.model.LogJSON)
+	logger.WarnSection("Backend Changed")
+	if c.backendChange.Mode == models.BackendChangeReconfigure {
+		logger.Warn(fmt.Sprintf("Reconfigured from the '%s' backend to the '%s' backend without copying state",
+			c.backendChange.PreviousType, c.backendChange.Type))
+	} else {
+		logger.Warn(fmt.Sprintf("Migrated state from the '%s' backend to the '%s' backend, the statefile in the previous backend was left in place",
+			c.backendChange.PreviousType, c.backendChange.Type))
+	}
+	logger.EndSection()
+}
+
+func (c *client) runInitWithBackend(backendConfigPath string, backendChanged bool, getModules bool) error {
 	initArgs := []string{
 		"init",
 		"-input=false",
-		"-get=true",
+		fmt.Sprintf("-get=%t", getModules),
 		"-backend=true",
-		fmt.Sprintf("-backend-config=%s", backendConfigPath),
-		fmt.Sprintf("-get-plugins=%t", c.model.DownloadPlugins),
 	}
+	initArgs = append(initArgs, c.backendConfigArgs(backendConfigPath)...)
+	initArgs = append(initArgs, fmt.Sprintf("-get-plugins=%t", c.model.DownloadPlugins))
 	if c.model.PluginDir != "" {
 		initArgs = append(initArgs, fmt.Sprintf("-plugin-dir=%s", c.model.PluginDir))
 	}
+	if c.model.ReadOnly {
+		initArgs = append(initArgs, "-lock=false")
+	}
+	if c.model.InitUpgrade {
+		initArgs = append(initArgs, "-upgrade")
+	}
+	if backendChanged {
+		if c.model.BackendChangeMode == models.BackendChangeReconfigure {
+			initArgs = append(initArgs, "-reconfigure")
+		} else {
+			initArgs = append(initArgs, "-migrate-state", "-force-copy")
+		}
+	}
 
 	initCmd := c.terraformCmd(initArgs, nil)
-	var output []byte
-	if output, err = initCmd.CombinedOutput(); err != nil {
+	if output, err := initCmd.CombinedOutput(); err != nil {
 		// Even though we tell Terraform to skip downloading plugins, it will still return
 		// an error if the user has previously uploaded a "default" workspace which uses
 		// custom provider plugins. Despite the error message the initialization has otherwise
@@ -108,12 +351,81 @@ func (c *client) InitWithBackend() error {
 				}
 			}
 		}
-		return fmt.Errorf("terraform init command failed.\nError: %s\nOutput: %s", err, output)
+		return workspaceError(fmt.Errorf("terraform init command failed.\nError: %s\nOutput: %s%s%s", err, output, c.pluginDirHint(output), c.remoteWorkspacesHint(output)), output)
 	}
 
 	return nil
 }
 
+// backendChanged compares the backend recorded by a previous `terraform init`
+// in .terraform/terraform.tfstate against the current backend configuration,
+// returning the type of the previous backend.
+func (c *client) backendChanged() (string, bool, error) {
+	metadataPath := path.Join(c.model.Source, ".terraform", "terraform.tfstate")
+	contents, err := ioutil.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	metadata := struct {
+		Backend *struct {
+			Type   string                 `json:"type"`
+			Config map[string]interface{} `json:"config"`
+		} `json:"backend"`
+	}{}
+	if err = json.Unmarshal(contents, &metadata); err != nil {
+		return "", false, fmt.Errorf("Failed to unmarshal backend metadata at '%s': %s", metadataPath, err)
+	}
+	if metadata.Backend == nil || metadata.Backend.Type == "" {
+		return "", false, nil
+	}
+	previousType := metadata.Backend.Type
+	if previousType != c.model.BackendType {
+		return previousType, true, nil
+	}
+
+	// round trip through JSON to compare values with the same types
+	configContents, err := json.Marshal(c.model.BackendConfig)
+	if err != nil {
+		return "", false, err
+	}
+	config := map[string]interface{}{}
+	if err = json.Unmarshal(configContents, &config); err != nil {
+		return "", false, err
+	}
+	for key, value := range config {
+		if !reflect.DeepEqual(metadata.Backend.Config[key], value) {
+			return previousType, true, nil
+		}
+	}
+
+	return previousType, false, nil
+}
+
+func (c *client) currentLineage() (string, error) {
+	cmd := c.terraformCmd([]string{
+		"state",
+		"pull",
+	}, nil)
+	rawState, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Error running `state pull`: %s, Output: %s", err, rawState)
+	}
+	if len(bytes.TrimSpace(rawState)) == 0 {
+		return "", nil // no state exists yet
+	}
+
+	tfState := struct {
+		Lineage string `json:"lineage"`
+	}{}
+	if err = json.Unmarshal(rawState, &tfState); err != nil {
+		return "", fmt.Errorf("Failed to unmarshal JSON output.\nError: %s\nOutput: %s", err, rawState)
+	}
+	return tfState.Lineage, nil
+}
+
 func (c *client) writeBackendConfig(outputDir string) (string, error) {
 	configContents, err := json.Marshal(c.model.BackendConfig)
 	if err != nil {
@@ -132,7 +444,27 @@ func (c *client) writeBackendConfig(outputDir string) (string, error) {
 	return backendPath, nil
 }
 
-func (c *client) writePlanProviderConfig(outputDir string, planContents, planContentsJSON []byte) error {
+// backendConfigArgs passes `backend_config_file` and `backend_config_files`
+// as is, as their HCL can contain nested blocks such as the `workspaces` of
+// the `remote` backend. Terraform merges the files in order, so
+// `backend_config` takes precedence.
+func (c *client) backendConfigArgs(backendConfigPath string) []string {
+	configFiles := c.model.BackendConfigFiles
+	if c.model.BackendConfigFile != "" {
+		configFiles = append([]string{c.model.BackendConfigFile}, configFiles...)
+	}
+
+	args := []string{}
+	for _, configFile := range configFiles {
+		args = append(args, fmt.Sprintf("-backend-config=%s", shellQuote(configFile)))
+	}
+	if len(configFiles) > 0 && len(c.model.BackendConfig) == 0 {
+		return args
+	}
+	return append(args, fmt.Sprintf("-backend-config=%s", backendConfigPath))
+}
+
+func (c *client) writePlanProviderConfig(outputDir string, planContents, planContentsJSON, planContentsText []byte) error {
 	// GZip JSON plan to save space:
 	// https://github.com/ljfranklin/terraform-resource/issues/115#issuecomment-619525494
 	// Not gzipping the binary plan for now to avoid migration issues.
@@ -143,19 +475,12 @@ func (c *client) writePlanProviderConfig(outputDir string, planContents, planCon
 		return err
 	}
 
-	var encodedJSONBuffer bytes.Buffer
-	baseEncoder := base64.NewEncoder(base64.StdEncoding, &encodedJSONBuffer)
-	zw := gzip.NewWriter(baseEncoder)
-	if _, err = zw.Write(planContentsJSON); err != nil {
-		return err
-	}
-	if err = zw.Close(); err != nil {
-		return err
-	}
-	if err = baseEncoder.Close(); err != nil {
+	escapedJSONPlan, err := gzipAndEscape(planContentsJSON)
+	if err != nil {
 		return err
 	}
-	escapedJSONPlan, err := json.Marshal(encodedJSONBuffer.String())
+
+	escapedTextPlan, err := gzipAndEscape(planContentsText)
 	if err != nil {
 		return err
 	}
@@ -175,6 +500,9 @@ resource "stateful_string" "plan_output" {
 resource "stateful_string" "plan_output_json" {
   desired = %s
 }
+resource "stateful_string" "plan_output_text" {
+  desired = %s
+}
 output "%s" {
   sensitive = true
   value = stateful_string.plan_output.desired
@@ -183,7 +511,11 @@ output "%s" {
   sensitive = true
   value = stateful_string.plan_output_json.desired
 }
-`, escapedPlan, escapedJSONPlan, models.PlanContent, models.PlanContentJSON))
+output "%s" {
+  sensitive = true
+  value = stateful_string.plan_output_text.desired
+}
+`, escapedPlan, escapedJSONPlan, escapedTextPlan, models.PlanContent, models.PlanContentJSON, models.PlanContentText))
 
 	configPath, err := filepath.Abs(path.Join(outputDir, "resource_plan_config.tf"))
 	if err != nil {
@@ -197,6 +529,22 @@ output "%s" {
 	return nil
 }
 
+func gzipAndEscape(contents []byte) ([]byte, error) {
+	var encodedBuffer bytes.Buffer
+	baseEncoder := base64.NewEncoder(base64.StdEncoding, &encodedBuffer)
+	zw := gzip.NewWriter(baseEncoder)
+	if _, err := zw.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if err := baseEncoder.Close(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(encodedBuffer.String())
+}
+
 func (c *client) writeBackendOverride(outputDir string) error {
 	backendPath := path.Join(outputDir, "resource_backend_override.tf")
 	backendContent := fmt.Sprintf(`terraform {
@@ -209,6 +557,9 @@ func (c *client) InitWithoutBackend() error {
 	if err := c.clearTerraformState(); err != nil {
 		return err
 	}
+	if err := c.createPluginCacheDir(); err != nil {
+		return err
+	}
 
 	initArgs := []string{
 		"init",
@@ -219,15 +570,48 @@ func (c *client) InitWithoutBackend() error {
 	if c.model.PluginDir != "" {
 		initArgs = append(initArgs, fmt.Sprintf("-plugin-dir=%s", c.model.PluginDir))
 	}
+	if c.model.InitUpgrade {
+		initArgs = append(initArgs, "-upgrade")
+	}
 	initCmd := c.terraformCmd(initArgs, nil)
 
 	if output, err := initCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("terraform init command failed.\nError: %s\nOutput: %s", err, output)
+		return fmt.Errorf("terraform init command failed.\nError: %s\nOutput: %s%s", err, output, c.pluginDirHint(output))
 	}
 
 	return nil
 }
 
+// providerResolutionErrors are printed by init when a provider isn't in
+// `plugin_dir`, which replaces the registry entirely
+var providerResolutionErrors = []string{
+	"Failed to query available provider packages",
+	"Failed to install provider",
+	"Incompatible provider version",
+}
+
+func (c *client) pluginDirHint(initOutput []byte) string {
+	if c.model.PluginDir == "" {
+		return ""
+	}
+	for _, errSnippet := range providerResolutionErrors {
+		if bytes.Contains(initOutput, []byte(errSnippet)) {
+			return fmt.Sprintf("\nProviders are only installed from `plugin_dir` '%s', check it contains each required provider for %s_%s", c.model.PluginDir, runtime.GOOS, runtime.GOARCH)
+		}
+	}
+	return ""
+}
+
+// remoteWorkspacesHint explains the `remote` backend in prefix mode can't be
+// initialized until a workspace with the prefix exists, as `init` selects one
+func (c *client) remoteWorkspacesHint(initOutput []byte) string {
+	if c.model.BackendType != models.RemoteBackendType || !bytes.Contains(initOutput, []byte("No existing workspaces")) {
+		return ""
+	}
+	return fmt.Sprintf("\nThe `remote` backend requires at least one workspace named with the prefix '%s' before `terraform init`, "+
+		"create one in Terraform Cloud/Enterprise, e.g. for the first env", c.model.RemoteWorkspacePrefix())
+}
+
 // necessary to switch from backend to non-backend in `migrated_from_storage` code paths
 func (c *client) clearTerraformState() error {
 	configPath := path.Join(c.model.Source, ".terraform")
@@ -239,6 +623,9 @@ func (c *client) clearTerraformState() error {
 	return os.RemoveAll(backendConfig)
 }
 
+// jsonApplyMinVersion is the first release whose `apply` accepts -json
+const jsonApplyMinVersion = "0.15.3"
+
 func (c *client) Apply() error {
 	applyArgs := []string{
 		"apply",
@@ -247,6 +634,13 @@ func (c *client) Apply() error {
 		"-auto-approve",
 	}
 
+	// older releases apply as usual without reporting the applied changes
+	jsonUI := c.supportsJSONApply()
+	if jsonUI {
+		// read for the counts of added, changed and destroyed resources
+		applyArgs = append(applyArgs, "-json")
+	}
+
 	if c.model.PlanRun == false {
 		for _, varFile := range c.model.ConvertedVarFiles {
 			applyArgs = append(applyArgs, fmt.Sprintf("-var-file=%s", varFile))
@@ -261,20 +655,50 @@ func (c *client) Apply() error {
 
 	if c.model.PlanRun {
 		applyArgs = append(applyArgs, c.model.PlanFileLocalPath)
+	} else {
+		// terraform rejects -target when applying a saved plan
+		applyArgs = append(applyArgs, targetArgs(c.model.Targets)...)
+		applyArgs = append(applyArgs, replaceArgs(c.model.Replace)...)
+		applyArgs = append(applyArgs, c.refreshArgs()...)
 	}
 
-	applyCmd := c.terraformCmd(applyArgs, nil)
-	applyCmd.Stdout = c.logWriter
-	applyCmd.Stderr = c.logWriter
-	err := applyCmd.Run()
-	if err != nil {
-		return fmt.Errorf("Failed to run Terraform command: %s", err)
+	if c.model.Parallelism > 0 {
+		applyArgs = append(applyArgs, fmt.Sprintf("-parallelism=%d", c.model.Parallelism))
 	}
+	applyArgs = append(applyArgs, c.lockArgs()...)
+	applyArgs = append(applyArgs, c.lockTimeoutArgs()...)
 
-	return nil
+	c.appliedChanges = nil
+	newApplyCmd := func() *exec.Cmd {
+		return c.terraformCmd(applyArgs, nil)
+	}
+	if !jsonUI {
+		return c.runWithRetries("terraform apply", newApplyCmd)
+	}
+
+	var ui *jsonUIWriter
+	err := c.runWithRetriesTo("terraform apply", newApplyCmd, func(stderr io.Writer) io.Writer {
+		ui = &jsonUIWriter{log: c.logWriter, diagnostics: stderr}
+		return ui
+	})
+	if ui != nil {
+		c.appliedChanges = ui.applied
+	}
+	return err
 }
 
-func (c *client) Destroy() error {
+// supportsJSONApply is false if the version can't be determined, as passing
+// an unknown flag would fail the apply
+func (c *client) supportsJSONApply() bool {
+	version, err := c.Version()
+	if err != nil {
+		return false
+	}
+	return versionAtLeast(parseVersion(version), jsonApplyMinVersion)
+}
+
+// Destroy kills the terraform process if ctx is cancelled.
+func (c *client) Destroy(ctx context.Context) error {
 	destroyArgs := []string{
 		"destroy",
 		"-backup='-'", // no need to backup state file
@@ -285,22 +709,114 @@ func (c *client) Destroy() error {
 	for _, varFile := range c.model.ConvertedVarFiles {
 		destroyArgs = append(destroyArgs, fmt.Sprintf("-var-file=%s", varFile))
 	}
+	destroyArgs = append(destroyArgs, targetArgs(c.model.Targets)...)
 
-	destroyCmd := c.terraformCmd(destroyArgs, nil)
-	destroyCmd.Stdout = c.logWriter
-	destroyCmd.Stderr = c.logWriter
-	err := destroyCmd.Run()
-	if err != nil {
-		return fmt.Errorf("Failed to run Terraform command: %s", err)
+	if c.model.Parallelism > 0 {
+		destroyArgs = append(destroyArgs, fmt.Sprintf("-parallelism=%d", c.model.Parallelism))
 	}
+	destroyArgs = append(destroyArgs, c.lockArgs()...)
+	destroyArgs = append(destroyArgs, c.lockTimeoutArgs()...)
 
-	return nil
+	return c.runWithRetries("terraform destroy", func() *exec.Cmd {
+		return c.terraformCmdContext(ctx, destroyArgs, nil)
+	})
+}
+
+// runWithRetries runs the command from newCmd again while it exits 1 with a
+// transient backend error in its stderr, up to `max_retries` times. A
+// failure to acquire the state lock is returned as a StateLockedError.
+func (c *client) runWithRetries(description string, newCmd func() *exec.Cmd) error {
+	return c.runWithRetriesTo(description, newCmd, func(io.Writer) io.Writer {
+		return c.logWriter
+	})
 }
 
-func (c *client) Plan() (string, error) {
+// runWithRetriesTo sends each attempt's stdout to the writer returned by
+// newStdout, which is given the buffer of stderr read by the retry and state
+// lock checks
+func (c *client) runWithRetriesTo(description string, newCmd func() *exec.Cmd, newStdout func(stderr io.Writer) io.Writer) error {
+	retryer := retry.Retryer{
+		MaxRetries: c.model.MaxRetries,
+		Delay:      c.model.RetryDelayDuration(),
+		Logger:     logger.New(c.logWriter, c.model.LogJSON),
+	}
+
+	var stderr bytes.Buffer
+	run := func() error {
+		stderr.Reset()
+		cmd := newCmd()
+		stdout := newStdout(&stderr)
+		cmd.Stdout = stdout
+		cmd.Stderr = io.MultiWriter(c.logWriter, &stderr)
+		err := cmd.Run()
+		if flusher, ok := stdout.(interface{ Flush() error }); ok {
+			flusher.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to run Terraform command: %w", err)
+		}
+		return nil
+	}
+	isTransient := func(err error) bool {
+		var exitErr *exec.ExitError
+		return errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && retry.IsTransient(stderr.String())
+	}
+
+	return stateLockError(retryer.Do(description, run, isTransient), stderr.Bytes())
+}
+
+// targetArgs quotes each address as an index key such as
+// aws_instance.x["a"] would otherwise be mangled by the shell
+func targetArgs(targets []string) []string {
+	args := []string{}
+	for _, target := range targets {
+		args = append(args, shellQuote(fmt.Sprintf("-target=%s", target)))
+	}
+	return args
+}
+
+func replaceArgs(addresses []string) []string {
+	args := []string{}
+	for _, address := range addresses {
+		args = append(args, shellQuote(fmt.Sprintf("-replace=%s", address)))
+	}
+	return args
+}
+
+// lockTimeoutArgs makes Terraform retry acquiring the state lock rather than
+// failing immediately when another job holds it.
+func (c *client) lockTimeoutArgs() []string {
+	if c.model.LockTimeout == "" {
+		return []string{}
+	}
+	return []string{fmt.Sprintf("-lock-timeout=%s", c.model.LockTimeout)}
+}
+
+// lockArgs disables state locking only when explicitly requested, e.g. for
+// backends that don't support locking.
+func (c *client) lockArgs() []string {
+	if c.model.Lock == nil || *c.model.Lock {
+		return []string{}
+	}
+	return []string{"-lock=false"}
+}
+
+// refreshArgs is deliberately not used by Destroy, skipping the refresh
+// there risks acting on stale state.
+func (c *client) refreshArgs() []string {
+	if !c.model.SkipRefresh() {
+		return []string{}
+	}
+	return []string{"-refresh=false"}
+}
+
+// Plan returns the checksum of the saved plan and whether it has changes,
+// from `-detailed-exitcode` exiting 2
+func (c *client) Plan() (string, bool, error) {
 	planArgs := []string{
 		"plan",
 		"-input=false", // do not prompt for inputs
+		"-detailed-exitcode",
 		fmt.Sprintf("-out=%s", c.model.PlanFileLocalPath),
 		fmt.Sprintf("-state=%s", c.model.StateFileLocalPath),
 	}
@@ -308,27 +824,199 @@ func (c *client) Plan() (string, error) {
 	for _, varFile := range c.model.ConvertedVarFiles {
 		planArgs = append(planArgs, fmt.Sprintf("-var-file=%s", varFile))
 	}
+	// a saved plan already includes the replacements, see Apply
+	planArgs = append(planArgs, replaceArgs(c.model.Replace)...)
+	planArgs = append(planArgs, c.refreshArgs()...)
+	planArgs = append(planArgs, c.lockArgs()...)
+	planArgs = append(planArgs, c.lockTimeoutArgs()...)
 
+	var stderr bytes.Buffer
 	planCmd := c.terraformCmd(planArgs, nil)
 	planCmd.Stdout = c.logWriter
-	planCmd.Stderr = c.logWriter
+	planCmd.Stderr = io.MultiWriter(c.logWriter, &stderr)
 	err := planCmd.Run()
+	hasChanges := false
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		hasChanges = true
+		err = nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("Failed to run Terraform command: %s", err)
+		return "", false, stateLockError(fmt.Errorf("Failed to run Terraform command: %s", err), stderr.Bytes())
 	}
 
 	planFile, err := os.Open(c.model.PlanFileLocalPath)
 	if err != nil {
-		return "", fmt.Errorf("Failed to open planfile: %s", err)
+		return "", false, fmt.Errorf("Failed to open planfile: %s", err)
 	}
 	defer planFile.Close()
 
 	h := sha256.New()
 	if _, err := io.Copy(h, planFile); err != nil {
-		return "", fmt.Errorf("Failed to get planfile checksum: %s", err)
+		return "", false, fmt.Errorf("Failed to get planfile checksum: %s", err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), hasChanges, nil
+}
+
+func (c *client) RefreshOnly() ([]string, error) {
+	planArgs := []string{
+		"plan",
+		"-refresh-only",
+		"-input=false", // do not prompt for inputs
+		fmt.Sprintf("-out=%s", c.model.PlanFileLocalPath),
+	}
+
+	for _, varFile := range c.model.ConvertedVarFiles {
+		planArgs = append(planArgs, fmt.Sprintf("-var-file=%s", varFile))
+	}
+	planArgs = append(planArgs, c.lockArgs()...)
+	planArgs = append(planArgs, c.lockTimeoutArgs()...)
+
+	err := c.runWithRetries("terraform plan -refresh-only", func() *exec.Cmd {
+		return c.terraformCmd(planArgs, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	showCmd := c.terraformCmd([]string{
+		"show",
+		"-json",
+		c.model.PlanFileLocalPath,
+	}, nil)
+	rawPlan, err := showCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve refresh-only plan.\nError: %s\nOutput: %s", err, rawPlan)
+	}
+
+	drifted, err := driftedAttributes(rawPlan)
+	if err != nil {
+		return nil, err
+	}
+
+	applyArgs := []string{
+		"apply",
+		"-backup='-'",  // no need to backup state file
+		"-input=false", // do not prompt for inputs
+		"-auto-approve",
+	}
+	applyArgs = append(applyArgs, c.lockArgs()...)
+	applyArgs = append(applyArgs, c.lockTimeoutArgs()...)
+	applyArgs = append(applyArgs, c.model.PlanFileLocalPath)
+
+	err = c.runWithRetries("terraform apply -refresh-only", func() *exec.Cmd {
+		return c.terraformCmd(applyArgs, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drifted, nil
+}
+
+// driftedAttributes parses the `resource_drift` section of a JSON plan and
+// returns the address of every attribute which changed outside of Terraform,
+// or just the resource address if the resource was deleted.
+func driftedAttributes(rawPlan []byte) ([]string, error) {
+	plan := struct {
+		ResourceDrift []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Before map[string]interface{} `json:"before"`
+				After  map[string]interface{} `json:"after"`
+			} `json:"change"`
+		} `json:"resource_drift"`
+	}{}
+	if err := json.Unmarshal(rawPlan, &plan); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal JSON plan.\nError: %s", err)
+	}
+
+	drifted := []string{}
+	for _, drift := range plan.ResourceDrift {
+		if drift.Change.After == nil {
+			drifted = append(drifted, drift.Address)
+			continue
+		}
+
+		attributes := []string{}
+		for key, before := range drift.Change.Before {
+			if !reflect.DeepEqual(before, drift.Change.After[key]) {
+				attributes = append(attributes, key)
+			}
+		}
+		for key := range drift.Change.After {
+			if _, ok := drift.Change.Before[key]; !ok {
+				attributes = append(attributes, key)
+			}
+		}
+		sort.Strings(attributes)
+		for _, attr := range attributes {
+			drifted = append(drifted, fmt.Sprintf("%s.%s", drift.Address, attr))
+		}
+	}
+
+	return drifted, nil
+}
+
+type PlanChanges struct {
+	Add     int
+	Change  int
+	Destroy int
+
+	// resource addresses in plan order, a replaced resource is in both
+	// AddAddresses and DestroyAddresses
+	AddAddresses     []string
+	ChangeAddresses  []string
+	DestroyAddresses []string
+
+	// Deferred counts the actions Terraform postponed to a later apply, e.g.
+	// for a provider configured from an unknown value
+	Deferred          int
+	DeferredAddresses []string
+}
+
+// planChanges counts the `resource_changes` in a JSON plan the same way
+// `terraform plan` summarizes them, i.e. a replace is both an add and a destroy.
+func planChanges(rawPlan []byte) (PlanChanges, error) {
+	plan := struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+		DeferredChanges []struct {
+			ResourceChange struct {
+				Address string `json:"address"`
+			} `json:"resource_change"`
+		} `json:"deferred_changes"`
+	}{}
+	if err := json.Unmarshal(rawPlan, &plan); err != nil {
+		return PlanChanges{}, fmt.Errorf("Failed to unmarshal JSON plan.\nError: %s", err)
+	}
+
+	changes := PlanChanges{}
+	for _, resourceChange := range plan.ResourceChanges {
+		for _, action := range resourceChange.Change.Actions {
+			switch action {
+			case "create":
+				changes.Add++
+				changes.AddAddresses = append(changes.AddAddresses, resourceChange.Address)
+			case "update":
+				changes.Change++
+				changes.ChangeAddresses = append(changes.ChangeAddresses, resourceChange.Address)
+			case "delete":
+				changes.Destroy++
+				changes.DestroyAddresses = append(changes.DestroyAddresses, resourceChange.Address)
+			}
+		}
+	}
+	for _, deferredChange := range plan.DeferredChanges {
+		changes.Deferred++
+		changes.DeferredAddresses = append(changes.DeferredAddresses, deferredChange.ResourceChange.Address)
 	}
 
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	return changes, nil
 }
 
 func (c *client) JSONPlan() error {
@@ -353,13 +1041,101 @@ func (c *client) JSONPlan() error {
 	return nil
 }
 
+func (c *client) TextPlan() error {
+	showCmd := c.terraformCmd([]string{
+		"show",
+		"-no-color",
+		c.model.PlanFileLocalPath,
+	}, nil)
+	rawOutput, err := showCmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve output.\nError: %s\nOutput: %s", err, rawOutput)
+	}
+
+	err = ioutil.WriteFile(c.model.TextPlanFileLocalPath, rawOutput, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write text planfile to %s: %s", c.model.TextPlanFileLocalPath, err)
+	}
+
+	return nil
+}
+
+// validateResult is the output of `terraform validate -json`
+type validateResult struct {
+	Valid       bool                 `json:"valid"`
+	Diagnostics []validateDiagnostic `json:"diagnostics"`
+}
+
+type validateDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Range    *struct {
+		Filename string `json:"filename"`
+		Start    struct {
+			Line int `json:"line"`
+		} `json:"start"`
+	} `json:"range"`
+}
+
+func (d validateDiagnostic) String() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "%s: %s", strings.Title(d.Severity), d.Summary)
+	if d.Range != nil {
+		fmt.Fprintf(&msg, "\n  on %s line %d", d.Range.Filename, d.Range.Start.Line)
+	}
+	if d.Detail != "" {
+		fmt.Fprintf(&msg, "\n  %s", strings.Replace(d.Detail, "\n", "\n  ", -1))
+	}
+	return msg.String()
+}
+
+func (c *client) Validate() error {
+	validateCmd := c.terraformCmd([]string{
+		"validate",
+		"-json",
+		"-no-color",
+	}, nil)
+
+	// validate exits non-zero for an invalid config but still prints the JSON
+	rawOutput, err := validateCmd.Output()
+	result := validateResult{}
+	if jsonErr := json.Unmarshal(rawOutput, &result); jsonErr != nil {
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				rawOutput = append(rawOutput, exitErr.Stderr...)
+			}
+			return fmt.Errorf("Failed to validate configuration.\nError: %s\nOutput: %s", err, rawOutput)
+		}
+		return fmt.Errorf("Failed to unmarshal JSON output.\nError: %s\nOutput: %s", jsonErr, rawOutput)
+	}
+
+	errs := []string{}
+	for _, diag := range result.Diagnostics {
+		if diag.Severity == "error" {
+			errs = append(errs, diag.String())
+		} else {
+			fmt.Fprintf(c.logWriter, "%s\n", diag)
+		}
+	}
+	if !result.Valid || len(errs) > 0 {
+		return fmt.Errorf("Terraform configuration is invalid:\n\n%s", strings.Join(errs, "\n\n"))
+	}
+
+	return nil
+}
+
 func (c *client) Output(envName string) (map[string]map[string]interface{}, error) {
+	if c.model.ReadOnly {
+		return c.outputFromState(envName)
+	}
+
 	outputArgs := []string{
 		"output",
 		"-json",
 	}
 	outputCmd := c.terraformCmd(outputArgs, []string{
-		fmt.Sprintf("TF_WORKSPACE=%s", envName),
+		fmt.Sprintf("TF_WORKSPACE=%s", c.workspaceName(envName)),
 	})
 
 	rawOutput, err := outputCmd.Output()
@@ -375,6 +1151,87 @@ func (c *client) Output(envName string) (map[string]map[string]interface{}, erro
 	return tfOutput, nil
 }
 
+// OutputValue returns the value of a single output, without the type and
+// sensitive fields returned by Output
+func (c *client) OutputValue(envName string, name string) (interface{}, error) {
+	if c.model.ReadOnly {
+		outputs, err := c.outputFromState(envName, name)
+		if err != nil {
+			return nil, err
+		}
+		return outputs[name]["value"], nil
+	}
+
+	outputCmd := c.terraformCmd([]string{
+		"output",
+		"-json",
+		name,
+	}, []string{
+		fmt.Sprintf("TF_WORKSPACE=%s", c.workspaceName(envName)),
+	})
+
+	rawOutput, err := outputCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve output '%s'.\nError: %s", name, err)
+	}
+
+	if !utf8.Valid(rawOutput) {
+		return nil, fmt.Errorf("Failed to unmarshal JSON output '%s'.\nError: output contains invalid UTF-8", name)
+	}
+	var value interface{}
+	if err = json.Unmarshal(rawOutput, &value); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal JSON output '%s'.\nError: %s", name, err)
+	}
+
+	return value, nil
+}
+
+// outputFromState reads the outputs from `state pull` for read-only gets, as
+// some backends take a lock for `terraform output`. Only the given outputs are
+// checked for invalid UTF-8 if any are named.
+func (c *client) outputFromState(envName string, names ...string) (map[string]map[string]interface{}, error) {
+	rawState, err := c.StatePull(envName)
+	if err != nil {
+		return nil, err
+	}
+	rawOutputs, err := StateOutputs(rawState)
+	if err != nil {
+		return nil, err
+	}
+	stateOutputs := map[string]json.RawMessage{}
+	if err = json.Unmarshal(rawOutputs, &stateOutputs); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal JSON output.\nError: %s", err)
+	}
+	if len(names) == 0 {
+		for name := range stateOutputs {
+			names = append(names, name)
+		}
+	}
+
+	tfOutput := map[string]map[string]interface{}{}
+	for _, name := range names {
+		rawOutput, ok := stateOutputs[name]
+		if !ok {
+			return nil, fmt.Errorf("Failed to retrieve output '%s'.\nError: no such output in the state", name)
+		}
+		// json.Unmarshal would silently replace the invalid bytes
+		if !utf8.Valid(rawOutput) {
+			return nil, fmt.Errorf("Failed to unmarshal JSON output '%s'.\nError: output contains invalid UTF-8", name)
+		}
+		output := map[string]interface{}{}
+		if err = json.Unmarshal(rawOutput, &output); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal JSON output '%s'.\nError: %s", name, err)
+		}
+		// the state omits `sensitive` when false, unlike `terraform output`
+		if _, ok := output["sensitive"]; !ok {
+			output["sensitive"] = false
+		}
+		tfOutput[name] = output
+	}
+
+	return tfOutput, nil
+}
+
 func (c *client) OutputWithLegacyStorage() (map[string]map[string]interface{}, error) {
 	outputArgs := []string{
 		"output",
@@ -438,14 +1295,16 @@ func (c *client) Import(envName string) error {
 		for _, varFile := range c.model.ConvertedVarFiles {
 			importArgs = append(importArgs, fmt.Sprintf("-var-file=%s", varFile))
 		}
+		importArgs = append(importArgs, c.lockArgs()...)
+		importArgs = append(importArgs, c.lockTimeoutArgs()...)
 
-		importArgs = append(importArgs, tfID)
-		importArgs = append(importArgs, iaasID)
+		importArgs = append(importArgs, shellQuote(tfID))
+		importArgs = append(importArgs, shellQuote(iaasID))
 
 		importCmd := c.terraformCmd(importArgs, nil)
 		rawOutput, err := importCmd.CombinedOutput()
 		if err != nil {
-			return fmt.Errorf("Failed to import resource %s %s.\nError: %s\nOutput: %s", tfID, iaasID, err, rawOutput)
+			return stateLockError(fmt.Errorf("Failed to import resource %s %s.\nError: %s\nOutput: %s", tfID, iaasID, err, rawOutput), rawOutput)
 		}
 	}
 
@@ -476,14 +1335,16 @@ func (c *client) ImportWithLegacyStorage() error {
 		for _, varFile := range c.model.ConvertedVarFiles {
 			importArgs = append(importArgs, fmt.Sprintf("-var-file=%s", varFile))
 		}
+		importArgs = append(importArgs, c.lockArgs()...)
+		importArgs = append(importArgs, c.lockTimeoutArgs()...)
 
-		importArgs = append(importArgs, tfID)
-		importArgs = append(importArgs, iaasID)
+		importArgs = append(importArgs, shellQuote(tfID))
+		importArgs = append(importArgs, shellQuote(iaasID))
 
 		importCmd := c.terraformCmd(importArgs, nil)
 		rawOutput, err := importCmd.CombinedOutput()
 		if err != nil {
-			return fmt.Errorf("Failed to import resource %s %s.\nError: %s\nOutput: %s", tfID, iaasID, err, rawOutput)
+			return stateLockError(fmt.Errorf("Failed to import resource %s %s.\nError: %s\nOutput: %s", tfID, iaasID, err, rawOutput), rawOutput)
 		}
 	}
 
@@ -505,23 +1366,61 @@ func (c *client) WorkspaceList() ([]string, error) {
 	for scanner.Scan() {
 		env := strings.TrimPrefix(scanner.Text(), "*")
 		env = strings.TrimSpace(env)
-		if len(env) > 0 {
-			envs = append(envs, env)
+		if len(env) == 0 {
+			continue
+		}
+		if c.model.WorkspacePrefix != "" {
+			// hide workspaces belonging to other teams sharing the backend
+			if !strings.HasPrefix(env, c.model.WorkspacePrefix) {
+				continue
+			}
+			env = strings.TrimPrefix(env, c.model.WorkspacePrefix)
 		}
+		envs = append(envs, env)
 	}
 
 	return envs, nil
 }
 
+// workspaceName namespaces the env within a backend shared with other
+// teams, see `source.backend_prefix`.
+func (c *client) workspaceName(envName string) string {
+	return workspaceName(c.model, envName)
+}
+
+func workspaceName(model models.Terraform, envName string) string {
+	if envName == defaultWorkspace {
+		return envName
+	}
+	return model.WorkspacePrefix + envName
+}
+
+// validateRemoteWorkspaceName checks the Terraform Cloud workspace which
+// would store envName, `<workspaces.prefix><backend_prefix><env>`, is valid
+// before `workspace new` creates it. Other backends accept any name.
+func (c *client) validateRemoteWorkspaceName(envName string) error {
+	if c.model.BackendType != models.RemoteBackendType {
+		return nil
+	}
+	workspace := c.model.RemoteWorkspacePrefix() + c.workspaceName(envName)
+	if !remoteWorkspaceNameRegex.MatchString(workspace) {
+		return fmt.Errorf("Invalid env name '%s' for `backend_type: remote`, the workspace name '%s' may only contain letters, numbers, '-' and '_'", envName, workspace)
+	}
+	if len(workspace) > maxRemoteWorkspaceNameLength {
+		return fmt.Errorf("Invalid env name '%s' for `backend_type: remote`, the workspace name '%s' must be at most %d characters", envName, workspace, maxRemoteWorkspaceNameLength)
+	}
+	return nil
+}
+
 func (c *client) WorkspaceSelect(envName string) error {
 	cmd := c.terraformCmd([]string{
 		"workspace",
 		"select",
-		envName,
+		c.workspaceName(envName),
 	}, nil)
 
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("Error running `workspace select`: %s, Output: %s", err, output)
+		return workspaceError(fmt.Errorf("Error running `workspace select`: %s, Output: %s", err, output), output)
 	}
 
 	return nil
@@ -545,10 +1444,14 @@ func (c *client) WorkspaceNewIfNotExists(envName string) error {
 		return c.WorkspaceSelect(envName)
 	}
 
+	if err := c.validateRemoteWorkspaceName(envName); err != nil {
+		return err
+	}
+
 	cmd := c.terraformCmd([]string{
 		"workspace",
 		"new",
-		envName,
+		c.workspaceName(envName),
 	}, nil)
 
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -559,11 +1462,15 @@ func (c *client) WorkspaceNewIfNotExists(envName string) error {
 }
 
 func (c *client) WorkspaceNewFromExistingStateFile(envName string, localStateFilePath string) error {
+	if err := c.validateRemoteWorkspaceName(envName); err != nil {
+		return err
+	}
+
 	cmd := c.terraformCmd([]string{
 		"workspace",
 		"new",
 		fmt.Sprintf("-state=%s", localStateFilePath),
-		envName,
+		c.workspaceName(envName),
 	}, nil)
 
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -590,13 +1497,13 @@ func (c *client) WorkspaceDelete(envName string) error {
 	cmd := c.terraformCmd([]string{
 		"workspace",
 		"delete",
-		envName,
+		c.workspaceName(envName),
 	}, []string{
 		fmt.Sprintf("TF_WORKSPACE=%s", defaultWorkspace),
 	})
 
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("Error running `workspace delete`: %s, Output: %s", err, output)
+		return workspaceError(fmt.Errorf("Error running `workspace delete`: %s, Output: %s", err, output), output)
 	}
 
 	return nil
@@ -611,7 +1518,7 @@ func (c *client) WorkspaceDeleteWithForce(envName string) error {
 		"workspace",
 		"delete",
 		"-force",
-		envName,
+		c.workspaceName(envName),
 	}, []string{
 		fmt.Sprintf("TF_WORKSPACE=%s", defaultWorkspace),
 	})
@@ -628,7 +1535,7 @@ func (c *client) StatePull(envName string) ([]byte, error) {
 		"state",
 		"pull",
 	}, []string{
-		fmt.Sprintf("TF_WORKSPACE=%s", envName),
+		fmt.Sprintf("TF_WORKSPACE=%s", c.workspaceName(envName)),
 	})
 
 	rawOutput, err := cmd.Output()
@@ -643,11 +1550,67 @@ func (c *client) StatePull(envName string) ([]byte, error) {
 	return rawOutput, nil
 }
 
+func (c *client) StatePush(envName string, stateFilePath string) error {
+	return c.runStateCmd(envName, "state push", []string{"state", "push"}, stateFilePath)
+}
+
+func (c *client) StateMv(envName string, from string, to string) error {
+	c.logWriter.Write([]byte(fmt.Sprintf("Moving `%s` to `%s`...\n", from, to)))
+	return c.runStateCmd(envName, "state mv", []string{"state", "mv"}, from, to)
+}
+
+func (c *client) StateRm(envName string, address string) error {
+	c.logWriter.Write([]byte(fmt.Sprintf("Removing `%s` from the statefile...\n", address)))
+	return c.runStateCmd(envName, "state rm", []string{"state", "rm"}, address)
+}
+
+func (c *client) Taint(envName string, address string) error {
+	c.logWriter.Write([]byte(fmt.Sprintf("Tainting `%s`...\n", address)))
+	return c.runStateCmd(envName, "taint", []string{"taint"}, address)
+}
+
+// ForceUnlock releases the lock with the given ID on the state of the
+// selected workspace, see `force_unlock`
+func (c *client) ForceUnlock(lockID string) error {
+	c.logWriter.Write([]byte(fmt.Sprintf("Force unlocking the state lock '%s'...\n", lockID)))
+	cmd := c.terraformCmd([]string{
+		"force-unlock",
+		"-force",
+		shellQuote(lockID),
+	}, nil)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Error running `force-unlock`: %s, Output: %s", err, output)
+	}
+	return nil
+}
+
+func (c *client) runStateCmd(envName string, name string, subcommand []string, addresses ...string) error {
+	args := append(subcommand, c.lockArgs()...)
+	args = append(args, c.lockTimeoutArgs()...)
+	// addresses such as aws_instance.web["a"] would otherwise be mangled by sh
+	for _, address := range addresses {
+		args = append(args, shellQuote(address))
+	}
+
+	cmd := c.terraformCmd(args, []string{
+		fmt.Sprintf("TF_WORKSPACE=%s", c.workspaceName(envName)),
+	})
+	rawOutput, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running `%s`: %s, Output: %s", name, err, rawOutput)
+	}
+
+	return nil
+}
+
 func (c *client) CurrentStateVersion(envName string) (StateVersion, error) {
 	rawState, err := c.StatePull(envName)
 	if err != nil {
 		return StateVersion{}, err
 	}
+	if len(bytes.TrimSpace(rawState)) == 0 {
+		return StateVersion{Empty: true}, nil
+	}
 
 	tfState := map[string]interface{}{}
 	if err = json.Unmarshal(rawState, &tfState); err != nil {
@@ -678,6 +1641,10 @@ func (c *client) SavePlanToBackend(planEnvName string) error {
 	if err != nil {
 		return err
 	}
+	planContentsText, err := ioutil.ReadFile(c.model.TextPlanFileLocalPath)
+	if err != nil {
+		return err
+	}
 
 	tmpDir, err := ioutil.TempDir("", "tf-resource-plan")
 	if err != nil {
@@ -712,7 +1679,7 @@ func (c *client) SavePlanToBackend(planEnvName string) error {
 		c.logWriter = origLogger
 	}()
 
-	err = c.writePlanProviderConfig(tmpDir, planContents, planContentsJSON)
+	err = c.writePlanProviderConfig(tmpDir, planContents, planContentsJSON, planContentsText)
 	if err != nil {
 		return err
 	}
@@ -765,16 +1732,16 @@ func (c *client) GetPlanFromBackend(planEnvName string) error {
 }
 
 func (c *client) SetModel(model models.Terraform) {
-	c.model = model
+	c.model = resolvePaths(model)
 }
 
 func (c *client) resourceExists(tfID string, envName string) (bool, error) {
 	cmd := c.terraformCmd([]string{
 		"state",
 		"list",
-		tfID,
+		shellQuote(tfID),
 	}, []string{
-		fmt.Sprintf("TF_WORKSPACE=%s", envName),
+		fmt.Sprintf("TF_WORKSPACE=%s", c.workspaceName(envName)),
 	})
 	rawOutput, err := cmd.Output()
 	if err != nil {
@@ -794,7 +1761,7 @@ func (c *client) resourceExistsLegacyStorage(tfID string) (bool, error) {
 		"state",
 		"list",
 		fmt.Sprintf("-state=%s", c.model.StateFileLocalPath),
-		tfID,
+		shellQuote(tfID),
 	}, nil)
 	rawOutput, err := cmd.Output()
 	if err != nil {
@@ -805,8 +1772,32 @@ func (c *client) resourceExistsLegacyStorage(tfID string) (bool, error) {
 	return (len(strings.TrimSpace(string(rawOutput))) > 0), nil
 }
 
+// binaryPath is quoted for the shell, the default `terraform` is looked up on $PATH
+func (c *client) binaryPath() string {
+	if c.model.TerraformBinaryPath == "" {
+		return "terraform"
+	}
+	return shellQuote(c.model.TerraformBinaryPath)
+}
+
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
 func (c *client) terraformCmd(args []string, env []string) *exec.Cmd {
-	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf("terraform %s", strings.Join(args, " ")))
+	return c.terraformCmdContext(context.Background(), args, env)
+}
+
+func (c *client) terraformCmdContext(ctx context.Context, args []string, env []string) *exec.Cmd {
+	// exec replaces the shell so cancelling ctx signals terraform itself
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", fmt.Sprintf("exec %s %s", c.binaryPath(), strings.Join(args, " ")))
+	// an interrupt lets terraform finish in-flight operations, persist the
+	// state and release the lock, it is only killed if it hasn't exited
+	// after the grace period
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = interruptGracePeriod
 
 	cmd.Dir = c.model.Source
 	cmd.Env = os.Environ()
@@ -817,6 +1808,9 @@ func (c *client) terraformCmd(args []string, env []string) *exec.Cmd {
 	// To control terraform output in automation.
 	// As suggested in https://learn.hashicorp.com/terraform/development/running-terraform-in-automation#controlling-terraform-output-in-automation
 	cmd.Env = append(cmd.Env, "TF_IN_AUTOMATION=1")
+	if pluginCacheDir := c.pluginCacheDir(); pluginCacheDir != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("TF_PLUGIN_CACHE_DIR=%s", pluginCacheDir))
+	}
 	for _, e := range env {
 		cmd.Env = append(cmd.Env, e)
 	}
@@ -825,5 +1819,11 @@ func (c *client) terraformCmd(args []string, env []string) *exec.Cmd {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
 	}
 
+	// appended last so `vars` override the build metadata vars, as they do
+	// when written to a var file
+	for key, value := range c.model.VarsEnv {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
 	return cmd
 }
@@ -0,0 +1,1417 @@
+package terraform_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+
+	var (
+		tmpDir       string
+		argsFilePath string
+		originalPath string
+		model        models.Terraform
+	)
+
+	// installs a fake `terraform` binary which prints the `version` file, or
+	// v1.5.7, for `-v`, otherwise records its args and
+	// TF_WORKSPACE, prints the contents of the `stdout` file if present,
+	// runs the `init.sh` file for `init` if present, sleeps for the
+	// number of seconds in the `sleep` file if present, and exits 1 after
+	// printing the `stderr` file the number of times in `fail_times`
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-client-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		argsFilePath = path.Join(tmpDir, "args")
+		fakeTerraform := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = "-v" ]; then
+  if [ -f %[1]s/version ]; then cat %[1]s/version; else echo "Terraform v1.5.7"; fi
+  exit 0
+fi
+echo "$@" > %[1]s/args
+echo "$1" >> %[1]s/calls
+if [ -f %[1]s/fail_times ] && [ "$(cat %[1]s/fail_times)" -gt 0 ]; then
+  echo $(($(cat %[1]s/fail_times) - 1)) > %[1]s/fail_times
+  cat %[1]s/stderr >&2
+  exit 1
+fi
+echo "$TF_WORKSPACE" > %[1]s/tf_workspace
+echo "$FAKE_CREDENTIAL" > %[1]s/fake_credential
+echo "$TF_VAR_region" > %[1]s/tf_var_region
+echo "$TF_PLUGIN_CACHE_DIR" > %[1]s/tf_plugin_cache_dir
+if [ "$1" = "init" ] && [ -f %[1]s/init.sh ]; then sh %[1]s/init.sh "$@" || exit 1; fi
+if [ -f %[1]s/stdout ]; then cat %[1]s/stdout; fi
+if [ -f %[1]s/sleep ]; then exec sleep "$(cat %[1]s/sleep)"; fi
+`, tmpDir)
+		err = ioutil.WriteFile(path.Join(tmpDir, "terraform"), []byte(fakeTerraform), 0755)
+		Expect(err).ToNot(HaveOccurred())
+
+		originalPath = os.Getenv("PATH")
+		Expect(os.Setenv("PATH", fmt.Sprintf("%s:%s", tmpDir, originalPath))).To(Succeed())
+
+		model = models.Terraform{
+			Source:             tmpDir,
+			StateFileLocalPath: path.Join(tmpDir, "terraform.tfstate"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.Setenv("PATH", originalPath)).To(Succeed())
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	recordedArgs := func() []string {
+		contents, err := ioutil.ReadFile(argsFilePath)
+		Expect(err).ToNot(HaveOccurred())
+		return strings.Fields(string(contents))
+	}
+
+	recordedWorkspaceEnv := func() string {
+		contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_workspace"))
+		Expect(err).ToNot(HaveOccurred())
+		return strings.TrimSpace(string(contents))
+	}
+
+	fakeStdout := func(stdout string) {
+		err := ioutil.WriteFile(path.Join(tmpDir, "stdout"), []byte(stdout), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Describe("#Apply", func() {
+		It("does not pass -parallelism by default", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()[0]).To(Equal("apply"))
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-parallelism"))
+		})
+
+		It("passes -parallelism if Parallelism is set", func() {
+			model.Parallelism = 3
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-parallelism=3"))
+		})
+
+		It("passes a -replace flag per replace address", func() {
+			model.Replace = []string{"aws_instance.a", "module.network.aws_vpc.main"}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElements("-replace=aws_instance.a", "-replace=module.network.aws_vpc.main"))
+		})
+
+		It("passes -target and -replace addresses with string index keys through the shell unchanged", func() {
+			model.Targets = []string{`aws_instance.x["a"]`}
+			model.Replace = []string{`aws_instance.x["it's"]`}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElements(`-target=aws_instance.x["a"]`, `-replace=aws_instance.x["it's"]`))
+		})
+
+		It("does not pass -replace when applying a saved plan", func() {
+			model.Replace = []string{"aws_instance.a"}
+			model.PlanRun = true
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-replace"))
+		})
+
+		It("reads the applied changes from the JSON output and logs its messages", func() {
+			fakeStdout(`{"@level":"info","@message":"Terraform 1.5.7","type":"version"}
+{"@level":"info","@message":"Apply complete! Resources: 2 added, 1 changed, 3 destroyed.","type":"change_summary","changes":{"add":2,"change":1,"remove":3,"operation":"apply"}}
+`)
+			logWriter := &bytes.Buffer{}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-json"))
+			Expect(client.AppliedChanges()).To(Equal(&terraform.AppliedChanges{Add: 2, Change: 1, Destroy: 3}))
+			Expect(logWriter.String()).To(ContainSubstring("Apply complete! Resources: 2 added, 1 changed, 3 destroyed.\n"))
+			Expect(logWriter.String()).ToNot(ContainSubstring(`"@level"`))
+		})
+
+		It("applies without -json and reports no changes before Terraform 0.15.3", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "version"), []byte("Terraform v0.15.2\non linux_amd64\n"), 0644)).To(Succeed())
+			fakeStdout("Apply complete! Resources: 2 added, 1 changed, 3 destroyed.\n")
+			logWriter := &bytes.Buffer{}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()[0]).To(Equal("apply"))
+			Expect(recordedArgs()).ToNot(ContainElement("-json"))
+			Expect(client.AppliedChanges()).To(BeNil())
+			Expect(logWriter.String()).To(ContainSubstring("Apply complete! Resources: 2 added, 1 changed, 3 destroyed.\n"))
+		})
+
+		It("returns no applied changes if terraform reported none", func() {
+			fakeStdout("not json\n")
+			logWriter := &bytes.Buffer{}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(client.AppliedChanges()).To(BeNil())
+			Expect(logWriter.String()).To(ContainSubstring("not json\n"))
+		})
+	})
+
+	Describe("VarsEnv", func() {
+		It("exports the vars to terraform, overriding the same var in Env", func() {
+			model.Env = map[string]string{"TF_VAR_region": "build-region"}
+			model.VarsEnv = map[string]string{"TF_VAR_region": "us-east-1"}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_var_region"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal("us-east-1"))
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-var-file"))
+		})
+	})
+
+	Describe("retrying transient errors", func() {
+		failWith := func(times int, stderr string) {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "fail_times"), []byte(fmt.Sprint(times)), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte(stderr), 0644)).To(Succeed())
+		}
+
+		callCount := func() int {
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "calls"))
+			Expect(err).ToNot(HaveOccurred())
+			return len(strings.Fields(string(contents)))
+		}
+
+		BeforeEach(func() {
+			model.MaxRetries = 2
+			model.RetryDelay = "1ms"
+		})
+
+		It("retries apply after a transient backend error", func() {
+			failWith(2, "Error: RequestError: send request failed\ncaused by: dial tcp: i/o timeout")
+			logWriter := &bytes.Buffer{}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(callCount()).To(Equal(3))
+			Expect(logWriter.String()).To(ContainSubstring("terraform apply failed with a transient error, retrying in 1ms (retry 1 of 2)"))
+			Expect(logWriter.String()).To(ContainSubstring("retrying in 2ms (retry 2 of 2)"))
+		})
+
+		It("retries destroy after a transient backend error", func() {
+			failWith(1, "Error: TooManyRequests")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(context.Background())).To(Succeed())
+
+			Expect(callCount()).To(Equal(2))
+		})
+
+		It("returns the original error once retries are exhausted", func() {
+			failWith(5, "Error: RequestError: send request failed")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.Apply()
+
+			Expect(err).To(MatchError("Failed to run Terraform command: exit status 1"))
+			Expect(callCount()).To(Equal(3))
+		})
+
+		It("does not retry other errors", func() {
+			failWith(5, "Error: Invalid reference")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(MatchError("Failed to run Terraform command: exit status 1"))
+
+			Expect(callCount()).To(Equal(1))
+		})
+
+		It("retries the plan of refresh_only after a transient backend error", func() {
+			failWith(1, "Error: RequestError: send request failed")
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stdout"), []byte(`{}`), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.RefreshOnly()
+			Expect(err).ToNot(HaveOccurred())
+
+			// plan, plan, show, apply
+			Expect(callCount()).To(Equal(4))
+		})
+
+		It("does not retry by default", func() {
+			model.MaxRetries = 0
+			failWith(5, "Error: RequestError: send request failed")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).ToNot(Succeed())
+
+			Expect(callCount()).To(Equal(1))
+		})
+	})
+
+	Describe("state locks", func() {
+		lockedStderr := `
+│ Error: Error acquiring the state lock
+│
+│ Error message: ConditionalCheckFailedException: The conditional request failed
+│ Lock Info:
+│   ID:        9a4c1b0e-5d3f-4a8e-b1f2-0c6d7e8f9a0b
+│   Path:      tfstate-bucket/env:/staging/terraform.tfstate
+│   Operation: OperationTypeApply
+│   Who:       root@7f3c2a1b
+│   Version:   1.5.7
+│   Created:   2024-03-01 12:00:00.000000000 +0000 UTC
+│   Info:
+│
+│ Terraform acquires a state lock to protect the state from being written
+│ by multiple users at the same time.
+`
+
+		failWith := func(stderr string) {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "fail_times"), []byte("1"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte(stderr), 0644)).To(Succeed())
+		}
+
+		It("returns a StateLockedError with the lock info if apply can't acquire the lock", func() {
+			failWith(lockedStderr)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.Apply()
+
+			var lockErr *terraform.StateLockedError
+			Expect(errors.As(err, &lockErr)).To(BeTrue())
+			Expect(lockErr.ID).To(Equal("9a4c1b0e-5d3f-4a8e-b1f2-0c6d7e8f9a0b"))
+			Expect(lockErr.Path).To(Equal("tfstate-bucket/env:/staging/terraform.tfstate"))
+			Expect(lockErr.Who).To(Equal("root@7f3c2a1b"))
+			Expect(lockErr.HeldForWorkspace("staging")).To(BeTrue())
+			Expect(lockErr.HeldForWorkspace("staging-plan")).To(BeFalse())
+			Expect(lockErr.HeldForWorkspace("stag")).To(BeFalse())
+			Expect(err).To(MatchError("Failed to run Terraform command: exit status 1"))
+		})
+
+		It("returns a StateLockedError if plan can't acquire the lock", func() {
+			failWith(lockedStderr)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, _, err := client.Plan()
+
+			var lockErr *terraform.StateLockedError
+			Expect(errors.As(err, &lockErr)).To(BeTrue())
+			Expect(lockErr.ID).To(Equal("9a4c1b0e-5d3f-4a8e-b1f2-0c6d7e8f9a0b"))
+		})
+
+		It("returns a StateLockedError if refresh_only can't acquire the lock", func() {
+			failWith(lockedStderr)
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.RefreshOnly()
+
+			var lockErr *terraform.StateLockedError
+			Expect(errors.As(err, &lockErr)).To(BeTrue())
+			Expect(lockErr.ID).To(Equal("9a4c1b0e-5d3f-4a8e-b1f2-0c6d7e8f9a0b"))
+		})
+
+		It("returns other errors unchanged", func() {
+			failWith("Error: Invalid reference")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.Apply()
+
+			var lockErr *terraform.StateLockedError
+			Expect(errors.As(err, &lockErr)).To(BeFalse())
+		})
+
+		It("force unlocks the given lock ID", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.ForceUnlock("9a4c1b0e")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"force-unlock", "-force", "9a4c1b0e"}))
+		})
+	})
+
+	Context("when TerraformBinaryPath is set", func() {
+		It("runs that binary instead of terraform from $PATH", func() {
+			binDir := path.Join(tmpDir, "custom bin")
+			Expect(os.Mkdir(binDir, 0755)).To(Succeed())
+			customArgsPath := path.Join(tmpDir, "custom_args")
+			customTerraform := fmt.Sprintf("#!/bin/sh\necho \"$@\" > '%s'\n", customArgsPath)
+			binaryPath := path.Join(binDir, "terraform-1.7.0")
+			Expect(ioutil.WriteFile(binaryPath, []byte(customTerraform), 0755)).To(Succeed())
+			model.TerraformBinaryPath = binaryPath
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			contents, err := ioutil.ReadFile(customArgsPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Fields(string(contents))[0]).To(Equal("apply"))
+			Expect(argsFilePath).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("UseTerraformVersion", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stdout"), []byte("Terraform v1.5.7\non linux_amd64\n"), 0644)).To(Succeed())
+			model.DownloadCachePath = path.Join(tmpDir, "cache")
+		})
+
+		It("keeps the bundled binary if it is the requested version", func() {
+			model.TerraformVersion = "1.5.7"
+
+			resolved, err := terraform.UseTerraformVersion(model, nil, &bytes.Buffer{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolved.TerraformBinaryPath).To(BeEmpty())
+		})
+
+		It("uses a cached release if the bundled binary is another version", func() {
+			model.TerraformVersion = "1.3.0"
+			binaryPath := path.Join(tmpDir, "cache", "terraform", "1.3.0", "terraform")
+			Expect(os.MkdirAll(filepath.Dir(binaryPath), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(binaryPath, []byte("#!/bin/sh\necho 'Terraform v1.3.0'\n"), 0755)).To(Succeed())
+			logWriter := &bytes.Buffer{}
+
+			resolved, err := terraform.UseTerraformVersion(model, nil, logWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolved.TerraformBinaryPath).To(Equal(binaryPath))
+			Expect(logWriter.String()).To(ContainSubstring("Using terraform 1.3.0"))
+
+			version, err := terraform.NewClient(resolved, &bytes.Buffer{}).Version()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(ContainSubstring("Terraform v1.3.0"))
+		})
+
+		It("does nothing if no version is requested", func() {
+			resolved, err := terraform.UseTerraformVersion(model, nil, &bytes.Buffer{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolved).To(Equal(model))
+			Expect(path.Join(tmpDir, "calls")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("#InitWithBackend with BackendConfigFile", func() {
+		var (
+			configFile        string
+			generatedConfig   string
+			backendConfigArgs func() []string
+		)
+
+		BeforeEach(func() {
+			model.BackendType = "remote"
+			configFile = path.Join(tmpDir, "backend config", "remote.hcl")
+			Expect(os.MkdirAll(path.Dir(configFile), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(configFile, []byte("organization = \"acme\"\nworkspaces { prefix = \"app-\" }\n"), 0644)).To(Succeed())
+			generatedConfig = path.Join(tmpDir, "resource_backend_config.json")
+
+			// the fake records args split on whitespace, so rejoin them
+			backendConfigArgs = func() []string {
+				args := []string{}
+				for _, arg := range strings.Split(strings.Join(recordedArgs(), " "), " -") {
+					if strings.HasPrefix(arg, "backend-config=") {
+						args = append(args, "-"+arg)
+					}
+				}
+				return args
+			}
+		})
+
+		It("passes only the generated backend_config by default", func() {
+			model.BackendConfig = map[string]interface{}{"organization": "acme"}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(backendConfigArgs()).To(Equal([]string{"-backend-config=" + generatedConfig}))
+		})
+
+		It("passes the file instead of the generated backend_config", func() {
+			model.BackendConfigFile = configFile
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(backendConfigArgs()).To(Equal([]string{"-backend-config=" + configFile}))
+		})
+
+		It("passes backend_config after the file so its values take precedence", func() {
+			model.BackendConfigFile = configFile
+			model.BackendConfig = map[string]interface{}{"token": "fake-token"}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(backendConfigArgs()).To(Equal([]string{
+				"-backend-config=" + configFile,
+				"-backend-config=" + generatedConfig,
+			}))
+		})
+
+		It("passes backend_config_files in order after backend_config_file and before backend_config", func() {
+			otherFile := path.Join(tmpDir, "backend config", "region.hcl")
+			Expect(ioutil.WriteFile(otherFile, []byte("region = \"eu-west-1\"\n"), 0644)).To(Succeed())
+			model.BackendConfigFile = configFile
+			model.BackendConfigFiles = []string{otherFile, configFile}
+			model.BackendConfig = map[string]interface{}{"token": "fake-token"}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(backendConfigArgs()).To(Equal([]string{
+				"-backend-config=" + configFile,
+				"-backend-config=" + otherFile,
+				"-backend-config=" + configFile,
+				"-backend-config=" + generatedConfig,
+			}))
+		})
+
+		It("passes only backend_config_files without backend_config", func() {
+			model.BackendConfigFiles = []string{configFile}
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(backendConfigArgs()).To(Equal([]string{"-backend-config=" + configFile}))
+		})
+
+		It("resolves a relative path from the current dir", func() {
+			wd, err := os.Getwd()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Chdir(tmpDir)).To(Succeed())
+			defer os.Chdir(wd)
+			model.BackendConfigFile = path.Join("backend config", "remote.hcl")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			resolvedTmpDir, err := filepath.EvalSymlinks(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backendConfigArgs()).To(Or(
+				Equal([]string{"-backend-config=" + configFile}),
+				Equal([]string{"-backend-config=" + path.Join(resolvedTmpDir, "backend config", "remote.hcl")}),
+			))
+		})
+	})
+
+	Describe("#InitWithBackend with InitUpgrade", func() {
+		BeforeEach(func() {
+			model.BackendType = "s3"
+		})
+
+		It("does not upgrade by default", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("init"))
+			Expect(recordedArgs()).ToNot(ContainElement("-upgrade"))
+		})
+
+		It("passes -upgrade to init", func() {
+			model.InitUpgrade = true
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("init"))
+			Expect(recordedArgs()).To(ContainElement("-upgrade"))
+		})
+	})
+
+	Describe("#InitWithBackend after a change of backend", func() {
+		var (
+			logWriter *bytes.Buffer
+			initArgs  func() []string
+		)
+
+		BeforeEach(func() {
+			logWriter = &bytes.Buffer{}
+			// the lineage is checked by a `state pull` after init
+			initScript := fmt.Sprintf(`echo "$@" > %s/init_args`, tmpDir)
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "init.sh"), []byte(initScript), 0644)).To(Succeed())
+			initArgs = func() []string {
+				contents, err := ioutil.ReadFile(path.Join(tmpDir, "init_args"))
+				Expect(err).ToNot(HaveOccurred())
+				return strings.Fields(string(contents))
+			}
+			Expect(os.MkdirAll(path.Join(tmpDir, ".terraform"), 0755)).To(Succeed())
+			previousBackend := `{"backend": {"type": "s3", "config": {"bucket": "old-bucket"}}}`
+			Expect(ioutil.WriteFile(path.Join(tmpDir, ".terraform", "terraform.tfstate"), []byte(previousBackend), 0644)).To(Succeed())
+			fakeStdout(`{"lineage": "some-lineage"}`)
+
+			model.BackendType = "gcs"
+			model.BackendConfig = map[string]interface{}{"bucket": "new-bucket"}
+		})
+
+		It("refuses to continue without approval", func() {
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(MatchError(ContainSubstring("the backend configuration has changed")))
+			Expect(client.BackendChange()).To(BeNil())
+		})
+
+		It("migrates the state, warns, and reports the change", func() {
+			model.ApproveBackendChange = true
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(initArgs()).To(ContainElement("-migrate-state"))
+			Expect(initArgs()).To(ContainElement("-force-copy"))
+			Expect(client.BackendChange()).To(Equal(&terraform.BackendChange{
+				PreviousType: "s3",
+				Type:         "gcs",
+				Mode:         models.BackendChangeMigrateState,
+			}))
+			Expect(logWriter.String()).To(ContainSubstring("Backend Changed"))
+			Expect(logWriter.String()).To(ContainSubstring("Migrated state from the 's3' backend to the 'gcs' backend"))
+		})
+
+		It("reports a reconfigure", func() {
+			model.ApproveBackendChange = true
+			model.BackendChangeMode = models.BackendChangeReconfigure
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(initArgs()).To(ContainElement("-reconfigure"))
+			Expect(client.BackendChange().Mode).To(Equal(models.BackendChangeReconfigure))
+			Expect(logWriter.String()).To(ContainSubstring("without copying state"))
+		})
+
+		It("reports no change when the backend is the same", func() {
+			model.BackendType = "s3"
+			model.BackendConfig = map[string]interface{}{"bucket": "old-bucket"}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(initArgs()).ToNot(ContainElement("-migrate-state"))
+			Expect(client.BackendChange()).To(BeNil())
+			Expect(logWriter.String()).ToNot(ContainSubstring("Backend Changed"))
+		})
+	})
+
+	Describe("#InitWithBackend with PluginCacheDir", func() {
+		var (
+			cacheDir  string
+			logWriter *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			cacheDir = path.Join(tmpDir, "plugin-cache")
+			model.BackendType = "s3"
+			model.PluginCacheDir = cacheDir
+			logWriter = &bytes.Buffer{}
+
+			// simulates Terraform only downloading providers missing from the cache
+			initScript := fmt.Sprintf(`
+if [ ! -f "$TF_PLUGIN_CACHE_DIR/hashicorp/aws/5.0.0/terraform-provider-aws" ]; then
+  mkdir -p "$TF_PLUGIN_CACHE_DIR/hashicorp/aws/5.0.0"
+  echo provider > "$TF_PLUGIN_CACHE_DIR/hashicorp/aws/5.0.0/terraform-provider-aws"
+  echo hashicorp/aws >> %s/downloads
+fi
+`, tmpDir)
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "init.sh"), []byte(initScript), 0644)).To(Succeed())
+		})
+
+		freshInit := func() {
+			Expect(os.RemoveAll(path.Join(tmpDir, ".terraform"))).To(Succeed())
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(Succeed(), "Logs: %s", logWriter.String())
+		}
+
+		It("creates the dir and sets TF_PLUGIN_CACHE_DIR", func() {
+			freshInit()
+
+			Expect(cacheDir).To(BeADirectory())
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_plugin_cache_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal(cacheDir))
+		})
+
+		It("takes precedence over DownloadCachePath", func() {
+			model.DownloadCachePath = path.Join(tmpDir, "download-cache")
+			freshInit()
+
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_plugin_cache_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal(cacheDir))
+		})
+
+		It("reuses the providers cached by a previous init without downloading them again", func() {
+			freshInit()
+			freshInit()
+
+			downloads, err := ioutil.ReadFile(path.Join(tmpDir, "downloads"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(downloads))).To(Equal("hashicorp/aws"))
+		})
+
+		It("keeps existing contents of the dir", func() {
+			Expect(os.MkdirAll(path.Join(cacheDir, "other-build"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(cacheDir, "other-build", "provider"), []byte("in use"), 0644)).To(Succeed())
+
+			freshInit()
+
+			Expect(path.Join(cacheDir, "other-build", "provider")).To(BeARegularFile())
+		})
+
+		It("resolves a relative dir against the current dir", func() {
+			wd, err := os.Getwd()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Chdir(tmpDir)).To(Succeed())
+			defer os.Chdir(wd)
+			model.PluginCacheDir = "relative-cache"
+
+			freshInit()
+
+			Expect(path.Join(tmpDir, "relative-cache")).To(BeADirectory())
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_plugin_cache_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal(path.Join(tmpDir, "relative-cache")))
+		})
+	})
+
+	Describe("#InitWithBackend with DownloadCachePath", func() {
+		var (
+			cacheDir   string
+			logWriter  *bytes.Buffer
+			modulePath string
+		)
+
+		BeforeEach(func() {
+			cacheDir = path.Join(tmpDir, "cache")
+			modulePath = path.Join(tmpDir, ".terraform", "modules", "vpc", "main.tf")
+			model.BackendType = "s3"
+			model.DownloadCachePath = cacheDir
+			logWriter = &bytes.Buffer{}
+
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "main.tf"), []byte(`module "vpc" {}`), 0644)).To(Succeed())
+
+			// simulates downloading a registry module, fails if asked to init
+			// offline without the module installed
+			initScript := `
+case "$*" in
+*-get=true*)
+  mkdir -p .terraform/modules/vpc
+  echo 'variable "cidr" {}' > .terraform/modules/vpc/main.tf
+  echo '{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"3.0.0","Dir":".terraform/modules/vpc"}]}' > .terraform/modules/modules.json
+  ;;
+*)
+  test -f .terraform/modules/vpc/main.tf || exit 1
+  ;;
+esac
+`
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "init.sh"), []byte(initScript), 0644)).To(Succeed())
+		})
+
+		freshInit := func() {
+			Expect(os.RemoveAll(path.Join(tmpDir, ".terraform"))).To(Succeed())
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.InitWithBackend()).To(Succeed(), "Logs: %s", logWriter.String())
+		}
+
+		It("sets TF_PLUGIN_CACHE_DIR", func() {
+			freshInit()
+
+			contents, err := ioutil.ReadFile(path.Join(tmpDir, "tf_plugin_cache_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal(path.Join(cacheDir, "plugins")))
+			Expect(path.Join(cacheDir, "plugins")).To(BeADirectory())
+		})
+
+		It("downloads modules on a miss and restores them offline on a hit", func() {
+			freshInit()
+			Expect(recordedArgs()).To(ContainElement("-get=true"))
+			Expect(logWriter.String()).To(ContainSubstring("0 module(s) restored from `download_cache_path`, 1 downloaded"))
+
+			logWriter.Reset()
+			freshInit()
+			Expect(recordedArgs()).To(ContainElement("-get=false"))
+			Expect(logWriter.String()).To(ContainSubstring("1 module(s) restored from `download_cache_path`, 0 downloaded"))
+			Expect(modulePath).To(BeARegularFile())
+		})
+
+		It("downloads again when the config changes", func() {
+			freshInit()
+
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "main.tf"), []byte(`module "vpc" { cidr = "10.0.0.0/16" }`), 0644)).To(Succeed())
+			freshInit()
+			Expect(recordedArgs()).To(ContainElement("-get=true"))
+		})
+
+		It("detects a corrupt module and repairs it by downloading again", func() {
+			freshInit()
+
+			cachedFiles, err := filepath.Glob(path.Join(cacheDir, "modules", "*", "main.tf"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cachedFiles).To(HaveLen(1))
+			Expect(ioutil.WriteFile(cachedFiles[0], []byte("corrupted"), 0644)).To(Succeed())
+
+			logWriter.Reset()
+			freshInit()
+			Expect(recordedArgs()).To(ContainElement("-get=true"))
+			Expect(logWriter.String()).To(ContainSubstring("0 module(s) restored from `download_cache_path`, 1 downloaded"))
+
+			freshInit()
+			Expect(recordedArgs()).To(ContainElement("-get=false"))
+			contents, err := ioutil.ReadFile(modulePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("cidr"))
+		})
+	})
+
+	Describe("#Validate", func() {
+		It("succeeds and logs warnings for a valid config", func() {
+			fakeStdout(`{"valid": true, "error_count": 0, "warning_count": 1, "diagnostics": [
+				{"severity": "warning", "summary": "Deprecated attribute", "detail": "Use tags_all instead."}
+			]}`)
+			logWriter := &bytes.Buffer{}
+
+			client := terraform.NewClient(model, logWriter)
+			Expect(client.Validate()).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"validate", "-json", "-no-color"}))
+			Expect(logWriter.String()).To(ContainSubstring("Warning: Deprecated attribute\n  Use tags_all instead."))
+		})
+
+		It("returns the decoded errors for an invalid config", func() {
+			fakeStdout(`{"valid": false, "error_count": 1, "warning_count": 0, "diagnostics": [
+				{
+					"severity": "error",
+					"summary": "Unsupported argument",
+					"detail": "An argument named \"amii\" is not expected here.",
+					"range": {"filename": "main.tf", "start": {"line": 3, "column": 3}}
+				}
+			]}`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.Validate()
+
+			Expect(err).To(MatchError(
+				"Terraform configuration is invalid:\n\nError: Unsupported argument\n  on main.tf line 3\n  An argument named \"amii\" is not expected here."))
+		})
+
+		It("returns the raw output if it is not JSON", func() {
+			fakeStdout("Terraform crashed!")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.Validate()
+
+			Expect(err).To(MatchError(ContainSubstring("Terraform crashed!")))
+		})
+	})
+
+	Describe("state manipulation", func() {
+		It("runs state mv in the env's workspace", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.StateMv("staging", "aws_instance.old", "aws_instance.new")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"state", "mv", "aws_instance.old", "aws_instance.new"}))
+			Expect(recordedWorkspaceEnv()).To(Equal("staging"))
+		})
+
+		It("passes addresses with quotes and spaces through the shell intact", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.StateMv("staging", `aws_instance.web["a b"]`, `module.web.aws_instance.this["a"]`)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(argsFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(contents))).To(Equal(`state mv aws_instance.web["a b"] module.web.aws_instance.this["a"]`))
+		})
+
+		It("runs state rm with the lock args", func() {
+			model.LockTimeout = "10m"
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.StateRm("staging", "aws_instance.old")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"state", "rm", "-lock-timeout=10m", "aws_instance.old"}))
+		})
+
+		It("runs state push with the lock args", func() {
+			model.LockTimeout = "10m"
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.StatePush("staging", "/tmp/tagged.tfstate")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"state", "push", "-lock-timeout=10m", "/tmp/tagged.tfstate"}))
+			Expect(recordedWorkspaceEnv()).To(Equal("staging"))
+		})
+
+		It("reports the state version", func() {
+			fakeStdout(`{"serial": 3, "lineage": "some-lineage"}`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			version, err := client.CurrentStateVersion("staging")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(version).To(Equal(terraform.StateVersion{Serial: 3, Lineage: "some-lineage"}))
+		})
+
+		It("reports an empty state version if the workspace has no state", func() {
+			fakeStdout("\n")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			version, err := client.CurrentStateVersion("staging")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(version).To(Equal(terraform.StateVersion{Empty: true}))
+		})
+
+		It("runs taint", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Taint("staging", "aws_instance.web")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"taint", "aws_instance.web"}))
+		})
+	})
+
+	Describe("#Output", func() {
+		// a provider bug once wrote a string output which wasn't valid UTF-8
+		invalidUTF8Output := "{\"name\": {\"value\": \"caf\xe9\", \"type\": \"string\"}}"
+
+		It("leaves checking for invalid UTF-8 to the get", func() {
+			fakeStdout(invalidUTF8Output)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			outputs, err := client.Output("some-env")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(outputs["name"]["value"]).To(Equal("caf\uFFFD"))
+		})
+
+		It("returns a single output value", func() {
+			fakeStdout(`["item-1", "item-2"]`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			value, err := client.OutputValue("some-env", "list")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]interface{}{"item-1", "item-2"}))
+			Expect(recordedArgs()).To(Equal([]string{"output", "-json", "list"}))
+			Expect(recordedWorkspaceEnv()).To(Equal("some-env"))
+		})
+
+		It("returns an error if a single output value contains invalid UTF-8", func() {
+			fakeStdout("\"caf\xe9\"")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.OutputValue("some-env", "name")
+			Expect(err).To(MatchError(ContainSubstring("Failed to unmarshal JSON output 'name'")))
+		})
+	})
+
+	Context("when PluginDir is set", func() {
+		BeforeEach(func() {
+			model.PluginDir = "plugins"
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "fail_times"), []byte("1"), 0644)).To(Succeed())
+		})
+
+		It("mentions the plugin_dir when init can't resolve a provider", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte("Error: Failed to query available provider packages"), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.InitWithoutBackend()
+			Expect(err).To(MatchError(ContainSubstring("Providers are only installed from `plugin_dir` 'plugins'")))
+			Expect(recordedArgs()).To(ContainElement("-plugin-dir=plugins"))
+		})
+
+		It("mentions the plugin_dir when init with a backend can't resolve a provider", func() {
+			model.BackendType = "s3"
+			model.DownloadPlugins = true
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte("Error: Failed to install provider"), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.InitWithBackend()
+			Expect(err).To(MatchError(ContainSubstring("Providers are only installed from `plugin_dir` 'plugins'")))
+		})
+
+		It("does not mention the plugin_dir for other init errors", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte("Error: Invalid backend configuration"), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.InitWithoutBackend()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).ToNot(ContainSubstring("plugin_dir"))
+		})
+	})
+
+	Describe("#Plan", func() {
+		// a fake `terraform plan -detailed-exitcode` which exits with the code in `exit_code`
+		withExitCode := func(exitCode int) {
+			binaryPath := path.Join(tmpDir, "terraform-exit-code")
+			script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > '%s'\nexit %d\n", argsFilePath, exitCode)
+			Expect(ioutil.WriteFile(binaryPath, []byte(script), 0755)).To(Succeed())
+			model.TerraformBinaryPath = binaryPath
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(model.PlanFileLocalPath, []byte("fake-plan"), 0644)).To(Succeed())
+		}
+
+		It("reports changes when the plan exits 2", func() {
+			withExitCode(2)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			checksum, hasChanges, err := client.Plan()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hasChanges).To(BeTrue())
+			Expect(checksum).ToNot(BeEmpty())
+			Expect(recordedArgs()).To(ContainElement("-detailed-exitcode"))
+		})
+
+		It("reports no changes when the plan exits 0", func() {
+			withExitCode(0)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, hasChanges, err := client.Plan()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hasChanges).To(BeFalse())
+		})
+
+		It("returns an error when the plan exits 1", func() {
+			withExitCode(1)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, _, err := client.Plan()
+			Expect(err).To(MatchError(ContainSubstring("exit status 1")))
+		})
+	})
+
+	Context("when ReadOnly is set", func() {
+		BeforeEach(func() {
+			model.ReadOnly = true
+			model.BackendType = "s3"
+			fakeStdout(`{"version": 4, "serial": 3, "lineage": "some-lineage", "outputs": {
+  "name": {"value": "some-name", "type": "string"},
+  "password": {"value": "some-password", "type": "string", "sensitive": true}
+}}`)
+		})
+
+		It("inits without locking", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.InitWithBackend()).To(Succeed())
+
+			Expect(recordedArgs()[0]).To(Equal("init"))
+			Expect(recordedArgs()).To(ContainElement("-lock=false"))
+		})
+
+		It("reads outputs from `state pull` rather than `terraform output`", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			outputs, err := client.Output("some-env")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(outputs).To(Equal(map[string]map[string]interface{}{
+				"name":     {"value": "some-name", "type": "string", "sensitive": false},
+				"password": {"value": "some-password", "type": "string", "sensitive": true},
+			}))
+			Expect(recordedArgs()).To(Equal([]string{"state", "pull"}))
+			Expect(recordedWorkspaceEnv()).To(Equal("some-env"))
+
+			value, err := client.OutputValue("some-env", "name")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal("some-name"))
+			Expect(recordedArgs()).To(Equal([]string{"state", "pull"}))
+		})
+
+		It("returns an error naming an output which contains invalid UTF-8", func() {
+			fakeStdout("{\"version\": 4, \"outputs\": {\"name\": {\"value\": \"caf\xe9\", \"type\": \"string\"}, \"region\": {\"value\": \"us-east-1\"}}}")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.Output("some-env")
+			Expect(err).To(MatchError(ContainSubstring("Failed to unmarshal JSON output 'name'")))
+
+			value, err := client.OutputValue("some-env", "region")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal("us-east-1"))
+		})
+	})
+
+	Describe("missing workspaces", func() {
+		failWith := func(stderr string) {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "fail_times"), []byte("1"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte(stderr), 0644)).To(Succeed())
+		}
+
+		It("returns ErrWorkspaceNotFound if the workspace to select doesn't exist", func() {
+			failWith(`Workspace "some-env" doesn't exist.`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.WorkspaceSelect("some-env")
+			Expect(errors.Is(err, terraform.ErrWorkspaceNotFound)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(`Workspace "some-env" doesn't exist.`))
+		})
+
+		It("returns ErrWorkspaceNotFound if the workspace to delete doesn't exist", func() {
+			failWith(`Workspace "some-env" doesn't exist.`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.WorkspaceDelete("some-env")
+			Expect(errors.Is(err, terraform.ErrWorkspaceNotFound)).To(BeTrue())
+		})
+
+		It("returns ErrWorkspaceNotFound if init fails because the selected workspace doesn't exist", func() {
+			failWith(`Failed to select a workspace: Currently selected workspace "some-env" does not exist`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.InitWithBackend()
+			Expect(errors.Is(err, terraform.ErrWorkspaceNotFound)).To(BeTrue())
+		})
+
+		It("returns other errors unchanged", func() {
+			failWith("Error: Failed to get existing workspaces: AccessDenied")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.WorkspaceSelect("some-env")
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, terraform.ErrWorkspaceNotFound)).To(BeFalse())
+		})
+	})
+
+	Describe("#Destroy", func() {
+		It("does not pass -parallelism by default", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(context.Background())).To(Succeed())
+
+			Expect(recordedArgs()[0]).To(Equal("destroy"))
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-parallelism"))
+		})
+
+		It("passes -parallelism if Parallelism is set", func() {
+			model.Parallelism = 3
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(context.Background())).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-parallelism=3"))
+		})
+	})
+
+	Context("when the destroy context is cancelled", func() {
+		It("kills terraform and returns an error", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "sleep"), []byte("30"), 0644)).To(Succeed())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			start := time.Now()
+			Expect(client.Destroy(ctx)).ToNot(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		})
+
+		It("interrupts terraform so it can release the state lock", func() {
+			interruptible := fmt.Sprintf(`#!/bin/sh
+trap 'echo interrupted > %[1]s/interrupted; kill $!; exit 1' INT
+sleep 30 &
+wait
+`, tmpDir)
+			binaryPath := path.Join(tmpDir, "interruptible-terraform")
+			Expect(ioutil.WriteFile(binaryPath, []byte(interruptible), 0755)).To(Succeed())
+			model.TerraformBinaryPath = binaryPath
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(ctx)).ToNot(Succeed())
+			Expect(path.Join(tmpDir, "interrupted")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when Lock is set", func() {
+		It("does not pass -lock by default", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-lock="))
+		})
+
+		It("does not pass -lock if Lock is true", func() {
+			enabled := true
+			model.Lock = &enabled
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-lock="))
+		})
+
+		It("passes -lock=false to apply, destroy and plan if Lock is false", func() {
+			disabled := false
+			model.Lock = &disabled
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+			Expect(recordedArgs()).To(ContainElement("-lock=false"))
+
+			Expect(client.Destroy(context.Background())).To(Succeed())
+			Expect(recordedArgs()).To(ContainElement("-lock=false"))
+
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(model.PlanFileLocalPath, []byte("fake-plan"), 0644)).To(Succeed())
+			client.SetModel(model)
+			_, _, err := client.Plan()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recordedArgs()).To(ContainElement("-lock=false"))
+		})
+
+		It("passes -lock=false to the plan and apply of refresh_only if Lock is false", func() {
+			disabled := false
+			model.Lock = &disabled
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stdout"), []byte(`{}`), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.RefreshOnly()
+			Expect(err).ToNot(HaveOccurred())
+
+			// the apply of the refresh-only plan is the last command
+			Expect(recordedArgs()[0]).To(Equal("apply"))
+			Expect(recordedArgs()).To(ContainElement("-lock=false"))
+			Expect(recordedArgs()[len(recordedArgs())-1]).To(Equal(model.PlanFileLocalPath))
+		})
+	})
+
+	Context("when Refresh is false", func() {
+		BeforeEach(func() {
+			disabled := false
+			model.Refresh = &disabled
+		})
+
+		It("passes -refresh=false to apply", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-refresh=false"))
+		})
+
+		It("passes -refresh=false to plan", func() {
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(model.PlanFileLocalPath, []byte("fake-plan"), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, _, err := client.Plan()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(recordedArgs()).To(ContainElement("-refresh=false"))
+		})
+
+		It("does not pass -refresh=false to destroy", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(context.Background())).To(Succeed())
+
+			Expect(recordedArgs()).ToNot(ContainElement("-refresh=false"))
+		})
+	})
+
+	Context("when LockTimeout is set", func() {
+		BeforeEach(func() {
+			model.LockTimeout = "10m"
+		})
+
+		It("passes -lock-timeout to apply", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Apply()).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-lock-timeout=10m"))
+		})
+
+		It("passes -lock-timeout to destroy", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Destroy(context.Background())).To(Succeed())
+
+			Expect(recordedArgs()).To(ContainElement("-lock-timeout=10m"))
+		})
+
+		It("passes -lock-timeout to plan", func() {
+			model.PlanFileLocalPath = path.Join(tmpDir, "plan")
+			Expect(ioutil.WriteFile(model.PlanFileLocalPath, []byte("fake-plan"), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, _, err := client.Plan()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(recordedArgs()[0]).To(Equal("plan"))
+			Expect(recordedArgs()).To(ContainElement("-lock-timeout=10m"))
+		})
+
+		It("passes -lock-timeout to import", func() {
+			model.Imports = map[string]string{
+				"aws_instance.foo": "i-1234",
+			}
+			// `state list` prints nothing so the resource is imported
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.ImportWithLegacyStorage()).To(Succeed())
+
+			Expect(recordedArgs()[0]).To(Equal("import"))
+			Expect(recordedArgs()).To(ContainElement("-lock-timeout=10m"))
+		})
+	})
+
+	Describe("#Import", func() {
+		BeforeEach(func() {
+			model.Imports = map[string]string{
+				`aws_instance.x["a"]`: "some-id-$HOME",
+			}
+		})
+
+		It("passes the address and ID through the shell unchanged", func() {
+			// `state list` prints nothing so the resource is imported
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Import("some-env")).To(Succeed())
+
+			args := recordedArgs()
+			Expect(args[0]).To(Equal("import"))
+			Expect(args[len(args)-2:]).To(Equal([]string{`aws_instance.x["a"]`, "some-id-$HOME"}))
+		})
+
+		It("checks whether an address with a string index key exists", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stdout"), []byte(`aws_instance.x["a"]`), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.Import("some-env")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"state", "list", `aws_instance.x["a"]`}))
+		})
+	})
+
+	It("passes the model env to the terraform subprocess", func() {
+		model.EnvPerAction = map[string]map[string]string{
+			models.EnvActionPlan:  {"FAKE_CREDENTIAL": "read-only"},
+			models.EnvActionApply: {"FAKE_CREDENTIAL": "read-write"},
+		}
+		model.Env = model.EnvForAction(models.EnvActionApply)
+
+		client := terraform.NewClient(model, &bytes.Buffer{})
+		Expect(client.Apply()).To(Succeed())
+
+		contents, err := ioutil.ReadFile(path.Join(tmpDir, "fake_credential"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.TrimSpace(string(contents))).To(Equal("read-write"))
+	})
+
+	It("does not pass -lock-timeout by default", func() {
+		client := terraform.NewClient(model, &bytes.Buffer{})
+		Expect(client.Apply()).To(Succeed())
+
+		Expect(strings.Join(recordedArgs(), " ")).ToNot(ContainSubstring("-lock-timeout"))
+	})
+
+	Context("when WorkspacePrefix is set", func() {
+		BeforeEach(func() {
+			model.WorkspacePrefix = "team-a-"
+		})
+
+		It("only lists workspaces with the prefix and strips it", func() {
+			fakeStdout("* default\n  team-a-staging\n  team-a-staging-plan\n  team-b-staging\n")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			workspaces, err := client.WorkspaceList()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(workspaces).To(Equal([]string{"staging", "staging-plan"}))
+		})
+
+		It("prepends the prefix when selecting a workspace", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.WorkspaceSelect("staging")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"workspace", "select", "team-a-staging"}))
+		})
+
+		It("prepends the prefix when deleting a workspace", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.WorkspaceDelete("staging")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"workspace", "delete", "team-a-staging"}))
+			Expect(recordedWorkspaceEnv()).To(Equal("default"))
+		})
+
+		It("prepends the prefix to TF_WORKSPACE when pulling state", func() {
+			fakeStdout(`{"serial": 1, "lineage": "some-lineage"}`)
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			_, err := client.StatePull("staging")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(recordedWorkspaceEnv()).To(Equal("team-a-staging"))
+		})
+	})
+
+	Context("when BackendType is remote", func() {
+		BeforeEach(func() {
+			model.BackendType = "remote"
+			model.BackendConfig = map[string]interface{}{
+				"organization": "acme",
+				"workspaces":   map[string]interface{}{"prefix": "app-"},
+			}
+			model.WorkspacePrefix = "team-a-"
+		})
+
+		It("lists env names as terraform strips the remote prefix", func() {
+			// the remote backend has no default workspace in prefix mode
+			fakeStdout("* team-a-staging\n  team-a-staging-plan\n  team-b-staging\n")
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			workspaces, err := client.WorkspaceList()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(workspaces).To(Equal([]string{"staging", "staging-plan"}))
+		})
+
+		It("creates the workspace without the remote prefix which terraform adds", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			Expect(client.WorkspaceNewIfNotExists("staging")).To(Succeed())
+
+			Expect(recordedArgs()).To(Equal([]string{"workspace", "new", "team-a-staging"}))
+		})
+
+		It("returns an error before creating a workspace with an invalid name", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.WorkspaceNewIfNotExists("staging.v2")
+			Expect(err).To(MatchError(ContainSubstring("the workspace name 'app-team-a-staging.v2' may only contain letters, numbers, '-' and '_'")))
+
+			Expect(recordedArgs()).To(Equal([]string{"workspace", "list"}))
+		})
+
+		It("returns an error before creating a workspace with a name which is too long", func() {
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.WorkspaceNewFromExistingStateFile(strings.Repeat("a", 80), model.StateFileLocalPath)
+			Expect(err).To(MatchError(ContainSubstring("must be at most 90 characters")))
+
+			Expect(argsFilePath).ToNot(BeAnExistingFile())
+		})
+
+		It("explains init fails until a workspace with the prefix exists", func() {
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "fail_times"), []byte("1"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(tmpDir, "stderr"), []byte("Error: No existing workspaces."), 0644)).To(Succeed())
+
+			client := terraform.NewClient(model, &bytes.Buffer{})
+			err := client.InitWithBackend()
+			Expect(err).To(MatchError(ContainSubstring("requires at least one workspace named with the prefix 'app-'")))
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package terraform
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const unconvergedSuffix = markerNamespace + "unconverged"
+
+// ConvergenceMarker records the last fully converged version of an env while
+// applies still leave deferred actions behind, so `check` can keep emitting
+// that version with `require_converged`. The marker is stored as the outputs
+// of a separate workspace, similar to PutIntent.
+type ConvergenceMarker struct {
+	Client  Client
+	EnvName string
+}
+
+// Read returns the converged version, which is zero if the env has never
+// converged. The bool is false if the env is not waiting on deferred actions.
+func (m ConvergenceMarker) Read() (StateVersion, bool, error) {
+	values, found, err := readMarkerWorkspace(m.Client, m.workspace())
+	if err != nil || !found {
+		return StateVersion{}, found, err
+	}
+	if values["serial"] == "" {
+		return StateVersion{}, true, nil
+	}
+
+	serial, err := strconv.Atoi(values["serial"])
+	if err != nil {
+		return StateVersion{}, false, fmt.Errorf("Expected serial in workspace '%s' to be of type int: %s", m.workspace(), err)
+	}
+	return StateVersion{
+		Serial:  serial,
+		Lineage: values["lineage"],
+	}, true, nil
+}
+
+// Write records converged unless a marker already exists, which holds an
+// older converged version.
+func (m ConvergenceMarker) Write(converged StateVersion) error {
+	if _, found, err := m.Read(); err != nil || found {
+		return err
+	}
+
+	values := map[string]string{}
+	if converged != (StateVersion{}) {
+		values["serial"] = strconv.Itoa(converged.Serial)
+		values["lineage"] = converged.Lineage
+	}
+	return writeMarkerWorkspace(m.Client, m.workspace(), values)
+}
+
+// Clear removes the marker once an apply has converged.
+func (m ConvergenceMarker) Clear() error {
+	if _, found, err := readMarkerWorkspace(m.Client, m.workspace()); err != nil || !found {
+		return err
+	}
+	return m.Client.WorkspaceDeleteWithForce(m.workspace())
+}
+
+func (m ConvergenceMarker) workspace() string {
+	return fmt.Sprintf("%s%s", m.EnvName, unconvergedSuffix)
+}
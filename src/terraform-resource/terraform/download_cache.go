@@ -0,0 +1,381 @@
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	modulesDir      = ".terraform/modules"
+	modulesManifest = ".terraform/modules/modules.json"
+)
+
+// downloadCache stores providers and registry modules on a volume shared
+// between builds, e.g. one mounted on the worker, so that `terraform init`
+// doesn't need to contact the registry for every put.
+//
+// Layout:
+//
+//	plugins/                  TF_PLUGIN_CACHE_DIR, managed by Terraform
+//	modules/<key>/            a module package keyed by source and version
+//	modules/<key>.sha256      checksum of the package contents
+//	manifests/<config>.json   modules.json from the last online init of a config
+//	terraform/<version>/      releases downloaded for `terraform_version`
+type downloadCache struct {
+	path string
+}
+
+// moduleCacheStats is reported in the init summary line
+type moduleCacheStats struct {
+	Hits   int
+	Misses int
+}
+
+type moduleManifest struct {
+	Modules []moduleRecord `json:"Modules"`
+}
+
+type moduleRecord struct {
+	Key     string `json:"Key"`
+	Source  string `json:"Source"`
+	Version string `json:"Version,omitempty"`
+	Dir     string `json:"Dir"`
+}
+
+func (d downloadCache) pluginDir() string {
+	return filepath.Join(d.path, "plugins")
+}
+
+func (d downloadCache) terraformDir() string {
+	return filepath.Join(d.path, "terraform")
+}
+
+// restoreModules copies every module required by the config in sourceDir
+// from the cache into .terraform/modules. It returns false if any module is
+// missing, corrupt, or can't be cached, in which case init must download them.
+func (d downloadCache) restoreModules(sourceDir string) (bool, moduleCacheStats, error) {
+	stats := moduleCacheStats{}
+
+	configKey, err := configKey(sourceDir)
+	if err != nil {
+		return false, stats, err
+	}
+	contents, err := ioutil.ReadFile(d.manifestPath(configKey))
+	if os.IsNotExist(err) {
+		return false, stats, nil
+	} else if err != nil {
+		return false, stats, err
+	}
+	manifest := moduleManifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		// a corrupt manifest is repaired by the following online init
+		return false, stats, nil
+	}
+
+	packages := []moduleRecord{}
+	for _, module := range manifest.Modules {
+		if !isPackageDir(module) {
+			continue
+		}
+		if !isCacheable(module) {
+			stats.Misses++
+			continue
+		}
+		valid, err := d.verifyModule(module)
+		if err != nil {
+			return false, stats, err
+		}
+		if !valid {
+			stats.Misses++
+			continue
+		}
+		stats.Hits++
+		packages = append(packages, module)
+	}
+	if stats.Misses > 0 {
+		return false, stats, nil
+	}
+
+	for _, module := range packages {
+		dst := filepath.Join(sourceDir, filepath.FromSlash(module.Dir))
+		if err := os.RemoveAll(dst); err != nil {
+			return false, stats, err
+		}
+		if err := copyDir(d.modulePath(module), dst); err != nil {
+			return false, stats, fmt.Errorf("Failed to restore module '%s' from `download_cache_path`: %s", module.Source, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(sourceDir, modulesDir), 0755); err != nil {
+		return false, stats, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(sourceDir, modulesManifest), contents, 0644); err != nil {
+		return false, stats, err
+	}
+
+	return true, stats, nil
+}
+
+// saveModules stores the modules downloaded by an online init and returns
+// how many were downloaded. Writes go to a temp dir and are renamed into
+// place so concurrent builds never see a partially written package.
+func (d downloadCache) saveModules(sourceDir string) (int, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(sourceDir, modulesManifest))
+	if os.IsNotExist(err) {
+		return 0, nil // config has no modules
+	} else if err != nil {
+		return 0, err
+	}
+	manifest := moduleManifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return 0, fmt.Errorf("Failed to parse '%s': %s", modulesManifest, err)
+	}
+
+	downloaded := 0
+	for _, module := range manifest.Modules {
+		if !isPackageDir(module) {
+			continue
+		}
+		downloaded++
+		if !isCacheable(module) {
+			continue
+		}
+		if valid, err := d.verifyModule(module); err != nil || valid {
+			continue
+		}
+		if err := d.saveModule(sourceDir, module); err != nil {
+			return downloaded, fmt.Errorf("Failed to cache module '%s': %s", module.Source, err)
+		}
+	}
+
+	configKey, err := configKey(sourceDir)
+	if err != nil {
+		return downloaded, err
+	}
+	return downloaded, writeFileAtomic(d.manifestPath(configKey), contents)
+}
+
+func (d downloadCache) saveModule(sourceDir string, module moduleRecord) error {
+	src := filepath.Join(sourceDir, filepath.FromSlash(module.Dir))
+	checksum, err := dirChecksum(src)
+	if err != nil {
+		return err
+	}
+
+	modulesPath := filepath.Join(d.path, "modules")
+	if err := os.MkdirAll(modulesPath, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := ioutil.TempDir(modulesPath, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := copyDir(src, tmpDir); err != nil {
+		return err
+	}
+
+	// replaces a corrupt entry
+	if err := os.RemoveAll(d.modulePath(module)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, d.modulePath(module)); err != nil {
+		return err
+	}
+	return writeFileAtomic(d.checksumPath(module), []byte(checksum))
+}
+
+// verifyModule returns false if the module is not cached or its contents no
+// longer match the checksum recorded when it was cached
+func (d downloadCache) verifyModule(module moduleRecord) (bool, error) {
+	expected, err := ioutil.ReadFile(d.checksumPath(module))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	actual, err := dirChecksum(d.modulePath(module))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(expected)) == actual, nil
+}
+
+func (d downloadCache) modulePath(module moduleRecord) string {
+	return filepath.Join(d.path, "modules", moduleKey(module))
+}
+
+func (d downloadCache) checksumPath(module moduleRecord) string {
+	return d.modulePath(module) + ".sha256"
+}
+
+func (d downloadCache) manifestPath(configKey string) string {
+	return filepath.Join(d.path, "manifests", configKey+".json")
+}
+
+func moduleKey(module moduleRecord) string {
+	sum := sha256.Sum256([]byte(module.Source + "\x00" + module.Version))
+	return hex.EncodeToString(sum[:])
+}
+
+// isPackageDir is false for local modules and for modules nested inside
+// another package, which are restored along with their parent
+func isPackageDir(module moduleRecord) bool {
+	return module.Key != "" && module.Dir == modulesDir+"/"+module.Key
+}
+
+// only registry modules have an immutable version, a git ref may be a branch
+func isCacheable(module moduleRecord) bool {
+	return module.Version != ""
+}
+
+// configKey identifies the module calls of a config by hashing every
+// Terraform file, ignoring anything written by init or the resource itself
+func configKey(sourceDir string) (string, error) {
+	files := []string{}
+	err := filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() == "resource_backend_override.tf" {
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), ".tf") || strings.HasSuffix(info.Name(), ".tf.json") {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, filePath := range files {
+		relPath, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return "", err
+		}
+		if err := hashFile(hash, filepath.ToSlash(relPath), filePath); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func dirChecksum(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+
+	files := []string{}
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, filePath := range files {
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return "", err
+		}
+		if err := hashFile(hash, filepath.ToSlash(relPath), filePath); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(hash io.Writer, name string, filePath string) error {
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	contentsHash := sha256.Sum256(contents)
+	_, err = fmt.Fprintf(hash, "%s\x00%s\n", name, hex.EncodeToString(contentsHash[:]))
+	return err
+}
+
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(filePath, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeFileAtomic(filePath string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(contents); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filePath)
+}
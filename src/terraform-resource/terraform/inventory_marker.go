@@ -0,0 +1,60 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ljfranklin/terraform-resource/inventory"
+)
+
+const inventorySuffix = markerNamespace + "inventory"
+
+// InventoryMarker stores the inventory of providers and modules an env was
+// last applied with, so a `get` can report what was applied rather than what
+// an init would resolve today. The marker is stored as the outputs of a
+// separate workspace, similar to PutIntent.
+type InventoryMarker struct {
+	Client  Client
+	EnvName string
+}
+
+// Read returns the recorded inventory. The bool is false if the env was
+// never applied with `record_inventory`.
+func (m InventoryMarker) Read() (inventory.Inventory, bool, error) {
+	values, found, err := readMarkerWorkspace(m.Client, m.workspace())
+	if err != nil || !found {
+		return inventory.Inventory{}, false, err
+	}
+
+	var recorded inventory.Inventory
+	if err := json.Unmarshal([]byte(values["inventory"]), &recorded); err != nil {
+		return inventory.Inventory{}, false, fmt.Errorf("Failed to parse inventory in workspace '%s': %s", m.workspace(), err)
+	}
+	return recorded, true, nil
+}
+
+// Write replaces any inventory recorded by an earlier apply.
+func (m InventoryMarker) Write(recorded inventory.Inventory) error {
+	contents, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	if err := m.Clear(); err != nil {
+		return err
+	}
+	return writeMarkerWorkspace(m.Client, m.workspace(), map[string]string{
+		"inventory": string(contents),
+	})
+}
+
+// Clear removes the inventory, e.g. once the env is destroyed.
+func (m InventoryMarker) Clear() error {
+	if _, found, err := readMarkerWorkspace(m.Client, m.workspace()); err != nil || !found {
+		return err
+	}
+	return m.Client.WorkspaceDeleteWithForce(m.workspace())
+}
+
+func (m InventoryMarker) workspace() string {
+	return fmt.Sprintf("%s%s", m.EnvName, inventorySuffix)
+}
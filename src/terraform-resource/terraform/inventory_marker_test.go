@@ -0,0 +1,141 @@
+package terraform_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+
+	"github.com/ljfranklin/terraform-resource/inventory"
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InventoryMarker", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+		// fake backend mapping workspace name to its outputs
+		backend   map[string]map[string]map[string]interface{}
+		sourceDir string
+		logWriter *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		backend = map[string]map[string]map[string]interface{}{}
+		fakeClient = &terraformfakes.FakeClient{}
+		fakeClient.WorkspaceListStub = func() ([]string, error) {
+			spaces := []string{}
+			for space := range backend {
+				spaces = append(spaces, space)
+			}
+			return spaces, nil
+		}
+		fakeClient.OutputStub = func(space string) (map[string]map[string]interface{}, error) {
+			return backend[space], nil
+		}
+		fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+			if _, ok := backend[space]; ok {
+				return fmt.Errorf("Workspace %q already exists", space)
+			}
+			contents, err := ioutil.ReadFile(stateFilePath)
+			if err != nil {
+				return err
+			}
+			state := struct {
+				Outputs map[string]map[string]interface{} `json:"outputs"`
+			}{}
+			if err := json.Unmarshal(contents, &state); err != nil {
+				return err
+			}
+			backend[space] = state.Outputs
+			return nil
+		}
+		fakeClient.WorkspaceDeleteWithForceStub = func(space string) error {
+			delete(backend, space)
+			return nil
+		}
+
+		var err error
+		sourceDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-inventory-marker-test")
+		Expect(err).ToNot(HaveOccurred())
+		logWriter = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(sourceDir)
+	})
+
+	writeLockFile := func(version string) {
+		lockFile := fmt.Sprintf("provider \"registry.terraform.io/hashicorp/aws\" {\n  version = \"%s\"\n  hashes = [\n    \"h1:c29tZS1oYXNo\",\n  ]\n}\n", version)
+		Expect(ioutil.WriteFile(path.Join(sourceDir, ".terraform.lock.hcl"), []byte(lockFile), 0644)).To(Succeed())
+	}
+
+	newAction := func() terraform.Action {
+		return terraform.Action{
+			Client:          fakeClient,
+			EnvName:         "some-env",
+			Model:           models.Terraform{Source: sourceDir},
+			Logger:          logger.Logger{Sink: logWriter},
+			RecordInventory: true,
+		}
+	}
+
+	It("is not found for an env which was never recorded", func() {
+		_, found, err := terraform.InventoryMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("replaces the inventory on each apply", func() {
+		writeLockFile("5.30.0")
+		action := newAction()
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		writeLockFile("5.31.0")
+		action = newAction()
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		recorded, found, err := terraform.InventoryMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(recorded.Components).To(HaveLen(1))
+		Expect(recorded.Components[0].Version).To(Equal("5.31.0"))
+		Expect(terraform.IsMarkerWorkspace("some-env__tfr_inventory")).To(BeTrue())
+	})
+
+	It("warns about providers which do not match the lock file", func() {
+		writeLockFile("5.31.0")
+		packageDir := path.Join(sourceDir, ".terraform", "providers", "registry.terraform.io", "hashicorp", "aws", "5.31.0", runtime.GOOS+"_"+runtime.GOARCH)
+		Expect(os.MkdirAll(packageDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(packageDir, "terraform-provider-aws"), []byte("tampered"), 0755)).To(Succeed())
+
+		action := newAction()
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(logWriter.String()).To(ContainSubstring("do not match the hashes in .terraform.lock.hcl: registry.terraform.io/hashicorp/aws@5.31.0"))
+		recorded, _, err := terraform.InventoryMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorded.HashMismatches()).To(HaveLen(1))
+	})
+
+	It("removes the inventory when the env is destroyed", func() {
+		Expect(terraform.InventoryMarker{Client: fakeClient, EnvName: "some-env"}.Write(inventory.Inventory{})).To(Succeed())
+
+		action := newAction()
+		_, err := action.Destroy()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(backend).ToNot(HaveKey("some-env__tfr_inventory"))
+	})
+})
@@ -0,0 +1,101 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// AppliedChanges are the counts terraform reports when an apply completes
+type AppliedChanges struct {
+	Add     int
+	Change  int
+	Destroy int
+}
+
+// jsonUIWriter renders the machine readable output of `terraform apply
+// -json` as plain text in the build log. Error diagnostics are also copied
+// to diagnostics, so the same checks which read terraform's stderr, e.g. for
+// a held state lock, still work.
+type jsonUIWriter struct {
+	log         io.Writer
+	diagnostics io.Writer
+
+	// applied is nil until the apply's change summary has been seen
+	applied *AppliedChanges
+
+	partial []byte
+}
+
+type jsonUIMessage struct {
+	Level      string `json:"@level"`
+	Message    string `json:"@message"`
+	Type       string `json:"type"`
+	Diagnostic *struct {
+		Summary string `json:"summary"`
+		Detail  string `json:"detail"`
+	} `json:"diagnostic"`
+	Changes *struct {
+		Add       int    `json:"add"`
+		Change    int    `json:"change"`
+		Remove    int    `json:"remove"`
+		Operation string `json:"operation"`
+	} `json:"changes"`
+}
+
+func (w *jsonUIWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.partial[:i]
+		w.partial = w.partial[i+1:]
+		if err := w.writeLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes any final line without a trailing newline
+func (w *jsonUIWriter) Flush() error {
+	if len(w.partial) == 0 {
+		return nil
+	}
+	line := w.partial
+	w.partial = nil
+	return w.writeLine(line)
+}
+
+func (w *jsonUIWriter) writeLine(line []byte) error {
+	var message jsonUIMessage
+	if err := json.Unmarshal(line, &message); err != nil || message.Message == "" {
+		// e.g. a crash or a provider printing directly to stdout
+		_, err := fmt.Fprintf(w.log, "%s\n", line)
+		return err
+	}
+
+	if message.Type == "change_summary" && message.Changes != nil && message.Changes.Operation == "apply" {
+		w.applied = &AppliedChanges{
+			Add:     message.Changes.Add,
+			Change:  message.Changes.Change,
+			Destroy: message.Changes.Remove,
+		}
+	}
+
+	text := message.Message + "\n"
+	if message.Diagnostic != nil && message.Diagnostic.Detail != "" {
+		text += "\n" + message.Diagnostic.Detail + "\n"
+	}
+	if _, err := io.WriteString(w.log, text); err != nil {
+		return err
+	}
+	if message.Level == "error" {
+		_, err := io.WriteString(w.diagnostics, text)
+		return err
+	}
+	return nil
+}
@@ -1,14 +1,17 @@
 package terraform
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"strings"
+	"time"
 	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/retry"
 	"github.com/ljfranklin/terraform-resource/storage"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type LegacyStorageAction struct {
@@ -17,11 +20,22 @@ type LegacyStorageAction struct {
 	PlanFile  storage.PlanFile
 	StateFile storage.StateFile
 	Logger    logger.Logger
+	Span      *tracing.Span
+
+	// DeleteOnFailureTimeout bounds the destroy run by `delete_on_failure`,
+	// zero means no timeout
+	DeleteOnFailureTimeout time.Duration
 }
 
 type LegacyStorageResult struct {
 	Version storage.Version
 	Output  map[string]map[string]interface{}
+
+	// AlreadyDestroyed is true if a destroy found the state file already gone
+	AlreadyDestroyed bool
+
+	// SensitiveOutputNames are masked by SanitizedOutput, see Result
+	SensitiveOutputNames []string
 }
 
 func (r LegacyStorageResult) RawOutput() map[string]interface{} {
@@ -34,20 +48,7 @@ func (r LegacyStorageResult) RawOutput() map[string]interface{} {
 }
 
 func (r LegacyStorageResult) SanitizedOutput() map[string]string {
-	output := map[string]string{}
-	for key, value := range r.Output {
-		if value["sensitive"] == true {
-			output[key] = "<sensitive>"
-		} else {
-			jsonValue, err := json.Marshal(value["value"])
-			if err != nil {
-				jsonValue = []byte(fmt.Sprintf("Unable to parse output value for key '%s': %s", key, err))
-			}
-
-			output[key] = strings.Trim(string(jsonValue), "\"")
-		}
-	}
-	return output
+	return sanitizeOutput(r.Output, r.SensitiveOutputNames)
 }
 
 func (a *LegacyStorageAction) Apply() (LegacyStorageResult, error) {
@@ -56,7 +57,9 @@ func (a *LegacyStorageAction) Apply() (LegacyStorageResult, error) {
 		return LegacyStorageResult{}, err
 	}
 
+	applySpan := a.Span.StartChild("terraform apply")
 	result, err := a.attemptApply()
+	applySpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Apply!")
 		err = fmt.Errorf("Apply Error: %s", err)
@@ -66,7 +69,10 @@ func (a *LegacyStorageAction) Apply() (LegacyStorageResult, error) {
 	if err != nil && a.Model.DeleteOnFailure {
 		a.Logger.Warn("Cleaning Up Partially Created Resources...")
 
-		_, destroyErr := a.attemptDestroy()
+		ctx, cancel := deleteOnFailureContext(a.DeleteOnFailureTimeout)
+		_, destroyErr := a.attemptDestroy(ctx)
+		destroyErr = deleteOnFailureTimeoutError(ctx, a.DeleteOnFailureTimeout, destroyErr)
+		cancel()
 		if destroyErr != nil {
 			a.Logger.Error("Failed To Run Terraform Destroy!")
 			err = fmt.Errorf("%s\nDestroy Error: %s", err, destroyErr)
@@ -105,7 +111,9 @@ func (a *LegacyStorageAction) attemptApply() (LegacyStorageResult, error) {
 		a.StateFile = a.StateFile.ConvertFromTainted()
 	}
 
+	uploadSpan := a.Span.StartChild("state upload")
 	storageVersion, err := a.StateFile.Upload()
+	uploadSpan.End(err)
 	if err != nil {
 		return LegacyStorageResult{}, err
 	}
@@ -134,12 +142,28 @@ func (a *LegacyStorageAction) attemptApply() (LegacyStorageResult, error) {
 }
 
 func (a *LegacyStorageAction) Destroy() (LegacyStorageResult, error) {
-	err := a.setup()
+	stateFileExists, err := a.StateFile.Exists()
+	if err != nil {
+		return LegacyStorageResult{}, err
+	}
+	if stateFileExists == false {
+		stateFileExists, err = a.StateFile.ExistsAsTainted()
+		if err != nil {
+			return LegacyStorageResult{}, err
+		}
+	}
+	if stateFileExists == false {
+		return a.alreadyDestroyed()
+	}
+
+	err = a.setup()
 	if err != nil {
 		return LegacyStorageResult{}, err
 	}
 
-	result, err := a.attemptDestroy()
+	destroySpan := a.Span.StartChild("terraform destroy")
+	result, err := a.attemptDestroy(context.Background())
+	destroySpan.End(err)
 
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Destroy!")
@@ -156,11 +180,11 @@ func (a *LegacyStorageAction) Destroy() (LegacyStorageResult, error) {
 	return result, err
 }
 
-func (a *LegacyStorageAction) attemptDestroy() (LegacyStorageResult, error) {
+func (a *LegacyStorageAction) attemptDestroy(ctx context.Context) (LegacyStorageResult, error) {
 	a.Logger.WarnSection("Terraform Destroy")
 	defer a.Logger.EndSection()
 
-	if err := a.Client.Destroy(); err != nil {
+	if err := a.Client.Destroy(ctx); err != nil {
 		return LegacyStorageResult{}, err
 	}
 
@@ -178,13 +202,36 @@ func (a *LegacyStorageAction) attemptDestroy() (LegacyStorageResult, error) {
 	}, nil
 }
 
+// alreadyDestroyed lets a retriggered destroy succeed once the state file
+// is gone, the desired end state has been reached either way
+func (a *LegacyStorageAction) alreadyDestroyed() (LegacyStorageResult, error) {
+	a.Logger.Warn(fmt.Sprintf("State file '%s' does not exist, assuming it was already destroyed", a.StateFile.RemotePath))
+
+	// a leftover plan would otherwise be applied by a later put
+	if _, err := a.PlanFile.Delete(); err != nil {
+		return LegacyStorageResult{}, err
+	}
+	// deleting a missing state file is a no-op but returns the version
+	storageVersion, err := a.StateFile.Delete()
+	if err != nil {
+		return LegacyStorageResult{}, err
+	}
+	return LegacyStorageResult{
+		Output:           map[string]map[string]interface{}{},
+		Version:          storageVersion,
+		AlreadyDestroyed: true,
+	}, nil
+}
+
 func (a *LegacyStorageAction) Plan() (LegacyStorageResult, error) {
 	err := a.setup()
 	if err != nil {
 		return LegacyStorageResult{}, err
 	}
 
+	planSpan := a.Span.StartChild("terraform plan")
 	result, err := a.attemptPlan()
+	planSpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Plan!")
 		err = fmt.Errorf("Plan Error: %s", err)
@@ -201,7 +248,7 @@ func (a *LegacyStorageAction) attemptPlan() (LegacyStorageResult, error) {
 	a.Logger.InfoSection("Terraform Plan")
 	defer a.Logger.EndSection()
 
-	if _, err := a.Client.Plan(); err != nil {
+	if _, _, err := a.Client.Plan(); err != nil {
 		return LegacyStorageResult{}, err
 	}
 
@@ -245,7 +292,7 @@ func (a *LegacyStorageAction) setup() error {
 	}
 
 	if stateFileExists {
-		_, err = a.StateFile.Download()
+		err = downloadStateFile(a.StateFile, a.Model, a.Logger)
 		if err != nil {
 			return err
 		}
@@ -284,11 +331,14 @@ func (a *LegacyStorageAction) setup() error {
 		return err
 	}
 
-	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source); err != nil {
+	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source, a.Logger); err != nil {
 		return err
 	}
 
-	if err := a.Client.InitWithoutBackend(); err != nil {
+	initSpan := a.Span.StartChild("terraform init")
+	err = withSSHKeyFile(a.Model, a.Client.InitWithoutBackend)
+	initSpan.End(err)
+	if err != nil {
 		return err
 	}
 
@@ -320,3 +370,16 @@ func (a *LegacyStorageAction) uploadTaintedStatefile() error {
 
 	return nil
 }
+
+// downloadStateFile retries transient storage errors up to `max_retries` times
+func downloadStateFile(stateFile storage.StateFile, model models.Terraform, logger logger.Logger) error {
+	retryer := retry.Retryer{
+		MaxRetries: model.MaxRetries,
+		Delay:      model.RetryDelayDuration(),
+		Logger:     logger,
+	}
+	return retryer.Do("State file download", func() error {
+		_, err := stateFile.Download()
+		return err
+	}, retry.IsTransientError)
+}
@@ -0,0 +1,119 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// markerNamespace separates an env name from the kind of marker stored for
+// it, e.g. `staging__tfr_inventory`. Env names containing it are rejected by
+// ValidateEnvName so a marker can never be mistaken for an env. It only uses
+// characters Terraform Cloud allows in workspace names.
+const markerNamespace = "__tfr_"
+
+// planSuffix names the workspace holding the saved plan of a `plan_only` put
+const planSuffix = "-plan"
+
+// IsMarkerWorkspace is true for the workspaces the resource creates alongside
+// an env, e.g. to hold a `put` intent, rather than for an env itself. The
+// `<env>-plan` workspace predates markerNamespace, see IsPlanWorkspace.
+func IsMarkerWorkspace(workspace string) bool {
+	return strings.Contains(workspace, markerNamespace)
+}
+
+// IsPlanWorkspace is true if workspace holds the `plan_only` plan of one of
+// envs. An env may itself be named `<name>-plan`, so a plan workspace is only
+// recognised alongside its env.
+func IsPlanWorkspace(workspace string, envs []string) bool {
+	if !strings.HasSuffix(workspace, planSuffix) {
+		return false
+	}
+	envName := strings.TrimSuffix(workspace, planSuffix)
+	for _, env := range envs {
+		if env == envName {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEnvName rejects names which would be mistaken for a marker workspace
+func ValidateEnvName(envName string) error {
+	if strings.Contains(envName, markerNamespace) {
+		return fmt.Errorf("Invalid env name '%s', '%s' is reserved for the workspaces the resource stores alongside each env", envName, markerNamespace)
+	}
+	return nil
+}
+
+// readMarkerWorkspace returns the string outputs of a workspace used to
+// store a marker rather than infrastructure, e.g. a `put` intent.
+func readMarkerWorkspace(client Client, workspace string) (map[string]string, bool, error) {
+	spaces, err := client.WorkspaceList()
+	if err != nil {
+		return nil, false, err
+	}
+	exists := false
+	for _, space := range spaces {
+		if space == workspace {
+			exists = true
+		}
+	}
+	if !exists {
+		return nil, false, nil
+	}
+
+	outputs, err := client.Output(workspace)
+	if err != nil {
+		return nil, false, err
+	}
+	values := map[string]string{}
+	for key, output := range outputs {
+		if v, ok := output["value"].(string); ok {
+			values[key] = v
+		}
+	}
+
+	return values, true, nil
+}
+
+// writeMarkerWorkspace creates a workspace whose state holds only the given
+// string outputs. It fails if the workspace already exists.
+func writeMarkerWorkspace(client Client, workspace string, values map[string]string) error {
+	outputs := map[string]interface{}{}
+	for key, value := range values {
+		outputs[key] = map[string]string{
+			"value": value,
+			"type":  "string",
+		}
+	}
+	// an old terraform_version ensures any newer CLI will accept the push
+	state := map[string]interface{}{
+		"version":           4,
+		"terraform_version": "0.12.0",
+		"serial":            1,
+		"lineage":           randomHex(16),
+		"outputs":           outputs,
+		"resources":         []interface{}{},
+	}
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	stateFile, err := ioutil.TempFile("", "marker-*.tfstate")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stateFile.Name())
+	if _, err := stateFile.Write(contents); err != nil {
+		return err
+	}
+	if err := stateFile.Close(); err != nil {
+		return err
+	}
+
+	return client.WorkspaceNewFromExistingStateFile(workspace, stateFile.Name())
+}
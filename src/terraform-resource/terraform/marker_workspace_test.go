@@ -0,0 +1,28 @@
+package terraform_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/terraform"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Marker workspaces", func() {
+	It("does not mistake envs ending in a marker name for markers", func() {
+		for _, env := range []string{"api-plan", "api-put-intent", "api-unconverged", "api-inventory", "api-backend", "api-provenance"} {
+			Expect(terraform.IsMarkerWorkspace(env)).To(BeFalse(), env)
+		}
+		Expect(terraform.IsMarkerWorkspace("api__tfr_inventory")).To(BeTrue())
+	})
+
+	It("only recognises a plan workspace alongside its env", func() {
+		Expect(terraform.IsPlanWorkspace("api-plan", []string{"api", "api-plan"})).To(BeTrue())
+		Expect(terraform.IsPlanWorkspace("api-plan", []string{"web", "api-plan"})).To(BeFalse())
+		Expect(terraform.IsPlanWorkspace("api", []string{"api"})).To(BeFalse())
+	})
+
+	It("rejects env names which would be mistaken for a marker", func() {
+		Expect(terraform.ValidateEnvName("api-inventory")).To(Succeed())
+		Expect(terraform.ValidateEnvName("api__tfr_inventory")).To(MatchError(ContainSubstring("'__tfr_' is reserved")))
+	})
+})
@@ -1,11 +1,15 @@
 package terraform
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 	"github.com/ljfranklin/terraform-resource/logger"
 	"github.com/ljfranklin/terraform-resource/models"
 	"github.com/ljfranklin/terraform-resource/storage"
+	"github.com/ljfranklin/terraform-resource/tracing"
 )
 
 type MigratedFromStorageAction struct {
@@ -14,6 +18,11 @@ type MigratedFromStorageAction struct {
 	Logger    logger.Logger
 	EnvName   string
 	StateFile storage.StateFile
+	Span      *tracing.Span
+
+	// DeleteOnFailureTimeout bounds the destroy run by `delete_on_failure`,
+	// zero means no timeout
+	DeleteOnFailureTimeout time.Duration
 }
 
 func (a *MigratedFromStorageAction) Apply() (Result, error) {
@@ -22,7 +31,9 @@ func (a *MigratedFromStorageAction) Apply() (Result, error) {
 		return Result{}, err
 	}
 
+	applySpan := a.Span.StartChild("terraform apply")
 	result, err := a.attemptApply()
+	applySpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Apply!")
 		err = fmt.Errorf("Apply Error: %s", err)
@@ -31,7 +42,10 @@ func (a *MigratedFromStorageAction) Apply() (Result, error) {
 	if err != nil && a.Model.DeleteOnFailure {
 		a.Logger.Warn("Cleaning Up Partially Created Resources...")
 
-		_, destroyErr := a.attemptDestroy()
+		ctx, cancel := deleteOnFailureContext(a.DeleteOnFailureTimeout)
+		_, destroyErr := a.attemptDestroy(ctx)
+		destroyErr = deleteOnFailureTimeoutError(ctx, a.DeleteOnFailureTimeout, destroyErr)
+		cancel()
 		if destroyErr != nil {
 			a.Logger.Error("Failed To Run Terraform Destroy!")
 			err = fmt.Errorf("%s\nDestroy Error: %s", err, destroyErr)
@@ -65,7 +79,7 @@ func (a *MigratedFromStorageAction) attemptApply() (Result, error) {
 	}
 
 	if legacyStateFileExists {
-		_, err = a.StateFile.Download()
+		err = downloadStateFile(a.StateFile, a.Model, a.Logger)
 		if err != nil {
 			return Result{}, err
 		}
@@ -87,11 +101,10 @@ func (a *MigratedFromStorageAction) attemptApply() (Result, error) {
 
 	// make sure that legacy state file is deleted immediately after new workspace is created
 	if legacyStateFileExists {
-		migratedStateFile := a.StateFile.ConvertToMigrated()
-		if _, err = migratedStateFile.Upload(); err != nil {
-			return Result{}, err
-		}
-		if _, err = a.StateFile.Delete(); err != nil {
+		moveSpan := a.Span.StartChild("state move")
+		err = a.StateFile.MoveToMigrated()
+		moveSpan.End(err)
+		if err != nil {
 			return Result{}, err
 		}
 	}
@@ -129,11 +142,16 @@ func (a *MigratedFromStorageAction) attemptApply() (Result, error) {
 
 func (a *MigratedFromStorageAction) Destroy() (Result, error) {
 	err := a.setup()
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return alreadyDestroyed(a.EnvName, a.Logger), nil
+	}
 	if err != nil {
 		return Result{}, err
 	}
 
-	result, err := a.attemptDestroy()
+	destroySpan := a.Span.StartChild("terraform destroy")
+	result, err := a.attemptDestroy(context.Background())
+	destroySpan.End(err)
 	if err == nil {
 		a.Logger.Success("Successfully Ran Terraform Destroy!")
 	}
@@ -141,7 +159,7 @@ func (a *MigratedFromStorageAction) Destroy() (Result, error) {
 	return result, err
 }
 
-func (a *MigratedFromStorageAction) attemptDestroy() (Result, error) {
+func (a *MigratedFromStorageAction) attemptDestroy(ctx context.Context) (Result, error) {
 	a.Logger.WarnSection("Terraform Destroy")
 	defer a.Logger.EndSection()
 
@@ -161,7 +179,7 @@ func (a *MigratedFromStorageAction) attemptDestroy() (Result, error) {
 	}
 
 	if legacyStateFileExists {
-		_, err = a.StateFile.Download()
+		err = downloadStateFile(a.StateFile, a.Model, a.Logger)
 		if err != nil {
 			return Result{}, err
 		}
@@ -178,7 +196,12 @@ func (a *MigratedFromStorageAction) attemptDestroy() (Result, error) {
 		}
 	}
 
-	if err := a.Client.WorkspaceSelect(a.EnvName); err != nil {
+	if err := a.Client.WorkspaceSelect(a.EnvName); errors.Is(err, ErrWorkspaceNotFound) {
+		if err := a.deletePlanWorkspaceIfExists(); err != nil {
+			return Result{}, err
+		}
+		return alreadyDestroyed(a.EnvName, a.Logger), nil
+	} else if err != nil {
 		return Result{}, err
 	}
 
@@ -186,11 +209,12 @@ func (a *MigratedFromStorageAction) attemptDestroy() (Result, error) {
 		return Result{}, err
 	}
 
-	if err := a.Client.Destroy(); err != nil {
+	if err := a.Client.Destroy(ctx); err != nil {
 		return Result{}, err
 	}
 
-	if err := a.Client.WorkspaceDelete(a.EnvName); err != nil {
+	// a concurrent destroy may have deleted the workspace in the meantime
+	if err := a.Client.WorkspaceDelete(a.EnvName); err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
 		return Result{}, err
 	}
 
@@ -212,7 +236,12 @@ func (a *MigratedFromStorageAction) Plan() (Result, error) {
 		return Result{}, err
 	}
 
+	planSpan := a.Span.StartChild("terraform plan")
 	result, err := a.attemptPlan()
+	if err == nil {
+		recordPlanChanges(planSpan, a.Model.JSONPlanFileLocalPath)
+	}
+	planSpan.End(err)
 	if err != nil {
 		a.Logger.Error("Failed To Run Terraform Plan!")
 		err = fmt.Errorf("Plan Error: %s", err)
@@ -245,7 +274,7 @@ func (a *MigratedFromStorageAction) attemptPlan() (Result, error) {
 	}
 
 	if legacyStateFileExists {
-		_, err = a.StateFile.Download()
+		err = downloadStateFile(a.StateFile, a.Model, a.Logger)
 		if err != nil {
 			return Result{}, err
 		}
@@ -255,11 +284,10 @@ func (a *MigratedFromStorageAction) attemptPlan() (Result, error) {
 		}
 
 		// make sure that legacy state file is deleted immediately after new workspace is created
-		migratedStateFile := a.StateFile.ConvertToMigrated()
-		if _, err = migratedStateFile.Upload(); err != nil {
-			return Result{}, err
-		}
-		if _, err = a.StateFile.Delete(); err != nil {
+		moveSpan := a.Span.StartChild("state move")
+		err = a.StateFile.MoveToMigrated()
+		moveSpan.End(err)
+		if err != nil {
 			return Result{}, err
 		}
 	} else {
@@ -268,7 +296,7 @@ func (a *MigratedFromStorageAction) attemptPlan() (Result, error) {
 		}
 	}
 
-	planChecksum, err := a.Client.Plan()
+	planChecksum, hasChanges, err := a.Client.Plan()
 	if err != nil {
 		return Result{}, err
 	}
@@ -278,6 +306,11 @@ func (a *MigratedFromStorageAction) attemptPlan() (Result, error) {
 		return Result{}, err
 	}
 
+	err = a.Client.TextPlan()
+	if err != nil {
+		return Result{}, err
+	}
+
 	if err := a.Client.SavePlanToBackend(a.planNameForEnv()); err != nil {
 		return Result{}, err
 	}
@@ -288,6 +321,7 @@ func (a *MigratedFromStorageAction) attemptPlan() (Result, error) {
 			EnvName:      a.EnvName,
 			PlanChecksum: planChecksum,
 		},
+		PlanHasChanges: &hasChanges,
 	}, nil
 }
 
@@ -296,15 +330,18 @@ func (a *MigratedFromStorageAction) setup() error {
 		return err
 	}
 
-	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source); err != nil {
+	if err := copyOverrideFilesIntoSource(a.Model.OverrideFiles, a.Model.Source, a.Logger); err != nil {
 		return err
 	}
 
-	if err := copyOverrideFilesIntoSourceDir(a.Model.ModuleOverrideFiles); err != nil {
+	if err := copyOverrideFilesIntoSourceDir(a.Model.ModuleOverrideFiles, a.Model.Source, a.Logger); err != nil {
 		return err
 	}
 
-	if err := a.Client.InitWithBackend(); err != nil {
+	initSpan := a.Span.StartChild("terraform init")
+	err := withSSHKeyFile(a.Model, a.Client.InitWithBackend)
+	initSpan.End(err)
+	if err != nil {
 		return err
 	}
 
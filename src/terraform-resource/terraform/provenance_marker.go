@@ -0,0 +1,165 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const provenanceSuffix = markerNamespace + "provenance"
+
+// maxProvenanceRecords bounds the marker, older serials can no longer be
+// rolled back to
+const maxProvenanceRecords = 50
+
+// ProvenanceRecord is what a serial was applied with. The inputs are only
+// kept as the models.Terraform ConfigHash so secret vars are never stored.
+type ProvenanceRecord struct {
+	Serial         int    `json:"serial"`
+	Lineage        string `json:"lineage"`
+	ConfigHash     string `json:"config_hash"`
+	SourceRevision string `json:"source_revision,omitempty"`
+	PipelineName   string `json:"pipeline_name,omitempty"`
+	JobName        string `json:"job_name,omitempty"`
+	BuildName      string `json:"build_name,omitempty"`
+}
+
+// NewProvenanceRecord reads the build metadata Concourse sets for the put
+// and the commit of the git checkout containing sourceDir, if any
+func NewProvenanceRecord(configHash string, sourceDir string) ProvenanceRecord {
+	return ProvenanceRecord{
+		ConfigHash:     configHash,
+		SourceRevision: sourceRevision(sourceDir),
+		PipelineName:   os.Getenv("BUILD_PIPELINE_NAME"),
+		JobName:        os.Getenv("BUILD_JOB_NAME"),
+		BuildName:      os.Getenv("BUILD_NAME"),
+	}
+}
+
+// String describes where the record came from for error messages
+func (r ProvenanceRecord) String() string {
+	details := []string{}
+	if r.SourceRevision != "" {
+		details = append(details, fmt.Sprintf("source revision %s", r.SourceRevision))
+	}
+	if r.JobName != "" {
+		details = append(details, fmt.Sprintf("job '%s/%s' build '%s'", r.PipelineName, r.JobName, r.BuildName))
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("serial %d", r.Serial)
+	}
+	return fmt.Sprintf("serial %d (%s)", r.Serial, strings.Join(details, ", "))
+}
+
+// ProvenanceMarker records the inputs of the most recent serials of an env
+// so the `rollback` action can check a previous apply is being reproduced.
+// The marker is stored as the outputs of a separate workspace, similar to
+// InventoryMarker.
+type ProvenanceMarker struct {
+	Client  Client
+	EnvName string
+}
+
+// Read returns the records oldest first, or none if the env was never
+// applied with `record_provenance`.
+func (m ProvenanceMarker) Read() ([]ProvenanceRecord, error) {
+	values, found, err := readMarkerWorkspace(m.Client, m.workspace())
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var records []ProvenanceRecord
+	if err := json.Unmarshal([]byte(values["records"]), &records); err != nil {
+		return nil, fmt.Errorf("Failed to parse provenance in workspace '%s': %s", m.workspace(), err)
+	}
+	return records, nil
+}
+
+// Find returns the record for serial, false if none was kept
+func (m ProvenanceMarker) Find(serial int) (ProvenanceRecord, bool, error) {
+	records, err := m.Read()
+	if err != nil {
+		return ProvenanceRecord{}, false, err
+	}
+	for _, record := range records {
+		if record.Serial == serial {
+			return record, true, nil
+		}
+	}
+	return ProvenanceRecord{}, false, nil
+}
+
+// Add appends record, replacing any earlier record of the same serial and
+// dropping the oldest records beyond maxProvenanceRecords.
+func (m ProvenanceMarker) Add(record ProvenanceRecord) error {
+	existing, err := m.Read()
+	if err != nil {
+		return err
+	}
+	records := []ProvenanceRecord{}
+	for _, r := range existing {
+		if r.Serial != record.Serial {
+			records = append(records, r)
+		}
+	}
+	records = append(records, record)
+	if len(records) > maxProvenanceRecords {
+		records = records[len(records)-maxProvenanceRecords:]
+	}
+
+	contents, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := m.Clear(); err != nil {
+		return err
+	}
+	return writeMarkerWorkspace(m.Client, m.workspace(), map[string]string{
+		"records": string(contents),
+	})
+}
+
+// Clear removes the records, e.g. once the env is destroyed.
+func (m ProvenanceMarker) Clear() error {
+	if _, found, err := readMarkerWorkspace(m.Client, m.workspace()); err != nil || !found {
+		return err
+	}
+	return m.Client.WorkspaceDeleteWithForce(m.workspace())
+}
+
+func (m ProvenanceMarker) workspace() string {
+	return fmt.Sprintf("%s%s", m.EnvName, provenanceSuffix)
+}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// sourceRevision returns the commit checked out by the Concourse git
+// resource, which writes it to `.git/ref`, falling back to a detached HEAD.
+// It is empty if dir is not within a git checkout.
+func sourceRevision(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		gitDir := filepath.Join(dir, ".git")
+		if _, err := os.Stat(gitDir); err == nil {
+			for _, name := range []string{"ref", "HEAD"} {
+				contents, err := ioutil.ReadFile(filepath.Join(gitDir, name))
+				if err == nil && commitSHA.MatchString(strings.TrimSpace(string(contents))) {
+					return strings.TrimSpace(string(contents))
+				}
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
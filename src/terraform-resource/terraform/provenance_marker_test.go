@@ -0,0 +1,214 @@
+package terraform_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ljfranklin/terraform-resource/logger"
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProvenanceMarker", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+		// fake backend mapping workspace name to its outputs
+		backend   map[string]map[string]map[string]interface{}
+		serial    int
+		buildDir  string
+		sourceDir string
+		logWriter *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		backend = map[string]map[string]map[string]interface{}{}
+		fakeClient = &terraformfakes.FakeClient{}
+		fakeClient.WorkspaceListStub = func() ([]string, error) {
+			spaces := []string{}
+			for space := range backend {
+				spaces = append(spaces, space)
+			}
+			return spaces, nil
+		}
+		fakeClient.OutputStub = func(space string) (map[string]map[string]interface{}, error) {
+			return backend[space], nil
+		}
+		fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+			if _, ok := backend[space]; ok {
+				return fmt.Errorf("Workspace %q already exists", space)
+			}
+			contents, err := ioutil.ReadFile(stateFilePath)
+			if err != nil {
+				return err
+			}
+			state := struct {
+				Outputs map[string]map[string]interface{} `json:"outputs"`
+			}{}
+			if err := json.Unmarshal(contents, &state); err != nil {
+				return err
+			}
+			backend[space] = state.Outputs
+			return nil
+		}
+		fakeClient.WorkspaceDeleteWithForceStub = func(space string) error {
+			delete(backend, space)
+			return nil
+		}
+
+		// each apply bumps the serial
+		serial = 0
+		fakeClient.ApplyStub = func() error {
+			serial++
+			return nil
+		}
+		fakeClient.CurrentStateVersionStub = func(string) (terraform.StateVersion, error) {
+			return terraform.StateVersion{Serial: serial, Lineage: "some-lineage"}, nil
+		}
+
+		var err error
+		buildDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-provenance-marker-test")
+		Expect(err).ToNot(HaveOccurred())
+		sourceDir = path.Join(buildDir, "terraform")
+		Expect(os.MkdirAll(sourceDir, 0755)).To(Succeed())
+		logWriter = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(buildDir)
+	})
+
+	newAction := func(configHash string) terraform.Action {
+		return terraform.Action{
+			Client:           fakeClient,
+			EnvName:          "some-env",
+			Model:            models.Terraform{Source: sourceDir},
+			Logger:           logger.Logger{Sink: logWriter},
+			RecordProvenance: true,
+			ConfigHash:       configHash,
+		}
+	}
+
+	It("records the config hash and git revision of each applied serial", func() {
+		Expect(os.MkdirAll(path.Join(buildDir, ".git"), 0755)).To(Succeed())
+		revision := "0123456789abcdef0123456789abcdef01234567"
+		Expect(ioutil.WriteFile(path.Join(buildDir, ".git", "ref"), []byte(revision+"\n"), 0644)).To(Succeed())
+
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		action = newAction("second-hash")
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		records, err := terraform.ProvenanceMarker{Client: fakeClient, EnvName: "some-env"}.Read()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Serial).To(Equal(1))
+		Expect(records[0].ConfigHash).To(Equal("first-hash"))
+		Expect(records[0].Lineage).To(Equal("some-lineage"))
+		Expect(records[0].SourceRevision).To(Equal(revision))
+		Expect(records[1].Serial).To(Equal(2))
+		Expect(records[1].ConfigHash).To(Equal("second-hash"))
+		Expect(terraform.IsMarkerWorkspace("some-env__tfr_provenance")).To(BeTrue())
+	})
+
+	It("rolls back to a serial whose inputs match", func() {
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		action = newAction("second-hash")
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		action = newAction("first-hash")
+		result, err := action.Rollback(1)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeClient.ApplyCallCount()).To(Equal(3))
+		Expect(result.Version.Serial).To(Equal("3"))
+		Expect(logWriter.String()).To(ContainSubstring("Rolling back env 'some-env' from serial 2 to the config of serial 1"))
+
+		record, found, err := terraform.ProvenanceMarker{Client: fakeClient, EnvName: "some-env"}.Find(3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(record.ConfigHash).To(Equal("first-hash"))
+	})
+
+	It("refuses to roll back if the inputs don't match those of the serial", func() {
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		action = newAction("second-hash")
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		action = newAction("second-hash")
+		_, err = action.Rollback(1)
+		Expect(err).To(MatchError(ContainSubstring("don't match those serial 1 was applied with")))
+		Expect(err).To(MatchError(ContainSubstring("rollback_source")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(2))
+	})
+
+	It("refuses to roll back to a serial without a record", func() {
+		serial = 5
+		action := newAction("some-hash")
+		_, err := action.Rollback(4)
+		Expect(err).To(MatchError(ContainSubstring("can't be reconstructed")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(0))
+	})
+
+	It("refuses to roll back to a serial of a previous lineage", func() {
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		action = newAction("second-hash")
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		fakeClient.CurrentStateVersionStub = func(string) (terraform.StateVersion, error) {
+			return terraform.StateVersion{Serial: serial, Lineage: "other-lineage"}, nil
+		}
+		action = newAction("first-hash")
+		_, err = action.Rollback(1)
+		Expect(err).To(MatchError(ContainSubstring("now has lineage 'other-lineage'")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(2))
+	})
+
+	It("refuses to roll back to the current serial", func() {
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = action.Rollback(1)
+		Expect(err).To(MatchError(ContainSubstring("must be older than the current serial 1")))
+	})
+
+	It("still enforces max_changes", func() {
+		action := newAction("first-hash")
+		_, err := action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		action = newAction("second-hash")
+		_, err = action.Apply()
+		Expect(err).ToNot(HaveOccurred())
+
+		planPath := path.Join(buildDir, "plan.json")
+		plan := `{"resource_changes": [{"address": "aws_instance.a", "change": {"actions": ["delete"]}}]}`
+		Expect(ioutil.WriteFile(planPath, []byte(plan), 0644)).To(Succeed())
+
+		zero := 0
+		action = newAction("first-hash")
+		action.Model.JSONPlanFileLocalPath = planPath
+		action.MaxChanges = &models.ChangeBudget{Destroy: &zero}
+		_, err = action.Rollback(1)
+		Expect(err).To(MatchError(ContainSubstring("aws_instance.a")))
+		Expect(fakeClient.ApplyCallCount()).To(Equal(2))
+	})
+})
@@ -0,0 +1,165 @@
+package terraform
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+const putIntentSuffix = markerNamespace + "put_intent"
+
+// putIntentExpiry is how long a marker from the same build counts as a
+// sibling `put`. Siblings under `in_parallel` claim within moments of each
+// other, whereas a step retried with `attempts` only starts once the earlier
+// attempt has ended, which leaves its marker behind if it was killed, e.g. by
+// `timeout`.
+const putIntentExpiry = 5 * time.Minute
+
+// PutIntent records that a `put` of an env is in progress for a build so a
+// sibling `put` of the same env in the same build can fail immediately
+// rather than waiting on the state lock. The marker is stored as the outputs
+// of a separate workspace, similar to how plans are stored.
+type PutIntent struct {
+	Client    Client
+	EnvName   string
+	BuildID   string
+	BuildName string
+	JobName   string
+	Host      string
+
+	token string
+}
+
+type putIntentMarker struct {
+	BuildID   string
+	BuildName string
+	JobName   string
+	Host      string
+	Token     string
+	ClaimedAt time.Time
+}
+
+// NewPutIntent identifies the current build from the Concourse build
+// metadata. Concourse doesn't expose the step name so the container hostname
+// is the closest thing to identify a sibling step.
+func NewPutIntent(client Client, envName string) *PutIntent {
+	host, _ := os.Hostname()
+	return &PutIntent{
+		Client:    client,
+		EnvName:   envName,
+		BuildID:   os.Getenv("BUILD_ID"),
+		BuildName: os.Getenv("BUILD_NAME"),
+		JobName:   os.Getenv("BUILD_JOB_NAME"),
+		Host:      host,
+	}
+}
+
+// Claim must be called after the Client has been initialized with the backend.
+// Claiming again, e.g. for the destroy run by `delete_on_failure`, keeps the
+// existing claim.
+func (p *PutIntent) Claim() error {
+	if p.token != "" {
+		return nil
+	}
+	p.token = randomHex(16)
+
+	existing, found, err := p.read()
+	if err != nil {
+		return err
+	}
+	if found {
+		if existing.BuildID == p.BuildID && time.Since(existing.ClaimedAt) < putIntentExpiry {
+			return p.siblingError(existing)
+		}
+		// left behind by an earlier build, or an earlier attempt of this
+		// step, which was aborted before cleaning up
+		if err := p.Client.WorkspaceDeleteWithForce(p.workspace()); err != nil {
+			return err
+		}
+	}
+
+	if err := p.write(); err != nil {
+		// a sibling may have created the marker since we checked
+		if existing, found, readErr := p.read(); readErr == nil && found && existing.Token != p.token {
+			return p.siblingError(existing)
+		}
+		return err
+	}
+
+	// guards against a sibling overwriting the marker between our check and write
+	claimed, found, err := p.read()
+	if err != nil {
+		return err
+	}
+	if found && claimed.Token != p.token {
+		return p.siblingError(claimed)
+	}
+
+	return nil
+}
+
+// Release deletes the marker unless it now belongs to another put. It does
+// nothing if Claim was never called, e.g. because init failed.
+func (p *PutIntent) Release() error {
+	if p.token == "" {
+		return nil
+	}
+	current, found, err := p.read()
+	if err != nil {
+		return err
+	}
+	if !found || current.Token != p.token {
+		return nil
+	}
+	return p.Client.WorkspaceDeleteWithForce(p.workspace())
+}
+
+func (p *PutIntent) workspace() string {
+	return fmt.Sprintf("%s%s", p.EnvName, putIntentSuffix)
+}
+
+func (p *PutIntent) siblingError(marker putIntentMarker) error {
+	return fmt.Errorf(
+		"Another `put` to env '%s' is already running in this build (job '%s', build '%s', container '%s'). "+
+			"Remove the duplicate `put` step or set `put.params.allow_parallel_puts: true` to wait for the state lock instead.",
+		p.EnvName, marker.JobName, marker.BuildName, marker.Host,
+	)
+}
+
+func (p *PutIntent) read() (putIntentMarker, bool, error) {
+	values, found, err := readMarkerWorkspace(p.Client, p.workspace())
+	if err != nil || !found {
+		return putIntentMarker{}, found, err
+	}
+
+	// a marker without a valid time is treated as expired
+	claimedAt, _ := time.Parse(time.RFC3339, values["claimed_at"])
+
+	return putIntentMarker{
+		BuildID:   values["build_id"],
+		BuildName: values["build_name"],
+		JobName:   values["job_name"],
+		Host:      values["host"],
+		Token:     values["token"],
+		ClaimedAt: claimedAt,
+	}, true, nil
+}
+
+func (p *PutIntent) write() error {
+	return writeMarkerWorkspace(p.Client, p.workspace(), map[string]string{
+		"build_id":   p.BuildID,
+		"build_name": p.BuildName,
+		"job_name":   p.JobName,
+		"host":       p.Host,
+		"token":      p.token,
+		"claimed_at": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func randomHex(numBytes int) string {
+	b := make([]byte, numBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package terraform_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/terraform"
+	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PutIntent", func() {
+	var (
+		fakeClient *terraformfakes.FakeClient
+		// fake backend mapping workspace name to its outputs
+		backend map[string]map[string]map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		backend = map[string]map[string]map[string]interface{}{}
+		fakeClient = &terraformfakes.FakeClient{}
+		fakeClient.WorkspaceListStub = func() ([]string, error) {
+			spaces := []string{}
+			for space := range backend {
+				spaces = append(spaces, space)
+			}
+			return spaces, nil
+		}
+		fakeClient.OutputStub = func(space string) (map[string]map[string]interface{}, error) {
+			return backend[space], nil
+		}
+		fakeClient.WorkspaceNewFromExistingStateFileStub = func(space string, stateFilePath string) error {
+			if _, ok := backend[space]; ok {
+				return fmt.Errorf("Workspace %q already exists", space)
+			}
+			contents, err := ioutil.ReadFile(stateFilePath)
+			if err != nil {
+				return err
+			}
+			state := struct {
+				Outputs map[string]map[string]interface{} `json:"outputs"`
+			}{}
+			if err := json.Unmarshal(contents, &state); err != nil {
+				return err
+			}
+			backend[space] = state.Outputs
+			return nil
+		}
+		fakeClient.WorkspaceDeleteWithForceStub = func(space string) error {
+			delete(backend, space)
+			return nil
+		}
+	})
+
+	newIntent := func(buildID string, host string) *terraform.PutIntent {
+		return &terraform.PutIntent{
+			Client:    fakeClient,
+			EnvName:   "some-env",
+			BuildID:   buildID,
+			BuildName: "42",
+			JobName:   "deploy",
+			Host:      host,
+		}
+	}
+
+	It("writes a marker and removes it on release", func() {
+		intent := newIntent("1234", "container-a")
+
+		Expect(intent.Claim()).To(Succeed())
+		Expect(backend).To(HaveKey("some-env__tfr_put_intent"))
+		Expect(backend["some-env__tfr_put_intent"]["build_id"]["value"]).To(Equal("1234"))
+
+		Expect(intent.Release()).To(Succeed())
+		Expect(backend).ToNot(HaveKey("some-env__tfr_put_intent"))
+	})
+
+	It("fails a sibling put in the same build naming the other container", func() {
+		Expect(newIntent("1234", "container-a").Claim()).To(Succeed())
+
+		err := newIntent("1234", "container-b").Claim()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("already running in this build"))
+		Expect(err.Error()).To(ContainSubstring("container-a"))
+		Expect(err.Error()).To(ContainSubstring("allow_parallel_puts"))
+	})
+
+	It("replaces a marker left behind by an earlier attempt in the same build", func() {
+		Expect(newIntent("1234", "container-a").Claim()).To(Succeed())
+		backend["some-env__tfr_put_intent"]["claimed_at"]["value"] = time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+
+		Expect(newIntent("1234", "container-b").Claim()).To(Succeed())
+		Expect(backend["some-env__tfr_put_intent"]["host"]["value"]).To(Equal("container-b"))
+	})
+
+	It("keeps its claim when claimed again by the same put", func() {
+		intent := newIntent("1234", "container-a")
+		Expect(intent.Claim()).To(Succeed())
+		Expect(intent.Claim()).To(Succeed())
+		Expect(fakeClient.WorkspaceNewFromExistingStateFileCallCount()).To(Equal(1))
+	})
+
+	It("replaces a marker left behind by an earlier build", func() {
+		Expect(newIntent("1111", "container-a").Claim()).To(Succeed())
+
+		Expect(newIntent("2222", "container-b").Claim()).To(Succeed())
+		Expect(backend["some-env__tfr_put_intent"]["build_id"]["value"]).To(Equal("2222"))
+	})
+
+	It("does not remove a marker belonging to another put", func() {
+		intent := newIntent("1111", "container-a")
+		Expect(intent.Claim()).To(Succeed())
+		Expect(newIntent("2222", "container-b").Claim()).To(Succeed())
+
+		Expect(intent.Release()).To(Succeed())
+		Expect(backend).To(HaveKey("some-env__tfr_put_intent"))
+	})
+})
@@ -0,0 +1,66 @@
+package terraform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/models"
+)
+
+const gitSSHCommandEnv = "GIT_SSH_COMMAND"
+
+// withSSHKeyFile runs init with `ssh_private_key` written to a temp file which
+// GIT_SSH_COMMAND points ssh at. Only init fetches modules, so the file is
+// removed and GIT_SSH_COMMAND restored as soon as init returns. A
+// GIT_SSH_COMMAND in `env` still takes precedence as the client sets it last.
+func withSSHKeyFile(model models.Terraform, init func() error) error {
+	if model.SSHPrivateKey == "" {
+		return init()
+	}
+
+	keyFile, err := ioutil.TempFile("", "terraform-resource-ssh-key")
+	if err != nil {
+		return fmt.Errorf("Failed to create file for `ssh_private_key`: %s", err)
+	}
+	defer os.Remove(keyFile.Name())
+
+	// ssh rejects keys without a trailing newline
+	key := model.SSHPrivateKey
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
+	}
+	// TempFile creates the file with 0600, which ssh requires of keys
+	_, err = keyFile.WriteString(key)
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write `ssh_private_key`: %s", err)
+	}
+
+	previous, wasSet := os.LookupEnv(gitSSHCommandEnv)
+	defer func() {
+		if wasSet {
+			os.Setenv(gitSSHCommandEnv, previous)
+		} else {
+			os.Unsetenv(gitSSHCommandEnv)
+		}
+	}()
+	if err = os.Setenv(gitSSHCommandEnv, gitSSHCommandWithKey(keyFile.Name(), model.PrivateKeyUser)); err != nil {
+		return err
+	}
+
+	return init()
+}
+
+// gitSSHCommandWithKey only offers the given key, rather than any from an
+// ssh-agent or ~/.ssh, logging in as `private_key_user` if set
+func gitSSHCommandWithKey(keyPath string, user string) string {
+	command := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", shellQuote(keyPath))
+	if user != "" {
+		command += fmt.Sprintf(" -l %s", user)
+	}
+	return command
+}
@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// StateLockedError is returned when a command failed because another
+// process holds the state lock, with the `Lock Info` terraform reports
+type StateLockedError struct {
+	Err       error
+	ID        string
+	Path      string
+	Operation string
+	Who       string
+	Created   string
+}
+
+func (e *StateLockedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StateLockedError) Unwrap() error {
+	return e.Err
+}
+
+// LockInfo describes the holder of the lock for errors and logs
+func (e *StateLockedError) LockInfo() string {
+	return fmt.Sprintf("ID: %s, Path: %s, Operation: %s, Who: %s, Created: %s", e.ID, e.Path, e.Operation, e.Who, e.Created)
+}
+
+// HeldForWorkspace is true if the lock Path names the given workspace, e.g.
+// `bucket/env:/staging/terraform.tfstate` for the s3 backend. Terraform only
+// records `user@hostname` as the holder, so the path is the only part of the
+// lock tying it to an env. A lock on the `default` workspace is never matched
+// as most backends leave the workspace out of its path.
+func (e *StateLockedError) HeldForWorkspace(workspace string) bool {
+	if workspace == "" || workspace == defaultWorkspace {
+		return false
+	}
+	// `staging` must not match the lock of `staging-plan`
+	pattern := regexp.MustCompile(`(^|[^A-Za-z0-9_-])` + regexp.QuoteMeta(workspace) + `($|[^A-Za-z0-9_-])`)
+	return pattern.MatchString(e.Path)
+}
+
+// stateLockError returns a StateLockedError wrapping err if output reports
+// the state lock couldn't be acquired and includes the lock ID, otherwise err
+func stateLockError(err error, output []byte) error {
+	if err == nil || !bytes.Contains(output, []byte("Error acquiring the state lock")) {
+		return err
+	}
+
+	lockErr := &StateLockedError{Err: err}
+	fields := map[string]*string{
+		"ID":        &lockErr.ID,
+		"Path":      &lockErr.Path,
+		"Operation": &lockErr.Operation,
+		"Who":       &lockErr.Who,
+		"Created":   &lockErr.Created,
+	}
+	inLockInfo := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// terraform prefixes diagnostics with a `│` border in a terminal
+		line := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(scanner.Text()), "│"))
+		if line == "Lock Info:" {
+			inLockInfo = true
+			continue
+		}
+		if !inLockInfo {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if field, ok := fields[strings.TrimSpace(parts[0])]; ok && *field == "" {
+			*field = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if lockErr.ID == "" {
+		return err
+	}
+	return lockErr
+}
@@ -0,0 +1,56 @@
+package terraform
+
+import "github.com/ljfranklin/terraform-resource/models"
+
+// StateManipulation changes the state of an env after imports and before
+// apply, e.g. to move a resource to its new address after a refactor.
+type StateManipulation interface {
+	Manipulate(client Client, envName string) error
+}
+
+// NewStateManipulations converts the `state_manipulations` put param, which
+// models.OutParams has already validated
+func NewStateManipulations(changes []models.StateChange) []StateManipulation {
+	manipulations := []StateManipulation{}
+	for _, change := range changes {
+		switch {
+		case change.Mv != nil:
+			manipulations = append(manipulations, StateMvManipulation{From: change.Mv.From, To: change.Mv.To})
+		case change.Rm != "":
+			manipulations = append(manipulations, StateRmManipulation{Address: change.Rm})
+		case change.Taint != "":
+			manipulations = append(manipulations, TaintManipulation{Address: change.Taint})
+		}
+	}
+	return manipulations
+}
+
+// StateMvManipulation runs `terraform state mv From To`.
+type StateMvManipulation struct {
+	From string
+	To   string
+}
+
+func (m StateMvManipulation) Manipulate(client Client, envName string) error {
+	return client.StateMv(envName, m.From, m.To)
+}
+
+// StateRmManipulation runs `terraform state rm Address`, so Terraform
+// forgets the resource without destroying it.
+type StateRmManipulation struct {
+	Address string
+}
+
+func (m StateRmManipulation) Manipulate(client Client, envName string) error {
+	return client.StateRm(envName, m.Address)
+}
+
+// TaintManipulation runs `terraform taint Address` so the resource is
+// replaced by the following apply.
+type TaintManipulation struct {
+	Address string
+}
+
+func (m TaintManipulation) Manipulate(client Client, envName string) error {
+	return client.Taint(envName, m.Address)
+}
@@ -0,0 +1,102 @@
+package terraform
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/storage"
+)
+
+// StateModifiedTime returns when the backend last wrote the env's statefile,
+// the zero time if it has none
+type StateModifiedTime func(envName string) (time.Time, error)
+
+// NewStateModifiedTime reads the statefile of the `local` and `s3` backends
+// directly, as Terraform doesn't record when the state was written in the
+// state itself. It is nil for other backends, and for s3 credentials the
+// storage driver can't reproduce, e.g. a session token or an assumed role.
+func NewStateModifiedTime(model models.Terraform, httpClient *http.Client) StateModifiedTime {
+	switch model.BackendType {
+	case "local":
+		return localStateModifiedTime(model)
+	case "s3":
+		return s3StateModifiedTime(model, httpClient)
+	}
+	return nil
+}
+
+func localStateModifiedTime(model models.Terraform) StateModifiedTime {
+	return func(envName string) (time.Time, error) {
+		statePath := backendConfigString(model.BackendConfig, "path", "terraform.tfstate")
+		if workspace := workspaceName(model, envName); workspace != defaultWorkspace {
+			workspaceDir := backendConfigString(model.BackendConfig, "workspace_dir", "terraform.tfstate.d")
+			statePath = filepath.Join(workspaceDir, workspace, "terraform.tfstate")
+		}
+		if !filepath.IsAbs(statePath) {
+			statePath = filepath.Join(model.Source, statePath)
+		}
+
+		info, err := os.Stat(statePath)
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+}
+
+func s3StateModifiedTime(model models.Terraform, httpClient *http.Client) StateModifiedTime {
+	config := model.BackendConfig
+	for _, key := range []string{"token", "role_arn", "assume_role"} {
+		if _, ok := config[key]; ok {
+			return nil
+		}
+	}
+	if model.Env["AWS_SESSION_TOKEN"] != "" {
+		return nil
+	}
+
+	pathStyle := backendConfigBool(config, "use_path_style") || backendConfigBool(config, "force_path_style")
+	endpoint := backendConfigString(config, "endpoint", "")
+	if endpoints, ok := config["endpoints"].(map[string]interface{}); ok {
+		endpoint = backendConfigString(endpoints, "s3", endpoint)
+	}
+	driver := storage.NewS3(storage.Model{
+		Bucket:          backendConfigString(config, "bucket", ""),
+		AccessKeyID:     backendConfigString(config, "access_key", model.Env["AWS_ACCESS_KEY_ID"]),
+		SecretAccessKey: backendConfigString(config, "secret_key", model.Env["AWS_SECRET_ACCESS_KEY"]),
+		RegionName:      backendConfigString(config, "region", model.Env["AWS_REGION"]),
+		Profile:         backendConfigString(config, "profile", model.Env["AWS_PROFILE"]),
+		Endpoint:        endpoint,
+		UsePathStyle:    &pathStyle,
+		UseSigningV4:    true,
+		HTTPClient:      httpClient,
+	})
+
+	return func(envName string) (time.Time, error) {
+		key := backendConfigString(config, "key", "")
+		if workspace := workspaceName(model, envName); workspace != defaultWorkspace {
+			key = path.Join(backendConfigString(config, "workspace_key_prefix", "env:"), workspace, key)
+		}
+		version, err := driver.Version(key)
+		return version.LastModified, err
+	}
+}
+
+func backendConfigString(config map[string]interface{}, key string, defaultValue string) string {
+	if value, ok := config[key].(string); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func backendConfigBool(config map[string]interface{}, key string) bool {
+	value, _ := config[key].(bool)
+	return value
+}
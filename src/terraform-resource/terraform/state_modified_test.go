@@ -0,0 +1,73 @@
+package terraform_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/terraform"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StateModifiedTime", func() {
+	var (
+		sourceDir string
+		model     models.Terraform
+	)
+
+	BeforeEach(func() {
+		var err error
+		sourceDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-state-modified-test")
+		Expect(err).ToNot(HaveOccurred())
+		model = models.Terraform{
+			Source:      sourceDir,
+			BackendType: "local",
+		}
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(sourceDir)
+	})
+
+	writeState := func(statePath string, modified time.Time) {
+		Expect(os.MkdirAll(path.Dir(statePath), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(statePath, []byte(`{"serial": 1}`), 0644)).To(Succeed())
+		Expect(os.Chtimes(statePath, modified, modified)).To(Succeed())
+	}
+
+	It("reads the mtime of a workspace's statefile with the local backend", func() {
+		modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		writeState(path.Join(sourceDir, "terraform.tfstate.d", "some-env", "terraform.tfstate"), modified)
+
+		stateModified := terraform.NewStateModifiedTime(model, nil)
+		Expect(stateModified("some-env")).To(BeTemporally("==", modified))
+	})
+
+	It("uses the workspace_dir and workspace prefix", func() {
+		modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		writeState(path.Join(sourceDir, "states", "team-a-some-env", "terraform.tfstate"), modified)
+		model.BackendConfig = map[string]interface{}{"workspace_dir": "states"}
+		model.WorkspacePrefix = "team-a-"
+
+		stateModified := terraform.NewStateModifiedTime(model, nil)
+		Expect(stateModified("some-env")).To(BeTemporally("==", modified))
+	})
+
+	It("returns the zero time if the env has no statefile", func() {
+		stateModified := terraform.NewStateModifiedTime(model, nil)
+		Expect(stateModified("missing-env")).To(BeZero())
+	})
+
+	It("is nil for backends whose statefiles it can't read", func() {
+		model.BackendType = "gcs"
+		Expect(terraform.NewStateModifiedTime(model, nil)).To(BeNil())
+
+		model.BackendType = "s3"
+		model.BackendConfig = map[string]interface{}{"bucket": "some-bucket", "role_arn": "some-role"}
+		Expect(terraform.NewStateModifiedTime(model, nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,40 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// StateOutputs returns the `outputs` of the root module in rawState, read
+// from the top level of current statefiles or from the root entry in
+// `modules` of the version 3 statefiles written by older terraform releases.
+// An empty state has no outputs.
+func StateOutputs(rawState []byte) (json.RawMessage, error) {
+	noOutputs := json.RawMessage("{}")
+	if len(bytes.TrimSpace(rawState)) == 0 {
+		return noOutputs, nil
+	}
+
+	state := struct {
+		Outputs json.RawMessage `json:"outputs"`
+		Modules []struct {
+			Path    []string        `json:"path"`
+			Outputs json.RawMessage `json:"outputs"`
+		} `json:"modules"`
+	}{}
+	if err := json.Unmarshal(rawState, &state); err != nil {
+		return nil, fmt.Errorf("Failed to parse statefile: %s", err)
+	}
+
+	outputs := state.Outputs
+	for _, module := range state.Modules {
+		if len(module.Path) == 1 && module.Path[0] == "root" {
+			outputs = module.Outputs
+		}
+	}
+	if len(outputs) == 0 || string(outputs) == "null" {
+		return noOutputs, nil
+	}
+	return outputs, nil
+}
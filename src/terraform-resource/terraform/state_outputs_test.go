@@ -0,0 +1,47 @@
+package terraform_test
+
+import (
+	"github.com/ljfranklin/terraform-resource/terraform"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StateOutputs", func() {
+	It("returns the top level outputs of the statefile", func() {
+		outputs, err := terraform.StateOutputs([]byte(`{
+			"version": 4,
+			"outputs": {"env_name": {"value": "staging", "type": "string"}},
+			"resources": []
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(MatchJSON(`{"env_name": {"value": "staging", "type": "string"}}`))
+	})
+
+	It("returns the root module outputs of a version 3 statefile", func() {
+		outputs, err := terraform.StateOutputs([]byte(`{
+			"version": 3,
+			"modules": [
+				{"path": ["root", "network"], "outputs": {"vpc_id": {"value": "vpc-1"}}},
+				{"path": ["root"], "outputs": {"env_name": {"value": "staging"}}}
+			]
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(MatchJSON(`{"env_name": {"value": "staging"}}`))
+	})
+
+	It("returns no outputs for an empty state", func() {
+		outputs, err := terraform.StateOutputs([]byte("\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(MatchJSON(`{}`))
+
+		outputs, err = terraform.StateOutputs([]byte(`{"version": 4, "resources": []}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outputs).To(MatchJSON(`{}`))
+	})
+
+	It("returns an error if the statefile is not JSON", func() {
+		_, err := terraform.StateOutputs([]byte("not-json"))
+		Expect(err).To(MatchError(ContainSubstring("Failed to parse statefile")))
+	})
+})
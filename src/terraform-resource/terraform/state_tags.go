@@ -0,0 +1,116 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// StateTags records which Concourse build last applied an env. Terraform
+// state has no field for custom metadata and drops unknown keys whenever it
+// rewrites the state, so the tags are stored as root outputs instead.
+type StateTags struct {
+	PipelineName string
+	JobName      string
+	BuildID      string
+	AppliedAt    time.Time
+}
+
+// NewStateTags reads the build metadata Concourse sets for the put
+func NewStateTags() StateTags {
+	return StateTags{
+		PipelineName: os.Getenv("BUILD_PIPELINE_NAME"),
+		JobName:      os.Getenv("BUILD_JOB_NAME"),
+		BuildID:      os.Getenv("BUILD_ID"),
+		AppliedAt:    time.Now().UTC(),
+	}
+}
+
+// ReadStateTags returns the tags from the env's outputs. The bool is false if
+// the env was never applied with `tag_state`.
+func ReadStateTags(client Client, envName string) (StateTags, bool, error) {
+	outputs, err := client.Output(envName)
+	if err != nil {
+		return StateTags{}, false, err
+	}
+	appliedAt, ok := outputs["concourse_applied_at"]["value"].(string)
+	if !ok {
+		return StateTags{}, false, nil
+	}
+
+	tags := StateTags{}
+	tags.AppliedAt, err = time.Parse(time.RFC3339, appliedAt)
+	if err != nil {
+		return StateTags{}, false, fmt.Errorf("Expected output 'concourse_applied_at' of '%s' to be an RFC 3339 time: %s", envName, err)
+	}
+	tags.PipelineName, _ = outputs["concourse_pipeline_name"]["value"].(string)
+	tags.JobName, _ = outputs["concourse_job_name"]["value"].(string)
+	tags.BuildID, _ = outputs["concourse_build_id"]["value"].(string)
+	return tags, true, nil
+}
+
+func (t StateTags) outputs() map[string]string {
+	return map[string]string{
+		"concourse_pipeline_name": t.PipelineName,
+		"concourse_job_name":      t.JobName,
+		"concourse_build_id":      t.BuildID,
+		"concourse_applied_at":    t.AppliedAt.Format(time.RFC3339),
+	}
+}
+
+// tagState adds the tags to the env's state and pushes it back with the
+// serial bumped, as the backend refuses a different state with the same serial
+func tagState(client Client, envName string, tags StateTags) error {
+	rawState, err := client.StatePull(envName)
+	if err != nil {
+		return err
+	}
+
+	// UseNumber keeps large numeric attributes exact across the round trip
+	decoder := json.NewDecoder(bytes.NewReader(rawState))
+	decoder.UseNumber()
+	state := map[string]interface{}{}
+	if err := decoder.Decode(&state); err != nil {
+		return fmt.Errorf("Failed to unmarshal JSON output.\nError: %s\nOutput: %s", err, rawState)
+	}
+
+	serial, err := json.Number(fmt.Sprintf("%v", state["serial"])).Int64()
+	if err != nil {
+		return fmt.Errorf("Expected number value for 'serial' but got '%#v'", state["serial"])
+	}
+	state["serial"] = serial + 1
+
+	outputs, ok := state["outputs"].(map[string]interface{})
+	if !ok {
+		outputs = map[string]interface{}{}
+	}
+	for name, value := range tags.outputs() {
+		outputs[name] = map[string]interface{}{
+			"value": value,
+			"type":  "string",
+		}
+	}
+	state["outputs"] = outputs
+
+	taggedState, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	stateFile, err := ioutil.TempFile("", "terraform-resource-tagged-state")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stateFile.Name())
+	if _, err := stateFile.Write(taggedState); err != nil {
+		stateFile.Close()
+		return err
+	}
+	if err := stateFile.Close(); err != nil {
+		return err
+	}
+
+	return client.StatePush(envName, stateFile.Name())
+}
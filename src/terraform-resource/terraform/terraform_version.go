@@ -0,0 +1,78 @@
+package terraform
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ljfranklin/terraform-resource/models"
+	"github.com/ljfranklin/terraform-resource/tfinstall"
+)
+
+// UseTerraformVersion returns model with `terraform_binary_path` pointing at
+// a binary of `terraform_version`, downloading the release if the bundled
+// binary is a different version. Nothing changes if no version is pinned.
+func UseTerraformVersion(model models.Terraform, httpClient *http.Client, logWriter io.Writer) (models.Terraform, error) {
+	if model.TerraformVersion == "" {
+		return model, nil
+	}
+
+	bundledVersion, err := NewClient(model, logWriter).Version()
+	if err == nil && parseVersion(bundledVersion) == model.TerraformVersion {
+		return model, nil
+	}
+
+	installer := tfinstall.Installer{
+		CacheDir:   tfinstall.DefaultCacheDir(),
+		HTTPClient: httpClient,
+	}
+	if model.DownloadCachePath != "" {
+		installer.CacheDir = downloadCache{path: model.DownloadCachePath}.terraformDir()
+	}
+	binaryPath, err := installer.Install(model.TerraformVersion)
+	if err != nil {
+		return models.Terraform{}, err
+	}
+	logWriter.Write([]byte(fmt.Sprintf("Using terraform %s from '%s'\n", model.TerraformVersion, binaryPath)))
+
+	model.TerraformBinaryPath = binaryPath
+	return model, nil
+}
+
+// parseVersion returns 1.5.7 from the `Terraform v1.5.7` first line of
+// `terraform -v`
+func parseVersion(versionOutput string) string {
+	firstLine := strings.SplitN(versionOutput, "\n", 2)[0]
+	return strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(firstLine, "Terraform")), "v")
+}
+
+// versionAtLeast compares dotted release numbers such as 1.5.7, ignoring any
+// pre-release suffix. An unparseable version is never at least minimum.
+func versionAtLeast(version string, minimum string) bool {
+	parse := func(v string) ([]int, bool) {
+		parts := strings.Split(strings.SplitN(v, "-", 2)[0], ".")
+		numbers := make([]int, len(parts))
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, false
+			}
+			numbers[i] = n
+		}
+		return numbers, true
+	}
+
+	got, ok := parse(version)
+	if !ok {
+		return false
+	}
+	want, _ := parse(minimum)
+	for i, n := range want {
+		if i >= len(got) || got[i] != n {
+			return i < len(got) && got[i] > n
+		}
+	}
+	return true
+}
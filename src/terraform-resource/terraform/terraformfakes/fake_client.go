@@ -2,12 +2,23 @@
 package terraformfakes
 
 import (
-	"sync"
+	"context"
 	"github.com/ljfranklin/terraform-resource/models"
 	"github.com/ljfranklin/terraform-resource/terraform"
+	"sync"
 )
 
 type FakeClient struct {
+	AppliedChangesStub        func() *terraform.AppliedChanges
+	appliedChangesMutex       sync.RWMutex
+	appliedChangesArgsForCall []struct {
+	}
+	appliedChangesReturns struct {
+		result1 *terraform.AppliedChanges
+	}
+	appliedChangesReturnsOnCall map[int]struct {
+		result1 *terraform.AppliedChanges
+	}
 	ApplyStub        func() error
 	applyMutex       sync.RWMutex
 	applyArgsForCall []struct {
@@ -18,6 +29,16 @@ type FakeClient struct {
 	applyReturnsOnCall map[int]struct {
 		result1 error
 	}
+	BackendChangeStub        func() *terraform.BackendChange
+	backendChangeMutex       sync.RWMutex
+	backendChangeArgsForCall []struct {
+	}
+	backendChangeReturns struct {
+		result1 *terraform.BackendChange
+	}
+	backendChangeReturnsOnCall map[int]struct {
+		result1 *terraform.BackendChange
+	}
 	CurrentStateVersionStub        func(string) (terraform.StateVersion, error)
 	currentStateVersionMutex       sync.RWMutex
 	currentStateVersionArgsForCall []struct {
@@ -31,9 +52,10 @@ type FakeClient struct {
 		result1 terraform.StateVersion
 		result2 error
 	}
-	DestroyStub        func() error
+	DestroyStub        func(context.Context) error
 	destroyMutex       sync.RWMutex
 	destroyArgsForCall []struct {
+		arg1 context.Context
 	}
 	destroyReturns struct {
 		result1 error
@@ -41,6 +63,17 @@ type FakeClient struct {
 	destroyReturnsOnCall map[int]struct {
 		result1 error
 	}
+	ForceUnlockStub        func(string) error
+	forceUnlockMutex       sync.RWMutex
+	forceUnlockArgsForCall []struct {
+		arg1 string
+	}
+	forceUnlockReturns struct {
+		result1 error
+	}
+	forceUnlockReturnsOnCall map[int]struct {
+		result1 error
+	}
 	GetPlanFromBackendStub        func(string) error
 	getPlanFromBackendMutex       sync.RWMutex
 	getPlanFromBackendArgsForCall []struct {
@@ -116,6 +149,20 @@ type FakeClient struct {
 		result1 map[string]map[string]interface{}
 		result2 error
 	}
+	OutputValueStub        func(string, string) (interface{}, error)
+	outputValueMutex       sync.RWMutex
+	outputValueArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	outputValueReturns struct {
+		result1 interface{}
+		result2 error
+	}
+	outputValueReturnsOnCall map[int]struct {
+		result1 interface{}
+		result2 error
+	}
 	OutputWithLegacyStorageStub        func() (map[string]map[string]interface{}, error)
 	outputWithLegacyStorageMutex       sync.RWMutex
 	outputWithLegacyStorageArgsForCall []struct {
@@ -128,16 +175,30 @@ type FakeClient struct {
 		result1 map[string]map[string]interface{}
 		result2 error
 	}
-	PlanStub        func() (string, error)
+	PlanStub        func() (string, bool, error)
 	planMutex       sync.RWMutex
 	planArgsForCall []struct {
 	}
 	planReturns struct {
 		result1 string
-		result2 error
+		result2 bool
+		result3 error
 	}
 	planReturnsOnCall map[int]struct {
 		result1 string
+		result2 bool
+		result3 error
+	}
+	RefreshOnlyStub        func() ([]string, error)
+	refreshOnlyMutex       sync.RWMutex
+	refreshOnlyArgsForCall []struct {
+	}
+	refreshOnlyReturns struct {
+		result1 []string
+		result2 error
+	}
+	refreshOnlyReturnsOnCall map[int]struct {
+		result1 []string
 		result2 error
 	}
 	SavePlanToBackendStub        func(string) error
@@ -156,6 +217,19 @@ type FakeClient struct {
 	setModelArgsForCall []struct {
 		arg1 models.Terraform
 	}
+	StateMvStub        func(string, string, string) error
+	stateMvMutex       sync.RWMutex
+	stateMvArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	stateMvReturns struct {
+		result1 error
+	}
+	stateMvReturnsOnCall map[int]struct {
+		result1 error
+	}
 	StatePullStub        func(string) ([]byte, error)
 	statePullMutex       sync.RWMutex
 	statePullArgsForCall []struct {
@@ -169,6 +243,62 @@ type FakeClient struct {
 		result1 []byte
 		result2 error
 	}
+	StatePushStub        func(string, string) error
+	statePushMutex       sync.RWMutex
+	statePushArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	statePushReturns struct {
+		result1 error
+	}
+	statePushReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StateRmStub        func(string, string) error
+	stateRmMutex       sync.RWMutex
+	stateRmArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	stateRmReturns struct {
+		result1 error
+	}
+	stateRmReturnsOnCall map[int]struct {
+		result1 error
+	}
+	TaintStub        func(string, string) error
+	taintMutex       sync.RWMutex
+	taintArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	taintReturns struct {
+		result1 error
+	}
+	taintReturnsOnCall map[int]struct {
+		result1 error
+	}
+	TextPlanStub        func() error
+	textPlanMutex       sync.RWMutex
+	textPlanArgsForCall []struct {
+	}
+	textPlanReturns struct {
+		result1 error
+	}
+	textPlanReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ValidateStub        func() error
+	validateMutex       sync.RWMutex
+	validateArgsForCall []struct {
+	}
+	validateReturns struct {
+		result1 error
+	}
+	validateReturnsOnCall map[int]struct {
+		result1 error
+	}
 	VersionStub        func() (string, error)
 	versionMutex       sync.RWMutex
 	versionArgsForCall []struct {
@@ -253,6 +383,58 @@ type FakeClient struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeClient) AppliedChanges() *terraform.AppliedChanges {
+	fake.appliedChangesMutex.Lock()
+	ret, specificReturn := fake.appliedChangesReturnsOnCall[len(fake.appliedChangesArgsForCall)]
+	fake.appliedChangesArgsForCall = append(fake.appliedChangesArgsForCall, struct {
+	}{})
+	fake.recordInvocation("AppliedChanges", []interface{}{})
+	fake.appliedChangesMutex.Unlock()
+	if fake.AppliedChangesStub != nil {
+		return fake.AppliedChangesStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.appliedChangesReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) AppliedChangesCallCount() int {
+	fake.appliedChangesMutex.RLock()
+	defer fake.appliedChangesMutex.RUnlock()
+	return len(fake.appliedChangesArgsForCall)
+}
+
+func (fake *FakeClient) AppliedChangesCalls(stub func() *terraform.AppliedChanges) {
+	fake.appliedChangesMutex.Lock()
+	defer fake.appliedChangesMutex.Unlock()
+	fake.AppliedChangesStub = stub
+}
+
+func (fake *FakeClient) AppliedChangesReturns(result1 *terraform.AppliedChanges) {
+	fake.appliedChangesMutex.Lock()
+	defer fake.appliedChangesMutex.Unlock()
+	fake.AppliedChangesStub = nil
+	fake.appliedChangesReturns = struct {
+		result1 *terraform.AppliedChanges
+	}{result1}
+}
+
+func (fake *FakeClient) AppliedChangesReturnsOnCall(i int, result1 *terraform.AppliedChanges) {
+	fake.appliedChangesMutex.Lock()
+	defer fake.appliedChangesMutex.Unlock()
+	fake.AppliedChangesStub = nil
+	if fake.appliedChangesReturnsOnCall == nil {
+		fake.appliedChangesReturnsOnCall = make(map[int]struct {
+			result1 *terraform.AppliedChanges
+		})
+	}
+	fake.appliedChangesReturnsOnCall[i] = struct {
+		result1 *terraform.AppliedChanges
+	}{result1}
+}
+
 func (fake *FakeClient) Apply() error {
 	fake.applyMutex.Lock()
 	ret, specificReturn := fake.applyReturnsOnCall[len(fake.applyArgsForCall)]
@@ -305,6 +487,58 @@ func (fake *FakeClient) ApplyReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) BackendChange() *terraform.BackendChange {
+	fake.backendChangeMutex.Lock()
+	ret, specificReturn := fake.backendChangeReturnsOnCall[len(fake.backendChangeArgsForCall)]
+	fake.backendChangeArgsForCall = append(fake.backendChangeArgsForCall, struct {
+	}{})
+	fake.recordInvocation("BackendChange", []interface{}{})
+	fake.backendChangeMutex.Unlock()
+	if fake.BackendChangeStub != nil {
+		return fake.BackendChangeStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.backendChangeReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) BackendChangeCallCount() int {
+	fake.backendChangeMutex.RLock()
+	defer fake.backendChangeMutex.RUnlock()
+	return len(fake.backendChangeArgsForCall)
+}
+
+func (fake *FakeClient) BackendChangeCalls(stub func() *terraform.BackendChange) {
+	fake.backendChangeMutex.Lock()
+	defer fake.backendChangeMutex.Unlock()
+	fake.BackendChangeStub = stub
+}
+
+func (fake *FakeClient) BackendChangeReturns(result1 *terraform.BackendChange) {
+	fake.backendChangeMutex.Lock()
+	defer fake.backendChangeMutex.Unlock()
+	fake.BackendChangeStub = nil
+	fake.backendChangeReturns = struct {
+		result1 *terraform.BackendChange
+	}{result1}
+}
+
+func (fake *FakeClient) BackendChangeReturnsOnCall(i int, result1 *terraform.BackendChange) {
+	fake.backendChangeMutex.Lock()
+	defer fake.backendChangeMutex.Unlock()
+	fake.BackendChangeStub = nil
+	if fake.backendChangeReturnsOnCall == nil {
+		fake.backendChangeReturnsOnCall = make(map[int]struct {
+			result1 *terraform.BackendChange
+		})
+	}
+	fake.backendChangeReturnsOnCall[i] = struct {
+		result1 *terraform.BackendChange
+	}{result1}
+}
+
 func (fake *FakeClient) CurrentStateVersion(arg1 string) (terraform.StateVersion, error) {
 	fake.currentStateVersionMutex.Lock()
 	ret, specificReturn := fake.currentStateVersionReturnsOnCall[len(fake.currentStateVersionArgsForCall)]
@@ -368,15 +602,16 @@ func (fake *FakeClient) CurrentStateVersionReturnsOnCall(i int, result1 terrafor
 	}{result1, result2}
 }
 
-func (fake *FakeClient) Destroy() error {
+func (fake *FakeClient) Destroy(arg1 context.Context) error {
 	fake.destroyMutex.Lock()
 	ret, specificReturn := fake.destroyReturnsOnCall[len(fake.destroyArgsForCall)]
 	fake.destroyArgsForCall = append(fake.destroyArgsForCall, struct {
-	}{})
-	fake.recordInvocation("Destroy", []interface{}{})
+		arg1 context.Context
+	}{arg1})
+	fake.recordInvocation("Destroy", []interface{}{arg1})
 	fake.destroyMutex.Unlock()
 	if fake.DestroyStub != nil {
-		return fake.DestroyStub()
+		return fake.DestroyStub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -391,12 +626,19 @@ func (fake *FakeClient) DestroyCallCount() int {
 	return len(fake.destroyArgsForCall)
 }
 
-func (fake *FakeClient) DestroyCalls(stub func() error) {
+func (fake *FakeClient) DestroyCalls(stub func(context.Context) error) {
 	fake.destroyMutex.Lock()
 	defer fake.destroyMutex.Unlock()
 	fake.DestroyStub = stub
 }
 
+func (fake *FakeClient) DestroyArgsForCall(i int) context.Context {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	argsForCall := fake.destroyArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeClient) DestroyReturns(result1 error) {
 	fake.destroyMutex.Lock()
 	defer fake.destroyMutex.Unlock()
@@ -420,6 +662,66 @@ func (fake *FakeClient) DestroyReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) ForceUnlock(arg1 string) error {
+	fake.forceUnlockMutex.Lock()
+	ret, specificReturn := fake.forceUnlockReturnsOnCall[len(fake.forceUnlockArgsForCall)]
+	fake.forceUnlockArgsForCall = append(fake.forceUnlockArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("ForceUnlock", []interface{}{arg1})
+	fake.forceUnlockMutex.Unlock()
+	if fake.ForceUnlockStub != nil {
+		return fake.ForceUnlockStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.forceUnlockReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) ForceUnlockCallCount() int {
+	fake.forceUnlockMutex.RLock()
+	defer fake.forceUnlockMutex.RUnlock()
+	return len(fake.forceUnlockArgsForCall)
+}
+
+func (fake *FakeClient) ForceUnlockCalls(stub func(string) error) {
+	fake.forceUnlockMutex.Lock()
+	defer fake.forceUnlockMutex.Unlock()
+	fake.ForceUnlockStub = stub
+}
+
+func (fake *FakeClient) ForceUnlockArgsForCall(i int) string {
+	fake.forceUnlockMutex.RLock()
+	defer fake.forceUnlockMutex.RUnlock()
+	argsForCall := fake.forceUnlockArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) ForceUnlockReturns(result1 error) {
+	fake.forceUnlockMutex.Lock()
+	defer fake.forceUnlockMutex.Unlock()
+	fake.ForceUnlockStub = nil
+	fake.forceUnlockReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) ForceUnlockReturnsOnCall(i int, result1 error) {
+	fake.forceUnlockMutex.Lock()
+	defer fake.forceUnlockMutex.Unlock()
+	fake.ForceUnlockStub = nil
+	if fake.forceUnlockReturnsOnCall == nil {
+		fake.forceUnlockReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.forceUnlockReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) GetPlanFromBackend(arg1 string) error {
 	fake.getPlanFromBackendMutex.Lock()
 	ret, specificReturn := fake.getPlanFromBackendReturnsOnCall[len(fake.getPlanFromBackendArgsForCall)]
@@ -811,6 +1113,70 @@ func (fake *FakeClient) OutputReturnsOnCall(i int, result1 map[string]map[string
 	}{result1, result2}
 }
 
+func (fake *FakeClient) OutputValue(arg1 string, arg2 string) (interface{}, error) {
+	fake.outputValueMutex.Lock()
+	ret, specificReturn := fake.outputValueReturnsOnCall[len(fake.outputValueArgsForCall)]
+	fake.outputValueArgsForCall = append(fake.outputValueArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("OutputValue", []interface{}{arg1, arg2})
+	fake.outputValueMutex.Unlock()
+	if fake.OutputValueStub != nil {
+		return fake.OutputValueStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.outputValueReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) OutputValueCallCount() int {
+	fake.outputValueMutex.RLock()
+	defer fake.outputValueMutex.RUnlock()
+	return len(fake.outputValueArgsForCall)
+}
+
+func (fake *FakeClient) OutputValueCalls(stub func(string, string) (interface{}, error)) {
+	fake.outputValueMutex.Lock()
+	defer fake.outputValueMutex.Unlock()
+	fake.OutputValueStub = stub
+}
+
+func (fake *FakeClient) OutputValueArgsForCall(i int) (string, string) {
+	fake.outputValueMutex.RLock()
+	defer fake.outputValueMutex.RUnlock()
+	argsForCall := fake.outputValueArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) OutputValueReturns(result1 interface{}, result2 error) {
+	fake.outputValueMutex.Lock()
+	defer fake.outputValueMutex.Unlock()
+	fake.OutputValueStub = nil
+	fake.outputValueReturns = struct {
+		result1 interface{}
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) OutputValueReturnsOnCall(i int, result1 interface{}, result2 error) {
+	fake.outputValueMutex.Lock()
+	defer fake.outputValueMutex.Unlock()
+	fake.OutputValueStub = nil
+	if fake.outputValueReturnsOnCall == nil {
+		fake.outputValueReturnsOnCall = make(map[int]struct {
+			result1 interface{}
+			result2 error
+		})
+	}
+	fake.outputValueReturnsOnCall[i] = struct {
+		result1 interface{}
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeClient) OutputWithLegacyStorage() (map[string]map[string]interface{}, error) {
 	fake.outputWithLegacyStorageMutex.Lock()
 	ret, specificReturn := fake.outputWithLegacyStorageReturnsOnCall[len(fake.outputWithLegacyStorageArgsForCall)]
@@ -866,7 +1232,7 @@ func (fake *FakeClient) OutputWithLegacyStorageReturnsOnCall(i int, result1 map[
 	}{result1, result2}
 }
 
-func (fake *FakeClient) Plan() (string, error) {
+func (fake *FakeClient) Plan() (string, bool, error) {
 	fake.planMutex.Lock()
 	ret, specificReturn := fake.planReturnsOnCall[len(fake.planArgsForCall)]
 	fake.planArgsForCall = append(fake.planArgsForCall, struct {
@@ -877,10 +1243,10 @@ func (fake *FakeClient) Plan() (string, error) {
 		return fake.PlanStub()
 	}
 	if specificReturn {
-		return ret.result1, ret.result2
+		return ret.result1, ret.result2, ret.result3
 	}
 	fakeReturns := fake.planReturns
-	return fakeReturns.result1, fakeReturns.result2
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
 }
 
 func (fake *FakeClient) PlanCallCount() int {
@@ -889,34 +1255,92 @@ func (fake *FakeClient) PlanCallCount() int {
 	return len(fake.planArgsForCall)
 }
 
-func (fake *FakeClient) PlanCalls(stub func() (string, error)) {
+func (fake *FakeClient) PlanCalls(stub func() (string, bool, error)) {
 	fake.planMutex.Lock()
 	defer fake.planMutex.Unlock()
 	fake.PlanStub = stub
 }
 
-func (fake *FakeClient) PlanReturns(result1 string, result2 error) {
+func (fake *FakeClient) PlanReturns(result1 string, result2 bool, result3 error) {
 	fake.planMutex.Lock()
 	defer fake.planMutex.Unlock()
 	fake.PlanStub = nil
 	fake.planReturns = struct {
 		result1 string
-		result2 error
-	}{result1, result2}
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
 }
 
-func (fake *FakeClient) PlanReturnsOnCall(i int, result1 string, result2 error) {
+func (fake *FakeClient) PlanReturnsOnCall(i int, result1 string, result2 bool, result3 error) {
 	fake.planMutex.Lock()
 	defer fake.planMutex.Unlock()
 	fake.PlanStub = nil
 	if fake.planReturnsOnCall == nil {
 		fake.planReturnsOnCall = make(map[int]struct {
 			result1 string
-			result2 error
+			result2 bool
+			result3 error
 		})
 	}
 	fake.planReturnsOnCall[i] = struct {
 		result1 string
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeClient) RefreshOnly() ([]string, error) {
+	fake.refreshOnlyMutex.Lock()
+	ret, specificReturn := fake.refreshOnlyReturnsOnCall[len(fake.refreshOnlyArgsForCall)]
+	fake.refreshOnlyArgsForCall = append(fake.refreshOnlyArgsForCall, struct {
+	}{})
+	fake.recordInvocation("RefreshOnly", []interface{}{})
+	fake.refreshOnlyMutex.Unlock()
+	if fake.RefreshOnlyStub != nil {
+		return fake.RefreshOnlyStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.refreshOnlyReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) RefreshOnlyCallCount() int {
+	fake.refreshOnlyMutex.RLock()
+	defer fake.refreshOnlyMutex.RUnlock()
+	return len(fake.refreshOnlyArgsForCall)
+}
+
+func (fake *FakeClient) RefreshOnlyCalls(stub func() ([]string, error)) {
+	fake.refreshOnlyMutex.Lock()
+	defer fake.refreshOnlyMutex.Unlock()
+	fake.RefreshOnlyStub = stub
+}
+
+func (fake *FakeClient) RefreshOnlyReturns(result1 []string, result2 error) {
+	fake.refreshOnlyMutex.Lock()
+	defer fake.refreshOnlyMutex.Unlock()
+	fake.RefreshOnlyStub = nil
+	fake.refreshOnlyReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) RefreshOnlyReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.refreshOnlyMutex.Lock()
+	defer fake.refreshOnlyMutex.Unlock()
+	fake.RefreshOnlyStub = nil
+	if fake.refreshOnlyReturnsOnCall == nil {
+		fake.refreshOnlyReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.refreshOnlyReturnsOnCall[i] = struct {
+		result1 []string
 		result2 error
 	}{result1, result2}
 }
@@ -1012,6 +1436,68 @@ func (fake *FakeClient) SetModelArgsForCall(i int) models.Terraform {
 	return argsForCall.arg1
 }
 
+func (fake *FakeClient) StateMv(arg1 string, arg2 string, arg3 string) error {
+	fake.stateMvMutex.Lock()
+	ret, specificReturn := fake.stateMvReturnsOnCall[len(fake.stateMvArgsForCall)]
+	fake.stateMvArgsForCall = append(fake.stateMvArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("StateMv", []interface{}{arg1, arg2, arg3})
+	fake.stateMvMutex.Unlock()
+	if fake.StateMvStub != nil {
+		return fake.StateMvStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.stateMvReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) StateMvCallCount() int {
+	fake.stateMvMutex.RLock()
+	defer fake.stateMvMutex.RUnlock()
+	return len(fake.stateMvArgsForCall)
+}
+
+func (fake *FakeClient) StateMvCalls(stub func(string, string, string) error) {
+	fake.stateMvMutex.Lock()
+	defer fake.stateMvMutex.Unlock()
+	fake.StateMvStub = stub
+}
+
+func (fake *FakeClient) StateMvArgsForCall(i int) (string, string, string) {
+	fake.stateMvMutex.RLock()
+	defer fake.stateMvMutex.RUnlock()
+	argsForCall := fake.stateMvArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) StateMvReturns(result1 error) {
+	fake.stateMvMutex.Lock()
+	defer fake.stateMvMutex.Unlock()
+	fake.StateMvStub = nil
+	fake.stateMvReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) StateMvReturnsOnCall(i int, result1 error) {
+	fake.stateMvMutex.Lock()
+	defer fake.stateMvMutex.Unlock()
+	fake.StateMvStub = nil
+	if fake.stateMvReturnsOnCall == nil {
+		fake.stateMvReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.stateMvReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) StatePull(arg1 string) ([]byte, error) {
 	fake.statePullMutex.Lock()
 	ret, specificReturn := fake.statePullReturnsOnCall[len(fake.statePullArgsForCall)]
@@ -1075,6 +1561,293 @@ func (fake *FakeClient) StatePullReturnsOnCall(i int, result1 []byte, result2 er
 	}{result1, result2}
 }
 
+func (fake *FakeClient) StatePush(arg1 string, arg2 string) error {
+	fake.statePushMutex.Lock()
+	ret, specificReturn := fake.statePushReturnsOnCall[len(fake.statePushArgsForCall)]
+	fake.statePushArgsForCall = append(fake.statePushArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("StatePush", []interface{}{arg1, arg2})
+	fake.statePushMutex.Unlock()
+	if fake.StatePushStub != nil {
+		return fake.StatePushStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.statePushReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) StatePushCallCount() int {
+	fake.statePushMutex.RLock()
+	defer fake.statePushMutex.RUnlock()
+	return len(fake.statePushArgsForCall)
+}
+
+func (fake *FakeClient) StatePushCalls(stub func(string, string) error) {
+	fake.statePushMutex.Lock()
+	defer fake.statePushMutex.Unlock()
+	fake.StatePushStub = stub
+}
+
+func (fake *FakeClient) StatePushArgsForCall(i int) (string, string) {
+	fake.statePushMutex.RLock()
+	defer fake.statePushMutex.RUnlock()
+	argsForCall := fake.statePushArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) StatePushReturns(result1 error) {
+	fake.statePushMutex.Lock()
+	defer fake.statePushMutex.Unlock()
+	fake.StatePushStub = nil
+	fake.statePushReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) StatePushReturnsOnCall(i int, result1 error) {
+	fake.statePushMutex.Lock()
+	defer fake.statePushMutex.Unlock()
+	fake.StatePushStub = nil
+	if fake.statePushReturnsOnCall == nil {
+		fake.statePushReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.statePushReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) StateRm(arg1 string, arg2 string) error {
+	fake.stateRmMutex.Lock()
+	ret, specificReturn := fake.stateRmReturnsOnCall[len(fake.stateRmArgsForCall)]
+	fake.stateRmArgsForCall = append(fake.stateRmArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("StateRm", []interface{}{arg1, arg2})
+	fake.stateRmMutex.Unlock()
+	if fake.StateRmStub != nil {
+		return fake.StateRmStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.stateRmReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) StateRmCallCount() int {
+	fake.stateRmMutex.RLock()
+	defer fake.stateRmMutex.RUnlock()
+	return len(fake.stateRmArgsForCall)
+}
+
+func (fake *FakeClient) StateRmCalls(stub func(string, string) error) {
+	fake.stateRmMutex.Lock()
+	defer fake.stateRmMutex.Unlock()
+	fake.StateRmStub = stub
+}
+
+func (fake *FakeClient) StateRmArgsForCall(i int) (string, string) {
+	fake.stateRmMutex.RLock()
+	defer fake.stateRmMutex.RUnlock()
+	argsForCall := fake.stateRmArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) StateRmReturns(result1 error) {
+	fake.stateRmMutex.Lock()
+	defer fake.stateRmMutex.Unlock()
+	fake.StateRmStub = nil
+	fake.stateRmReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) StateRmReturnsOnCall(i int, result1 error) {
+	fake.stateRmMutex.Lock()
+	defer fake.stateRmMutex.Unlock()
+	fake.StateRmStub = nil
+	if fake.stateRmReturnsOnCall == nil {
+		fake.stateRmReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.stateRmReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Taint(arg1 string, arg2 string) error {
+	fake.taintMutex.Lock()
+	ret, specificReturn := fake.taintReturnsOnCall[len(fake.taintArgsForCall)]
+	fake.taintArgsForCall = append(fake.taintArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("Taint", []interface{}{arg1, arg2})
+	fake.taintMutex.Unlock()
+	if fake.TaintStub != nil {
+		return fake.TaintStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.taintReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) TaintCallCount() int {
+	fake.taintMutex.RLock()
+	defer fake.taintMutex.RUnlock()
+	return len(fake.taintArgsForCall)
+}
+
+func (fake *FakeClient) TaintCalls(stub func(string, string) error) {
+	fake.taintMutex.Lock()
+	defer fake.taintMutex.Unlock()
+	fake.TaintStub = stub
+}
+
+func (fake *FakeClient) TaintArgsForCall(i int) (string, string) {
+	fake.taintMutex.RLock()
+	defer fake.taintMutex.RUnlock()
+	argsForCall := fake.taintArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) TaintReturns(result1 error) {
+	fake.taintMutex.Lock()
+	defer fake.taintMutex.Unlock()
+	fake.TaintStub = nil
+	fake.taintReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) TaintReturnsOnCall(i int, result1 error) {
+	fake.taintMutex.Lock()
+	defer fake.taintMutex.Unlock()
+	fake.TaintStub = nil
+	if fake.taintReturnsOnCall == nil {
+		fake.taintReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.taintReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) TextPlan() error {
+	fake.textPlanMutex.Lock()
+	ret, specificReturn := fake.textPlanReturnsOnCall[len(fake.textPlanArgsForCall)]
+	fake.textPlanArgsForCall = append(fake.textPlanArgsForCall, struct {
+	}{})
+	fake.recordInvocation("TextPlan", []interface{}{})
+	fake.textPlanMutex.Unlock()
+	if fake.TextPlanStub != nil {
+		return fake.TextPlanStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.textPlanReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) TextPlanCallCount() int {
+	fake.textPlanMutex.RLock()
+	defer fake.textPlanMutex.RUnlock()
+	return len(fake.textPlanArgsForCall)
+}
+
+func (fake *FakeClient) TextPlanCalls(stub func() error) {
+	fake.textPlanMutex.Lock()
+	defer fake.textPlanMutex.Unlock()
+	fake.TextPlanStub = stub
+}
+
+func (fake *FakeClient) TextPlanReturns(result1 error) {
+	fake.textPlanMutex.Lock()
+	defer fake.textPlanMutex.Unlock()
+	fake.TextPlanStub = nil
+	fake.textPlanReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) TextPlanReturnsOnCall(i int, result1 error) {
+	fake.textPlanMutex.Lock()
+	defer fake.textPlanMutex.Unlock()
+	fake.TextPlanStub = nil
+	if fake.textPlanReturnsOnCall == nil {
+		fake.textPlanReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.textPlanReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Validate() error {
+	fake.validateMutex.Lock()
+	ret, specificReturn := fake.validateReturnsOnCall[len(fake.validateArgsForCall)]
+	fake.validateArgsForCall = append(fake.validateArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Validate", []interface{}{})
+	fake.validateMutex.Unlock()
+	if fake.ValidateStub != nil {
+		return fake.ValidateStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.validateReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) ValidateCallCount() int {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return len(fake.validateArgsForCall)
+}
+
+func (fake *FakeClient) ValidateCalls(stub func() error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = stub
+}
+
+func (fake *FakeClient) ValidateReturns(result1 error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = nil
+	fake.validateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) ValidateReturnsOnCall(i int, result1 error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = nil
+	if fake.validateReturnsOnCall == nil {
+		fake.validateReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.validateReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) Version() (string, error) {
 	fake.versionMutex.Lock()
 	ret, specificReturn := fake.versionReturnsOnCall[len(fake.versionArgsForCall)]
@@ -1489,12 +2262,18 @@ func (fake *FakeClient) WorkspaceSelectReturnsOnCall(i int, result1 error) {
 func (fake *FakeClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.appliedChangesMutex.RLock()
+	defer fake.appliedChangesMutex.RUnlock()
 	fake.applyMutex.RLock()
 	defer fake.applyMutex.RUnlock()
+	fake.backendChangeMutex.RLock()
+	defer fake.backendChangeMutex.RUnlock()
 	fake.currentStateVersionMutex.RLock()
 	defer fake.currentStateVersionMutex.RUnlock()
 	fake.destroyMutex.RLock()
 	defer fake.destroyMutex.RUnlock()
+	fake.forceUnlockMutex.RLock()
+	defer fake.forceUnlockMutex.RUnlock()
 	fake.getPlanFromBackendMutex.RLock()
 	defer fake.getPlanFromBackendMutex.RUnlock()
 	fake.importMutex.RLock()
@@ -1509,16 +2288,32 @@ func (fake *FakeClient) Invocations() map[string][][]interface{} {
 	defer fake.jSONPlanMutex.RUnlock()
 	fake.outputMutex.RLock()
 	defer fake.outputMutex.RUnlock()
+	fake.outputValueMutex.RLock()
+	defer fake.outputValueMutex.RUnlock()
 	fake.outputWithLegacyStorageMutex.RLock()
 	defer fake.outputWithLegacyStorageMutex.RUnlock()
 	fake.planMutex.RLock()
 	defer fake.planMutex.RUnlock()
+	fake.refreshOnlyMutex.RLock()
+	defer fake.refreshOnlyMutex.RUnlock()
 	fake.savePlanToBackendMutex.RLock()
 	defer fake.savePlanToBackendMutex.RUnlock()
 	fake.setModelMutex.RLock()
 	defer fake.setModelMutex.RUnlock()
+	fake.stateMvMutex.RLock()
+	defer fake.stateMvMutex.RUnlock()
 	fake.statePullMutex.RLock()
 	defer fake.statePullMutex.RUnlock()
+	fake.statePushMutex.RLock()
+	defer fake.statePushMutex.RUnlock()
+	fake.stateRmMutex.RLock()
+	defer fake.stateRmMutex.RUnlock()
+	fake.taintMutex.RLock()
+	defer fake.taintMutex.RUnlock()
+	fake.textPlanMutex.RLock()
+	defer fake.textPlanMutex.RUnlock()
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
 	fake.versionMutex.RLock()
 	defer fake.versionMutex.RUnlock()
 	fake.workspaceDeleteMutex.RLock()
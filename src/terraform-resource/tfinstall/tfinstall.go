@@ -0,0 +1,173 @@
+package tfinstall
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// DefaultBaseURL hosts the official terraform releases
+const DefaultBaseURL = "https://releases.hashicorp.com"
+
+// versionRegex matches release versions such as 1.5.7 or 1.6.0-beta1, which
+// are also used in file paths and URLs
+var versionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$`)
+
+// maxBinarySize guards against a malicious archive, terraform is ~100MB
+const maxBinarySize = 1 << 30
+
+// DefaultCacheDir is used when there is no `download_cache_path`
+func DefaultCacheDir() string {
+	return filepath.Join(os.TempDir(), "terraform-resource", "terraform")
+}
+
+// ValidateVersion returns an error unless version is a release version
+func ValidateVersion(version string) error {
+	if !versionRegex.MatchString(version) {
+		return fmt.Errorf("Invalid `terraform_version` '%s', expected a release version such as '1.5.7'", version)
+	}
+	return nil
+}
+
+// Installer downloads terraform releases into CacheDir, laid out as
+// <version>/terraform
+type Installer struct {
+	CacheDir string
+
+	// BaseURL defaults to DefaultBaseURL
+	BaseURL string
+
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Install returns the path to the terraform binary for version, downloading
+// and verifying it against the release checksums unless it is already cached
+func (i Installer) Install(version string) (string, error) {
+	if err := ValidateVersion(version); err != nil {
+		return "", err
+	}
+
+	binaryPath := filepath.Join(i.CacheDir, version, "terraform")
+	if fileInfo, err := os.Stat(binaryPath); err == nil && fileInfo.Mode().IsRegular() {
+		return binaryPath, nil
+	}
+
+	binary, err := i.download(version)
+	if err != nil {
+		return "", fmt.Errorf("Failed to download terraform %s: %s", version, err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(binaryPath), 0755); err != nil {
+		return "", fmt.Errorf("Failed to create terraform cache dir: %s", err)
+	}
+	// renamed into place so a concurrent build never runs a partial binary
+	tmpFile, err := ioutil.TempFile(filepath.Dir(binaryPath), "terraform-*")
+	if err != nil {
+		return "", fmt.Errorf("Failed to write terraform %s: %s", version, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(binary)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), binaryPath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to write terraform %s: %s", version, err)
+	}
+
+	return binaryPath, nil
+}
+
+func (i Installer) download(version string) ([]byte, error) {
+	zipName := fmt.Sprintf("terraform_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH)
+	sums, err := i.get(version, fmt.Sprintf("terraform_%s_SHA256SUMS", version))
+	if err != nil {
+		return nil, err
+	}
+	expectedSum, err := checksumFor(sums, zipName)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := i.get(version, zipName)
+	if err != nil {
+		return nil, err
+	}
+	actualSum := sha256.Sum256(archive)
+	if hex.EncodeToString(actualSum[:]) != expectedSum {
+		return nil, fmt.Errorf("checksum mismatch for %s, expected %s but got %s", zipName, expectedSum, hex.EncodeToString(actualSum[:]))
+	}
+
+	return unzipBinary(archive)
+}
+
+func (i Installer) get(version string, filename string) ([]byte, error) {
+	baseURL := i.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	client := i.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	url := fmt.Sprintf("%s/terraform/%s/%s", strings.TrimSuffix(baseURL, "/"), version, filename)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// checksumFor finds filename in a SHA256SUMS file, whose lines are
+// `<sha256>  <filename>`
+func checksumFor(sums []byte, filename string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == filename {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s, the release may not support this platform", filename)
+}
+
+func unzipBinary(archive []byte) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid release archive: %s", err)
+	}
+	for _, file := range reader.File {
+		if file.Name != "terraform" {
+			continue
+		}
+		contents, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid release archive: %s", err)
+		}
+		defer contents.Close()
+		return ioutil.ReadAll(io.LimitReader(contents, maxBinarySize))
+	}
+	return nil, fmt.Errorf("release archive does not contain a terraform binary")
+}
@@ -0,0 +1,13 @@
+package tfinstall_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTfinstall(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tfinstall Suite")
+}
@@ -0,0 +1,125 @@
+package tfinstall_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+
+	"github.com/ljfranklin/terraform-resource/tfinstall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Installer", func() {
+
+	var (
+		tmpDir    string
+		server    *httptest.Server
+		files     map[string][]byte
+		requests  []string
+		installer tfinstall.Installer
+		zipName   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir(os.TempDir(), "terraform-resource-tfinstall-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		zipName = fmt.Sprintf("terraform_1.5.7_%s_%s.zip", runtime.GOOS, runtime.GOARCH)
+		archive := releaseArchive("#!/bin/sh\necho 'Terraform v1.5.7'\n")
+		sum := sha256.Sum256(archive)
+		files = map[string][]byte{
+			"/terraform/1.5.7/" + zipName: archive,
+			"/terraform/1.5.7/terraform_1.5.7_SHA256SUMS": []byte(fmt.Sprintf(
+				"%s  terraform_1.5.7_other_arch.zip\n%s  %s\n", hex.EncodeToString(make([]byte, 32)), hex.EncodeToString(sum[:]), zipName,
+			)),
+		}
+		requests = []string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			contents, ok := files[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(contents)
+		}))
+
+		installer = tfinstall.Installer{
+			CacheDir: path.Join(tmpDir, "cache"),
+			BaseURL:  server.URL,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		_ = os.RemoveAll(tmpDir)
+	})
+
+	It("downloads, verifies and caches the release binary", func() {
+		binaryPath, err := installer.Install("1.5.7")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(binaryPath).To(Equal(path.Join(tmpDir, "cache", "1.5.7", "terraform")))
+
+		fileInfo, err := os.Stat(binaryPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		contents, err := ioutil.ReadFile(binaryPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(ContainSubstring("Terraform v1.5.7"))
+		Expect(requests).To(HaveLen(2))
+
+		cachedPath, err := installer.Install("1.5.7")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cachedPath).To(Equal(binaryPath))
+		Expect(requests).To(HaveLen(2), "expected cached binary to be reused")
+	})
+
+	It("returns an error when the archive does not match the checksum", func() {
+		files["/terraform/1.5.7/"+zipName] = releaseArchive("tampered")
+
+		_, err := installer.Install("1.5.7")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Failed to download terraform 1.5.7"))
+		Expect(err.Error()).To(ContainSubstring("checksum mismatch"))
+
+		_, statErr := os.Stat(path.Join(tmpDir, "cache", "1.5.7", "terraform"))
+		Expect(os.IsNotExist(statErr)).To(BeTrue())
+	})
+
+	It("returns an error when the release does not exist", func() {
+		_, err := installer.Install("9.9.9")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Failed to download terraform 9.9.9"))
+		Expect(err.Error()).To(ContainSubstring("404"))
+	})
+
+	It("rejects versions which are not releases", func() {
+		for _, version := range []string{"latest", "v1.5.7", "1.5", "../1.5.7"} {
+			_, err := installer.Install(version)
+			Expect(err).To(MatchError(ContainSubstring("Invalid `terraform_version`")), version)
+		}
+		Expect(requests).To(BeEmpty())
+	})
+})
+
+func releaseArchive(binary string) []byte {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	file, err := writer.Create("terraform")
+	Expect(err).ToNot(HaveOccurred())
+	_, err = file.Write([]byte(binary))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+	return buf.Bytes()
+}
@@ -0,0 +1,250 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ljfranklin/terraform-resource/encoder"
+)
+
+const (
+	// a down collector should never delay or fail a build
+	FlushTimeout = 3 * time.Second
+
+	defaultServiceName = "terraform-resource"
+	tracesPath         = "/v1/traces"
+)
+
+type Config struct {
+	Endpoint    string `json:"endpoint"`
+	ServiceName string `json:"service_name,omitempty"` // optional
+}
+
+// Tracer records spans in memory and exports them to an OTLP/HTTP collector
+// on Flush. A nil Tracer, and any nil Span it returns, is a no-op so callers
+// don't need to check whether tracing is enabled.
+type Tracer struct {
+	config Config
+	client *http.Client
+
+	mutex sync.Mutex
+	spans []*Span
+}
+
+type Span struct {
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+func New(config Config) *Tracer {
+	if config.Endpoint == "" {
+		return nil
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = defaultServiceName
+	}
+
+	return &Tracer{
+		config: config,
+		client: &http.Client{
+			Timeout: FlushTimeout,
+		},
+	}
+}
+
+// Start begins a new root span, or a child span if parent is non-nil.
+func (t *Tracer) Start(name string, parent *Span) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer:     t,
+		spanID:     randomHex(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+	if parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = randomHex(16)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = append(t.spans, span)
+
+	return span
+}
+
+// StartChild is shorthand for starting a child span from the same Tracer.
+func (s *Span) StartChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(name, s)
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// End records the finish time of the span and marks it as failed if err is
+// non-nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+}
+
+// Traceparent returns the W3C trace context header value for this span,
+// e.g. to pass to subprocesses via the TRACEPARENT env var.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+// Flush exports all recorded spans. Errors are returned so they can be
+// logged but should never fail the build.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mutex.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := encoder.NewJSONEncoder(&body).Encode(t.exportRequest(spans)); err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(t.config.Endpoint, "/")
+	if !strings.HasSuffix(url, tracesPath) {
+		url += tracesPath
+	}
+	resp, err := t.client.Post(url, "application/json", &body)
+	if err != nil {
+		return fmt.Errorf("Failed to export traces to '%s': %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Failed to export traces to '%s': unexpected status code %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// see https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+func (t *Tracer) exportRequest(spans []*Span) map[string]interface{} {
+	exportedSpans := []map[string]interface{}{}
+	for _, span := range spans {
+		end := span.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+
+		status := map[string]interface{}{
+			"code": 1, // STATUS_CODE_OK
+		}
+		if span.err != nil {
+			status = map[string]interface{}{
+				"code":    2, // STATUS_CODE_ERROR
+				"message": span.err.Error(),
+			}
+		}
+
+		exportedSpan := map[string]interface{}{
+			"traceId":           span.traceID,
+			"spanId":            span.spanID,
+			"name":              span.name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+			"attributes":        exportAttributes(span.attributes),
+			"status":            status,
+		}
+		if span.parentID != "" {
+			exportedSpan["parentSpanId"] = span.parentID
+		}
+		exportedSpans = append(exportedSpans, exportedSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": exportAttributes(map[string]interface{}{
+						"service.name": t.config.ServiceName,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{
+							"name": defaultServiceName,
+						},
+						"spans": exportedSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func exportAttributes(attributes map[string]interface{}) []interface{} {
+	exported := []interface{}{}
+	for key, value := range attributes {
+		var exportedValue map[string]interface{}
+		switch v := value.(type) {
+		case bool:
+			exportedValue = map[string]interface{}{"boolValue": v}
+		case int:
+			exportedValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case float64:
+			exportedValue = map[string]interface{}{"doubleValue": v}
+		default:
+			exportedValue = map[string]interface{}{"stringValue": fmt.Sprintf("%v", v)}
+		}
+		exported = append(exported, map[string]interface{}{
+			"key":   key,
+			"value": exportedValue,
+		})
+	}
+	return exported
+}
+
+func randomHex(numBytes int) string {
+	b := make([]byte, numBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,201 @@
+package tracing_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ljfranklin/terraform-resource/tracing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []attribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []exportedSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type exportedSpan struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId"`
+	Name         string      `json:"name"`
+	Attributes   []attribute `json:"attributes"`
+	Status       struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type attribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+var _ = Describe("Tracing", func() {
+
+	var (
+		server       *httptest.Server
+		requestPaths []string
+		requests     []exportRequest
+		statusCode   int
+	)
+
+	BeforeEach(func() {
+		requestPaths = []string{}
+		requests = []exportRequest{}
+		statusCode = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			req := exportRequest{}
+			Expect(json.Unmarshal(body, &req)).To(Succeed())
+
+			requestPaths = append(requestPaths, r.URL.Path)
+			requests = append(requests, req)
+			w.WriteHeader(statusCode)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("is a no-op when no endpoint is given", func() {
+		tracer := tracing.New(tracing.Config{})
+		Expect(tracer).To(BeNil())
+
+		span := tracer.Start("put", nil)
+		span.SetAttribute("env_name", "staging")
+		span.StartChild("terraform init").End(nil)
+		span.End(nil)
+
+		Expect(span.Traceparent()).To(BeEmpty())
+		Expect(tracer.Flush()).To(Succeed())
+	})
+
+	It("exports the root span and its children to the collector", func() {
+		tracer := tracing.New(tracing.Config{
+			Endpoint:    server.URL,
+			ServiceName: "my-pipeline",
+		})
+
+		root := tracer.Start("put", nil)
+		root.SetAttribute("env_name", "staging")
+
+		plan := root.StartChild("terraform plan")
+		plan.SetAttribute("changes.add", 2)
+		plan.End(nil)
+
+		apply := root.StartChild("terraform apply")
+		apply.End(errors.New("apply failed"))
+
+		root.End(nil)
+
+		Expect(tracer.Flush()).To(Succeed())
+
+		Expect(requestPaths).To(Equal([]string{"/v1/traces"}))
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].ResourceSpans).To(HaveLen(1))
+
+		resource := requests[0].ResourceSpans[0]
+		Expect(resource.Resource.Attributes).To(ConsistOf(attribute{
+			Key:   "service.name",
+			Value: map[string]interface{}{"stringValue": "my-pipeline"},
+		}))
+
+		spans := resource.ScopeSpans[0].Spans
+		Expect(spans).To(HaveLen(3))
+
+		Expect(spans[0].Name).To(Equal("put"))
+		Expect(spans[0].TraceID).To(HaveLen(32))
+		Expect(spans[0].SpanID).To(HaveLen(16))
+		Expect(spans[0].ParentSpanID).To(BeEmpty())
+		Expect(spans[0].Attributes).To(ConsistOf(attribute{
+			Key:   "env_name",
+			Value: map[string]interface{}{"stringValue": "staging"},
+		}))
+		Expect(spans[0].Status.Code).To(Equal(1))
+
+		Expect(spans[1].Name).To(Equal("terraform plan"))
+		Expect(spans[1].TraceID).To(Equal(spans[0].TraceID))
+		Expect(spans[1].ParentSpanID).To(Equal(spans[0].SpanID))
+		Expect(spans[1].Attributes).To(ConsistOf(attribute{
+			Key:   "changes.add",
+			Value: map[string]interface{}{"intValue": "2"},
+		}))
+
+		Expect(spans[2].Name).To(Equal("terraform apply"))
+		Expect(spans[2].ParentSpanID).To(Equal(spans[0].SpanID))
+		Expect(spans[2].Status.Code).To(Equal(2))
+		Expect(spans[2].Status.Message).To(Equal("apply failed"))
+
+		Expect(root.Traceparent()).To(Equal("00-" + spans[0].TraceID + "-" + spans[0].SpanID + "-01"))
+	})
+
+	It("defaults the service name", func() {
+		tracer := tracing.New(tracing.Config{
+			Endpoint: server.URL + "/v1/traces",
+		})
+		tracer.Start("get", nil).End(nil)
+
+		Expect(tracer.Flush()).To(Succeed())
+
+		Expect(requestPaths).To(Equal([]string{"/v1/traces"}))
+		Expect(requests[0].ResourceSpans[0].Resource.Attributes).To(ConsistOf(attribute{
+			Key:   "service.name",
+			Value: map[string]interface{}{"stringValue": "terraform-resource"},
+		}))
+	})
+
+	It("does not export spans twice", func() {
+		tracer := tracing.New(tracing.Config{
+			Endpoint: server.URL,
+		})
+		tracer.Start("get", nil).End(nil)
+
+		Expect(tracer.Flush()).To(Succeed())
+		Expect(tracer.Flush()).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+	})
+
+	It("returns an error if the collector rejects the spans", func() {
+		statusCode = http.StatusInternalServerError
+
+		tracer := tracing.New(tracing.Config{
+			Endpoint: server.URL,
+		})
+		tracer.Start("check", nil).End(nil)
+
+		err := tracer.Flush()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("500"))
+	})
+
+	It("returns an error if the collector is unreachable", func() {
+		server.Close()
+
+		tracer := tracing.New(tracing.Config{
+			Endpoint: server.URL,
+		})
+		tracer.Start("check", nil).End(nil)
+
+		err := tracer.Flush()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Failed to export traces"))
+	})
+})
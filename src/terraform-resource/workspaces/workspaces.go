@@ -1,13 +1,45 @@
 package workspaces
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/ljfranklin/terraform-resource/terraform"
 )
 
 type Workspaces struct {
 	client terraform.Client
+
+	// Prefix restricts the workspaces that are considered to those whose
+	// names begin with it, e.g. to ignore envs owned by other pipelines
+	Prefix string
+
+	// Filter further restricts the workspaces to those it matches, nil
+	// considers all of them
+	Filter *regexp.Regexp
+
+	// Concurrency is how many workspaces StaleEnvs reads at once,
+	// DefaultConcurrency if unset
+	Concurrency int
+
+	// Deadline stops StaleEnvs from starting to read more workspaces once
+	// passed, the zero value means no deadline
+	Deadline time.Time
+
+	// StateModified is how StaleEnvs ages each env, by the tags added by
+	// `tag_state` if nil
+	StateModified terraform.StateModifiedTime
 }
 
+// DefaultConcurrency is used when Concurrency is unset, high enough to speed
+// up backends with hundreds of workspaces without overwhelming the backend
+const DefaultConcurrency = 8
+
 func New(client terraform.Client) *Workspaces {
 	return &Workspaces{
 		client: client,
@@ -31,13 +63,111 @@ func (w Workspaces) LatestVersionForEnv(envName string) (terraform.StateVersion,
 	return w.client.CurrentStateVersion(envName)
 }
 
+// StaleEnv is an env whose statefile was last written longer ago than the limit
+type StaleEnv struct {
+	Name    string
+	AgeDays int
+}
+
+// StaleEnvs returns the envs last applied more than maxAgeDays ago, sorted by
+// name. The age is that of the statefile if StateModified is set, otherwise it
+// is read from the tags added by `tag_state` and envs which were never tagged
+// are skipped. If some envs can't be read, e.g. once the Deadline passes, the
+// stale envs found among the rest are still returned along with an error
+// naming each env which was not read.
+func (w Workspaces) StaleEnvs(maxAgeDays int, now time.Time) ([]StaleEnv, error) {
+	err := w.client.InitWithBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	spaces, err := w.client.WorkspaceList()
+	if err != nil {
+		return nil, err
+	}
+	spaces = FilterByRegex(FilterByPrefix(spaces, w.Prefix), w.Filter)
+	sort.Strings(spaces)
+
+	envs := []string{}
+	for _, space := range spaces {
+		if space == "default" || terraform.IsMarkerWorkspace(space) || terraform.IsPlanWorkspace(space, spaces) {
+			continue
+		}
+		envs = append(envs, space)
+	}
+
+	type ageResult struct {
+		appliedAt time.Time
+		err       error
+	}
+	results := make([]ageResult, len(envs))
+
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if !w.Deadline.IsZero() && time.Now().After(w.Deadline) {
+					results[i].err = errors.New("Timed out before reading the workspace")
+					continue
+				}
+				results[i].appliedAt, results[i].err = w.appliedAt(envs[i])
+			}
+		}()
+	}
+	for i := range envs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	stale := []StaleEnv{}
+	failures := []string{}
+	for i, result := range results {
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to read the last apply time of '%s': %s", envs[i], result.err))
+			continue
+		}
+		if result.appliedAt.IsZero() {
+			continue
+		}
+		ageDays := int(now.Sub(result.appliedAt).Hours() / 24)
+		if ageDays > maxAgeDays {
+			stale = append(stale, StaleEnv{Name: envs[i], AgeDays: ageDays})
+		}
+	}
+	if len(failures) > 0 {
+		return stale, errors.New(strings.Join(failures, "\n"))
+	}
+	return stale, nil
+}
+
+// appliedAt is the zero time if the env has no statefile or, without
+// StateModified, no tags
+func (w Workspaces) appliedAt(envName string) (time.Time, error) {
+	if w.StateModified != nil {
+		return w.StateModified(envName)
+	}
+	tags, found, err := terraform.ReadStateTags(w.client, envName)
+	if err != nil || !found {
+		return time.Time{}, err
+	}
+	return tags.AppliedAt, nil
+}
+
 func (w Workspaces) spaceExists(envName string) (bool, error) {
 	spaces, err := w.client.WorkspaceList()
 	if err != nil {
 		return false, err
 	}
 
-	for _, space := range spaces {
+	for _, space := range FilterByRegex(FilterByPrefix(spaces, w.Prefix), w.Filter) {
 		if space == envName {
 			return true, nil
 		}
@@ -45,3 +175,35 @@ func (w Workspaces) spaceExists(envName string) (bool, error) {
 
 	return false, nil
 }
+
+// FilterByPrefix returns the spaces beginning with prefix. The comparison is
+// case-sensitive as Terraform workspace names are.
+func FilterByPrefix(spaces []string, prefix string) []string {
+	if prefix == "" {
+		return spaces
+	}
+
+	filtered := []string{}
+	for _, space := range spaces {
+		if strings.HasPrefix(space, prefix) {
+			filtered = append(filtered, space)
+		}
+	}
+	return filtered
+}
+
+// FilterByRegex returns the spaces matched by filter, or all of them if
+// filter is nil
+func FilterByRegex(spaces []string, filter *regexp.Regexp) []string {
+	if filter == nil {
+		return spaces
+	}
+
+	filtered := []string{}
+	for _, space := range spaces {
+		if filter.MatchString(space) {
+			filtered = append(filtered, space)
+		}
+	}
+	return filtered
+}
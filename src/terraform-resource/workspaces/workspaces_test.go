@@ -2,6 +2,11 @@ package workspaces_test
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
 	"github.com/ljfranklin/terraform-resource/terraform"
 	"github.com/ljfranklin/terraform-resource/terraform/terraformfakes"
 	"github.com/ljfranklin/terraform-resource/workspaces"
@@ -53,6 +58,61 @@ var _ = Describe("Workspaces", func() {
 			})
 		})
 
+		Context("when a workspace prefix is set", func() {
+			BeforeEach(func() {
+				fakeTerraform = &terraformfakes.FakeClient{}
+				fakeTerraform.WorkspaceListReturns([]string{"team-a-env", "team-b-env"}, nil)
+				fakeTerraform.CurrentStateVersionReturns(terraform.StateVersion{
+					Serial:  7,
+					Lineage: "aaaaa",
+				}, nil)
+			})
+
+			It("returns a Version for an env matching the prefix", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.Prefix = "team-a-"
+
+				version, err := spaces.LatestVersionForEnv("team-a-env")
+				Expect(err).To(BeNil())
+				Expect(version.Serial).To(Equal(7))
+			})
+
+			It("returns an empty Version for an env not matching the prefix", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.Prefix = "team-a-"
+
+				version, err := spaces.LatestVersionForEnv("team-b-env")
+				Expect(err).To(BeNil())
+				Expect(version).To(Equal(terraform.StateVersion{}))
+				Expect(fakeTerraform.CurrentStateVersionCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a workspace filter is set", func() {
+			BeforeEach(func() {
+				fakeTerraform = &terraformfakes.FakeClient{}
+				fakeTerraform.WorkspaceListReturns([]string{"team-a-env", "team-b-env"}, nil)
+				fakeTerraform.CurrentStateVersionReturns(terraform.StateVersion{
+					Serial:  7,
+					Lineage: "aaaaa",
+				}, nil)
+			})
+
+			It("returns an empty Version for an env not matching the filter", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.Filter = regexp.MustCompile(`^team-a-.*$`)
+
+				version, err := spaces.LatestVersionForEnv("team-b-env")
+				Expect(err).To(BeNil())
+				Expect(version).To(Equal(terraform.StateVersion{}))
+				Expect(fakeTerraform.CurrentStateVersionCallCount()).To(Equal(0))
+
+				version, err = spaces.LatestVersionForEnv("team-a-env")
+				Expect(err).To(BeNil())
+				Expect(version.Serial).To(Equal(7))
+			})
+		})
+
 		Context("when initializing fails", func() {
 			BeforeEach(func() {
 				fakeTerraform = &terraformfakes.FakeClient{}
@@ -96,4 +156,213 @@ var _ = Describe("Workspaces", func() {
 			})
 		})
 	})
+
+	Describe("#StaleEnvs", func() {
+		var (
+			fakeTerraform *terraformfakes.FakeClient
+			now           time.Time
+			outputs       map[string]map[string]map[string]interface{}
+		)
+
+		appliedDaysAgo := func(days int) map[string]map[string]interface{} {
+			return map[string]map[string]interface{}{
+				"concourse_applied_at": {"value": now.Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339)},
+			}
+		}
+
+		BeforeEach(func() {
+			now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+			outputs = map[string]map[string]map[string]interface{}{
+				"default":          appliedDaysAgo(100),
+				"fresh-env":        appliedDaysAgo(3),
+				"stale-env":        appliedDaysAgo(45),
+				"stale-env-plan":   appliedDaysAgo(45),
+				"untagged-env":     {},
+				"team-b-stale-env": appliedDaysAgo(60),
+			}
+			fakeTerraform = &terraformfakes.FakeClient{}
+			fakeTerraform.WorkspaceListReturns([]string{"default", "stale-env", "fresh-env", "stale-env-plan", "untagged-env", "team-b-stale-env"}, nil)
+			fakeTerraform.OutputStub = func(envName string) (map[string]map[string]interface{}, error) {
+				return outputs[envName], nil
+			}
+		})
+
+		It("returns the tagged envs last applied more than the given days ago", func() {
+			spaces := workspaces.New(fakeTerraform)
+
+			stale, err := spaces.StaleEnvs(30, now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stale).To(Equal([]workspaces.StaleEnv{
+				{Name: "stale-env", AgeDays: 45},
+				{Name: "team-b-stale-env", AgeDays: 60},
+			}))
+			Expect(fakeTerraform.InitWithBackendCallCount()).To(Equal(1))
+		})
+
+		It("only considers workspaces with the prefix", func() {
+			spaces := workspaces.New(fakeTerraform)
+			spaces.Prefix = "team-b-"
+
+			stale, err := spaces.StaleEnvs(30, now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stale).To(Equal([]workspaces.StaleEnv{{Name: "team-b-stale-env", AgeDays: 60}}))
+		})
+
+		It("only considers workspaces matching the filter", func() {
+			spaces := workspaces.New(fakeTerraform)
+			spaces.Filter = regexp.MustCompile(`^stale-env$`)
+
+			stale, err := spaces.StaleEnvs(30, now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stale).To(Equal([]workspaces.StaleEnv{{Name: "stale-env", AgeDays: 45}}))
+		})
+
+		It("returns the stale envs which could be read along with an error naming the others", func() {
+			outputs["stale-env"] = map[string]map[string]interface{}{
+				"concourse_applied_at": {"value": "last tuesday"},
+			}
+			spaces := workspaces.New(fakeTerraform)
+
+			stale, err := spaces.StaleEnvs(30, now)
+			Expect(err).To(MatchError(ContainSubstring("Failed to read the last apply time of 'stale-env'")))
+			Expect(stale).To(Equal([]workspaces.StaleEnv{{Name: "team-b-stale-env", AgeDays: 60}}))
+		})
+
+		Context("when StateModified is set", func() {
+			It("ages every env by its statefile, tagged or not", func() {
+				modified := map[string]time.Time{
+					"fresh-env":        now.Add(-3 * 24 * time.Hour),
+					"stale-env":        now.Add(-45 * 24 * time.Hour),
+					"untagged-env":     now.Add(-90 * 24 * time.Hour),
+					"team-b-stale-env": now.Add(-10 * 24 * time.Hour),
+				}
+				spaces := workspaces.New(fakeTerraform)
+				spaces.StateModified = func(envName string) (time.Time, error) {
+					return modified[envName], nil
+				}
+
+				stale, err := spaces.StaleEnvs(30, now)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stale).To(Equal([]workspaces.StaleEnv{
+					{Name: "stale-env", AgeDays: 45},
+					{Name: "untagged-env", AgeDays: 90},
+				}))
+				Expect(fakeTerraform.OutputCallCount()).To(Equal(0))
+			})
+
+			It("skips envs without a statefile and names those which can't be read", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.StateModified = func(envName string) (time.Time, error) {
+					if envName == "stale-env" {
+						return time.Time{}, errors.New("HeadObject request failed")
+					}
+					return time.Time{}, nil
+				}
+
+				stale, err := spaces.StaleEnvs(30, now)
+				Expect(err).To(MatchError(ContainSubstring("Failed to read the last apply time of 'stale-env': HeadObject request failed")))
+				Expect(stale).To(BeEmpty())
+			})
+		})
+
+		Context("with many workspaces", func() {
+			var (
+				envNames []string
+				inFlight int32
+				maxSeen  int32
+			)
+
+			BeforeEach(func() {
+				envNames = []string{}
+				for i := 0; i < 300; i++ {
+					envNames = append(envNames, fmt.Sprintf("env-%03d", i))
+				}
+				inFlight = 0
+				maxSeen = 0
+				fakeTerraform.WorkspaceListReturns(envNames, nil)
+				fakeTerraform.OutputStub = func(envName string) (map[string]map[string]interface{}, error) {
+					current := atomic.AddInt32(&inFlight, 1)
+					defer atomic.AddInt32(&inFlight, -1)
+					for {
+						seen := atomic.LoadInt32(&maxSeen)
+						if current <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, current) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					return appliedDaysAgo(45), nil
+				}
+			})
+
+			It("reads DefaultConcurrency workspaces at once", func() {
+				spaces := workspaces.New(fakeTerraform)
+
+				start := time.Now()
+				stale, err := spaces.StaleEnvs(30, now)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stale).To(HaveLen(300))
+				Expect(stale[0].Name).To(Equal("env-000"))
+				Expect(stale[299].Name).To(Equal("env-299"))
+				Expect(maxSeen).To(BeNumerically("<=", workspaces.DefaultConcurrency))
+				Expect(maxSeen).To(BeNumerically(">", 1))
+				// reading serially would take at least 300 * 5ms
+				Expect(time.Since(start)).To(BeNumerically("<", 1500*time.Millisecond))
+			})
+
+			It("reads at most Concurrency workspaces at once", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.Concurrency = 2
+
+				_, err := spaces.StaleEnvs(30, now)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(maxSeen).To(BeNumerically("<=", 2))
+			})
+
+			It("stops reading workspaces once the Deadline has passed", func() {
+				spaces := workspaces.New(fakeTerraform)
+				spaces.Deadline = time.Now().Add(-time.Second)
+
+				stale, err := spaces.StaleEnvs(30, now)
+				Expect(err).To(MatchError(ContainSubstring("Failed to read the last apply time of 'env-000': Timed out before reading the workspace")))
+				Expect(stale).To(BeEmpty())
+				Expect(fakeTerraform.OutputCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("FilterByPrefix", func() {
+		spaces := []string{"team-a-env", "team-a", "Team-a-other", "team-b-env"}
+
+		It("does not filter when the prefix is empty", func() {
+			Expect(workspaces.FilterByPrefix(spaces, "")).To(Equal(spaces))
+		})
+
+		It("keeps a workspace exactly matching the prefix", func() {
+			Expect(workspaces.FilterByPrefix(spaces, "team-a")).To(Equal([]string{"team-a-env", "team-a"}))
+		})
+
+		It("keeps workspaces partially matching the prefix, case-sensitively", func() {
+			Expect(workspaces.FilterByPrefix(spaces, "team-a-")).To(Equal([]string{"team-a-env"}))
+		})
+
+		It("returns no workspaces when none match", func() {
+			Expect(workspaces.FilterByPrefix(spaces, "team-c-")).To(BeEmpty())
+		})
+	})
+
+	Describe("FilterByRegex", func() {
+		spaces := []string{"team-a-env", "team-a", "team-b-env"}
+
+		It("does not filter when the filter is nil", func() {
+			Expect(workspaces.FilterByRegex(spaces, nil)).To(Equal(spaces))
+		})
+
+		It("keeps the workspaces matching the filter", func() {
+			Expect(workspaces.FilterByRegex(spaces, regexp.MustCompile(`^team-.-env$`))).To(Equal([]string{"team-a-env", "team-b-env"}))
+		})
+
+		It("returns no workspaces when none match", func() {
+			Expect(workspaces.FilterByRegex(spaces, regexp.MustCompile(`^team-c$`))).To(BeEmpty())
+		})
+	})
 })